@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"context"
+
 	"github.com/asjdf/gorm-cache/config"
 	"github.com/asjdf/gorm-cache/util"
 	"gorm.io/gorm"
@@ -12,34 +14,150 @@ func AfterCreate(cache *Gorm2Cache) func(db *gorm.DB) {
 			return // no rows affected, no need to invalidate cache
 		}
 
-		tableName := ""
-		if db.Statement.Schema != nil {
-			tableName = db.Statement.Schema.Table
-		} else {
-			tableName = db.Statement.Table
+		tableName := cache.getTableName(db)
+		ctx := cache.logCtx(db, tableName)
+
+		if db.Error == nil {
+			markTableWritten(ctx, tableName)
+			cache.invalidateDependentsOfUncached(ctx, "AfterCreate", tableName)
+		}
+
+		if db.Error == nil && util.ShouldCache(tableName, cache.Config.Tables) &&
+			(cache.Config.CacheLevel == config.CacheLevelAll || cache.Config.CacheLevel == config.CacheLevelOnlySearch) {
+			// not-found results of created keys are outdated even if InvalidateWhenUpdate is off
+			err := cache.invalidateNegativesOfCreated(ctx, db, tableName)
+			if err != nil {
+				cache.Logger.CtxError(ctx, "[AfterCreate] invalidating not-found results for table %s error: %v",
+					tableName, err)
+			}
+		}
+
+		if db.Error == nil && util.ShouldCache(tableName, cache.Config.Tables) && cache.primaryCacheEnabled() &&
+			!cache.Config.DisableCachePenetrationProtect {
+			// keys of created rows may be cached as not found
+			err := cache.invalidatePrimaryNegativesOfCreated(ctx, db, tableName)
+			if err != nil {
+				cache.Logger.CtxError(ctx, "[AfterCreate] invalidating primary cache of created rows for table %s error: %v",
+					tableName, err)
+			}
 		}
-		ctx := db.Statement.Context
 
 		if db.Error == nil && cache.Config.InvalidateWhenUpdate && util.ShouldCache(tableName, cache.Config.Tables) {
+			upsert := isUpsert(db)
+			primaryKeys, objects := getObjectsAfterLoad(db)
+			if len(primaryKeys) == len(objects) {
+				cache.markDirty(ctx, tableName, primaryKeys)
+			} else {
+				cache.markDirty(ctx, tableName, nil)
+			}
+
+			if upsert &&
+				(cache.Config.CacheLevel == config.CacheLevelAll || cache.Config.CacheLevel == config.CacheLevelOnlyPrimary) {
+				// rows updated by upsert may be in primary cache, keys of them may be missing if database doesn't return
+				var err error
+				if len(primaryKeys) == len(objects) {
+					cache.Logger.CtxInfo(ctx, "[AfterCreate] upsert, now start to invalidate cache for primary keys: %+v",
+						cache.redact(primaryKeys))
+					err = cache.BatchInvalidatePrimaryCache(ctx, getStatementTableName(db), primaryKeys)
+				} else {
+					cache.Logger.CtxInfo(ctx, "[AfterCreate] upsert, now start to invalidate all primary cache for table: %s",
+						tableName)
+					err = cache.InvalidateAllPrimaryCache(ctx, getStatementTableName(db))
+				}
+				if err != nil {
+					cache.Logger.CtxError(ctx, "[AfterCreate] invalidating primary cache for table %s error: %v",
+						tableName, err)
+				}
+			}
+
 			if cache.Config.CacheLevel == config.CacheLevelAll || cache.Config.CacheLevel == config.CacheLevelOnlySearch {
 				invalidSearchCache := func() {
 					// We invalidate search cache here,
 					// because any newly created objects may cause search cache results to be outdated and invalid.
 					cache.Logger.CtxInfo(ctx, "[AfterCreate] now start to invalidate search cache for table: %s", tableName)
-					err := cache.InvalidateSearchCache(ctx, tableName)
+					if upsert {
+						// rows updated by upsert may be in any page
+						err := cache.InvalidateSearchCache(ctx, tableName)
+						if err != nil {
+							cache.Logger.CtxError(ctx, "[AfterCreate] invalidating search cache for table %s error: %v",
+								tableName, err)
+							return
+						}
+						cache.Logger.CtxInfo(ctx, "[AfterCreate] invalidating search cache for table: %s finished.", tableName)
+						return
+					}
+					err := cache.invalidateSearchCacheExceptPages(ctx, tableName)
 					if err != nil {
 						cache.Logger.CtxError(ctx, "[AfterCreate] invalidating search cache for table %s error: %v",
 							tableName, err)
 						return
 					}
+					err = cache.invalidatePagesOfKeys(ctx, tableName, primaryKeys)
+					if err != nil {
+						cache.Logger.CtxError(ctx, "[AfterCreate] invalidating pages for table %s error: %v",
+							tableName, err)
+						return
+					}
 					cache.Logger.CtxInfo(ctx, "[AfterCreate] invalidating search cache for table: %s finished.", tableName)
 				}
-				if cache.Config.AsyncWrite {
-					go invalidSearchCache()
+				if cache.Config.AsyncInvalidate {
+					cache.goAsync(invalidSearchCache)
 				} else {
 					invalidSearchCache()
 				}
 			}
 		}
+
+		if db.Error == nil && cache.Config.PopulatePrimaryOnCreate && util.ShouldCache(tableName, cache.Config.Tables) &&
+			cache.primaryCacheEnabled() {
+			populate := cache.primaryPopulatorOfCreated(ctx, db, tableName)
+			if populate == nil {
+				return
+			}
+			if cache.Config.AsyncCachePopulate {
+				cache.goAsync(func() {
+					defer cache.recoverPanic(ctx, "AfterCreate")
+					populate()
+				})
+			} else {
+				populate()
+			}
+		}
+	}
+}
+
+// primaryPopulatorOfCreated returns the function setting created rows in dest of db in primary cache, nil if they
+// can't be cached. It takes all it needs from db at once, as db is changed after create.
+func (c *Gorm2Cache) primaryPopulatorOfCreated(ctx context.Context, db *gorm.DB, tableName string) func() {
+	if isUpsert(db) || len(db.Statement.Selects) > 0 || len(db.Statement.Omits) > 0 || c.isSchemaless(db) {
+		// rows in dest may differ from the ones in database
+		return nil
+	}
+	seq := c.seqs.load(tableName)
+	primaryKeys, objects := getObjectsAfterLoad(db)
+	if len(objects) == 0 || len(primaryKeys) != len(objects) {
+		c.Logger.CtxInfo(ctx, "[AfterCreate] primary keys of created rows are unknown, primary cache not set")
+		return nil
+	}
+	pinned := c.isPinned(db, tableName)
+	primaryTable := getStatementTableName(db)
+	return func() {
+		kvs := make([]util.Kv, 0, len(objects))
+		for i, object := range objects {
+			jsonStr, err := c.jsonCodec().Marshal(object)
+			if err != nil {
+				c.Logger.CtxError(ctx, "[AfterCreate] object %v cannot marshal, not cached", c.redact(object))
+				continue
+			}
+			kvs = append(kvs, util.Kv{Key: primaryKeys[i], Value: string(jsonStr), Pinned: pinned})
+		}
+		populated, err := c.populateSince(ctx, tableName, seq, c.primaryCacheSetter(primaryTable, kvs), func(ctx context.Context) {})
+		if err != nil {
+			c.Logger.CtxError(ctx, "[AfterCreate] set primary cache of created rows %v error: %v", c.redact(primaryKeys), err)
+			return
+		}
+		if populated {
+			c.Logger.CtxInfo(ctx, "[AfterCreate] primary cache set for %d created rows of table %s", len(kvs), tableName)
+		}
 	}
 }
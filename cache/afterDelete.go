@@ -14,36 +14,40 @@ func AfterDelete(cache *Gorm2Cache) func(db *gorm.DB) {
 			return // no rows affected, no need to invalidate cache
 		}
 
-		tableName := ""
-		if db.Statement.Schema != nil {
-			tableName = db.Statement.Schema.Table
-		} else {
-			tableName = db.Statement.Table
+		tableName := cache.getTableName(db)
+		ctx := cache.logCtx(db, tableName)
+
+		if db.Error == nil {
+			markTableWritten(ctx, tableName)
+			cache.invalidateDependentsOfUncached(ctx, "AfterDelete", tableName)
 		}
-		ctx := db.Statement.Context
 
 		if db.Error == nil && cache.Config.InvalidateWhenUpdate && util.ShouldCache(tableName, cache.Config.Tables) {
+			cache.markDirty(ctx, tableName, getPrimaryKeysFromWhereClause(db))
+
 			var wg sync.WaitGroup
 			wg.Add(2)
 
-			go func() {
+			cache.goAsync(func() {
 				defer wg.Done()
+				defer cache.recoverPanic(ctx, "AfterDelete")
 
 				if cache.Config.CacheLevel == config.CacheLevelAll || cache.Config.CacheLevel == config.CacheLevelOnlyPrimary {
 					primaryKeys := getPrimaryKeysFromWhereClause(db)
 					if len(primaryKeys) > 0 {
 						cache.Logger.CtxInfo(ctx, "[AfterDelete] now start to invalidate cache for primary keys: %v",
-							primaryKeys)
-						err := cache.BatchInvalidatePrimaryCache(ctx, tableName, primaryKeys)
+							cache.redact(primaryKeys))
+						err := cache.BatchInvalidatePrimaryCache(ctx, getStatementTableName(db), primaryKeys)
 						if err != nil {
 							cache.Logger.CtxError(ctx, "[AfterDelete] invalidating cache for primary keys: %v error: %v",
-								primaryKeys, err)
+								cache.redact(primaryKeys), err)
 							return
 						}
-						cache.Logger.CtxInfo(ctx, "[AfterDelete] invalidating cache for primary keys: %v finished.", primaryKeys)
+						cache.Logger.CtxInfo(ctx, "[AfterDelete] invalidating cache for primary keys: %v finished.",
+							cache.redact(primaryKeys))
 					} else {
 						cache.Logger.CtxInfo(ctx, "[AfterDelete] now start to invalidate all primary cache for table: %s", tableName)
-						err := cache.InvalidateAllPrimaryCache(ctx, tableName)
+						err := cache.InvalidateAllPrimaryCache(ctx, getStatementTableName(db))
 						if err != nil {
 							cache.Logger.CtxError(ctx, "[AfterDelete] invalidating primary cache for table %s error: %v",
 								tableName, err)
@@ -53,24 +57,31 @@ func AfterDelete(cache *Gorm2Cache) func(db *gorm.DB) {
 					}
 
 				}
-			}()
+			})
 
-			go func() {
+			cache.goAsync(func() {
 				defer wg.Done()
+				defer cache.recoverPanic(ctx, "AfterDelete")
 
 				if cache.Config.CacheLevel == config.CacheLevelAll || cache.Config.CacheLevel == config.CacheLevelOnlySearch {
 					cache.Logger.CtxInfo(ctx, "[AfterDelete] now start to invalidate search cache for table: %s", tableName)
-					err := cache.InvalidateSearchCache(ctx, tableName)
+					err := cache.invalidateSearchCacheExceptPages(ctx, tableName)
 					if err != nil {
 						cache.Logger.CtxError(ctx, "[AfterDelete] invalidating search cache for table %s error: %v",
 							tableName, err)
 						return
 					}
+					err = cache.invalidatePagesOfKeys(ctx, tableName, getPrimaryKeysFromWhereClause(db))
+					if err != nil {
+						cache.Logger.CtxError(ctx, "[AfterDelete] invalidating pages for table %s error: %v",
+							tableName, err)
+						return
+					}
 					cache.Logger.CtxInfo(ctx, "[AfterDelete] invalidating search cache for table: %s finished.", tableName)
 				}
-			}()
+			})
 
-			if !cache.Config.AsyncWrite {
+			if !cache.Config.AsyncInvalidate {
 				wg.Wait()
 			}
 		}
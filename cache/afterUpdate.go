@@ -14,38 +14,49 @@ func AfterUpdate(cache *Gorm2Cache) func(db *gorm.DB) {
 			return // no rows affected, no need to invalidate cache
 		}
 
-		tableName := ""
-		if db.Statement.Schema != nil {
-			tableName = db.Statement.Schema.Table
-		} else {
-			tableName = db.Statement.Table
+		tableName := cache.getTableName(db)
+		ctx := cache.logCtx(db, tableName)
+
+		if db.Error == nil && !cache.touchesRelevantColumns(db, tableName) {
+			markTableWritten(ctx, tableName)
+			cache.Logger.CtxInfo(ctx, "[AfterUpdate] update of table %s assigns no cache relevant columns, skip invalidation",
+				tableName)
+			return
+		}
+
+		if db.Error == nil {
+			markTableWritten(ctx, tableName)
+			cache.invalidateDependentsOfUncached(ctx, "AfterUpdate", tableName)
 		}
-		ctx := db.Statement.Context
 
 		if db.Error == nil && cache.Config.InvalidateWhenUpdate && util.ShouldCache(tableName, cache.Config.Tables) {
+			cache.markDirty(ctx, tableName, getPrimaryKeysFromWhereClause(db))
+
 			var wg sync.WaitGroup
 			wg.Add(2)
 
-			go func() {
+			cache.goAsync(func() {
 				defer wg.Done()
+				defer cache.recoverPanic(ctx, "AfterUpdate")
 
 				if cache.Config.CacheLevel == config.CacheLevelAll || cache.Config.CacheLevel == config.CacheLevelOnlyPrimary {
 					primaryKeys := getPrimaryKeysFromWhereClause(db)
-					cache.Logger.CtxInfo(ctx, "[AfterUpdate] parse primary keys = %v", primaryKeys)
+					cache.Logger.CtxInfo(ctx, "[AfterUpdate] parse primary keys = %v", cache.redact(primaryKeys))
 
 					if len(primaryKeys) > 0 {
 						cache.Logger.CtxInfo(ctx, "[AfterUpdate] now start to invalidate cache for primary keys: %+v",
-							primaryKeys)
-						err := cache.BatchInvalidatePrimaryCache(ctx, tableName, primaryKeys)
+							cache.redact(primaryKeys))
+						err := cache.BatchInvalidatePrimaryCache(ctx, getStatementTableName(db), primaryKeys)
 						if err != nil {
 							cache.Logger.CtxError(ctx, "[AfterUpdate] invalidating primary cache for key %v error: %v",
-								primaryKeys, err)
+								cache.redact(primaryKeys), err)
 							return
 						}
-						cache.Logger.CtxInfo(ctx, "[AfterUpdate] invalidating cache for primary keys: %+v finished.", primaryKeys)
+						cache.Logger.CtxInfo(ctx, "[AfterUpdate] invalidating cache for primary keys: %+v finished.",
+							cache.redact(primaryKeys))
 					} else {
 						cache.Logger.CtxInfo(ctx, "[AfterUpdate] now start to invalidate all primary cache for table: %s", tableName)
-						err := cache.InvalidateAllPrimaryCache(ctx, tableName)
+						err := cache.InvalidateAllPrimaryCache(ctx, getStatementTableName(db))
 						if err != nil {
 							cache.Logger.CtxError(ctx, "[AfterUpdate] invalidating primary cache for table %s error: %v",
 								tableName, err)
@@ -54,10 +65,11 @@ func AfterUpdate(cache *Gorm2Cache) func(db *gorm.DB) {
 						cache.Logger.CtxInfo(ctx, "[AfterUpdate] invalidating all primary cache for table: %s finished.", tableName)
 					}
 				}
-			}()
+			})
 
-			go func() {
+			cache.goAsync(func() {
 				defer wg.Done()
+				defer cache.recoverPanic(ctx, "AfterUpdate")
 
 				if cache.Config.CacheLevel == config.CacheLevelAll || cache.Config.CacheLevel == config.CacheLevelOnlySearch {
 					cache.Logger.CtxInfo(ctx, "[AfterUpdate] now start to invalidate search cache for table: %s", tableName)
@@ -69,9 +81,9 @@ func AfterUpdate(cache *Gorm2Cache) func(db *gorm.DB) {
 					}
 					cache.Logger.CtxInfo(ctx, "[AfterUpdate] invalidating search cache for table: %s finished.", tableName)
 				}
-			}()
+			})
 
-			if !cache.Config.AsyncWrite {
+			if !cache.Config.AsyncInvalidate {
 				wg.Wait()
 			}
 		}
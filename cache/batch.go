@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"gorm.io/gorm"
+)
+
+type primaryBatchKey struct{}
+
+// primaryBatch collects primary cache of a query and the queries preloading its associations,
+// so that they are written to storage together once the query is done
+type primaryBatch struct {
+	mu     sync.Mutex
+	closed bool
+	items  []primaryBatchItem
+}
+
+type primaryBatchItem struct {
+	table        string
+	primaryTable string // table name used by the query, which primary cache keys are generated with
+	seq          int64  // invalidation sequence of table when the query started
+	kvs          []util.Kv
+}
+
+// add adds kvs to the batch, it reports false if the batch has been flushed
+func (b *primaryBatch) add(item primaryBatchItem) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return false
+	}
+	b.items = append(b.items, item)
+	return true
+}
+
+func (b *primaryBatch) close() []primaryBatchItem {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return b.items
+}
+
+// BatchSetPrimaryKeyCaches sets primary cache of several tables, kvs is keyed by table name and the keys of kvs
+// are primary keys. Tables kept in the same storage are set with one round trip.
+func (c *Gorm2Cache) BatchSetPrimaryKeyCaches(ctx context.Context, kvs map[string][]util.Kv) error {
+	grouped := make(map[storage.DataStorage][]util.Kv)
+	for tableName, tableKvs := range kvs {
+		s := c.routeStorage(c.resolveTableName(tableName))
+		for _, kv := range tableKvs {
+			kv.Key = c.genPrimaryCacheKey(tableName, kv.Key)
+			grouped[s] = append(grouped[s], kv)
+		}
+	}
+	for s, storageKvs := range grouped {
+		err := c.wrapStorage(s).BatchSetKeys(ctx, storageKvs)
+		if err != nil {
+			return err
+		}
+	}
+	for tableName, tableKvs := range kvs {
+		c.recordWrite(c.genTablePrimaryCachePrefix(c.resolveTableName(tableName)), tableKvs...)
+	}
+	return nil
+}
+
+// BatchInvalidatePrimaryCaches invalidates primary cache of several tables, primaryKeys is keyed by table name.
+// Tables kept in the same storage are invalidated with one round trip.
+func (c *Gorm2Cache) BatchInvalidatePrimaryCaches(ctx context.Context, primaryKeys map[string][]string) error {
+	cacheKeys := make(map[string][]string, len(primaryKeys))
+	for tableName, keys := range primaryKeys {
+		table := c.resolveTableName(tableName)
+		c.markInvalidated(table)
+		for _, primaryKey := range keys {
+			cacheKeys[table] = append(cacheKeys[table], c.genPrimaryCacheKey(tableName, primaryKey))
+		}
+	}
+	err := c.batchDeleteKeys(ctx, cacheKeys)
+	if err != nil {
+		return err
+	}
+	for tableName, keys := range primaryKeys {
+		c.notifyInvalidate(ctx, tableName, keys)
+	}
+	return nil
+}
+
+// batchDeleteKeys deletes cache keys of several tables, keyed by table name, with one round trip per storage
+func (c *Gorm2Cache) batchDeleteKeys(ctx context.Context, cacheKeys map[string][]string) error {
+	grouped := make(map[storage.DataStorage][]string)
+	for tableName, keys := range cacheKeys {
+		s := c.routeStorage(tableName)
+		grouped[s] = append(grouped[s], keys...)
+	}
+	for s, keys := range grouped {
+		err := c.wrapStorage(s).BatchDeleteKeys(ctx, keys)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startPrimaryBatch makes primary cache of db's query and the queries preloading its associations
+// written in one batch after query
+func (c *Gorm2Cache) startPrimaryBatch(db *gorm.DB) {
+	if len(db.Statement.Preloads) == 0 || !c.primaryCacheEnabled() {
+		return
+	}
+	if _, ok := db.Statement.Context.Value(primaryBatchKey{}).(*primaryBatch); ok {
+		// preloads of a preload are collected by the outermost query
+		return
+	}
+	batch := &primaryBatch{}
+	db.InstanceSet(c.stmtKey("primary_batch"), batch)
+	// the original context is restored after query
+	if _, ok := db.InstanceGet(c.stmtKey("ctx")); !ok {
+		db.InstanceSet(c.stmtKey("ctx"), db.Statement.Context)
+	}
+	db.Statement.Context = context.WithValue(db.Statement.Context, primaryBatchKey{}, batch)
+}
+
+// primaryBatchOf returns the batch of the query db belongs to, nil if there's no such batch
+func primaryBatchOf(db *gorm.DB) *primaryBatch {
+	batch, _ := db.Statement.Context.Value(primaryBatchKey{}).(*primaryBatch)
+	return batch
+}
+
+// deferPrimaryCache adds item to batch, it reports false if there's no batch, the query of item didn't go
+// through BeforeQuery or the batch has been flushed, in which case the caller sets the cache itself
+func deferPrimaryCache(batch *primaryBatch, item primaryBatchItem) bool {
+	if batch == nil || item.seq < 0 {
+		return false
+	}
+	return batch.add(item)
+}
+
+// flushPrimaryBatch writes primary cache collected in the batch of db's query. Like populateCache, cache of
+// tables invalidated since their queries started is dropped, and deleted again if invalidated while writing.
+func (c *Gorm2Cache) flushPrimaryBatch(db *gorm.DB) {
+	obj, ok := db.InstanceGet(c.stmtKey("primary_batch"))
+	if !ok {
+		return
+	}
+	items := obj.(*primaryBatch).close()
+	if len(items) == 0 {
+		return
+	}
+	ctx := db.Statement.Context
+	exp := c.explanationOf(db)
+	flush := func() {
+		defer c.recoverPanic(ctx, "flushPrimaryBatch")
+		kvs := make(map[string][]util.Kv)
+		valid := make([]primaryBatchItem, 0, len(items))
+		// keys are generated before writing, as invalidation may change the key prefix of table
+		keys := make([][]string, 0, len(items))
+		for _, item := range items {
+			if c.seqs.load(item.table) != item.seq {
+				c.Logger.CtxInfo(ctx, "[flushPrimaryBatch] table %s invalidated during query, primary cache not set",
+					item.table)
+				exp.add("table %s invalidated during query, primary cache not set", item.table)
+				continue
+			}
+			kvs[item.primaryTable] = append(kvs[item.primaryTable], item.kvs...)
+			valid = append(valid, item)
+			itemKeys := make([]string, 0, len(item.kvs))
+			for _, kv := range item.kvs {
+				itemKeys = append(itemKeys, c.genPrimaryCacheKey(item.primaryTable, kv.Key))
+			}
+			keys = append(keys, itemKeys)
+		}
+		if len(valid) == 0 {
+			return
+		}
+		err := c.BatchSetPrimaryKeyCaches(ctx, kvs)
+		if err != nil {
+			c.Logger.CtxError(ctx, "[flushPrimaryBatch] batch set primary cache of %d tables error: %v", len(kvs), err)
+			exp.add("set primary cache in batch error: %v", err)
+			for _, item := range valid {
+				c.retryPopulate(item.table, item.seq, c.primaryCacheSetter(item.primaryTable, item.kvs),
+					func(ctx context.Context) {})
+			}
+			return
+		}
+		stale := make(map[string][]string)
+		cnt := 0
+		for i, item := range valid {
+			if c.seqs.load(item.table) != item.seq {
+				stale[item.table] = append(stale[item.table], keys[i]...)
+				continue
+			}
+			cnt += len(item.kvs)
+		}
+		if len(stale) > 0 {
+			c.Logger.CtxInfo(ctx, "[flushPrimaryBatch] tables invalidated while populating, delete keys %v",
+				c.redact(stale))
+			err = c.batchDeleteKeys(ctx, stale)
+			if err != nil {
+				c.Logger.CtxError(ctx, "[flushPrimaryBatch] delete keys of invalidated tables error: %v", err)
+			}
+		}
+		exp.add("primary cache of %d tables set in batch for %d objects", len(kvs)-len(stale), cnt)
+	}
+	if c.Config.AsyncCachePopulate {
+		c.goAsync(flush)
+		return
+	}
+	flush()
+}
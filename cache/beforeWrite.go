@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/util"
+	"gorm.io/gorm"
+)
+
+// BeforeWrite invalidates cache of tables in InvalidateBeforeWriteTables before the write is executed.
+// Together with the invalidation after the write, it makes a double delete around the write.
+// funcName is the name used in logs, primary cache is invalidated only if invalidatePrimary is true
+// (newly created objects are never in primary cache).
+func BeforeWrite(cache *Gorm2Cache, funcName string, invalidatePrimary bool) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil || !cache.Config.InvalidateWhenUpdate || len(cache.Config.InvalidateBeforeWriteTables) == 0 {
+			return
+		}
+
+		tableName := cache.getTableName(db)
+		ctx := cache.logCtx(db, tableName)
+
+		if !util.ContainString(tableName, cache.Config.InvalidateBeforeWriteTables) ||
+			!util.ShouldCache(tableName, cache.Config.Tables) {
+			return
+		}
+
+		if invalidatePrimary {
+			cache.markDirty(ctx, tableName, getPrimaryKeysOfWrite(db))
+		} else {
+			// keys of created rows may not be known before they are created
+			cache.markDirty(ctx, tableName, nil)
+		}
+
+		if invalidatePrimary &&
+			(cache.Config.CacheLevel == config.CacheLevelAll || cache.Config.CacheLevel == config.CacheLevelOnlyPrimary) {
+			primaryKeys := getPrimaryKeysOfWrite(db)
+			var err error
+			if len(primaryKeys) > 0 {
+				cache.Logger.CtxInfo(ctx, "[%s] now start to invalidate cache for primary keys: %+v", funcName, cache.redact(primaryKeys))
+				err = cache.BatchInvalidatePrimaryCache(ctx, getStatementTableName(db), primaryKeys)
+			} else {
+				cache.Logger.CtxInfo(ctx, "[%s] now start to invalidate all primary cache for table: %s", funcName, tableName)
+				err = cache.InvalidateAllPrimaryCache(ctx, getStatementTableName(db))
+			}
+			if err != nil {
+				cache.Logger.CtxError(ctx, "[%s] invalidating primary cache for table %s error: %v", funcName, tableName, err)
+			}
+		}
+
+		if cache.Config.CacheLevel == config.CacheLevelAll || cache.Config.CacheLevel == config.CacheLevelOnlySearch {
+			cache.Logger.CtxInfo(ctx, "[%s] now start to invalidate search cache for table: %s", funcName, tableName)
+			err := cache.InvalidateSearchCache(ctx, tableName)
+			if err != nil {
+				cache.Logger.CtxError(ctx, "[%s] invalidating search cache for table %s error: %v", funcName, tableName, err)
+			}
+		}
+	}
+}
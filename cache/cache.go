@@ -2,6 +2,11 @@ package cache
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/asjdf/gorm-cache/config"
 	"github.com/asjdf/gorm-cache/storage"
 	"github.com/asjdf/gorm-cache/util"
@@ -24,8 +29,11 @@ type Cache interface {
 	Name() string
 	Initialize(db *gorm.DB) error
 	AttachToDB(db *gorm.DB)
+	DetachFromDB(db *gorm.DB) error
 
 	ResetCache() error
+	ResetStats() error
+	Close() error
 	StatsAccessor
 }
 
@@ -38,137 +46,692 @@ type Gorm2Cache struct {
 	cache    storage.DataStorage
 	hitCount int64
 
+	invalidatedAt      sync.Map // table name -> unix ms of last invalidation
+	routedStorages     sync.Map // storages StorageRouter has routed to, except CacheStorage
+	routedInitFailures sync.Map // storage -> *routedInitFailure, routed storages which failed to initialize
+	attached           sync.Map // *gorm.Config of dbs callbacks are registered on
+	registered         sync.Map // *gorm.Config of dbs callbacks have been registered on, including detached ones
+	tableVersions      sync.Map // table name -> *tableVersion
+	pages              pageIndex
+	dependencies       dependencyIndex
+	negatives          negativeIndex
+	dedup              writeDedup
+	keyCounts          keyCountIndex
+	fullTables         fullTableIndex
+	seqs               invalidationSeq
+	logSampler         logSampler
+	verifySampler      verifySampler
+	missLimiter        missLimiter
+	invalidations      invalidationJobs
+	errorRecorder      *errorRecorder
+
+	asyncQueueDepth int64
+	populateRetries int64 // populations waiting for retry
+	resetting       int32 // 1 while ResetCache is running
+	resetAt         int64 // unix ms when last ResetCache finished
+	initialized     bool  // Init has succeeded
+	callbacksNamed  int32 // 1 once callbacks are registered, since when CallbackName doesn't change
+	namespaced      int32 // 1 if callback names contain InstanceId
+	instanceIdOnce  sync.Once
+	closeOnce       sync.Once
+	closed          chan struct{} // closed by Close
+	snapshotStopped chan struct{} // closed when stats snapshot stops, nil if it never starts
+
 	*stats
 }
 
+// Name returns name of the plugin, which contains InstanceId so that more than one cache can be used on a db.
+// db.Use calls it before Initialize, so InstanceId of a cache constructed as a struct literal is generated here.
 func (c *Gorm2Cache) Name() string {
-	return util.GormCachePrefix
+	c.ensureInstanceId()
+	return util.GormCachePrefix + ":" + c.InstanceId
+}
+
+// ensureInstanceId generates InstanceId if it isn't set
+func (c *Gorm2Cache) ensureInstanceId() {
+	c.instanceIdOnce.Do(func() {
+		if c.InstanceId == "" {
+			c.InstanceId = util.GenInstanceId()
+		}
+	})
 }
 
+// CallbackName returns the name that callback of the cache is registered with, e.g. CallbackName("after_query"),
+// it's useful to register other callbacks before or after the cache's. Callbacks of the first cache used on a db
+// keep the names of former versions, e.g. "gorm:cache:after_query", callbacks of caches used on a db after it are
+// named with InstanceId, e.g. "gorm:cache:<InstanceId>:after_query".
+func (c *Gorm2Cache) CallbackName(name string) string {
+	prefix := c.Config.CallbackNamePrefix
+	if prefix == "" {
+		prefix = config.DefaultCallbackNamePrefix
+	}
+	if atomic.LoadInt32(&c.namespaced) == 1 {
+		return prefix + ":" + c.InstanceId + ":" + name
+	}
+	return prefix + ":" + name
+}
+
+// nameCallbacks makes CallbackName contain InstanceId if callbacks of another cache on db have the names
+// without it. Names are kept once callbacks are registered, it fails if they are taken on db then.
+func (c *Gorm2Cache) nameCallbacks(db *gorm.DB) error {
+	// gorm still gets callbacks after they are removed, so names of callbacks of a detached cache are taken
+	if _, ok := c.registered.Load(db.Config); ok || db.Callback().Query().Get(c.CallbackName("before_query")) == nil {
+		return nil
+	}
+	if !atomic.CompareAndSwapInt32(&c.callbacksNamed, 0, 1) {
+		return fmt.Errorf("callback names of cache %s are taken on db, set a different CallbackNamePrefix",
+			c.InstanceId)
+	}
+	atomic.StoreInt32(&c.namespaced, 1)
+	return nil
+}
+
+// stmtKey returns the key of statement instance values the cache keeps across its callbacks
+func (c *Gorm2Cache) stmtKey(name string) string {
+	return "gorm:cache:" + c.InstanceId + ":" + name
+}
+
+// Initialize registers callbacks of the cache on db. A cache constructed as a struct literal, e.g. in
+// gorm.Config.Plugins, is initialized here if Init wasn't called.
 func (c *Gorm2Cache) Initialize(db *gorm.DB) (err error) {
-	err = db.Callback().Create().After("gorm:create").Register("gorm:cache:after_create", AfterCreate(c))
+	if !c.initialized {
+		if c.Config == nil {
+			return fmt.Errorf("you pass a nil config")
+		}
+		err = c.Init()
+		if err != nil {
+			return err
+		}
+	}
+	if c.db == nil {
+		c.db = db
+	}
+	if _, ok := c.attached.Load(db.Config); ok {
+		// registered by Use or AttachToDB before, callbacks are replaced instead of run twice
+		c.Logger.CtxInfo(context.Background(), "[Initialize] cache %s is already registered on db, replace its callbacks",
+			c.InstanceId)
+	}
+	err = c.nameCallbacks(db)
 	if err != nil {
 		return err
 	}
+	atomic.StoreInt32(&c.callbacksNamed, 1)
+	anchors := c.callbackAnchors()
 
-	err = db.Callback().Delete().After("gorm:delete").Register("gorm:cache:after_delete", AfterDelete(c))
+	createCallback := db.Callback().Create()
+	err = registerCallback(createCallback.Get, createCallback.Replace, createCallback.Before(anchors.AfterCreate).Register,
+		c.CallbackName("before_create"), c.recoverCallback("BeforeCreate", BeforeWrite(c, "BeforeCreate", false), nil))
+	if err != nil {
+		return err
+	}
+	err = registerCallback(createCallback.Get, createCallback.Replace, createCallback.After(anchors.AfterCreate).Register,
+		c.CallbackName("after_create"), c.recoverCallback("AfterCreate", AfterCreate(c), nil))
 	if err != nil {
 		return err
 	}
 
-	err = db.Callback().Update().After("gorm:update").Register("gorm:cache:after_update", AfterUpdate(c))
+	deleteCallback := db.Callback().Delete()
+	err = registerCallback(deleteCallback.Get, deleteCallback.Replace, deleteCallback.Before(anchors.AfterDelete).Register,
+		c.CallbackName("before_delete"), c.recoverCallback("BeforeDelete", BeforeWrite(c, "BeforeDelete", true), nil))
+	if err != nil {
+		return err
+	}
+	err = registerCallback(deleteCallback.Get, deleteCallback.Replace, deleteCallback.After(anchors.AfterDelete).Register,
+		c.CallbackName("after_delete"), c.recoverCallback("AfterDelete", AfterDelete(c), nil))
+	if err != nil {
+		return err
+	}
+
+	updateCallback := db.Callback().Update()
+	err = registerCallback(updateCallback.Get, updateCallback.Replace, updateCallback.Before(anchors.AfterUpdate).Register,
+		c.CallbackName("before_update"), c.recoverCallback("BeforeUpdate", BeforeWrite(c, "BeforeUpdate", true), nil))
+	if err != nil {
+		return err
+	}
+	err = registerCallback(updateCallback.Get, updateCallback.Replace, updateCallback.After(anchors.AfterUpdate).Register,
+		c.CallbackName("after_update"), c.recoverCallback("AfterUpdate", AfterUpdate(c), nil))
+	if err != nil {
+		return err
+	}
+
+	rawCallback := db.Callback().Raw()
+	err = registerCallback(rawCallback.Get, rawCallback.Replace, rawCallback.After("gorm:raw").Register,
+		c.CallbackName("after_raw"), c.recoverCallback("AfterRaw", AfterRaw(c), nil))
 	if err != nil {
 		return err
 	}
 
-	err = newQueryHandler(c).Bind(db)
+	err = NewQueryHandler(c).Bind(db)
 	if err != nil {
 		return err
 	}
 
+	c.attached.Store(db.Config, struct{}{})
+	c.registered.Store(db.Config, struct{}{})
 	return
 }
 
+func (c *Gorm2Cache) callbackAnchors() *config.CallbackAnchors {
+	if c.Config.CallbackAnchors != nil {
+		return c.Config.CallbackAnchors
+	}
+	return config.DefaultCallbackAnchors
+}
+
+// registerCallback registers fn under name, or replaces the registered one if name already exists,
+// so that using the plugin more than once on a db doesn't fail or run the callback twice
+func registerCallback(get func(string) func(*gorm.DB), replace, register func(string, func(*gorm.DB)) error,
+	name string, fn func(*gorm.DB)) error {
+	if get(name) != nil {
+		return replace(name, fn)
+	}
+	return register(name, fn)
+}
+
+// AttachToDB registers callbacks of the cache on db like Initialize. Unlike db.Use, which returns gorm.ErrRegistered
+// when the cache is used on db again, it may be called any number of times along with db.Use.
 func (c *Gorm2Cache) AttachToDB(db *gorm.DB) {
 	_ = c.Initialize(db)
 }
 
+// DetachFromDB removes callbacks of the cache from db, so that db queries and writes without cache since then.
+// The cache may be attached or used on db again later, writes in the meantime don't invalidate it though, so call
+// ResetCache before if db is written while detached. Detaching a db the cache isn't attached to does nothing.
+func (c *Gorm2Cache) DetachFromDB(db *gorm.DB) error {
+	if _, ok := c.attached.Load(db.Config); !ok {
+		return nil
+	}
+	callbacks := db.Callback()
+	for _, callback := range []struct {
+		remove func(string) error
+		name   string
+	}{
+		{callbacks.Create().Remove, "before_create"},
+		{callbacks.Create().Remove, "after_create"},
+		{callbacks.Delete().Remove, "before_delete"},
+		{callbacks.Delete().Remove, "after_delete"},
+		{callbacks.Update().Remove, "before_update"},
+		{callbacks.Update().Remove, "after_update"},
+		{callbacks.Raw().Remove, "after_raw"},
+		{callbacks.Query().Remove, "before_query"},
+		{callbacks.Query().Remove, "after_query"},
+	} {
+		if err := callback.remove(c.CallbackName(callback.name)); err != nil {
+			return err
+		}
+	}
+	c.attached.Delete(db.Config)
+	if plugin, ok := db.Plugins[c.Name()]; ok && plugin == Cache(c) {
+		delete(db.Plugins, c.Name())
+	}
+	c.Logger.CtxInfo(context.Background(), "[DetachFromDB] cache %s is detached from db", c.InstanceId)
+	return nil
+}
+
 func (c *Gorm2Cache) Init() error {
-	c.InstanceId = util.GenInstanceId()
+	if err := c.Config.Validate(); err != nil {
+		return err
+	}
+	c.ensureInstanceId()
+	if c.stats == nil {
+		c.stats = &stats{}
+	}
 
-	if c.Config.CacheStorage != nil {
-		c.cache = c.Config.CacheStorage
-	} else {
-		c.cache = storage.NewMem(storage.DefaultMemStoreConfig)
+	s, err := c.resolveStorage()
+	if err != nil {
+		return err
+	}
+	c.cache = s
+	err = c.checkKeyNamespaces()
+	if err != nil {
+		return err
+	}
+
+	c.Config.ApplyDurations()
+	if c.Config.AsyncWrite {
+		c.Config.AsyncCachePopulate = true
+		c.Config.AsyncInvalidate = true
 	}
 
 	if c.Config.DebugLogger == nil {
-		c.Config.DebugLogger = &util.DefaultLogger{}
+		c.Config.DebugLogger = &util.DefaultLogger{CtxFieldsFunc: c.Config.LogCtxFieldsFunc}
+	}
+	c.Config.DebugLogger.SetIsDebug(c.Config.DebugMode)
+	c.errorRecorder = &errorRecorder{LoggerInterface: c.Config.DebugLogger}
+	c.Logger = c.errorRecorder
+	c.logSampler = logSampler{
+		rate:         c.Config.DebugSampleRate,
+		maxPerSecond: c.Config.DebugMaxSampledPerSecond,
+		tables:       c.Config.DebugTables,
+	}
+	if c.logSampler.enabled() {
+		c.Logger = &sampledLogger{LoggerInterface: c.Logger}
 	}
-	c.Logger = c.Config.DebugLogger
-	c.Logger.SetIsDebug(c.Config.DebugMode)
 
-	err := c.cache.Init(&storage.Config{
-		TTL:    c.Config.CacheTTL,
-		Debug:  c.Config.DebugMode,
-		Logger: c.Logger,
-	})
+	err = c.cache.Init(c.storageConfig(c.cache))
 	if err != nil {
 		c.Logger.CtxError(context.Background(), "[Init] cache init error: %v", err)
+		return fmt.Errorf("init storage %T: %w", c.cache, err)
+	}
+	err = c.initConfiguredRoutes()
+	if err != nil {
+		c.Logger.CtxError(context.Background(), "[Init] %v", err)
 		return err
 	}
+	c.closed = make(chan struct{})
+	c.startStatsSnapshot()
+	c.initialized = true
 	return nil
 }
 
+// resolveStorage returns CacheStorage if set, else the storage created by StorageFactory if set,
+// else an in-memory storage
+func (c *Gorm2Cache) resolveStorage() (storage.DataStorage, error) {
+	if c.Config.CacheStorage != nil {
+		return c.Config.CacheStorage, nil
+	}
+	if c.Config.StorageFactory != nil {
+		s := c.Config.StorageFactory()
+		if s == nil {
+			return nil, fmt.Errorf("storage factory returned nil storage")
+		}
+		return s, nil
+	}
+	return storage.NewMem(storage.DefaultMemStoreConfig), nil
+}
+
 func (c *Gorm2Cache) ResetCache() error {
 	c.stats.ResetHitCount()
+	c.pages.reset()
+	c.dependencies.reset()
+	c.negatives.reset()
+	c.dedup.reset()
+	c.keyCounts.reset()
+	c.fullTables.reset()
+	c.seqs.bumpAll()
+	c.tableVersions.Range(func(key, _ interface{}) bool {
+		c.tableVersions.Delete(key)
+		return true
+	})
+	if c.Config.ResetBarrierWindow > 0 {
+		atomic.StoreInt32(&c.resetting, 1)
+		defer func() {
+			atomic.StoreInt64(&c.resetAt, time.Now().UnixMilli())
+			atomic.StoreInt32(&c.resetting, 0)
+		}()
+	}
 	ctx := context.Background()
-	err := c.cache.CleanCache(ctx)
+	for _, s := range c.allStorages() {
+		// only keys of this cache are deleted, others sharing the storage keep theirs
+		err := s.DeleteKeysWithPrefix(ctx, c.keyPrefixOf(s))
+		if err != nil {
+			c.Logger.CtxError(ctx, "[ResetCache] reset cache error: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// InvalidateSearchCache invalidates all search cache of table, including cached pages
+func (c *Gorm2Cache) InvalidateSearchCache(ctx context.Context, tableName string) error {
+	if c.shouldInvalidateAsync(tableName) {
+		return c.invalidateTableAsync(ctx, tableName)
+	}
+	err := c.invalidateSearchCacheExceptPages(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	err = c.InvalidatePages(ctx, tableName)
 	if err != nil {
-		c.Logger.CtxError(ctx, "[ResetCache] reset cache error: %v", err)
 		return err
 	}
+	c.negatives.forget(tableName)
 	return nil
 }
 
-func (c *Gorm2Cache) InvalidateSearchCache(ctx context.Context, tableName string) error {
-	return c.cache.DeleteKeysWithPrefix(ctx, util.GenSearchCachePrefix(c.InstanceId, tableName))
+func (c *Gorm2Cache) invalidateSearchCacheExceptPages(ctx context.Context, tableName string) error {
+	if c.shouldInvalidateAsync(tableName) {
+		return c.invalidateTableAsync(ctx, tableName)
+	}
+	c.markInvalidated(tableName)
+	err := c.storageOf(tableName).DeleteKeysWithPrefix(ctx, util.GenSearchCachePrefix(c.tableKeyPrefix(tableName), tableName))
+	if err != nil {
+		return err
+	}
+	c.keyCounts.forget(util.GenSearchCachePrefix(c.tableKeyPrefix(tableName), tableName))
+	c.notifyInvalidate(ctx, tableName, nil)
+	return c.invalidateDependents(ctx, tableName)
 }
 
 func (c *Gorm2Cache) InvalidatePrimaryCache(ctx context.Context, tableName string, primaryKey string) error {
-	return c.cache.DeleteKey(ctx, util.GenPrimaryCacheKey(c.InstanceId, tableName, primaryKey))
+	table := c.resolveTableName(tableName)
+	c.markInvalidated(table)
+	err := c.storageOf(table).DeleteKey(ctx, c.genPrimaryCacheKey(tableName, primaryKey))
+	if err != nil {
+		return err
+	}
+	c.notifyInvalidate(ctx, tableName, []string{primaryKey})
+	return nil
 }
 
 func (c *Gorm2Cache) BatchInvalidatePrimaryCache(ctx context.Context, tableName string, primaryKeys []string) error {
+	table := c.resolveTableName(tableName)
+	c.markInvalidated(table)
 	cacheKeys := make([]string, 0, len(primaryKeys))
 	for _, primaryKey := range primaryKeys {
-		cacheKeys = append(cacheKeys, util.GenPrimaryCacheKey(c.InstanceId, tableName, primaryKey))
+		cacheKeys = append(cacheKeys, c.genPrimaryCacheKey(tableName, primaryKey))
 	}
-	return c.cache.BatchDeleteKeys(ctx, cacheKeys)
+	err := c.storageOf(table).BatchDeleteKeys(ctx, cacheKeys)
+	if err != nil {
+		return err
+	}
+	c.notifyInvalidate(ctx, tableName, primaryKeys)
+	return nil
 }
 
 func (c *Gorm2Cache) InvalidateAllPrimaryCache(ctx context.Context, tableName string) error {
-	return c.cache.DeleteKeysWithPrefix(ctx, util.GenPrimaryCachePrefix(c.InstanceId, tableName))
+	table := c.resolveTableName(tableName)
+	if c.shouldInvalidateAsync(table) {
+		return c.invalidateTableAsync(ctx, table)
+	}
+	c.markInvalidated(table)
+	err := c.storageOf(table).DeleteKeysWithPrefix(ctx, c.genPrimaryCachePrefix(tableName))
+	if err != nil {
+		return err
+	}
+	c.keyCounts.forget(c.genPrimaryCachePrefix(tableName))
+	c.notifyInvalidate(ctx, tableName, nil)
+	return nil
 }
 
 func (c *Gorm2Cache) BatchPrimaryKeyExists(ctx context.Context, tableName string, primaryKeys []string) (bool, error) {
 	cacheKeys := make([]string, 0, len(primaryKeys))
 	for _, primaryKey := range primaryKeys {
-		cacheKeys = append(cacheKeys, util.GenPrimaryCacheKey(c.InstanceId, tableName, primaryKey))
+		cacheKeys = append(cacheKeys, c.genPrimaryCacheKey(tableName, primaryKey))
 	}
-	return c.cache.BatchKeyExist(ctx, cacheKeys)
+	return c.storageOf(c.resolveTableName(tableName)).BatchKeyExist(ctx, cacheKeys)
 }
 
 func (c *Gorm2Cache) SearchKeyExists(ctx context.Context, tableName string, SQL string, vars ...interface{}) (bool, error) {
-	cacheKey := util.GenSearchCacheKey(c.InstanceId, tableName, SQL, vars...)
-	return c.cache.KeyExists(ctx, cacheKey)
+	cacheKey := c.genSearchCacheKey(tableName, SQL, vars...)
+	return c.storageOf(tableName).KeyExists(ctx, cacheKey)
 }
 
 func (c *Gorm2Cache) BatchSetPrimaryKeyCache(ctx context.Context, tableName string, kvs []util.Kv) error {
 	for idx, kv := range kvs {
-		kvs[idx].Key = util.GenPrimaryCacheKey(c.InstanceId, tableName, kv.Key)
+		kvs[idx].Key = c.genPrimaryCacheKey(tableName, kv.Key)
+	}
+	batches := [][]util.Kv{kvs}
+	if size := c.Config.PrimaryCacheBatchSize; size > 0 && int64(len(kvs)) > size {
+		batches = chunkKvs(kvs, size)
+	}
+	for idx, batch := range batches {
+		if idx > 0 {
+			// give storage and other goroutines a chance between batches
+			if err := pauseBetweenBatches(ctx, c.Config.PrimaryCacheBatchPause); err != nil {
+				return err
+			}
+		}
+		err := c.storageOf(c.resolveTableName(tableName)).BatchSetKeys(ctx, batch)
+		if err != nil {
+			return err
+		}
+		c.recordWrite(c.genTablePrimaryCachePrefix(c.resolveTableName(tableName)), batch...)
+	}
+	return nil
+}
+
+// primaryCacheSetter returns the set func of populateCache which sets primary cache of kvs
+func (c *Gorm2Cache) primaryCacheSetter(tableName string, kvs []util.Kv) func(ctx context.Context) ([]string, error) {
+	return func(ctx context.Context) ([]string, error) {
+		// keys are replaced with cache keys, kvs are kept as they are for retries
+		kvs := append([]util.Kv(nil), kvs...)
+		err := c.BatchSetPrimaryKeyCache(ctx, tableName, kvs)
+		keys := make([]string, 0, len(kvs))
+		for _, kv := range kvs {
+			keys = append(keys, kv.Key)
+		}
+		return keys, err
 	}
-	return c.cache.BatchSetKeys(ctx, kvs)
 }
 
 func (c *Gorm2Cache) SetSearchCache(ctx context.Context, cacheValue string, tableName string,
 	sql string, vars ...interface{}) error {
-	key := util.GenSearchCacheKey(c.InstanceId, tableName, sql, vars...)
-	return c.cache.SetKey(ctx, util.Kv{
-		Key:   key,
+	return c.SetSearchCacheWithTTL(ctx, cacheValue, 0, tableName, sql, vars...)
+}
+
+// SetSearchCacheWithTTL is like SetSearchCache, but the entry expires after ttl ms instead of CacheTTL
+func (c *Gorm2Cache) SetSearchCacheWithTTL(ctx context.Context, cacheValue string, ttl int64, tableName string,
+	sql string, vars ...interface{}) error {
+	kv := util.Kv{
+		Key:   c.genSearchCacheKey(tableName, sql, vars...),
 		Value: cacheValue,
-	})
+		TTL:   ttl,
+	}
+	err := c.storageOf(tableName).SetKey(ctx, kv)
+	if err != nil {
+		return err
+	}
+	c.recordWrite(util.GenSearchCachePrefix(c.tableKeyPrefix(tableName), tableName), kv)
+	return nil
 }
 
 func (c *Gorm2Cache) GetSearchCache(ctx context.Context, tableName string, sql string, vars ...interface{}) (string, error) {
-	key := util.GenSearchCacheKey(c.InstanceId, tableName, sql, vars...)
-	return c.cache.GetValue(ctx, key)
+	key := c.genSearchCacheKey(tableName, sql, vars...)
+	return c.storageOf(tableName).GetValue(ctx, key)
 }
 
 func (c *Gorm2Cache) BatchGetPrimaryCache(ctx context.Context, tableName string, primaryKeys []string) ([]string, error) {
 	cacheKeys := make([]string, 0, len(primaryKeys))
 	for _, primaryKey := range primaryKeys {
-		cacheKeys = append(cacheKeys, util.GenPrimaryCacheKey(c.InstanceId, tableName, primaryKey))
+		cacheKeys = append(cacheKeys, c.genPrimaryCacheKey(tableName, primaryKey))
+	}
+	return c.storageOf(c.resolveTableName(tableName)).BatchGetValues(ctx, cacheKeys)
+}
+
+// getTableName returns the table name that cache keys of db's statement are generated with
+func (c *Gorm2Cache) getTableName(db *gorm.DB) string {
+	return c.resolveTableName(getStatementTableName(db))
+}
+
+// getStatementTableName returns the table name used by db's statement, before TableNameResolver is applied
+func getStatementTableName(db *gorm.DB) string {
+	if db.Statement.Schema != nil && db.Statement.Table == "" {
+		return db.Statement.Schema.Table
+	}
+	return db.Statement.Table
+}
+
+// resolveTableName maps the table name used by a statement with TableNameResolver
+func (c *Gorm2Cache) resolveTableName(tableName string) string {
+	if c.Config.TableNameResolver != nil {
+		return c.Config.TableNameResolver(tableName)
+	}
+	return tableName
+}
+
+// genPrimaryCachePrefix returns the prefix of primary cache keys of tableName, the table name used by statements.
+// Keys of a table resolved to another one are kept under the prefix of the resolved table followed by tableName as
+// one more key segment, so that deleting keys with the prefix of the resolved table invalidates them too, while
+// rows of shard tables with the same primary keys are still told apart.
+func (c *Gorm2Cache) genPrimaryCachePrefix(tableName string) string {
+	table := c.resolveTableName(tableName)
+	prefix := c.genTablePrimaryCachePrefix(table)
+	if table != tableName {
+		prefix += ":" + util.EscapeKeySegment(tableName)
 	}
-	return c.cache.BatchGetValues(ctx, cacheKeys)
+	return prefix
+}
+
+// genTablePrimaryCachePrefix returns the prefix of primary cache keys of table resolved by TableNameResolver,
+// including keys of the tables resolved to it
+func (c *Gorm2Cache) genTablePrimaryCachePrefix(table string) string {
+	return util.GenPrimaryCachePrefix(c.tableKeyPrefix(table), table)
+}
+
+func (c *Gorm2Cache) genPrimaryCacheKey(tableName string, primaryKey string) string {
+	return c.genPrimaryCachePrefix(tableName) + ":" + primaryKey
+}
+
+// isSchemaless checks if the query of db reads a table without its model, i.e. there's no schema,
+// or the schema is parsed from dest which isn't the model of the table queried
+func (c *Gorm2Cache) isSchemaless(db *gorm.DB) bool {
+	return db.Statement.Schema == nil || c.getTableName(db) != db.Statement.Schema.Table
+}
+
+func (c *Gorm2Cache) primaryCacheEnabled() bool {
+	return c.Config.CacheLevel == config.CacheLevelAll || c.Config.CacheLevel == config.CacheLevelOnlyPrimary
+}
+
+func (c *Gorm2Cache) searchCacheEnabled() bool {
+	return c.Config.CacheLevel == config.CacheLevelAll || c.Config.CacheLevel == config.CacheLevelOnlySearch
+}
+
+// shouldCacheQuery checks if the query on given table may be served from or written to cache
+func (c *Gorm2Cache) shouldCacheQuery(db *gorm.DB, tableName string) bool {
+	return c.whyNotCacheQuery(db, tableName) == ""
+}
+
+// whyNotCacheQuery returns why the query on given table may not be served from or written to cache,
+// empty if it may
+func (c *Gorm2Cache) whyNotCacheQuery(db *gorm.DB, tableName string) string {
+	switch {
+	case !util.ShouldCache(tableName, c.Config.Tables):
+		return fmt.Sprintf("table %s is not in Tables", tableName)
+	case hasLockingClause(db):
+		return "query is a locking read"
+	case isTableWritten(db.Statement.Context, tableName):
+		return fmt.Sprintf("table %s has been written within the read-your-writes context", tableName)
+	case c.storageUnavailable(tableName):
+		return fmt.Sprintf("storage of table %s is unavailable", tableName)
+	case c.isDirty(db, tableName):
+		return fmt.Sprintf("rows of table %s read by the query are marked dirty", tableName)
+	}
+	return ""
+}
+
+// isPinned checks if cache of the query of db is pinned, that is kept until it's invalidated
+func (c *Gorm2Cache) isPinned(db *gorm.DB, tableName string) bool {
+	return util.ContainString(tableName, c.Config.PinnedTables) || isPinnedQuery(db.Statement.Context)
+}
+
+// markDirty puts the dirty marker of table into storage, together with the markers of primaryKeys written,
+// or the marker of all rows if primaryKeys are unknown
+func (c *Gorm2Cache) markDirty(ctx context.Context, tableName string, primaryKeys []string) {
+	if c.Config.DirtyMarkerTTL <= 0 {
+		return
+	}
+	keyPrefix := c.keyPrefix(tableName)
+	keys := []string{util.GenDirtyMarkerKey(keyPrefix, tableName)}
+	if len(primaryKeys) == 0 {
+		keys = append(keys, util.GenDirtyAllKeysMarkerKey(keyPrefix, tableName))
+	}
+	for _, primaryKey := range primaryKeys {
+		keys = append(keys, util.GenDirtyKeyMarkerKey(keyPrefix, tableName, primaryKey))
+	}
+	kvs := make([]util.Kv, 0, len(keys))
+	for _, key := range keys {
+		kvs = append(kvs, util.Kv{Key: key, Value: "1", TTL: c.Config.DirtyMarkerTTL})
+	}
+	err := c.storageOf(tableName).BatchSetKeys(ctx, kvs)
+	if err != nil {
+		c.Logger.CtxError(ctx, "[markDirty] set dirty marker for table %s error: %v", tableName, err)
+	}
+}
+
+// isDirty checks if the query of db reads rows marked dirty: the rows of its primary keys if it only looks up
+// primary keys, else any row of table. It's checked once per statement, a storage error is treated as dirty.
+func (c *Gorm2Cache) isDirty(db *gorm.DB, tableName string) bool {
+	if c.Config.DirtyMarkerTTL <= 0 {
+		return false
+	}
+	if dirty, ok := db.InstanceGet(c.stmtKey("dirty")); ok {
+		return dirty.(bool)
+	}
+	ctx := db.Statement.Context
+	keyPrefix := c.keyPrefix(tableName)
+	keys := []string{util.GenDirtyMarkerKey(keyPrefix, tableName)}
+	if primaryKeys := getPrimaryKeysFromWhereClause(db); len(primaryKeys) > 0 &&
+		!hasOtherClauseExceptPrimaryField(db) && !hasConflictingPrimaryConditions(db) {
+		// writes of other rows don't change the result
+		keys = []string{util.GenDirtyAllKeysMarkerKey(keyPrefix, tableName)}
+		for _, primaryKey := range primaryKeys {
+			keys = append(keys, util.GenDirtyKeyMarkerKey(keyPrefix, tableName, primaryKey))
+		}
+	}
+	dirty := false
+	s := c.storageOf(tableName)
+	for _, key := range keys {
+		exists, err := s.KeyExists(ctx, key)
+		if err != nil {
+			c.Logger.CtxError(ctx, "[isDirty] check dirty marker for table %s error: %v", tableName, err)
+		}
+		if err != nil || exists {
+			dirty = true
+			break
+		}
+	}
+	db.InstanceSet(c.stmtKey("dirty"), dirty)
+	return dirty
+}
+
+func (c *Gorm2Cache) markInvalidated(tableName string) {
+	c.seqs.bump(tableName)
+	c.fullTables.forget(tableName)
+	if c.Config.ReplicaLagWindow > 0 {
+		c.invalidatedAt.Store(tableName, time.Now().UnixMilli())
+	}
+}
+
+// notifyInvalidate calls OnInvalidate after cache of table is invalidated, keys are the invalidated primary keys
+// or nil if all cache of a kind is invalidated
+func (c *Gorm2Cache) notifyInvalidate(ctx context.Context, tableName string, keys []string) {
+	if c.Config.OnInvalidate == nil {
+		return
+	}
+	defer c.recoverPanic(ctx, "OnInvalidate")
+	c.Config.OnInvalidate(ctx, tableName, keys)
+}
+
+// inLagWindow checks if table was invalidated within ReplicaLagWindow
+func (c *Gorm2Cache) inLagWindow(tableName string) bool {
+	if c.Config.ReplicaLagWindow <= 0 {
+		return false
+	}
+	last, ok := c.invalidatedAt.Load(tableName)
+	if !ok {
+		return false
+	}
+	return time.Now().UnixMilli()-last.(int64) < c.Config.ReplicaLagWindow
+}
+
+// inResetBarrier checks if ResetCache is running or finished within ResetBarrierWindow
+func (c *Gorm2Cache) inResetBarrier() bool {
+	if c.Config.ResetBarrierWindow <= 0 {
+		return false
+	}
+	if atomic.LoadInt32(&c.resetting) == 1 {
+		return true
+	}
+	return time.Now().UnixMilli()-atomic.LoadInt64(&c.resetAt) < c.Config.ResetBarrierWindow
+}
+
+// keySQL returns the sql text that is used for key generation
+func (c *Gorm2Cache) keySQL(sql string) string {
+	if c.Config.StripSQLComments {
+		return util.StripSQLComments(sql)
+	}
+	return sql
+}
+
+// genQueryCacheKey generates the key that result of query is cached with, limited queries are cached as pages
+func (c *Gorm2Cache) genQueryCacheKey(db *gorm.DB, tableName string, sql string, vars ...interface{}) string {
+	if isPageQuery(db) {
+		return util.GenPageCacheKey(c.tableKeyPrefix(tableName), tableName, c.keySQL(sql), vars...)
+	}
+	return c.genSearchCacheKey(tableName, sql, vars...)
+}
+
+func (c *Gorm2Cache) genSearchCacheKey(tableName string, sql string, vars ...interface{}) string {
+	return util.GenSearchCacheKey(c.tableKeyPrefix(tableName), tableName, c.keySQL(sql), vars...)
 }
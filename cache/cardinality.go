@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+)
+
+// keyCountIndex estimates key count per key prefix in process memory for storages which can't count keys.
+// It counts keys written since the prefix was last deleted, so overwritten, expired, evicted
+// or individually deleted keys are still counted.
+type keyCountIndex struct {
+	counts sync.Map // key prefix -> *int64
+}
+
+func (k *keyCountIndex) add(keyPrefix string, delta int64) {
+	cnt, _ := k.counts.LoadOrStore(keyPrefix, new(int64))
+	atomic.AddInt64(cnt.(*int64), delta)
+}
+
+func (k *keyCountIndex) get(keyPrefix string) int64 {
+	if cnt, ok := k.counts.Load(keyPrefix); ok {
+		return atomic.LoadInt64(cnt.(*int64))
+	}
+	return 0
+}
+
+func (k *keyCountIndex) forget(keyPrefix string) {
+	k.counts.Delete(keyPrefix)
+}
+
+func (k *keyCountIndex) reset() {
+	k.counts.Range(func(key, _ interface{}) bool {
+		k.counts.Delete(key)
+		return true
+	})
+}
+
+// recordWrite updates payload size histogram and key count estimate after kvs are written under keyPrefix
+func (c *Gorm2Cache) recordWrite(keyPrefix string, kvs ...util.Kv) {
+	for _, kv := range kvs {
+		c.observePayloadSize(len(kv.Value))
+	}
+	c.keyCounts.add(keyPrefix, int64(len(kvs)))
+}
+
+// TableKeyCount returns count of cache keys of table, including primary cache, search cache and cached pages.
+// It's counted by storage, or it's an estimate of keys written by this instance since they were last invalidated
+// if storage can't count keys.
+func (c *Gorm2Cache) TableKeyCount(ctx context.Context, tableName string) (int64, error) {
+	prefixes := []string{
+		util.GenPrimaryCachePrefix(c.tableKeyPrefix(tableName), tableName),
+		util.GenSearchCachePrefix(c.tableKeyPrefix(tableName), tableName),
+		util.GenPageCachePrefix(c.tableKeyPrefix(tableName), tableName),
+	}
+	var total int64
+	s := c.storageOf(tableName)
+	for _, prefix := range prefixes {
+		cnt, err := s.EntryCount(ctx, prefix)
+		if errors.Is(err, storage.ErrNotSupported) {
+			cnt, err = c.keyCounts.get(prefix), nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		total += cnt
+	}
+	return total, nil
+}
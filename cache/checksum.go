@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+)
+
+// checksumPrefix starts values written with checksum, they are checksumPrefix + 8 hex digits of CRC-32 + ":" + value
+const checksumPrefix = "crc:"
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func sealValue(value string) string {
+	return fmt.Sprintf("%s%08x:%s", checksumPrefix, crc32.Checksum([]byte(value), crcTable), value)
+}
+
+// openValue returns the value sealed in sealed, false if sealed has no checksum or fails it
+func openValue(sealed string) (string, bool) {
+	if !strings.HasPrefix(sealed, checksumPrefix) || len(sealed) < len(checksumPrefix)+9 {
+		return "", false
+	}
+	sealed = sealed[len(checksumPrefix):]
+	if sealed[8] != ':' {
+		return "", false
+	}
+	sum, err := strconv.ParseUint(sealed[:8], 16, 32)
+	if err != nil {
+		return "", false
+	}
+	value := sealed[9:]
+	return value, uint32(sum) == crc32.Checksum([]byte(value), crcTable)
+}
+
+// wrapStorage wraps s with checksum and retry as configured, operations of the cache go through it
+func (c *Gorm2Cache) wrapStorage(s storage.DataStorage) storage.DataStorage {
+	return c.withRetry(c.withChecksum(s))
+}
+
+// withChecksum wraps s so that values are written with checksum and validated on read if ValueChecksum is on
+func (c *Gorm2Cache) withChecksum(s storage.DataStorage) storage.DataStorage {
+	if !c.Config.ValueChecksum {
+		return s
+	}
+	return &checksumStorage{DataStorage: s, cache: c}
+}
+
+// checksumStorage seals values written to the storage it wraps with checksum, and evicts values failing it on read
+type checksumStorage struct {
+	storage.DataStorage
+	cache *Gorm2Cache
+}
+
+// evict deletes keys whose values failed checksum
+func (s *checksumStorage) evict(ctx context.Context, keys []string) {
+	for range keys {
+		s.cache.IncrCorruptCount()
+	}
+	s.cache.Logger.CtxError(ctx, "[checksumStorage] values of keys %v fail checksum, evicted", s.cache.redact(keys))
+	if err := s.DataStorage.BatchDeleteKeys(ctx, keys); err != nil {
+		s.cache.Logger.CtxError(ctx, "[checksumStorage] evict keys error: %v", err)
+	}
+}
+
+func (s *checksumStorage) GetValue(ctx context.Context, key string) (string, error) {
+	sealed, err := s.DataStorage.GetValue(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	value, ok := openValue(sealed)
+	if !ok {
+		s.evict(ctx, []string{key})
+		return "", storage.ErrCacheNotFound
+	}
+	return value, nil
+}
+
+func (s *checksumStorage) BatchGetValues(ctx context.Context, keys []string) ([]string, error) {
+	sealed, err := s.DataStorage.BatchGetValues(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, len(sealed))
+	corrupt := make([]string, 0)
+	for i := range sealed {
+		var ok bool
+		if values[i], ok = openValue(sealed[i]); !ok {
+			corrupt = append(corrupt, keys[i])
+		}
+	}
+	if len(corrupt) > 0 {
+		// like a key not found, the batch is a miss
+		s.evict(ctx, corrupt)
+		return nil, storage.ErrCacheNotFound
+	}
+	return values, nil
+}
+
+func (s *checksumStorage) SetKey(ctx context.Context, kv util.Kv) error {
+	kv.Value = sealValue(kv.Value)
+	return s.DataStorage.SetKey(ctx, kv)
+}
+
+func (s *checksumStorage) BatchSetKeys(ctx context.Context, kvs []util.Kv) error {
+	sealed := make([]util.Kv, len(kvs))
+	for i, kv := range kvs {
+		kv.Value = sealValue(kv.Value)
+		sealed[i] = kv
+	}
+	return s.DataStorage.BatchSetKeys(ctx, sealed)
+}
+
+// evictCorrupt deletes keys of tableName whose values can't be decoded, e.g. partially written or written by
+// another codec, so that the query reads the database and caches its result again
+func (c *Gorm2Cache) evictCorrupt(ctx context.Context, tableName string, keys []string) {
+	for range keys {
+		c.IncrCorruptCount()
+	}
+	if err := c.storageOf(tableName).BatchDeleteKeys(ctx, keys); err != nil {
+		c.Logger.CtxError(ctx, "[evictCorrupt] delete keys %v error: %v", c.redact(keys), err)
+	}
+}
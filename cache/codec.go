@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/base64"
+	stdjson "encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+	"unsafe"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/modern-go/reflect2"
+)
+
+// dbValueJSON is the codec of caches with EncodeDBValues on
+var dbValueJSON = func() jsoniter.API {
+	api := jsoniter.Config{
+		EscapeHTML:             true,
+		ValidateJsonRawMessage: true,
+		TagKey:                 "gormCache",
+	}.Froze()
+	api.RegisterExtension(&dbValueExtension{})
+	return api
+}()
+
+// jsonCodec returns the codec which cache values are marshaled with
+func (c *Gorm2Cache) jsonCodec() jsoniter.API {
+	if c.Config.EncodeDBValues {
+		return dbValueJSON
+	}
+	return json
+}
+
+var (
+	scannerType       = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType        = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*stdjson.Marshaler)(nil)).Elem()
+	jsonUnmarshalType = reflect.TypeOf((*stdjson.Unmarshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isDBValueType checks if values of typ are scanned from and stored into database by themselves while marshaling
+// themselves to JSON, which may not tell NULL from zero values, e.g. a nullable string marshaled as "" if NULL
+func isDBValueType(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Interface {
+		return false
+	}
+	ptrType := reflect.PtrTo(typ)
+	if !ptrType.Implements(scannerType) || !ptrType.Implements(valuerType) {
+		return false
+	}
+	for _, t := range []reflect.Type{jsonMarshalerType, jsonUnmarshalType, textMarshalerType, textUnmarshalType} {
+		if ptrType.Implements(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// dbValueExtension encodes values of db value types as the driver.Value they store in database and decodes them by
+// scanning it back, so they round-trip through cache like they are read from database.
+// The driver.Value is encoded as null if it's nil, else {"kind": value}, kinds are i (int64), f (float64), b (bool),
+// s (string), x ([]byte in base64) and t (time.Time in RFC 3339).
+type dbValueExtension struct {
+	jsoniter.DummyExtension
+}
+
+// CreateEncoder claims db value types and pointers to them, whose JSON marshaling would be used otherwise
+func (e *dbValueExtension) CreateEncoder(typ reflect2.Type) jsoniter.ValEncoder {
+	if isDBValueType(typ.Type1()) {
+		return &dbValueCodec{typ: typ}
+	}
+	if ptrType, ok := typ.(*reflect2.UnsafePtrType); ok && isDBValueType(ptrType.Elem().Type1()) {
+		return &jsoniter.OptionalEncoder{ValueEncoder: &dbValueCodec{typ: ptrType.Elem()}}
+	}
+	return nil
+}
+
+func (e *dbValueExtension) CreateDecoder(typ reflect2.Type) jsoniter.ValDecoder {
+	if isDBValueType(typ.Type1()) {
+		return &dbValueCodec{typ: typ}
+	}
+	if ptrType, ok := typ.(*reflect2.UnsafePtrType); ok && isDBValueType(ptrType.Elem().Type1()) {
+		return &jsoniter.OptionalDecoder{ValueType: ptrType.Elem(), ValueDecoder: &dbValueCodec{typ: ptrType.Elem()}}
+	}
+	return nil
+}
+
+type dbValueCodec struct {
+	typ reflect2.Type
+}
+
+func (d *dbValueCodec) IsEmpty(ptr unsafe.Pointer) bool {
+	return false
+}
+
+func (d *dbValueCodec) Encode(ptr unsafe.Pointer, stream *jsoniter.Stream) {
+	value, err := d.typ.PackEFace(ptr).(driver.Valuer).Value()
+	if err != nil {
+		stream.Error = fmt.Errorf("get driver value of %v error: %w", d.typ, err)
+		return
+	}
+	if value == nil {
+		stream.WriteNil()
+		return
+	}
+	stream.WriteObjectStart()
+	switch v := value.(type) {
+	case int64:
+		stream.WriteObjectField("i")
+		stream.WriteInt64(v)
+	case float64:
+		stream.WriteObjectField("f")
+		stream.WriteFloat64(v)
+	case bool:
+		stream.WriteObjectField("b")
+		stream.WriteBool(v)
+	case string:
+		stream.WriteObjectField("s")
+		stream.WriteString(v)
+	case []byte:
+		stream.WriteObjectField("x")
+		stream.WriteString(base64.StdEncoding.EncodeToString(v))
+	case time.Time:
+		stream.WriteObjectField("t")
+		stream.WriteString(v.Format(time.RFC3339Nano))
+	default:
+		stream.Error = fmt.Errorf("driver value %T of %v is not supported", value, d.typ)
+		return
+	}
+	stream.WriteObjectEnd()
+}
+
+func (d *dbValueCodec) Decode(ptr unsafe.Pointer, iter *jsoniter.Iterator) {
+	var value interface{}
+	if !iter.ReadNil() {
+		for kind := iter.ReadObject(); kind != ""; kind = iter.ReadObject() {
+			switch kind {
+			case "i":
+				value = iter.ReadInt64()
+			case "f":
+				value = iter.ReadFloat64()
+			case "b":
+				value = iter.ReadBool()
+			case "s":
+				value = iter.ReadString()
+			case "x":
+				b, err := base64.StdEncoding.DecodeString(iter.ReadString())
+				if err != nil {
+					iter.ReportError("decode db value", err.Error())
+					return
+				}
+				value = b
+			case "t":
+				t, err := time.Parse(time.RFC3339Nano, iter.ReadString())
+				if err != nil {
+					iter.ReportError("decode db value", err.Error())
+					return
+				}
+				value = t
+			default:
+				iter.ReportError("decode db value", "unknown kind "+kind)
+				return
+			}
+		}
+		if iter.Error != nil {
+			return
+		}
+	}
+	// like a row read from database, the value is scanned into a zero value
+	d.typ.UnsafeSet(ptr, d.typ.UnsafeNew())
+	if err := d.typ.PackEFace(ptr).(sql.Scanner).Scan(value); err != nil {
+		iter.ReportError("decode db value", err.Error())
+	}
+}
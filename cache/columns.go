@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"github.com/asjdf/gorm-cache/util"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// assignedColumns returns columns assigned by the SET clause of db's update, ok is false if they are unknown
+func assignedColumns(db *gorm.DB) (columns []string, ok bool) {
+	c, ok := db.Statement.Clauses["SET"]
+	if !ok {
+		return nil, false
+	}
+	set, ok := c.Expression.(clause.Set)
+	if !ok || len(set) == 0 {
+		return nil, false
+	}
+	for _, assignment := range set {
+		columns = append(columns, assignment.Column.Name)
+	}
+	return columns, true
+}
+
+// touchesRelevantColumns checks if db's update may change results of cached queries of table, i.e. it assigns
+// a column in CacheRelevantColumns of table or a primary key. It's true if the table has no relevant columns
+// configured or assigned columns are unknown.
+func (c *Gorm2Cache) touchesRelevantColumns(db *gorm.DB, tableName string) bool {
+	relevant, ok := c.Config.CacheRelevantColumns[tableName]
+	if !ok {
+		return true
+	}
+	columns, ok := assignedColumns(db)
+	if !ok {
+		return true
+	}
+	for _, column := range columns {
+		if util.ContainString(column, relevant) {
+			return true
+		}
+		if db.Statement.Schema != nil {
+			if field := db.Statement.Schema.LookUpField(column); field != nil && field.PrimaryKey {
+				return true
+			}
+		}
+	}
+	return false
+}
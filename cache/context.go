@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type readYourWritesKey struct{}
+
+type nestedQueryKey struct{}
+
+type pinnedKey struct{}
+
+// writtenTables records tables written within a read-your-writes context
+type writtenTables struct {
+	mu     sync.RWMutex
+	tables map[string]struct{}
+}
+
+// WithReadYourWrites returns a copy of ctx in which, once a table has been written (create/update/delete),
+// following queries on this table bypass cache, so a request always reads its own writes.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(readYourWritesKey{}).(*writtenTables); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, readYourWritesKey{}, &writtenTables{tables: make(map[string]struct{})})
+}
+
+func markTableWritten(ctx context.Context, tableName string) {
+	if ctx == nil {
+		return
+	}
+	if w, ok := ctx.Value(readYourWritesKey{}).(*writtenTables); ok {
+		w.mu.Lock()
+		w.tables[tableName] = struct{}{}
+		w.mu.Unlock()
+	}
+}
+
+func isTableWritten(ctx context.Context, tableName string) bool {
+	if ctx == nil {
+		return false
+	}
+	w, ok := ctx.Value(readYourWritesKey{}).(*writtenTables)
+	if !ok {
+		return false
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	_, ok = w.tables[tableName]
+	return ok
+}
+
+func withNestedQuery(ctx context.Context) context.Context {
+	return context.WithValue(ctx, nestedQueryKey{}, true)
+}
+
+// isNestedQuery checks if query is issued (e.g. by an AfterFind hook) while another query is in flight
+func isNestedQuery(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	nested, _ := ctx.Value(nestedQueryKey{}).(bool)
+	return nested
+}
+
+// WithPinned returns a copy of ctx in which results of queries are cached as pinned entries, which never expire
+// and aren't evicted when storage is full, as if their tables were in PinnedTables
+func WithPinned(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pinnedKey{}, true)
+}
+
+func isPinnedQuery(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	pinned, _ := ctx.Value(pinnedKey{}).(bool)
+	return pinned
+}
+
+// lookupContext returns the context for cache lookup of a query within ctx, which takes LookupDeadlineFraction
+// of the time left before deadline of ctx, so the database query still has the rest if storage is slow
+func (c *Gorm2Cache) lookupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok || c.Config.LookupDeadlineFraction <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, time.Duration(float64(time.Until(deadline))*c.Config.LookupDeadlineFraction))
+}
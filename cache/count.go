@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CachedFindAndCount finds records of db into dest, and counts all records db matches regardless of its LIMIT and
+// OFFSET into count, i.e. the Find and Count pair of a paginated list. If both results are in search cache, they are
+// got in one storage round trip, else both queries run as usual and are cached. Both results are search cache of
+// the table, so any invalidation of the table clears them together.
+func (c *Gorm2Cache) CachedFindAndCount(db *gorm.DB, dest interface{}, count *int64) error {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if c.getFindAndCount(ctx, db, dest, count) {
+		return nil
+	}
+	if err := db.Session(&gorm.Session{Context: ctx}).Find(dest).Error; err != nil {
+		return err
+	}
+	return countSession(db, ctx, dest).Count(count).Error
+}
+
+// getFindAndCount gets results of CachedFindAndCount from cache, it returns false unless both are found
+func (c *Gorm2Cache) getFindAndCount(ctx context.Context, db *gorm.DB, dest interface{}, count *int64) bool {
+	// the count sql is built like Count does, which isn't done for custom selects
+	if len(db.Statement.Selects) > 0 {
+		return false
+	}
+	findTx := db.Session(&gorm.Session{Context: ctx})
+	findTx.Statement.Dest = dest
+	table, _, findKey := c.FingerprintQuery(findTx)
+
+	countTx := countSession(db, ctx, dest)
+	countTx.Statement.AddClause(clause.Select{Expression: clause.Expr{SQL: "count(*)"}})
+	if _, ok := countTx.Statement.Clauses["GROUP BY"]; !ok {
+		delete(countTx.Statement.Clauses, "ORDER BY")
+	}
+	countTx.Statement.Dest = count
+	_, _, countKey := c.FingerprintQuery(countTx)
+
+	if findKey == "" || countKey == "" || !c.shouldCacheQuery(findTx, table) {
+		return false
+	}
+	keys := []string{findKey, countKey}
+	values, err := c.storageOf(table).BatchGetValues(ctx, keys)
+	if err != nil || len(values) != 2 {
+		return false
+	}
+	results := []interface{}{dest, count}
+	for i, value := range values {
+		rowsAffectedPos := strings.Index(value, "|")
+		if rowsAffectedPos < 0 {
+			// e.g. a not-found result, which Find and Count never cache
+			return false
+		}
+		if _, err = strconv.ParseInt(value[:rowsAffectedPos], 10, 64); err != nil {
+			c.evictCorrupt(ctx, table, keys[i:i+1])
+			return false
+		}
+		if err = c.jsonCodec().Unmarshal([]byte(value[rowsAffectedPos+1:]), results[i]); err != nil {
+			c.Logger.CtxError(ctx, "[CachedFindAndCount] unmarshal search cache error: %v", err)
+			c.evictCorrupt(ctx, table, keys[i:i+1])
+			return false
+		}
+	}
+	c.incrHit(searchHit)
+	c.incrHit(searchHit)
+	c.Logger.CtxInfo(ctx, "[CachedFindAndCount] find and count of table %s served from cache", table)
+	return true
+}
+
+// countSession returns a session of db which counts all records db matches, regardless of its LIMIT and OFFSET
+func countSession(db *gorm.DB, ctx context.Context, dest interface{}) *gorm.DB {
+	tx := db.Session(&gorm.Session{Context: ctx})
+	delete(tx.Statement.Clauses, "LIMIT")
+	if tx.Statement.Model == nil {
+		tx.Statement.Model = dest
+	}
+	return tx
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/asjdf/gorm-cache/util"
+)
+
+// defaultWriteDedupSize is the max count of recently written keys remembered if WriteDedupSize is 0
+const defaultWriteDedupSize = 1000
+
+// writeDedup remembers search cache keys being written or recently written with hash of their values in a small
+// LRU, so that writing the same value to the same key again within the dedup window can be skipped
+type writeDedup struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front is the most recently written
+}
+
+type dedupEntry struct {
+	key      string
+	hash     uint64
+	writing  bool
+	expireAt int64 // unix ms, the end of the dedup window of the last finished write
+}
+
+// dedupState tells how a write of a value to a key relates to the writes remembered
+type dedupState int
+
+const (
+	dedupNew     dedupState = iota // value isn't being written nor written recently to key
+	dedupWriting                   // the same value is being written to key
+	dedupWritten                   // the same value was written to key within the window
+)
+
+func hashValue(value string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(value))
+	return h.Sum64()
+}
+
+// begin starts writing value to key unless the same value is being written to it already,
+// the least recently written key is dropped beyond size
+func (w *writeDedup) begin(key string, value string, size int) dedupState {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.entries == nil {
+		w.entries = make(map[string]*list.Element)
+		w.order = list.New()
+	}
+	hash := hashValue(value)
+	state := dedupNew
+	if elem, ok := w.entries[key]; ok {
+		entry := elem.Value.(*dedupEntry)
+		if entry.hash == hash && entry.writing {
+			return dedupWriting
+		}
+		if entry.hash == hash && entry.expireAt > time.Now().UnixMilli() {
+			state = dedupWritten
+		} else {
+			entry.hash = hash
+			entry.expireAt = 0
+		}
+		entry.writing = true
+		w.order.MoveToFront(elem)
+		return state
+	}
+	w.entries[key] = w.order.PushFront(&dedupEntry{key: key, hash: hash, writing: true})
+	for w.order.Len() > size {
+		oldest := w.order.Back()
+		w.order.Remove(oldest)
+		delete(w.entries, oldest.Value.(*dedupEntry).key)
+	}
+	return state
+}
+
+// end finishes writing value to key started by begin, the dedup window of key restarts if value was written
+func (w *writeDedup) end(key string, value string, written bool, window int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	elem, ok := w.entries[key]
+	if !ok {
+		return
+	}
+	entry := elem.Value.(*dedupEntry)
+	if entry.hash != hashValue(value) {
+		return
+	}
+	entry.writing = false
+	if written {
+		entry.expireAt = time.Now().UnixMilli() + window
+	}
+}
+
+func (w *writeDedup) reset() {
+	w.mu.Lock()
+	w.entries = nil
+	w.order = nil
+	w.mu.Unlock()
+}
+
+// dedupEnabled reports whether rewriting identical search cache is skipped within WriteDedupWindow
+func (c *Gorm2Cache) dedupEnabled() bool {
+	return c.Config.WriteDedupWindow > 0
+}
+
+// beginWrite starts writing kv to search cache of tableName, it returns false if the same value is being written
+// to kv.Key, or was written to it within WriteDedupWindow and the key is still in storage, otherwise the write
+// must be finished by endWrite. Keys deleted or evicted within the window are written again.
+func (c *Gorm2Cache) beginWrite(ctx context.Context, tableName string, kv util.Kv) bool {
+	if !c.dedupEnabled() {
+		return true
+	}
+	size := c.Config.WriteDedupSize
+	if size <= 0 {
+		size = defaultWriteDedupSize
+	}
+	switch c.dedup.begin(kv.Key, kv.Value, size) {
+	case dedupWriting:
+		return false
+	case dedupWritten:
+		exists, err := c.storageOf(tableName).KeyExists(ctx, kv.Key)
+		if err == nil && exists {
+			c.dedup.end(kv.Key, kv.Value, false, c.Config.WriteDedupWindow)
+			return false
+		}
+	}
+	return true
+}
+
+// endWrite finishes writing kv to search cache started by beginWrite, written tells whether kv was set
+func (c *Gorm2Cache) endWrite(kv util.Kv, written bool) {
+	if c.dedupEnabled() {
+		c.dedup.end(kv.Key, kv.Value, written, c.Config.WriteDedupWindow)
+	}
+}
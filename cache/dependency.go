@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/util"
+)
+
+// dependencyIndex records which tables' cached queries read from other tables (subqueries, joins)
+type dependencyIndex struct {
+	mu         sync.Mutex
+	dependents map[string]map[string]struct{} // table name -> tables whose cached queries read it
+}
+
+func (d *dependencyIndex) add(tableName string, dependent string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dependents == nil {
+		d.dependents = make(map[string]map[string]struct{})
+	}
+	if _, ok := d.dependents[tableName]; !ok {
+		d.dependents[tableName] = make(map[string]struct{})
+	}
+	d.dependents[tableName][dependent] = struct{}{}
+}
+
+// take removes and returns the dependents of table
+func (d *dependencyIndex) take(tableName string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dependents := make([]string, 0, len(d.dependents[tableName]))
+	for dependent := range d.dependents[tableName] {
+		dependents = append(dependents, dependent)
+	}
+	delete(d.dependents, tableName)
+	return dependents
+}
+
+func (d *dependencyIndex) reset() {
+	d.mu.Lock()
+	d.dependents = nil
+	d.mu.Unlock()
+}
+
+// recordDependencies records that cached results of sql on table also depend on other tables it reads
+func (c *Gorm2Cache) recordDependencies(tableName string, sql string) {
+	for _, referenced := range util.GetReferencedTables(sql) {
+		if c.Config.TableNameResolver != nil {
+			referenced = c.Config.TableNameResolver(referenced)
+		}
+		if referenced != tableName {
+			c.dependencies.add(referenced, tableName)
+		}
+	}
+}
+
+// invalidateDependents invalidates search cache of tables whose cached queries read table
+func (c *Gorm2Cache) invalidateDependents(ctx context.Context, tableName string) error {
+	for _, dependent := range c.dependencies.take(tableName) {
+		c.Logger.CtxInfo(ctx, "[invalidateDependents] invalidate search cache of table %s which depends on %s",
+			dependent, tableName)
+		if err := c.InvalidateSearchCache(ctx, dependent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InvalidateJoin invalidates cached queries over join table joinTable (e.g. the many2many table "user_roles"),
+// namely its own search cache and search cache of tables whose cached queries join it.
+// Use it after writing joinTable bypassing gorm callbacks (e.g. raw sql).
+// Cached queries aren't indexed by owner, so all of them are invalidated, ownerKey only shows up in logs.
+func (c *Gorm2Cache) InvalidateJoin(ctx context.Context, joinTable string, ownerKey interface{}) error {
+	c.Logger.CtxInfo(ctx, "[InvalidateJoin] invalidate cached queries over join table %s for owner %v", joinTable, c.redact(ownerKey))
+	if c.Config.TableNameResolver != nil {
+		joinTable = c.Config.TableNameResolver(joinTable)
+	}
+	if util.ShouldCache(joinTable, c.Config.Tables) {
+		return c.InvalidateSearchCache(ctx, joinTable)
+	}
+	return c.invalidateDependents(ctx, joinTable)
+}
+
+// invalidateDependentsOfUncached invalidates cached queries of other tables reading table after it is written,
+// where table itself is not cached (e.g. a many2many join table written by association operations)
+func (c *Gorm2Cache) invalidateDependentsOfUncached(ctx context.Context, funcName string, tableName string) {
+	if !c.Config.InvalidateWhenUpdate || util.ShouldCache(tableName, c.Config.Tables) {
+		return
+	}
+	if c.Config.CacheLevel != config.CacheLevelAll && c.Config.CacheLevel != config.CacheLevelOnlySearch {
+		return
+	}
+	err := c.invalidateDependents(ctx, tableName)
+	if err != nil {
+		c.Logger.CtxError(ctx, "[%s] invalidating queries depending on table %s error: %v", funcName, tableName, err)
+	}
+}
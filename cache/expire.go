@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"gorm.io/gorm"
+)
+
+// slideExpiration extends ttl of the keys the query of db hit to CacheTTL in background
+// if table is in SlidingExpirationTables, pinned cache is left as is
+func (c *Gorm2Cache) slideExpiration(ctx context.Context, db *gorm.DB, tableName string, hit hitKind, searchKey string) {
+	if c.Config.CacheTTL <= 0 || !util.ContainString(tableName, c.Config.SlidingExpirationTables) {
+		return
+	}
+	if c.isPinned(db, tableName) {
+		return
+	}
+	var keys []string
+	switch {
+	case hit == primaryHit:
+		for _, primaryKey := range getPrimaryKeysFromWhereClause(db) {
+			keys = append(keys, c.genPrimaryCacheKey(getStatementTableName(db), primaryKey))
+		}
+	case hit == searchHit && db.Error == util.SearchCacheHit && db.RowsAffected > 0:
+		// empty and not found results keep their own ttl
+		keys = append(keys, searchKey)
+	default:
+		return
+	}
+	s := c.storageOf(tableName)
+	ttl := time.Duration(c.Config.CacheTTL) * time.Millisecond
+	c.goAsync(func() {
+		defer c.recoverPanic(ctx, "slideExpiration")
+		for _, key := range keys {
+			err := s.Expire(ctx, key, ttl)
+			if err != nil && err != storage.ErrCacheNotFound {
+				c.Logger.CtxError(ctx, "[slideExpiration] expire key %v error: %v", c.redact(key), err)
+			}
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+type explainKey struct{}
+
+// Explanation decisions the cache made for a query, in the order they were made
+type Explanation struct {
+	Table string
+	SQL   string
+	Steps []string
+}
+
+// explanation is an Explanation being recorded, steps may be added by cache population in background
+type explanation struct {
+	mu sync.Mutex
+	Explanation
+}
+
+// explainRecorder keeps the explanation of the last query run within a context returned by WithExplain
+type explainRecorder struct {
+	mu   sync.Mutex
+	last *explanation
+}
+
+// WithExplain returns a copy of ctx in which the cache records why queries are served from cache or not and
+// whether their results are cached, ExplainLast returns the record of the last query. It's meant for debugging.
+func WithExplain(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(explainKey{}).(*explainRecorder); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, explainKey{}, &explainRecorder{})
+}
+
+// ExplainLast returns the explanation of the last query run within ctx, which must be returned by WithExplain.
+// Queries issued by the query, e.g. by Preload, finish before it, so it's the last one. nil if there is none.
+func ExplainLast(ctx context.Context) *Explanation {
+	r, ok := ctx.Value(explainKey{}).(*explainRecorder)
+	if !ok {
+		return nil
+	}
+	r.mu.Lock()
+	e := r.last
+	r.mu.Unlock()
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	res := e.Explanation
+	res.Steps = append([]string(nil), e.Steps...)
+	return &res
+}
+
+// startExplain starts recording decisions for the query of db if its context is returned by WithExplain
+func (c *Gorm2Cache) startExplain(db *gorm.DB, tableName string, sql string) {
+	if db.Statement.Context == nil {
+		return
+	}
+	if _, ok := db.Statement.Context.Value(explainKey{}).(*explainRecorder); ok {
+		db.InstanceSet(c.stmtKey("explain"), &explanation{Explanation: Explanation{Table: tableName, SQL: sql}})
+	}
+}
+
+// explanationOf returns the explanation being recorded for the query of db, nil if it's not recorded
+func (c *Gorm2Cache) explanationOf(db *gorm.DB) *explanation {
+	obj, ok := db.InstanceGet(c.stmtKey("explain"))
+	if !ok {
+		return nil
+	}
+	return obj.(*explanation)
+}
+
+// explain records a decision for the query of db
+func (c *Gorm2Cache) explain(db *gorm.DB, format string, v ...interface{}) {
+	c.explanationOf(db).add(format, v...)
+}
+
+// add records a decision, it's a no-op on nil explanation
+func (e *explanation) add(format string, v ...interface{}) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	e.Steps = append(e.Steps, fmt.Sprintf(format, v...))
+	e.mu.Unlock()
+}
+
+// finishExplain makes the explanation of the query of db the last one of its context
+func (c *Gorm2Cache) finishExplain(db *gorm.DB) {
+	obj, ok := db.InstanceGet(c.stmtKey("explain"))
+	if !ok {
+		return
+	}
+	ctx := db.Statement.Context
+	if ctxObj, ok := db.InstanceGet(c.stmtKey("ctx")); ok {
+		ctx = ctxObj.(context.Context)
+	}
+	if r, ok := ctx.Value(explainKey{}).(*explainRecorder); ok {
+		r.mu.Lock()
+		r.last = obj.(*explanation)
+		r.mu.Unlock()
+	}
+}
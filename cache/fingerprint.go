@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/asjdf/gorm-cache/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+// queryClauses clauses gorm builds query sql with by default
+var queryClauses = []string{"SELECT", "FROM", "WHERE", "GROUP BY", "ORDER BY", "LIMIT", "FOR"}
+
+// FingerprintQuery computes the cache keys the query of db reads and writes without executing it, so tooling can
+// invalidate exactly those keys. db is a query which is not executed yet, e.g. db.Model(&User{}).Where("id IN (?)", ids),
+// and the query is fingerprinted as if it's run by Find with the model as dest.
+// table is the table name used in keys, keys are primary cache keys, which are only used when the query filters by
+// primary keys alone, and searchKey is the search (or page) cache key. Keys of disabled cache levels are empty.
+func (c *Gorm2Cache) FingerprintQuery(db *gorm.DB) (table string, keys []string, searchKey string) {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// a session with context clones the statement, so db is left untouched
+	tx := db.Session(&gorm.Session{Context: ctx})
+	stmt := tx.Statement
+	if stmt.Model == nil {
+		stmt.Model = stmt.Dest
+	} else if stmt.Dest == nil {
+		stmt.Dest = stmt.Model
+	}
+	if stmt.Model != nil && stmt.Schema == nil {
+		if err := stmt.Parse(stmt.Model); err != nil {
+			c.Logger.CtxError(ctx, "[FingerprintQuery] parse model %T error: %v", stmt.Model, err)
+		}
+	}
+	if stmt.Dest != nil {
+		stmt.ReflectValue = reflect.Indirect(reflect.ValueOf(stmt.Dest))
+	}
+	if len(stmt.BuildClauses) == 0 {
+		stmt.BuildClauses = queryClauses
+	}
+	callbacks.BuildQuerySQL(tx)
+
+	table = c.getTableName(tx)
+	if c.Config.CacheLevel == config.CacheLevelAll || c.Config.CacheLevel == config.CacheLevelOnlySearch {
+		sql, vars := buildKeySQL(tx, c.Config.KeyIgnoredClauses)
+		searchKey = c.genQueryCacheKey(tx, table, sql, vars...)
+	}
+	if (c.Config.CacheLevel == config.CacheLevelAll || c.Config.CacheLevel == config.CacheLevelOnlyPrimary) &&
+		isModelDest(tx) && !hasOtherClauseExceptPrimaryField(tx) && !hasConflictingPrimaryConditions(tx) {
+		for _, primaryKey := range getPrimaryKeysFromWhereClause(tx) {
+			keys = append(keys, c.genPrimaryCacheKey(getStatementTableName(tx), primaryKey))
+		}
+	}
+	return table, keys, searchKey
+}
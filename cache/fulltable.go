@@ -0,0 +1,744 @@
+package cache
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asjdf/gorm-cache/util"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// fullTableLoadKey marks the query loading a full table, which must not be served from cache
+type fullTableLoadKey struct{}
+
+// fullTable is a table in FullTableCacheTables loaded entirely into process memory
+type fullTable struct {
+	schema *schema.Schema
+	rows   []reflect.Value // pointers to models, in ascending order of primary key
+}
+
+type fullTableEntry struct {
+	done      chan struct{}
+	table     *fullTable // nil if the table has more rows than CacheMaxItemCnt
+	loadedAt  time.Time
+	marker    string // key of the marker in storage written before loading
+	checkedAt int64  // unix ms when the marker was last found in storage
+}
+
+// fullTableCheckInterval in ms, the marker of a loaded table is checked in storage at most once within it,
+// so that invalidations by other processes take effect after it at most
+const fullTableCheckInterval = 1000
+
+// fullTableIndex keeps loaded tables, a table is dropped on invalidation and loaded again on next access
+type fullTableIndex struct {
+	mu      sync.Mutex
+	entries map[string]*fullTableEntry
+}
+
+func (f *fullTableIndex) forget(tableName string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.entries, tableName)
+}
+
+func (f *fullTableIndex) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries = nil
+}
+
+func (c *Gorm2Cache) isFullTable(tableName string) bool {
+	return util.ContainString(tableName, c.Config.FullTableCacheTables)
+}
+
+// WarmUpFullTables loads tables of models in FullTableCacheTables into memory, so that the first queries
+// on them don't have to wait for loading
+func (c *Gorm2Cache) WarmUpFullTables(ctx context.Context, models ...interface{}) error {
+	if c.db == nil {
+		return fmt.Errorf("cache is not used by any db")
+	}
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: c.db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		tableName := stmt.Schema.Table
+		if c.Config.TableNameResolver != nil {
+			tableName = c.Config.TableNameResolver(tableName)
+		}
+		if !c.isFullTable(tableName) {
+			return fmt.Errorf("table %s is not in FullTableCacheTables", tableName)
+		}
+		if _, err := c.fullTable(ctx, tableName, stmt.Schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fullTable returns the loaded table, which is loaded if it's not yet, has been loaded for more than CacheTTL, or
+// its marker is gone from storage. nil is returned if the table has more rows than CacheMaxItemCnt.
+func (c *Gorm2Cache) fullTable(ctx context.Context, tableName string, sch *schema.Schema) (*fullTable, error) {
+	f := &c.fullTables
+	f.mu.Lock()
+	if entry, ok := f.entries[tableName]; ok {
+		f.mu.Unlock()
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		ttl := time.Duration(c.Config.CacheTTL) * time.Millisecond
+		if (ttl <= 0 || time.Since(entry.loadedAt) < ttl) && c.fullTableMarked(ctx, tableName, entry) {
+			return entry.table, nil
+		}
+		f.mu.Lock()
+		if f.entries[tableName] == entry {
+			delete(f.entries, tableName)
+		}
+		f.mu.Unlock()
+		return c.fullTable(ctx, tableName, sch)
+	}
+	entry := &fullTableEntry{done: make(chan struct{})}
+	if f.entries == nil {
+		f.entries = make(map[string]*fullTableEntry)
+	}
+	f.entries[tableName] = entry
+	f.mu.Unlock()
+
+	// the marker is written before loading, so that invalidations during loading delete it
+	entry.marker = util.GenFullTableMarkerKey(c.tableKeyPrefix(tableName), tableName)
+	err := c.storageOf(tableName).SetKey(ctx, util.Kv{Key: entry.marker, Value: "1"})
+	var table *fullTable
+	if err != nil {
+		c.Logger.CtxError(ctx, "[fullTable] set marker of table %s error: %v", tableName, err)
+	} else {
+		entry.checkedAt = time.Now().UnixMilli()
+		table, err = c.loadFullTable(ctx, tableName, sch)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	defer close(entry.done)
+	if err != nil {
+		// waiting queries go to database, the table is loaded again on next access
+		if f.entries[tableName] == entry {
+			delete(f.entries, tableName)
+		}
+		return nil, err
+	}
+	if f.entries[tableName] != entry {
+		// invalidated while loading, rows may be outdated, the next access loads it again
+		return nil, nil
+	}
+	entry.table = table
+	entry.loadedAt = time.Now()
+	return table, nil
+}
+
+// fullTableMarked checks if the marker of the loaded table is still in storage. Invalidations of search cache by
+// any process sharing the storage delete it, and bumping the table version moves it, so the table is loaded again.
+func (c *Gorm2Cache) fullTableMarked(ctx context.Context, tableName string, entry *fullTableEntry) bool {
+	now := time.Now().UnixMilli()
+	if now-atomic.LoadInt64(&entry.checkedAt) < fullTableCheckInterval {
+		return true
+	}
+	marker := util.GenFullTableMarkerKey(c.tableKeyPrefix(tableName), tableName)
+	if marker != entry.marker {
+		return false
+	}
+	exists, err := c.storageOf(tableName).KeyExists(ctx, marker)
+	if err != nil {
+		c.Logger.CtxError(ctx, "[fullTable] check marker of table %s error: %v", tableName, err)
+		return false
+	}
+	if exists {
+		atomic.StoreInt64(&entry.checkedAt, now)
+	}
+	return exists
+}
+
+func (c *Gorm2Cache) loadFullTable(ctx context.Context, tableName string, sch *schema.Schema) (*fullTable, error) {
+	rows := reflect.New(reflect.SliceOf(reflect.PtrTo(sch.ModelType)))
+	tx := c.db.Session(&gorm.Session{NewDB: true, Context: context.WithValue(ctx, fullTableLoadKey{}, true)}).
+		Model(reflect.New(sch.ModelType).Interface())
+	if field := sch.PrioritizedPrimaryField; field != nil {
+		tx = tx.Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}})
+	}
+	if err := tx.Find(rows.Interface()).Error; err != nil {
+		c.Logger.CtxError(ctx, "[loadFullTable] load table %s error: %v", tableName, err)
+		return nil, err
+	}
+	cnt := rows.Elem().Len()
+	if c.Config.CacheMaxItemCnt != 0 && int64(cnt) > c.Config.CacheMaxItemCnt {
+		c.Logger.CtxInfo(ctx, "[loadFullTable] table %s has %d rows, more than max item count, not loaded",
+			tableName, cnt)
+		return nil, nil
+	}
+	table := &fullTable{schema: sch, rows: make([]reflect.Value, 0, cnt)}
+	for i := 0; i < cnt; i++ {
+		table.rows = append(table.rows, rows.Elem().Index(i))
+	}
+	c.Logger.CtxInfo(ctx, "[loadFullTable] table %s loaded with %d rows", tableName, cnt)
+	return table, nil
+}
+
+func isFullTableLoad(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	load, _ := ctx.Value(fullTableLoadKey{}).(bool)
+	return load
+}
+
+var fullTableClauses = map[string]struct{}{"SELECT": {}, "FROM": {}, "WHERE": {}, "ORDER BY": {}, "LIMIT": {}}
+
+// tryFullTable serves the query of db by filtering, ordering and limiting rows of the loaded table in memory,
+// it returns false if the query can't be evaluated in memory, e.g. it joins other tables or its conditions
+// are more than comparisons of columns with values
+func (c *Gorm2Cache) tryFullTable(ctx context.Context, db *gorm.DB, tableName string) bool {
+	stmt := db.Statement
+	if !isModelDest(db) || stmt.Distinct || len(stmt.Joins) > 0 || stmt.TableExpr != nil ||
+		stmt.Table != stmt.Schema.Table || stmt.Unscoped {
+		c.explain(db, "query can't be evaluated on full table cache")
+		return false
+	}
+	for name := range stmt.Clauses {
+		if _, ok := fullTableClauses[name]; !ok {
+			c.explain(db, "%s clause can't be evaluated on full table cache", name)
+			return false
+		}
+	}
+	table, err := c.fullTable(ctx, tableName, stmt.Schema)
+	if err != nil || table == nil {
+		c.explain(db, "table isn't loaded in full table cache")
+		return false
+	}
+	if table.schema != stmt.Schema {
+		c.explain(db, "query can't be evaluated on full table cache")
+		return false
+	}
+
+	var exprs []clause.Expression
+	if cla, ok := stmt.Clauses["WHERE"]; ok {
+		where, ok := cla.Expression.(clause.Where)
+		if !ok {
+			c.explain(db, "conditions can't be evaluated on full table cache")
+			return false
+		}
+		exprs = where.Exprs
+	}
+	e := &fullTableEval{ctx: ctx, schema: table.schema, tableName: stmt.Schema.Table, ok: true,
+		binaryStrings: c.Config.FullTableBinaryCollation}
+	rows := make([]reflect.Value, 0)
+	for _, row := range table.rows {
+		if e.where(row.Elem(), exprs) == truthTrue {
+			rows = append(rows, row)
+		}
+	}
+	rows = e.orderBy(rows, stmt)
+	if !e.ok {
+		c.explain(db, "conditions or order can't be evaluated on full table cache")
+		return false
+	}
+	if cla, ok := stmt.Clauses["LIMIT"]; ok {
+		if limit, ok := cla.Expression.(clause.Limit); ok {
+			if limit.Offset > 0 {
+				if limit.Offset >= len(rows) {
+					rows = rows[:0]
+				} else {
+					rows = rows[limit.Offset:]
+				}
+			}
+			if limit.Limit != nil && *limit.Limit >= 0 && *limit.Limit < len(rows) {
+				rows = rows[:*limit.Limit]
+			}
+		}
+	}
+
+	var value interface{}
+	switch reflect.Indirect(reflect.ValueOf(stmt.Dest)).Kind() {
+	case reflect.Struct:
+		if len(rows) == 0 {
+			db.RowsAffected = 0
+			if stmt.RaiseErrorOnNotFound {
+				db.Error = util.RecordNotFoundCacheHit
+			} else {
+				resetDest(db)
+				db.Error = util.SearchCacheHit
+			}
+			c.explain(db, "served by full table cache, no row matches")
+			return true
+		}
+		rows = rows[:1]
+		value = rows[0].Interface()
+	case reflect.Slice, reflect.Array:
+		objects := make([]interface{}, 0, len(rows))
+		for _, row := range rows {
+			objects = append(objects, row.Interface())
+		}
+		value = objects
+	default:
+		return false
+	}
+	data, err := c.jsonCodec().Marshal(value)
+	if err == nil {
+		err = c.jsonCodec().Unmarshal(data, stmt.Dest)
+	}
+	if err != nil {
+		c.Logger.CtxError(ctx, "[tryFullTable] copy rows of table %s error: %v", tableName, err)
+		c.explain(db, "copy rows of full table cache error: %v", err)
+		return false
+	}
+	db.RowsAffected = int64(len(rows))
+	db.Error = util.SearchCacheHit
+	c.explain(db, "served by full table cache, %d rows match", len(rows))
+	return true
+}
+
+// truth is the result of a condition in SQL, which is unknown if NULL is compared
+type truth int8
+
+const (
+	truthFalse truth = iota
+	truthTrue
+	truthUnknown
+)
+
+func (t truth) not() truth {
+	switch t {
+	case truthTrue:
+		return truthFalse
+	case truthFalse:
+		return truthTrue
+	default:
+		return truthUnknown
+	}
+}
+
+func (t truth) and(u truth) truth {
+	switch {
+	case t == truthFalse || u == truthFalse:
+		return truthFalse
+	case t == truthTrue && u == truthTrue:
+		return truthTrue
+	default:
+		return truthUnknown
+	}
+}
+
+func (t truth) or(u truth) truth {
+	switch {
+	case t == truthTrue || u == truthTrue:
+		return truthTrue
+	case t == truthFalse && u == truthFalse:
+		return truthFalse
+	default:
+		return truthUnknown
+	}
+}
+
+// fullTableEval evaluates conditions and order of a query on rows, ok turns false once anything can't be evaluated
+type fullTableEval struct {
+	ctx           context.Context
+	schema        *schema.Schema
+	tableName     string
+	ok            bool
+	binaryStrings bool // strings are compared byte by byte like binary collations
+}
+
+// where evaluates exprs of WHERE clause, which are joined by AND except single OR conditions, like gorm builds them
+func (e *fullTableEval) where(row reflect.Value, exprs []clause.Expression) truth {
+	if len(exprs) == 0 {
+		return truthTrue
+	}
+	if or, ok := exprs[0].(clause.OrConditions); ok && len(or.Exprs) == 1 {
+		// gorm moves it behind the first other condition
+		e.ok = false
+		return truthFalse
+	}
+	return e.join(row, exprs, false)
+}
+
+// join evaluates exprs joined by AND, or by OR if isOr, a single OR condition among them is joined by OR
+func (e *fullTableEval) join(row reflect.Value, exprs []clause.Expression, isOr bool) truth {
+	// AND binds tighter than OR, so exprs are split into groups joined by AND
+	result, group := truthFalse, truthTrue
+	for i, expr := range exprs {
+		if single, ok := expr.(clause.OrConditions); ok && len(single.Exprs) == 1 && i > 0 && !isOr {
+			result = result.or(group)
+			group = e.eval(row, single.Exprs[0])
+			continue
+		}
+		if isOr {
+			result = result.or(e.eval(row, expr))
+		} else {
+			group = group.and(e.eval(row, expr))
+		}
+	}
+	if isOr {
+		return result
+	}
+	return result.or(group)
+}
+
+func (e *fullTableEval) eval(row reflect.Value, expr clause.Expression) truth {
+	switch v := expr.(type) {
+	case clause.AndConditions:
+		return e.join(row, v.Exprs, false)
+	case clause.OrConditions:
+		return e.join(row, v.Exprs, true)
+	case clause.NotConditions:
+		res := truthTrue
+		for _, expr := range v.Exprs {
+			res = res.and(e.eval(row, expr).not())
+		}
+		return res
+	case clause.Eq:
+		return e.compare(row, v.Column, "=", v.Value)
+	case clause.Neq:
+		return e.compare(row, v.Column, "<>", v.Value)
+	case clause.Gt:
+		return e.compare(row, v.Column, ">", v.Value)
+	case clause.Gte:
+		return e.compare(row, v.Column, ">=", v.Value)
+	case clause.Lt:
+		return e.compare(row, v.Column, "<", v.Value)
+	case clause.Lte:
+		return e.compare(row, v.Column, "<=", v.Value)
+	case clause.IN:
+		return e.in(row, v.Column, v.Values)
+	case clause.Expr:
+		return e.expr(row, v)
+	}
+	e.ok = false
+	return truthFalse
+}
+
+var simpleExprRegexp = regexp.MustCompile(`^([\w.` + "`" + `"]+) ?(=|<>|!=|<=|>=|<|>|not in|in|is not null|is null) ?(\(\?\)|\?)?$`)
+
+// expr evaluates conditions like "column op ?", "column IN (?)" and "column IS NULL"
+func (e *fullTableEval) expr(row reflect.Value, expr clause.Expr) truth {
+	sql := strings.ToLower(strings.Join(strings.Fields(expr.SQL), " "))
+	sql = strings.NewReplacer(" (", "(", "( ", "(", " )", ")").Replace(sql)
+	sql = strings.Replace(sql, "in(", "in (", 1)
+	matches := simpleExprRegexp.FindStringSubmatch(sql)
+	if matches == nil {
+		e.ok = false
+		return truthFalse
+	}
+	column, op, placeholder := matches[1], matches[2], matches[3]
+	switch op {
+	case "is null", "is not null":
+		if placeholder != "" || len(expr.Vars) != 0 {
+			e.ok = false
+			return truthFalse
+		}
+		value, ok := e.value(row, column)
+		if !ok {
+			return truthFalse
+		}
+		if (value == nil) == (op == "is null") {
+			return truthTrue
+		}
+		return truthFalse
+	case "in", "not in":
+		if placeholder == "" || len(expr.Vars) != 1 {
+			e.ok = false
+			return truthFalse
+		}
+		values, ok := sliceValues(expr.Vars[0])
+		if !ok {
+			e.ok = false
+			return truthFalse
+		}
+		res := e.in(row, column, values)
+		if op == "not in" {
+			return res.not()
+		}
+		return res
+	}
+	if placeholder != "?" || len(expr.Vars) != 1 {
+		e.ok = false
+		return truthFalse
+	}
+	if _, ok := sliceValues(expr.Vars[0]); ok {
+		e.ok = false
+		return truthFalse
+	}
+	return e.compare(row, column, op, expr.Vars[0])
+}
+
+func (e *fullTableEval) in(row reflect.Value, column interface{}, values []interface{}) truth {
+	res := truthFalse
+	for _, value := range values {
+		res = res.or(e.compare(row, column, "=", value))
+	}
+	return res
+}
+
+func (e *fullTableEval) compare(row reflect.Value, column interface{}, op string, value interface{}) truth {
+	fieldValue, ok := e.value(row, column)
+	if !ok {
+		return truthFalse
+	}
+	value = normalizeValue(value)
+	if value == nil && (op == "=" || op == "<>") {
+		// gorm builds IS NULL and IS NOT NULL for them
+		if (fieldValue == nil) == (op == "=") {
+			return truthTrue
+		}
+		return truthFalse
+	}
+	if fieldValue == nil || value == nil {
+		return truthUnknown
+	}
+	cmp, ok := compareValues(fieldValue, value, e.binaryStrings)
+	if !ok {
+		e.ok = false
+		return truthFalse
+	}
+	var res bool
+	switch op {
+	case "=":
+		res = cmp == 0
+	case "<>", "!=":
+		res = cmp != 0
+	case "<":
+		res = cmp < 0
+	case "<=":
+		res = cmp <= 0
+	case ">":
+		res = cmp > 0
+	case ">=":
+		res = cmp >= 0
+	}
+	if res {
+		return truthTrue
+	}
+	return truthFalse
+}
+
+// value returns normalized value of column in row
+func (e *fullTableEval) value(row reflect.Value, column interface{}) (interface{}, bool) {
+	var name string
+	switch v := column.(type) {
+	case string:
+		name = v
+	case clause.Column:
+		if v.Raw || (v.Table != "" && v.Table != clause.CurrentTable && v.Table != e.tableName) {
+			e.ok = false
+			return nil, false
+		}
+		name = v.Name
+	default:
+		e.ok = false
+		return nil, false
+	}
+	var field *schema.Field
+	if name == clause.PrimaryKey {
+		field = e.schema.PrioritizedPrimaryField
+	} else {
+		name = strings.Trim(name, "`\"")
+		if pos := strings.LastIndex(name, "."); pos >= 0 {
+			if strings.Trim(name[:pos], "`\"") != e.tableName {
+				e.ok = false
+				return nil, false
+			}
+			name = strings.Trim(name[pos+1:], "`\"")
+		}
+		field = e.schema.LookUpField(name)
+	}
+	if field == nil {
+		e.ok = false
+		return nil, false
+	}
+	value, _ := field.ValueOf(e.ctx, row)
+	return normalizeValue(value), true
+}
+
+// orderBy sorts rows by ORDER BY clause, rows are kept in order of primary key if there isn't one
+func (e *fullTableEval) orderBy(rows []reflect.Value, stmt *gorm.Statement) []reflect.Value {
+	cla, ok := stmt.Clauses["ORDER BY"]
+	if !ok {
+		return rows
+	}
+	orderBy, ok := cla.Expression.(clause.OrderBy)
+	if !ok || orderBy.Expression != nil {
+		e.ok = false
+		return rows
+	}
+	type orderColumn struct {
+		column clause.Column
+		desc   bool
+	}
+	columns := make([]orderColumn, 0, len(orderBy.Columns))
+	for _, col := range orderBy.Columns {
+		if !col.Column.Raw {
+			columns = append(columns, orderColumn{column: col.Column, desc: col.Desc})
+			continue
+		}
+		// e.g. Order("value1 desc, id")
+		for _, part := range strings.Split(col.Column.Name, ",") {
+			fields := strings.Fields(strings.ToLower(part))
+			if len(fields) == 0 || len(fields) > 2 || (len(fields) == 2 && fields[1] != "asc" && fields[1] != "desc") {
+				e.ok = false
+				return rows
+			}
+			columns = append(columns, orderColumn{
+				column: clause.Column{Name: fields[0]},
+				desc:   col.Desc || (len(fields) == 2 && fields[1] == "desc"),
+			})
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, col := range columns {
+			a, okA := e.value(rows[i].Elem(), col.column)
+			b, okB := e.value(rows[j].Elem(), col.column)
+			if !okA || !okB || a == nil || b == nil {
+				// databases differ in where NULL goes
+				e.ok = false
+				return false
+			}
+			cmp, ok := compareValues(a, b, e.binaryStrings)
+			if !ok {
+				e.ok = false
+				return false
+			}
+			if cmp != 0 {
+				return (cmp < 0) != col.desc
+			}
+		}
+		return false
+	})
+	return rows
+}
+
+// normalizeValue converts v into nil, int64, float64, string or time.Time, or returns it as is if it can't
+func normalizeValue(v interface{}) interface{} {
+	if valuer, ok := v.(driver.Valuer); ok {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return nil
+		}
+		value, err := valuer.Value()
+		if err != nil {
+			return v
+		}
+		v = value
+	}
+	if v == nil {
+		return nil
+	}
+	if t, ok := v.(time.Time); ok {
+		return t
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u := rv.Uint(); u <= 1<<63-1 {
+			return int64(u)
+		}
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.Bool:
+		// databases keep booleans as 0 and 1
+		if rv.Bool() {
+			return int64(1)
+		}
+		return int64(0)
+	case reflect.String:
+		return rv.String()
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes())
+		}
+	}
+	if t, ok := rv.Interface().(time.Time); ok {
+		return t
+	}
+	return rv.Interface()
+}
+
+// compareValues compares normalized values, ok is false if they aren't comparable in the same way as in database.
+// Strings are compared only if binaryStrings, since databases compare them by collation, which may be case
+// insensitive, e.g. the default ones of MySQL.
+func compareValues(a, b interface{}, binaryStrings bool) (int, bool) {
+	switch x := a.(type) {
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			return compareOrdered(x, y), true
+		case float64:
+			return compareOrdered(float64(x), y), true
+		}
+	case float64:
+		switch y := b.(type) {
+		case int64:
+			return compareOrdered(x, float64(y)), true
+		case float64:
+			return compareOrdered(x, y), true
+		}
+	case string:
+		if y, ok := b.(string); ok && binaryStrings {
+			return strings.Compare(x, y), true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			switch {
+			case x.Before(y):
+				return -1, true
+			case x.After(y):
+				return 1, true
+			default:
+				return 0, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func compareOrdered[T int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// sliceValues returns elements of v if it's a slice or array other than []byte
+func sliceValues(v interface{}) ([]interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	if rv.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	values := make([]interface{}, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		values = append(values, rv.Index(i).Interface())
+	}
+	return values, true
+}
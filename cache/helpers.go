@@ -2,20 +2,177 @@ package cache
 
 import (
 	"context"
+	"database/sql/driver"
+	"errors"
 	"fmt"
 	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/asjdf/gorm-cache/util"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
+// buildKeySQL returns sql and vars used for key generation. Clauses listed in ignoredClauses
+// are left out, and gorm:query_option is appended since it is not part of the built sql.
+func buildKeySQL(db *gorm.DB, ignoredClauses []string) (string, []interface{}) {
+	sql, vars := db.Statement.SQL.String(), db.Statement.Vars
+
+	ignored := false
+	for _, name := range ignoredClauses {
+		if _, ok := db.Statement.Clauses[name]; ok {
+			ignored = true
+			break
+		}
+	}
+	if ignored && len(db.Statement.BuildClauses) > 0 {
+		stmt := &gorm.Statement{
+			DB:       db,
+			ConnPool: db.Statement.ConnPool,
+			Context:  db.Statement.Context,
+			Schema:   db.Statement.Schema,
+			Table:    db.Statement.Table,
+			Clauses:  make(map[string]clause.Clause, len(db.Statement.Clauses)),
+		}
+		for name, c := range db.Statement.Clauses {
+			if !util.ContainString(name, ignoredClauses) {
+				stmt.Clauses[name] = c
+			}
+		}
+		stmt.Build(db.Statement.BuildClauses...)
+		sql, vars = stmt.SQL.String(), stmt.Vars
+	}
+
+	if option, ok := db.Get("gorm:query_option"); ok {
+		sql += " " + fmt.Sprint(option)
+	}
+	return sql, vars
+}
+
+// isPointerDest checks if Dest is a non-nil pointer, which is required to unmarshal cached results into
+func isPointerDest(db *gorm.DB) bool {
+	if db.Statement.Dest == nil {
+		return false
+	}
+	destValue := reflect.ValueOf(db.Statement.Dest)
+	return destValue.Kind() == reflect.Ptr && !destValue.IsNil()
+}
+
+// isModelDest checks if query loads complete rows of the statement's model, only then results can be
+// cached (and served) by primary key. Results of aggregates, Count, Pluck, partial selects or queries
+// scanning into other types can only be cached as a whole in search cache.
+func isModelDest(db *gorm.DB) bool {
+	if db.Statement.Schema == nil || db.Statement.Dest == nil {
+		return false
+	}
+	destType := reflect.TypeOf(db.Statement.Dest)
+	for destType.Kind() == reflect.Ptr || destType.Kind() == reflect.Slice || destType.Kind() == reflect.Array {
+		destType = destType.Elem()
+	}
+	if destType != db.Statement.Schema.ModelType {
+		return false
+	}
+	if len(db.Statement.Omits) > 0 {
+		return false
+	}
+	for _, sel := range db.Statement.Selects {
+		if sel != "*" {
+			return false
+		}
+	}
+	return !isAggregateQuery(db)
+}
+
+var aggregateFuncs = []string{"count(", "sum(", "avg(", "min(", "max(", "group_concat(", "string_agg("}
+
+// isAggregateQuery checks if query groups rows or selects aggregate functions
+func isAggregateQuery(db *gorm.DB) bool {
+	if _, ok := db.Statement.Clauses["GROUP BY"]; ok {
+		return true
+	}
+	cla, ok := db.Statement.Clauses["SELECT"]
+	if !ok {
+		return false
+	}
+	sel, ok := cla.Expression.(clause.Select)
+	if !ok {
+		return false
+	}
+	selectSQL := make([]string, 0, len(sel.Columns)+1)
+	for _, column := range sel.Columns {
+		selectSQL = append(selectSQL, column.Name)
+	}
+	if expr, ok := sel.Expression.(clause.Expr); ok {
+		selectSQL = append(selectSQL, expr.SQL)
+	}
+	for _, str := range selectSQL {
+		str = strings.Replace(strings.ToLower(str), " ", "", -1)
+		for _, fn := range aggregateFuncs {
+			if strings.Contains(str, fn) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasLockingClause checks if query is a locking read (e.g. FOR UPDATE), which must always read the database
+func hasLockingClause(db *gorm.DB) bool {
+	_, ok := db.Statement.Clauses["FOR"]
+	return ok
+}
+
+// isUpsert checks if create may update existing rows on conflict (e.g. ON CONFLICT DO UPDATE, ON DUPLICATE KEY UPDATE)
+func isUpsert(db *gorm.DB) bool {
+	cla, ok := db.Statement.Clauses["ON CONFLICT"]
+	if !ok {
+		return false
+	}
+	onConflict, ok := cla.Expression.(clause.OnConflict)
+	return !ok || !onConflict.DoNothing
+}
+
 // getPrimaryKeysFromWhereClause try to find primary keys from Eq and IN exprs in WHERE clause,
-// and get objects that are being operated
+// and get objects that are being operated. Keys of models with composite primary keys are generated
+// by genCompositeKey, see getCompositeKeysFromWhereClause.
 func getPrimaryKeysFromWhereClause(db *gorm.DB) []string {
-	primaryKeys := make([]string, 0)
+	names := primaryFieldNames(db)
+	switch len(names) {
+	case 0:
+		return nil
+	case 1:
+		return getColumnValuesFromWhereClause(db, names[0])
+	}
+	return getCompositeKeysFromWhereClause(db, names)
+}
+
+// primaryFieldNames returns db names of primary fields of the statement's model
+func primaryFieldNames(db *gorm.DB) []string {
+	if db.Statement.Schema == nil {
+		return nil
+	}
+	return db.Statement.Schema.PrimaryFieldDBNames
+}
+
+// getColumnValuesFromWhereClause try to find values of column dbName from Eq and IN exprs in WHERE clause
+func getColumnValuesFromWhereClause(db *gorm.DB, dbName string) []string {
+	values := make([]string, 0)
+	for _, expr := range getWhereExprs(db) {
+		name, colValues, ok := getColumnCondition(expr)
+		if ok && name == dbName {
+			values = append(values, colValues...)
+		}
+	}
+	return uniqueStringSlice(values)
+}
 
+func getWhereExprs(db *gorm.DB) []clause.Expression {
 	cla, ok := db.Statement.Clauses["WHERE"]
 	if !ok {
 		return nil
@@ -24,49 +181,223 @@ func getPrimaryKeysFromWhereClause(db *gorm.DB) []string {
 	if !ok {
 		return nil
 	}
-	dbName := ""
-	if db.Statement.Schema == nil {
-		return nil
+	return where.Exprs
+}
+
+// getColumnCondition returns column and values of expr if it's an Eq or IN condition of a single column
+func getColumnCondition(expr clause.Expression) (name string, values []string, ok bool) {
+	switch v := expr.(type) {
+	case clause.Eq:
+		name = getColNameFromColumn(v.Column)
+		return name, []string{keyString(v.Value)}, name != ""
+	case clause.IN:
+		name = getColNameFromColumn(v.Column)
+		for _, val := range v.Values {
+			values = append(values, keyString(val))
+		}
+		return name, values, name != ""
+	case clause.Expr:
+		ttype := getExprType(v)
+		if ttype == "in" || ttype == "eq" {
+			return getColNameFromExpr(v, ttype), getPrimaryKeysFromExpr(v, ttype), true
+		}
 	}
-	for _, field := range db.Statement.Schema.Fields {
-		if field.PrimaryKey {
-			dbName = field.DBName
-			break
+	return "", nil, false
+}
+
+// getCompositeKeysFromWhereClause try to find composite primary keys of fields names from WHERE clause.
+// Keys are told by Eq conditions on every field, optionally with one of them replaced by an IN condition,
+// or by a row value IN condition on the fields, e.g. (a, b) IN ((1, 2), (3, 4)). Other combinations,
+// e.g. IN conditions on several fields, don't tell which values go together, so no key is returned.
+func getCompositeKeysFromWhereClause(db *gorm.DB, names []string) []string {
+	fixed := make(map[string]string, len(names))
+	var listName string
+	var list []string
+	var tuples [][]string
+	for _, expr := range getWhereExprs(db) {
+		if rows, ok := getTupleValues(expr, names); ok {
+			if tuples != nil {
+				return nil
+			}
+			tuples = rows
+			continue
+		}
+		name, values, ok := getColumnCondition(expr)
+		if !ok || !util.ContainString(name, names) {
+			continue
+		}
+		values = uniqueStringSlice(values)
+		if len(values) == 1 {
+			if v, ok := fixed[name]; ok && v != values[0] {
+				return nil
+			}
+			fixed[name] = values[0]
+			continue
+		}
+		if listName != "" {
+			return nil
 		}
+		listName, list = name, values
 	}
-	if len(dbName) == 0 {
+
+	keys := make([]string, 0)
+	if tuples != nil {
+		if len(fixed) > 0 || listName != "" {
+			return nil
+		}
+		for _, row := range tuples {
+			keys = append(keys, genCompositeKey(row))
+		}
+		return uniqueStringSlice(keys)
+	}
+	if _, ok := fixed[listName]; ok {
 		return nil
 	}
-	for _, expr := range where.Exprs {
-		eqExpr, ok := expr.(clause.Eq)
-		if ok {
-			if getColNameFromColumn(eqExpr.Column) == dbName {
-				primaryKeys = append(primaryKeys, fmt.Sprintf("%v", eqExpr.Value))
+	if listName == "" {
+		list = []string{""}
+	}
+	for _, listValue := range list {
+		row := make([]string, 0, len(names))
+		for _, name := range names {
+			if name == listName {
+				row = append(row, listValue)
+				continue
+			}
+			v, ok := fixed[name]
+			if !ok {
+				return nil
 			}
+			row = append(row, v)
+		}
+		keys = append(keys, genCompositeKey(row))
+	}
+	return keys
+}
+
+// hasConflictingPrimaryConditions checks if several conditions restrict one primary field to different values,
+// e.g. id IN (1, 2) AND id IN (2, 3). The query only gets rows matching all of them, while keys are told by
+// putting their values together, so primary cache can't serve it.
+func hasConflictingPrimaryConditions(db *gorm.DB) bool {
+	names := primaryFieldNames(db)
+	conditions := make(map[string]string, len(names))
+	for _, expr := range getWhereExprs(db) {
+		name, values, ok := getColumnCondition(expr)
+		if !ok || !util.ContainString(name, names) {
 			continue
 		}
-		inExpr, ok := expr.(clause.IN)
-		if ok {
-			if getColNameFromColumn(inExpr.Column) == dbName {
-				for _, val := range inExpr.Values {
-					primaryKeys = append(primaryKeys, fmt.Sprintf("%v", val))
-				}
+		values = uniqueStringSlice(values)
+		sort.Strings(values)
+		joined := strings.Join(values, ",")
+		if prev, ok := conditions[name]; ok && prev != joined {
+			return true
+		}
+		conditions[name] = joined
+	}
+	return false
+}
+
+var tupleInRegexp = regexp.MustCompile(`^\(([^()]+)\)in(.+)$`)
+
+// getTupleValues returns values of row value IN condition expr on fields names, ordered as names, e.g.
+// [[1 2] [3 4]] for (a, b) IN ((1, 2), (3, 4)). ok is false if expr isn't such a condition.
+func getTupleValues(expr clause.Expression, names []string) (rows [][]string, ok bool) {
+	var columns []string
+	var values []interface{}
+	switch v := expr.(type) {
+	case clause.IN:
+		cols, isCols := v.Column.([]clause.Column)
+		if !isCols {
+			return nil, false
+		}
+		for _, col := range cols {
+			columns = append(columns, col.Name)
+		}
+		values = v.Values
+	case clause.Expr:
+		match := tupleInRegexp.FindStringSubmatch(strings.Replace(strings.ToLower(v.SQL), " ", "", -1))
+		if match == nil {
+			return nil, false
+		}
+		for _, col := range strings.Split(match[1], ",") {
+			if pos := strings.LastIndex(col, "."); pos >= 0 {
+				col = col[pos+1:]
 			}
+			columns = append(columns, strings.Trim(col, "`\""))
 		}
-		exprStruct, ok := expr.(clause.Expr)
-		if ok {
-			ttype := getExprType(exprStruct)
-			//fmt.Printf("expr: %+v, ttype: %s\n", exprStruct, ttype)
-			if ttype == "in" || ttype == "eq" {
-				fieldName := getColNameFromExpr(exprStruct, ttype)
-				if fieldName == dbName {
-					pKeys := getPrimaryKeysFromExpr(exprStruct, ttype)
-					primaryKeys = append(primaryKeys, pKeys...)
-				}
+		switch {
+		case (match[2] == "?" || match[2] == "(?)") && len(v.Vars) == 1:
+			// (a, b) IN ? with [][]interface{}{{1, 2}, {3, 4}}
+			list := reflect.Indirect(reflect.ValueOf(v.Vars[0]))
+			if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+				return nil, false
+			}
+			for i := 0; i < list.Len(); i++ {
+				values = append(values, list.Index(i).Interface())
 			}
+		case strings.Count(match[2], "?") == len(v.Vars) && strings.Trim(match[2], "(),?") == "":
+			// (a, b) IN ((?, ?), (?, ?)) with flat vars
+			if len(v.Vars)%len(columns) != 0 {
+				return nil, false
+			}
+			for i := 0; i < len(v.Vars); i += len(columns) {
+				values = append(values, v.Vars[i:i+len(columns)])
+			}
+		default:
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	// columns must be the fields in any order
+	if len(columns) != len(names) {
+		return nil, false
+	}
+	positions := make([]int, len(columns))
+	seen := make(map[string]struct{}, len(columns))
+	for i, col := range columns {
+		positions[i] = -1
+		for j, name := range names {
+			if col == name {
+				positions[i] = j
+			}
+		}
+		if _, dup := seen[col]; dup || positions[i] < 0 {
+			return nil, false
+		}
+		seen[col] = struct{}{}
+	}
+	for _, value := range values {
+		tuple := reflect.Indirect(reflect.ValueOf(value))
+		if (tuple.Kind() != reflect.Slice && tuple.Kind() != reflect.Array) || tuple.Len() != len(columns) {
+			return nil, false
+		}
+		row := make([]string, len(names))
+		for i := 0; i < tuple.Len(); i++ {
+			row[positions[i]] = keyString(tuple.Index(i).Interface())
 		}
+		rows = append(rows, row)
 	}
-	return uniqueStringSlice(primaryKeys)
+	return rows, true
+}
+
+// genCompositeKey generates primary key of values of composite primary fields, values are escaped,
+// so that e.g. ("a:b", "c") and ("a", "b:c") get different keys
+func genCompositeKey(values []string) string {
+	escaped := make([]string, 0, len(values))
+	for _, v := range values {
+		escaped = append(escaped, util.EscapeKeySegment(v))
+	}
+	return strings.Join(escaped, ":")
+}
+
+// isCanceledQuery checks if the query of db was aborted by cancellation or deadline of its context,
+// its result may be partial even without an error then
+func isCanceledQuery(db *gorm.DB) bool {
+	if errors.Is(db.Error, context.Canceled) || errors.Is(db.Error, context.DeadlineExceeded) {
+		return true
+	}
+	return db.Statement.Context != nil && db.Statement.Context.Err() != nil
 }
 
 func getColNameFromColumn(col interface{}) string {
@@ -81,49 +412,18 @@ func getColNameFromColumn(col interface{}) string {
 }
 
 func hasOtherClauseExceptPrimaryField(db *gorm.DB) bool {
-	cla, ok := db.Statement.Clauses["WHERE"]
-	if !ok {
-		return false
-	}
-	where, ok := cla.Expression.(clause.Where)
-	dbName := ""
-	for _, field := range db.Statement.Schema.Fields {
-		if field.PrimaryKey {
-			dbName = field.DBName
-		}
-	}
-	if len(dbName) == 0 {
+	names := primaryFieldNames(db)
+	if len(names) == 0 {
 		return true // return true to skip cache
 	}
-	for _, expr := range where.Exprs {
-		eqExpr, ok := expr.(clause.Eq)
-		if ok {
-			if getColNameFromColumn(eqExpr.Column) != dbName {
-				return true
-			}
+	for _, expr := range getWhereExprs(db) {
+		if _, ok := getTupleValues(expr, names); ok {
 			continue
 		}
-		inExpr, ok := expr.(clause.IN)
-		if ok {
-			if getColNameFromColumn(inExpr.Column) != dbName {
-				return true
-			}
-			continue
-		}
-		exprStruct, ok := expr.(clause.Expr)
-		if ok {
-			ttype := getExprType(exprStruct)
-			if ttype == "in" || ttype == "eq" {
-				fieldName := getColNameFromExpr(exprStruct, ttype)
-				if fieldName != dbName {
-					return true
-				}
-				continue
-			}
+		name, _, ok := getColumnCondition(expr)
+		if !ok || !util.ContainString(name, names) {
 			return true
 		}
-		fmt.Printf("expr: %+v\n", expr)
-		return true
 	}
 	return false
 }
@@ -194,7 +494,7 @@ func getPrimaryKeysFromExpr(expr clause.Expr, ttype string) []string {
 				}
 			} else if fields[1] == "(?)" {
 				for _, val := range expr.Vars {
-					primaryKeys = append(primaryKeys, fmt.Sprintf("%v", val))
+					primaryKeys = append(primaryKeys, keyString(val))
 				}
 			}
 		}
@@ -206,7 +506,7 @@ func getPrimaryKeysFromExpr(expr clause.Expr, ttype string) []string {
 				primaryKeys = append(primaryKeys, fields[1])
 			} else if fields[1] == "?" {
 				for _, val := range expr.Vars {
-					primaryKeys = append(primaryKeys, fmt.Sprintf("%v", val))
+					primaryKeys = append(primaryKeys, keyString(val))
 				}
 			}
 		}
@@ -215,10 +515,42 @@ func getPrimaryKeysFromExpr(expr clause.Expr, ttype string) []string {
 }
 
 func getObjectsAfterLoad(db *gorm.DB) (primaryKeys []string, objects []interface{}) {
+	return getObjectsOf(db, db.Statement.Dest)
+}
+
+// getPrimaryKeysOfWrite returns primary keys of rows written by db's statement before it's executed: the ones in
+// WHERE clause, or else the ones of its model (e.g. Model(&obj).Update(...), Save(&obj), Delete(&obj)), which gorm
+// adds to WHERE clause when executing it. It returns nil if keys of some rows are unknown.
+func getPrimaryKeysOfWrite(db *gorm.DB) []string {
+	if primaryKeys := getPrimaryKeysFromWhereClause(db); len(primaryKeys) > 0 {
+		return primaryKeys
+	}
+	if db.Statement.Model == nil {
+		return nil
+	}
+	count := 0
+	modelValue := reflect.Indirect(reflect.ValueOf(db.Statement.Model))
+	switch modelValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		count = modelValue.Len()
+	case reflect.Struct:
+		count = 1
+	}
+	primaryKeys, objects := getObjectsOf(db, db.Statement.Model)
+	if count == 0 || len(objects) != count || len(primaryKeys) != count {
+		// rows without primary keys are written by other conditions
+		return nil
+	}
+	return primaryKeys
+}
+
+// getObjectsOf returns objects in value, a struct or slice of structs of the statement's model, with their
+// primary keys. Objects without primary keys are skipped.
+func getObjectsOf(db *gorm.DB, value interface{}) (primaryKeys []string, objects []interface{}) {
 	primaryKeys = make([]string, 0)
 	values := make([]reflect.Value, 0)
 
-	destValue := reflect.Indirect(reflect.ValueOf(db.Statement.Dest))
+	destValue := reflect.Indirect(reflect.ValueOf(value))
 	switch destValue.Kind() {
 	case reflect.Slice, reflect.Array:
 		for i := 0; i < destValue.Len(); i++ {
@@ -229,24 +561,28 @@ func getObjectsAfterLoad(db *gorm.DB) (primaryKeys []string, objects []interface
 		values = append(values, destValue)
 	}
 
-	var valueOf func(context.Context, reflect.Value) (value interface{}, zero bool) = nil
+	var fields []*schema.Field
 	if db.Statement.Schema != nil {
-		for _, field := range db.Statement.Schema.Fields {
-			if field.PrimaryKey {
-				valueOf = field.ValueOf
-				break
-			}
-		}
+		fields = db.Statement.Schema.PrimaryFields
 	}
 
 	objects = make([]interface{}, 0, len(values))
+objectLoop:
 	for _, elemValue := range values {
-		if valueOf != nil {
-			primaryKey, isZero := valueOf(context.Background(), elemValue)
-			if isZero {
-				continue
+		if len(fields) > 0 {
+			keyValues := make([]string, 0, len(fields))
+			for _, field := range fields {
+				value, isZero := field.ValueOf(context.Background(), elemValue)
+				if isZero {
+					continue objectLoop
+				}
+				keyValues = append(keyValues, keyString(value))
+			}
+			if len(keyValues) == 1 {
+				primaryKeys = append(primaryKeys, keyValues[0])
+			} else {
+				primaryKeys = append(primaryKeys, genCompositeKey(keyValues))
 			}
-			primaryKeys = append(primaryKeys, fmt.Sprintf("%v", primaryKey))
 		}
 		objects = append(objects, elemValue.Interface())
 	}
@@ -270,10 +606,13 @@ func extractStringsFromVar(v interface{}) []string {
 	noPtrValue := reflect.Indirect(reflect.ValueOf(v))
 	switch noPtrValue.Kind() {
 	case reflect.Slice, reflect.Array:
+		if isScalarKey(noPtrValue) {
+			// e.g. uuid.UUID is a byte array, but a single key
+			return []string{keyString(v)}
+		}
 		ans := make([]string, 0)
 		for i := 0; i < noPtrValue.Len(); i++ {
-			obj := reflect.Indirect(noPtrValue.Index(i))
-			ans = append(ans, fmt.Sprintf("%v", obj))
+			ans = append(ans, keyString(noPtrValue.Index(i).Interface()))
 		}
 		return ans
 	case reflect.String:
@@ -281,6 +620,87 @@ func extractStringsFromVar(v interface{}) []string {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8,
 		reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		return []string{fmt.Sprintf("%d", noPtrValue.Interface())}
+	case reflect.Struct:
+		if isScalarKey(noPtrValue) {
+			// e.g. decimal.Decimal
+			return []string{keyString(v)}
+		}
 	}
 	return nil
 }
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// isScalarKey checks if value is a single key value though it may be a slice, array or struct, i.e. it's a []byte
+// or it has its own database or string form, e.g. uuid.UUID, decimal.Decimal or datatypes.JSON
+func isScalarKey(value reflect.Value) bool {
+	typ := value.Type()
+	if typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8 {
+		return true
+	}
+	ptrType := reflect.PtrTo(typ)
+	return ptrType.Implements(valuerType) || ptrType.Implements(stringerType)
+}
+
+// keyString formats a primary key value of a WHERE clause or an object the same way, so that keys of both match.
+// Types stored in database by driver.Valuer are formatted as their database values, e.g. uuid.UUID as its
+// canonical string form rather than its bytes, []byte as string, others like %v.
+func keyString(v interface{}) string {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return ""
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return ""
+	}
+	// methods of pointer receivers are called on a copy
+	ptr := reflect.New(value.Type())
+	ptr.Elem().Set(value)
+	if valuer, ok := ptr.Interface().(driver.Valuer); ok {
+		if dbValue, err := valuer.Value(); err == nil {
+			switch dv := dbValue.(type) {
+			case nil:
+				return ""
+			case []byte:
+				return string(dv)
+			case time.Time:
+				return dv.Format(time.RFC3339Nano)
+			default:
+				return fmt.Sprintf("%v", dv)
+			}
+		}
+	}
+	if b, ok := value.Interface().([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprintf("%v", value.Interface())
+}
+
+// chunkKvs splits kvs into chunks of at most size kvs
+func chunkKvs(kvs []util.Kv, size int64) [][]util.Kv {
+	chunks := make([][]util.Kv, 0, (int64(len(kvs))+size-1)/size)
+	for int64(len(kvs)) > size {
+		chunks = append(chunks, kvs[:size])
+		kvs = kvs[size:]
+	}
+	return append(chunks, kvs)
+}
+
+// pauseBetweenBatches waits for pause, or only yields the processor if pause is 0
+func pauseBetweenBatches(ctx context.Context, pause time.Duration) error {
+	if pause <= 0 {
+		runtime.Gosched()
+		return nil
+	}
+	timer := time.NewTimer(pause)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
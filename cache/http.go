@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/asjdf/gorm-cache/storage"
+	"gorm.io/gorm"
+)
+
+// TTLOf returns remaining ttl of the cache of the query run by db, e.g. the *gorm.DB returned by Find: its search
+// cache, or the primary cache expiring first of its primary keys if it was served by primary cache. 0 if the cache
+// never expires. It returns storage.ErrNotSupported if the storage can't tell, storage.ErrCacheNotFound if the
+// result isn't cached (yet, as it may be populated in background).
+func (c *Gorm2Cache) TTLOf(ctx context.Context, db *gorm.DB) (time.Duration, error) {
+	tableName := c.getTableName(db)
+	s, ok := c.routeStorage(tableName).(storage.TTLGetter)
+	if !ok {
+		return 0, storage.ErrNotSupported
+	}
+	keys := make([]string, 0)
+	if c.SourceOf(db) == SourcePrimaryCache {
+		for _, primaryKey := range getPrimaryKeysFromWhereClause(db) {
+			keys = append(keys, c.genPrimaryCacheKey(getStatementTableName(db), primaryKey))
+		}
+	} else if searchKey, ok := db.InstanceGet(c.stmtKey("search_key")); ok {
+		keys = append(keys, searchKey.(string))
+	}
+	if len(keys) == 0 {
+		return 0, storage.ErrCacheNotFound
+	}
+	var res time.Duration
+	for _, key := range keys {
+		ttl, err := s.TTL(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if ttl != 0 && (res == 0 || ttl < res) {
+			res = ttl
+		}
+	}
+	return res, nil
+}
+
+// WriteCacheHeaders sets headers of a REST handler serving a result which came from source, e.g. SourceOf(tx),
+// with ttl left, e.g. TTLOf(ctx, tx):
+//   - X-Cache is HIT if the result came from cache, else MISS
+//   - Cache-Control lets clients keep the result for ttl, no-cache if ttl is 0 or the result is stale
+//   - Age is how long the result has been cached, estimated by CacheTTL, only if it came from cache
+func (c *Gorm2Cache) WriteCacheHeaders(header http.Header, source Source, ttl time.Duration) {
+	if source.FromCache() {
+		header.Set("X-Cache", "HIT")
+	} else {
+		header.Set("X-Cache", "MISS")
+	}
+	if ttl <= 0 || source == SourceStaleCache {
+		header.Set("Cache-Control", "no-cache")
+		return
+	}
+	header.Set("Cache-Control", "max-age="+strconv.FormatInt(int64(ttl/time.Second), 10))
+	if source.FromCache() && c.Config.CacheTTL > 0 {
+		// ttl of cache is randomized around CacheTTL, the estimate never goes below 0
+		age := time.Duration(c.Config.CacheTTL)*time.Millisecond - ttl
+		if age < 0 {
+			age = 0
+		}
+		header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	}
+}
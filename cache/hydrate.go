@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/asjdf/gorm-cache/util"
+	jsoniter "github.com/json-iterator/go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+)
+
+// hydratePrimaryHit fills dest of db with cached objects of primaryKeys the way the query would: objects are ordered
+// by primary key, OFFSET and LIMIT are applied, and a struct dest takes the first one like First does.
+// It returns count of objects hydrated, and false if results can't be told from cache, e.g. the query is ordered
+// by other columns or no object is left after OFFSET, in which case the query should go to database.
+func hydratePrimaryHit(codec jsoniter.API, db *gorm.DB, primaryKeys []string, cacheValues []string) (int, bool, error) {
+	desc, ok := primaryKeyOrder(db)
+	if !ok {
+		return 0, false, nil
+	}
+
+	type object struct {
+		key   []string // values of primary fields
+		value string
+	}
+	composite := len(primaryFieldNames(db)) > 1
+	objects := make([]object, 0, len(primaryKeys))
+	seen := make(map[string]struct{}, len(primaryKeys))
+	var numeric []bool // if a primary field is numeric in all keys
+	for i, key := range primaryKeys {
+		// a key listed twice still matches one row
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keyValues := []string{key}
+		if composite {
+			keyValues = strings.Split(key, ":")
+		}
+		for j, v := range keyValues {
+			if j == len(numeric) {
+				numeric = append(numeric, true)
+			}
+			if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+				numeric[j] = false
+			}
+		}
+		objects = append(objects, object{key: keyValues, value: cacheValues[i]})
+	}
+	// composite keys are compared field by field, in the order of the primary key index
+	sort.SliceStable(objects, func(i, j int) bool {
+		for k := 0; k < len(objects[i].key) && k < len(objects[j].key); k++ {
+			x, y := objects[i].key[k], objects[j].key[k]
+			if x == y {
+				continue
+			}
+			if numeric[k] {
+				a, _ := strconv.ParseInt(x, 10, 64)
+				b, _ := strconv.ParseInt(y, 10, 64)
+				return (a < b) != desc
+			}
+			return (x < y) != desc
+		}
+		return false
+	})
+
+	if cla, ok := db.Statement.Clauses["LIMIT"]; ok {
+		if limit, ok := cla.Expression.(clause.Limit); ok {
+			if limit.Offset > 0 {
+				if limit.Offset >= len(objects) {
+					return 0, false, nil
+				}
+				objects = objects[limit.Offset:]
+			}
+			if limit.Limit != nil && *limit.Limit >= 0 && *limit.Limit < len(objects) {
+				objects = objects[:*limit.Limit]
+			}
+		}
+	}
+	if len(objects) == 0 {
+		return 0, false, nil
+	}
+
+	finalValue := ""
+	switch reflect.Indirect(reflect.ValueOf(db.Statement.Dest)).Kind() {
+	case reflect.Struct:
+		objects = objects[:1]
+		finalValue = objects[0].value
+	case reflect.Array, reflect.Slice:
+		values := make([]string, 0, len(objects))
+		for _, obj := range objects {
+			values = append(values, obj.value)
+		}
+		finalValue = "[" + strings.Join(values, ",") + "]"
+	default:
+		return 0, false, nil
+	}
+	if err := codec.Unmarshal([]byte(finalValue), db.Statement.Dest); err != nil {
+		return 0, false, err
+	}
+	return len(objects), true, nil
+}
+
+// primaryNotFoundValue is cached for primary keys which are looked up but not found
+const primaryNotFoundValue = "recordNotFound"
+
+// missingPrimaryKvs returns kvs caching primary keys which the query of db looked up but didn't find, found are
+// keys of the rows it returned. Keys are only told missing if the query looks up nothing but primary keys and isn't
+// cut short by LIMIT or OFFSET, and nothing is returned if cache penetration protection is disabled.
+func (c *Gorm2Cache) missingPrimaryKvs(db *gorm.DB, found []string) []util.Kv {
+	if c.Config.DisableCachePenetrationProtect || !isModelDest(db) || len(db.Statement.Joins) > 0 ||
+		db.Statement.TableExpr != nil || hasOtherClauseExceptPrimaryField(db) || hasConflictingPrimaryConditions(db) {
+		return nil
+	}
+	if cla, ok := db.Statement.Clauses["LIMIT"]; ok {
+		if limit, ok := cla.Expression.(clause.Limit); ok {
+			if limit.Offset > 0 || (limit.Limit != nil && len(found) >= *limit.Limit) {
+				return nil
+			}
+		}
+	}
+	foundSet := make(map[string]struct{}, len(found))
+	for _, key := range found {
+		foundSet[key] = struct{}{}
+	}
+	kvs := make([]util.Kv, 0)
+	for _, key := range getPrimaryKeysFromWhereClause(db) {
+		if _, ok := foundSet[key]; !ok {
+			kvs = append(kvs, util.Kv{Key: key, Value: primaryNotFoundValue, TTL: c.Config.EmptyResultTTL})
+		}
+	}
+	return kvs
+}
+
+// primaryKeyOrder returns if results of db are in descending order of primary key, ok is false if they are
+// ordered by other columns. Results without ORDER BY are in ascending order, as databases return them for
+// primary key lookups.
+func primaryKeyOrder(db *gorm.DB) (desc bool, ok bool) {
+	cla, exists := db.Statement.Clauses["ORDER BY"]
+	if !exists {
+		return false, true
+	}
+	orderBy, isOrderBy := cla.Expression.(clause.OrderBy)
+	if !isOrderBy || orderBy.Expression != nil {
+		return false, false
+	}
+	if len(orderBy.Columns) == 0 {
+		return false, true
+	}
+	// primary key is unique, so columns after it don't change the order
+	column := orderBy.Columns[0]
+	name := column.Column.Name
+	desc = column.Desc
+	if column.Column.Raw {
+		fields := strings.Fields(strings.ToLower(name))
+		if len(fields) == 0 || len(fields) > 2 {
+			return false, false
+		}
+		if len(fields) == 2 {
+			switch fields[1] {
+			case "asc":
+			case "desc":
+				desc = true
+			default:
+				return false, false
+			}
+		}
+		name = fields[0]
+		if pos := strings.LastIndex(name, "."); pos >= 0 {
+			name = name[pos+1:]
+		}
+		name = strings.Trim(name, "`\"")
+	}
+	if name == clause.PrimaryKey {
+		return desc, true
+	}
+	if field := db.Statement.Schema.PrioritizedPrimaryField; field != nil && name == field.DBName {
+		return desc, true
+	}
+	return false, false
+}
+
+// CallAfterFind calls AfterFind hooks of objects in dest of db like gorm does after a query, it can be used as
+// AfterCacheHit so that objects served from cache go through the hooks as well
+func CallAfterFind(db *gorm.DB) {
+	if db.Statement.Schema == nil || !db.Statement.Schema.AfterFind || db.Statement.SkipHooks || db.RowsAffected == 0 {
+		return
+	}
+	tx := db.Session(&gorm.Session{NewDB: true})
+	call := func(value reflect.Value) {
+		if value.CanAddr() {
+			value = value.Addr()
+		}
+		if i, ok := value.Interface().(callbacks.AfterFindInterface); ok {
+			_ = db.AddError(i.AfterFind(tx))
+		}
+	}
+	destValue := reflect.Indirect(reflect.ValueOf(db.Statement.Dest))
+	switch destValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < destValue.Len(); i++ {
+			call(reflect.Indirect(destValue.Index(i)))
+		}
+	case reflect.Struct:
+		call(destValue)
+	}
+}
+
+// corruptPrimaryKeys returns primary keys whose cached values fail to unmarshal into dest of db on their own,
+// all of primaryKeys if none does, e.g. the failure comes from combining them
+func corruptPrimaryKeys(codec jsoniter.API, db *gorm.DB, primaryKeys []string, cacheValues []string) []string {
+	elemType := reflect.Indirect(reflect.ValueOf(db.Statement.Dest)).Type()
+	if elemType.Kind() == reflect.Slice || elemType.Kind() == reflect.Array {
+		elemType = elemType.Elem()
+	}
+	for elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	corrupt := make([]string, 0)
+	for i, value := range cacheValues {
+		if err := codec.Unmarshal([]byte(value), reflect.New(elemType).Interface()); err != nil {
+			corrupt = append(corrupt, primaryKeys[i])
+		}
+	}
+	if len(corrupt) == 0 {
+		return primaryKeys
+	}
+	return corrupt
+}
+
+// resetDest empties a slice dest like gorm does before scanning rows into it
+func resetDest(db *gorm.DB) {
+	destValue := reflect.Indirect(reflect.ValueOf(db.Statement.Dest))
+	if destValue.Kind() == reflect.Slice && destValue.CanSet() {
+		destValue.Set(reflect.MakeSlice(destValue.Type(), 0, 0))
+	}
+}
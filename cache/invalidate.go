@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+)
+
+const (
+	// invalidationBatchSize is count of keys an invalidation job deletes at a time
+	invalidationBatchSize = 1000
+	// maxTrackedInvalidationJobs is count of the latest invalidation jobs kept for InvalidationJobs
+	maxTrackedInvalidationJobs = 100
+)
+
+// InvalidationJob progress of an invalidation deleting cache keys of a table in background
+type InvalidationJob struct {
+	Id         uint64
+	TableName  string
+	Prefixes   []string  // keys under these prefixes are deleted
+	Total      int64     // count of keys under Prefixes when the job started, -1 if storage can't count them
+	Deleted    int64     // count of keys deleted so far
+	Done       bool      // whether the job has finished
+	Err        string    // error which stopped the job, empty if none
+	StartedAt  time.Time // when the job started
+	FinishedAt time.Time // when the job finished, zero if not done
+}
+
+// invalidationJobs tracks the latest invalidation jobs
+type invalidationJobs struct {
+	mu     sync.Mutex
+	nextId uint64
+	jobs   []*InvalidationJob
+}
+
+func (j *invalidationJobs) start(tableName string, prefixes []string) *InvalidationJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.nextId++
+	job := &InvalidationJob{Id: j.nextId, TableName: tableName, Prefixes: prefixes, StartedAt: time.Now()}
+	j.jobs = append(j.jobs, job)
+	if len(j.jobs) > maxTrackedInvalidationJobs {
+		j.jobs = j.jobs[len(j.jobs)-maxTrackedInvalidationJobs:]
+	}
+	return job
+}
+
+func (j *invalidationJobs) update(fn func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn()
+}
+
+func (j *invalidationJobs) list() []InvalidationJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jobs := make([]InvalidationJob, 0, len(j.jobs))
+	for _, job := range j.jobs {
+		jobs = append(jobs, *job)
+	}
+	return jobs
+}
+
+// InvalidationJobs returns progress of the latest invalidation jobs, in the order they started
+func (c *Gorm2Cache) InvalidationJobs() []InvalidationJob {
+	return c.invalidations.list()
+}
+
+// shouldInvalidateAsync checks if cache of table is invalidated by jobs in background
+func (c *Gorm2Cache) shouldInvalidateAsync(tableName string) bool {
+	return util.ContainString(tableName, c.Config.AsyncInvalidationTables)
+}
+
+// invalidateTableAsync bumps the version of table so that its cache is invalidated at once, and deletes keys of
+// the former version in background. Cache written during the job belongs to the new version and is kept.
+func (c *Gorm2Cache) invalidateTableAsync(ctx context.Context, tableName string) error {
+	formerPrefix := c.tableKeyPrefix(tableName)
+	if err := c.BumpTableVersion(ctx, tableName); err != nil {
+		return err
+	}
+	prefixes := []string{
+		util.GenPrimaryCachePrefix(formerPrefix, tableName),
+		util.GenSearchCachePrefix(formerPrefix, tableName),
+		util.GenPageCachePrefix(formerPrefix, tableName),
+	}
+	for _, prefix := range prefixes {
+		c.keyCounts.forget(prefix)
+	}
+	job := c.invalidations.start(tableName, prefixes)
+	// cache of the former version is invalid at once, though its keys are deleted later
+	c.notifyInvalidate(ctx, tableName, nil)
+	c.goAsync(func() {
+		ctx := context.Background()
+		defer c.recoverPanic(ctx, "invalidateTableAsync")
+		err := c.runInvalidationJob(ctx, job)
+		var deleted int64
+		c.invalidations.update(func() {
+			deleted = job.Deleted
+			job.Done = true
+			job.FinishedAt = time.Now()
+			if err != nil {
+				job.Err = err.Error()
+			}
+		})
+		if err != nil {
+			c.Logger.CtxError(ctx, "[invalidateTableAsync] invalidation job %d of table %s error: %v", job.Id, tableName, err)
+			return
+		}
+		c.Logger.CtxInfo(ctx, "[invalidateTableAsync] invalidation job %d of table %s deleted %d keys",
+			job.Id, tableName, deleted)
+	})
+	return nil
+}
+
+func (c *Gorm2Cache) runInvalidationJob(ctx context.Context, job *InvalidationJob) error {
+	s := c.storageOf(job.TableName)
+	var total int64
+	for _, prefix := range job.Prefixes {
+		cnt, err := s.EntryCount(ctx, prefix)
+		if err != nil {
+			total = -1
+			break
+		}
+		total += cnt
+	}
+	c.invalidations.update(func() { job.Total = total })
+
+	for _, prefix := range job.Prefixes {
+		if err := c.deleteKeysInBatches(ctx, s, job, prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteKeysInBatches deletes keys under prefix a batch at a time, so that storage isn't blocked for long.
+// Passes over keys are repeated until one finds no key, since deleting keys may shift cursors of some storages.
+func (c *Gorm2Cache) deleteKeysInBatches(ctx context.Context, s storage.DataStorage, job *InvalidationJob, prefix string) error {
+	for {
+		var found bool
+		var cursor uint64
+		for {
+			keys, next, err := s.Keys(ctx, prefix, cursor, invalidationBatchSize)
+			if errors.Is(err, storage.ErrNotSupported) {
+				return s.DeleteKeysWithPrefix(ctx, prefix)
+			}
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				found = true
+				if err = s.BatchDeleteKeys(ctx, keys); err != nil {
+					return err
+				}
+				c.invalidations.update(func() { job.Deleted += int64(len(keys)) })
+			}
+			if next == 0 {
+				break
+			}
+			cursor = next
+		}
+		if !found {
+			return nil
+		}
+	}
+}
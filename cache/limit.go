@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// missLimiter limits count of queries of each table which missed cache and are querying the database
+type missLimiter struct {
+	slots sync.Map // table name -> chan struct{}
+}
+
+func (l *missLimiter) of(tableName string, max int64) chan struct{} {
+	slots, _ := l.slots.LoadOrStore(tableName, make(chan struct{}, max))
+	return slots.(chan struct{})
+}
+
+// acquireMissSlot takes a slot of table for the query of db, which missed cache, before it queries the database.
+// If all slots are taken, it waits for one and looks up cache again, since queries it waited for may have
+// populated cache. A slot taken is released after query.
+func (c *Gorm2Cache) acquireMissSlot(ctx context.Context, db *gorm.DB, tableName string, lookup func() hitKind) hitKind {
+	slots := c.missLimiter.of(tableName, c.Config.MaxConcurrentMissQueries)
+	select {
+	case slots <- struct{}{}:
+		db.InstanceSet(c.stmtKey("miss_slot"), slots)
+		return noHit
+	default:
+	}
+
+	c.Logger.CtxInfo(ctx, "[BeforeQuery] too many queries of table %s missed cache, wait for a slot", tableName)
+	select {
+	case slots <- struct{}{}:
+	case <-db.Statement.Context.Done():
+		_ = db.AddError(db.Statement.Context.Err())
+		return noHit
+	}
+	if hit := lookup(); hit != noHit {
+		<-slots
+		return hit
+	}
+	db.InstanceSet(c.stmtKey("miss_slot"), slots)
+	return noHit
+}
+
+// releaseMissSlot releases the slot the query of db took
+func (c *Gorm2Cache) releaseMissSlot(db *gorm.DB) {
+	if slots, ok := db.InstanceGet(c.stmtKey("miss_slot")); ok && slots != nil {
+		db.InstanceSet(c.stmtKey("miss_slot"), nil)
+		<-slots.(chan struct{})
+	}
+}
@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asjdf/gorm-cache/util"
+	"gorm.io/gorm"
+)
+
+type suppressInfoLogKey struct{}
+
+// sampledLogger drops info logs of operations which are not sampled, error logs are always kept
+type sampledLogger struct {
+	util.LoggerInterface
+}
+
+func (l *sampledLogger) CtxInfo(ctx context.Context, format string, v ...interface{}) {
+	if ctx != nil {
+		if suppressed, _ := ctx.Value(suppressInfoLogKey{}).(bool); suppressed {
+			return
+		}
+	}
+	l.LoggerInterface.CtxInfo(ctx, format, v...)
+}
+
+// logSampler decides which operations (queries and writes) print debug logs
+type logSampler struct {
+	rate         uint64   // 1 in rate operations is sampled, 0 or 1 samples all
+	maxPerSecond int64    // max operations sampled per second, 0 represents no limit
+	tables       []string // only operations on these tables are sampled, all if empty
+
+	counter uint64
+
+	mu          sync.Mutex
+	second      int64
+	secondCount int64
+}
+
+func (s *logSampler) enabled() bool {
+	return s.rate > 1 || s.maxPerSecond > 0 || len(s.tables) > 0
+}
+
+func (s *logSampler) sample(tableName string) bool {
+	if len(s.tables) > 0 && !util.ContainString(tableName, s.tables) {
+		return false
+	}
+	if s.rate > 1 && atomic.AddUint64(&s.counter, 1)%s.rate != 1 {
+		return false
+	}
+	if s.maxPerSecond > 0 {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		now := time.Now().Unix()
+		if now != s.second {
+			s.second, s.secondCount = now, 0
+		}
+		if s.secondCount >= s.maxPerSecond {
+			return false
+		}
+		s.secondCount++
+	}
+	return true
+}
+
+// logCtx returns the context that logs of the operation on table are printed with.
+// The sampling decision is made once per statement, so that all callbacks of a sampled statement print logs.
+func (c *Gorm2Cache) logCtx(db *gorm.DB, tableName string) context.Context {
+	ctx := db.Statement.Context
+	if c.Config.DebugMode {
+		ctx = util.WithLogFields(ctx, c.logFields(db, tableName))
+	}
+	if !c.logSampler.enabled() {
+		return ctx
+	}
+	sampled, ok := db.InstanceGet(c.stmtKey("log_sampled"))
+	if !ok {
+		sampled = c.logSampler.sample(tableName)
+		db.InstanceSet(c.stmtKey("log_sampled"), sampled)
+	}
+	if sampled.(bool) {
+		return ctx
+	}
+	return context.WithValue(ctx, suppressInfoLogKey{}, true)
+}
+
+// logFields returns fields of the operation of db for structured loggers, they're created once per statement
+func (c *Gorm2Cache) logFields(db *gorm.DB, tableName string) *util.LogFields {
+	if fields, ok := db.InstanceGet(c.stmtKey("log_fields")); ok {
+		return fields.(*util.LogFields)
+	}
+	fields := &util.LogFields{Table: tableName, Start: time.Now()}
+	db.InstanceSet(c.stmtKey("log_fields"), fields)
+	return fields
+}
+
+// setLogKey sets the cache key that following logs of the operation of db are printed with
+func (c *Gorm2Cache) setLogKey(db *gorm.DB, key string) {
+	if c.Config.DebugMode {
+		c.logFields(db, "").Key = fmt.Sprint(c.redact(key))
+	}
+}
+
+// redact rewrites v with LogRedactor before it's logged, v may contain keys, vars or cached values
+func (c *Gorm2Cache) redact(v interface{}) interface{} {
+	if c.Config.LogRedactor == nil {
+		return v
+	}
+	return c.Config.LogRedactor(v)
+}
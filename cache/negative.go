@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// maxTrackedNegatives is the max count of key values whose cached not-found results are tracked per table,
+// not-found results beyond it are still cached but invalidated along with the whole search cache on create
+const maxTrackedNegatives = 10000
+
+// negativeExpiryGrace keeps tracked not-found results a little longer than their ttl, since they are written after
+// being tracked, on top of the 10% ttl is randomized up by storages
+const negativeExpiryGrace = time.Second
+
+// negativeIndex tracks cached not-found results by the primary or unique key values they looked up,
+// so that creating rows with these values deletes exactly the outdated not-found results
+type negativeIndex struct {
+	mu     sync.Mutex
+	tables map[string]*negativeTable
+}
+
+type negativeTable struct {
+	negatives  map[string]map[string]int64 // column=value -> cache keys -> unix ms they expire at, 0 if never
+	overflowed bool                        // not-found results are cached untracked since too many were tracked
+}
+
+func negativeIndexKey(dbName string, value string) string {
+	return dbName + "=" + value
+}
+
+// record saves cache key of a not-found result expiring in ttl ms under key values, it returns false if too many
+// are tracked, in which case the table is marked overflowed
+func (n *negativeIndex) record(tableName string, key string, keyValues []string, ttl int64) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.tables == nil {
+		n.tables = make(map[string]*negativeTable)
+	}
+	table, ok := n.tables[tableName]
+	if !ok {
+		table = &negativeTable{negatives: make(map[string]map[string]int64)}
+		n.tables[tableName] = table
+	}
+	now := time.Now().UnixMilli()
+	if len(table.negatives)+len(keyValues) > maxTrackedNegatives {
+		table.prune(now)
+	}
+	if len(table.negatives)+len(keyValues) > maxTrackedNegatives {
+		table.overflowed = true
+		return false
+	}
+	var expireAt int64
+	if ttl > 0 {
+		expireAt = now + ttl + ttl/10 + negativeExpiryGrace.Milliseconds()
+	}
+	for _, keyValue := range keyValues {
+		if _, ok = table.negatives[keyValue]; !ok {
+			table.negatives[keyValue] = make(map[string]int64)
+		}
+		table.negatives[keyValue][key] = expireAt
+	}
+	return true
+}
+
+// prune drops tracked not-found results which have expired by now
+func (t *negativeTable) prune(now int64) {
+	for keyValue, keys := range t.negatives {
+		for key, expireAt := range keys {
+			if expireAt != 0 && expireAt <= now {
+				delete(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			delete(t.negatives, keyValue)
+		}
+	}
+}
+
+// take removes and returns cache keys of not-found results which looked up any of key values,
+// and whether not-found results of the table were cached untracked
+func (n *negativeIndex) take(tableName string, keyValues []string) ([]string, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	table, ok := n.tables[tableName]
+	if !ok {
+		return nil, false
+	}
+	now := time.Now().UnixMilli()
+	keys := make([]string, 0)
+	for _, keyValue := range keyValues {
+		for key, expireAt := range table.negatives[keyValue] {
+			if expireAt == 0 || expireAt > now {
+				keys = append(keys, key)
+			}
+		}
+		delete(table.negatives, keyValue)
+	}
+	return uniqueStringSlice(keys), table.overflowed
+}
+
+func (n *negativeIndex) forget(tableName string) {
+	n.mu.Lock()
+	delete(n.tables, tableName)
+	n.mu.Unlock()
+}
+
+func (n *negativeIndex) reset() {
+	n.mu.Lock()
+	n.tables = nil
+	n.mu.Unlock()
+}
+
+// getNegativeKeyValues returns the primary or unique key values in the WHERE clause of the query of db, which
+// its not-found result is tracked by
+func getNegativeKeyValues(db *gorm.DB) []string {
+	keyValues := make([]string, 0)
+	for _, field := range getKeyFields(db) {
+		for _, value := range getColumnValuesFromWhereClause(db, field.DBName) {
+			keyValues = append(keyValues, negativeIndexKey(field.DBName, value))
+		}
+	}
+	return keyValues
+}
+
+// recordNegative tracks a not-found result expiring in ttl ms by keyValues of its query, see getNegativeKeyValues,
+// it returns false if the result can't be tracked, which is cached anyway and invalidated along with the
+// whole search cache of the table when rows are created
+func (c *Gorm2Cache) recordNegative(tableName string, key string, keyValues []string, ttl int64) bool {
+	if len(keyValues) == 0 {
+		// not a lookup by key, newly created rows invalidate it along with the whole search cache
+		return true
+	}
+	return c.negatives.record(tableName, key, keyValues, ttl)
+}
+
+// invalidateNegativesOfCreated deletes cached not-found results which looked up key values of created rows,
+// the whole search cache of the table if some not-found results couldn't be tracked
+func (c *Gorm2Cache) invalidateNegativesOfCreated(ctx context.Context, db *gorm.DB, tableName string) error {
+	keys, overflowed := c.negatives.take(tableName, getKeyValuesAfterLoad(db))
+	if overflowed {
+		c.Logger.CtxInfo(ctx, "[invalidateNegativesOfCreated] not-found results of table %s aren't all tracked, "+
+			"invalidate its search cache", tableName)
+		return c.InvalidateSearchCache(ctx, tableName)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	c.Logger.CtxInfo(ctx, "[invalidateNegativesOfCreated] invalidate not-found results %v of table %s", c.redact(keys), tableName)
+	return c.storageOf(tableName).BatchDeleteKeys(ctx, keys)
+}
+
+// invalidatePrimaryNegativesOfCreated deletes primary cache of created rows, which may have been cached as not found
+func (c *Gorm2Cache) invalidatePrimaryNegativesOfCreated(ctx context.Context, db *gorm.DB, tableName string) error {
+	primaryKeys, _ := getObjectsAfterLoad(db)
+	if len(primaryKeys) == 0 {
+		return nil
+	}
+	cacheKeys := make([]string, 0, len(primaryKeys))
+	for _, primaryKey := range primaryKeys {
+		cacheKeys = append(cacheKeys, c.genPrimaryCacheKey(getStatementTableName(db), primaryKey))
+	}
+	err := c.storageOf(tableName).BatchDeleteKeys(ctx, cacheKeys)
+	if err != nil {
+		return err
+	}
+	c.notifyInvalidate(ctx, getStatementTableName(db), primaryKeys)
+	return nil
+}
+
+// getKeyFields returns primary and unique fields of the statement's model
+func getKeyFields(db *gorm.DB) []*schema.Field {
+	if db.Statement.Schema == nil {
+		return nil
+	}
+	fields := make([]*schema.Field, 0)
+	for _, field := range db.Statement.Schema.Fields {
+		if field.DBName != "" && (field.PrimaryKey || field.Unique) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// getKeyValuesAfterLoad returns column=value of primary and unique fields of objects in Dest
+func getKeyValuesAfterLoad(db *gorm.DB) []string {
+	fields := getKeyFields(db)
+	if len(fields) == 0 {
+		return nil
+	}
+	values := make([]reflect.Value, 0)
+	destValue := reflect.Indirect(reflect.ValueOf(db.Statement.Dest))
+	switch destValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < destValue.Len(); i++ {
+			values = append(values, reflect.Indirect(destValue.Index(i)))
+		}
+	case reflect.Struct:
+		values = append(values, destValue)
+	}
+
+	keyValues := make([]string, 0, len(values)*len(fields))
+	for _, elemValue := range values {
+		if elemValue.Kind() != reflect.Struct {
+			continue
+		}
+		for _, field := range fields {
+			value, isZero := field.ValueOf(db.Statement.Context, elemValue)
+			if isZero {
+				continue
+			}
+			keyValues = append(keyValues, negativeIndexKey(field.DBName, fmt.Sprintf("%v", value)))
+		}
+	}
+	return keyValues
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Option configures the cache created by New
+type Option func(conf *config.CacheConfig)
+
+// New creates a cache configured by opts. Unlike NewGorm2Cache with a struct literal config, it starts with
+// sane defaults (CacheLevelAll, invalidating when update, in-memory storage).
+func New(opts ...Option) (Cache, error) {
+	conf := &config.CacheConfig{
+		CacheLevel:           config.CacheLevelAll,
+		InvalidateWhenUpdate: true,
+	}
+	for _, opt := range opts {
+		opt(conf)
+	}
+	return NewGorm2Cache(conf)
+}
+
+// Plugins creates a cache configured by opts like New and returns it keyed by its name,
+// to be used as gorm.Config.Plugins so that gorm.Open registers the cache
+func Plugins(opts ...Option) (map[string]gorm.Plugin, error) {
+	c, err := New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]gorm.Plugin{c.Name(): c}, nil
+}
+
+// WithStorage keeps cache in s
+func WithStorage(s storage.DataStorage) Option {
+	return func(conf *config.CacheConfig) {
+		conf.CacheStorage = s
+	}
+}
+
+// WithRedis keeps cache in redis through client
+func WithRedis(client *redis.Client) Option {
+	return WithStorage(storage.NewRedis(&storage.RedisStoreConfig{Client: client}))
+}
+
+// WithMemory keeps at most maxSize items of cache in process memory
+func WithMemory(maxSize int64) Option {
+	return WithStorage(storage.NewMem(&storage.MemStoreConfig{MaxSize: maxSize}))
+}
+
+// WithPassthrough keeps nothing, queries go through callbacks and key generation but always hit the database.
+// It measures the overhead of the plugin, which benchmarks in test/overhead_test.go keep under budget.
+func WithPassthrough() Option {
+	return WithStorage(storage.NewNull())
+}
+
+// WithTTL expires cache after ttl, 0 represents forever
+func WithTTL(ttl time.Duration) Option {
+	return func(conf *config.CacheConfig) {
+		conf.CacheTTLDuration = ttl
+	}
+}
+
+// WithTables only caches given tables
+func WithTables(tables ...string) Option {
+	return func(conf *config.CacheConfig) {
+		conf.Tables = tables
+	}
+}
+
+// WithCacheLevel sets which kinds of cache are used
+func WithCacheLevel(level config.CacheLevel) Option {
+	return func(conf *config.CacheConfig) {
+		conf.CacheLevel = level
+	}
+}
+
+// WithInvalidateWhenUpdate sets whether cache is invalidated when tables are written
+func WithInvalidateWhenUpdate(invalidate bool) Option {
+	return func(conf *config.CacheConfig) {
+		conf.InvalidateWhenUpdate = invalidate
+	}
+}
+
+// WithAsyncWrite sets whether cache is populated and invalidated in async mode
+func WithAsyncWrite(async bool) Option {
+	return func(conf *config.CacheConfig) {
+		conf.AsyncWrite = async
+	}
+}
+
+// WithMaxItemCount doesn't cache queries retrieving more than cnt objects
+func WithMaxItemCount(cnt int64) Option {
+	return func(conf *config.CacheConfig) {
+		conf.CacheMaxItemCnt = cnt
+	}
+}
+
+// WithDebug prints access log through logger, the default logger is used if logger is nil
+func WithDebug(logger util.LoggerInterface) Option {
+	return func(conf *config.CacheConfig) {
+		conf.DebugMode = true
+		conf.DebugLogger = logger
+	}
+}
+
+// WithConfig modifies the config directly, for settings without a dedicated option
+func WithConfig(fn func(conf *config.CacheConfig)) Option {
+	return Option(fn)
+}
@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/asjdf/gorm-cache/util"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxTrackedPages is the max count of pages whose key range is tracked per table,
+// all pages of a table are invalidated once it's exceeded
+const maxTrackedPages = 10000
+
+// pageRange is the primary key range of rows a cached page contains
+type pageRange struct {
+	lo, hi int64
+	full   bool // page returned as many rows as its limit
+	order  int  // 1 ordered by primary key asc, -1 ordered by primary key desc, 0 other order
+}
+
+// affectedBy checks if creating or deleting the row with given primary key may change the page
+func (r pageRange) affectedBy(primaryKey int64) bool {
+	switch {
+	case r.order == 0 || !r.full:
+		return true
+	case r.order > 0:
+		return primaryKey <= r.hi
+	default:
+		return primaryKey >= r.lo
+	}
+}
+
+// pageIndex tracks key ranges of cached pages in process memory
+type pageIndex struct {
+	mu     sync.Mutex
+	tables map[string]map[string]pageRange // table name -> page cache key -> range
+}
+
+// record saves page range of key, it returns false if too many pages are tracked for the table
+func (p *pageIndex) record(tableName string, key string, r pageRange) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tables == nil {
+		p.tables = make(map[string]map[string]pageRange)
+	}
+	pages, ok := p.tables[tableName]
+	if !ok {
+		pages = make(map[string]pageRange)
+		p.tables[tableName] = pages
+	}
+	if _, ok = pages[key]; !ok && len(pages) >= maxTrackedPages {
+		return false
+	}
+	pages[key] = r
+	return true
+}
+
+// takeAffected removes and returns keys of pages which may be changed by creating or deleting given primary keys
+func (p *pageIndex) takeAffected(tableName string, primaryKeys []int64) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := make([]string, 0)
+	for key, r := range p.tables[tableName] {
+		for _, primaryKey := range primaryKeys {
+			if r.affectedBy(primaryKey) {
+				keys = append(keys, key)
+				delete(p.tables[tableName], key)
+				break
+			}
+		}
+	}
+	return keys
+}
+
+func (p *pageIndex) forget(tableName string) {
+	p.mu.Lock()
+	delete(p.tables, tableName)
+	p.mu.Unlock()
+}
+
+func (p *pageIndex) reset() {
+	p.mu.Lock()
+	p.tables = nil
+	p.mu.Unlock()
+}
+
+// InvalidatePages invalidates all cached pages (queries with LIMIT) of table
+func (c *Gorm2Cache) InvalidatePages(ctx context.Context, tableName string) error {
+	if c.shouldInvalidateAsync(tableName) {
+		return c.invalidateTableAsync(ctx, tableName)
+	}
+	c.markInvalidated(tableName)
+	c.pages.forget(tableName)
+	err := c.storageOf(tableName).DeleteKeysWithPrefix(ctx, util.GenPageCachePrefix(c.tableKeyPrefix(tableName), tableName))
+	if err != nil {
+		return err
+	}
+	c.keyCounts.forget(util.GenPageCachePrefix(c.tableKeyPrefix(tableName), tableName))
+	return nil
+}
+
+// invalidatePagesOfKeys invalidates pages which may be changed by creating or deleting rows with given primary keys.
+// All pages of table are invalidated unless PageRangeInvalidation is on and all keys are integers.
+func (c *Gorm2Cache) invalidatePagesOfKeys(ctx context.Context, tableName string, primaryKeys []string) error {
+	if !c.Config.PageRangeInvalidation || len(primaryKeys) == 0 {
+		return c.InvalidatePages(ctx, tableName)
+	}
+	intKeys := make([]int64, 0, len(primaryKeys))
+	for _, primaryKey := range primaryKeys {
+		intKey, err := strconv.ParseInt(primaryKey, 10, 64)
+		if err != nil {
+			return c.InvalidatePages(ctx, tableName)
+		}
+		intKeys = append(intKeys, intKey)
+	}
+	c.markInvalidated(tableName)
+	keys := c.pages.takeAffected(tableName, intKeys)
+	if len(keys) == 0 {
+		return nil
+	}
+	return c.storageOf(tableName).BatchDeleteKeys(ctx, keys)
+}
+
+// pageRangeOf returns the key range of the page the query of db returned primaryKeys for
+func pageRangeOf(db *gorm.DB, primaryKeys []string) pageRange {
+	r := pageRange{order: getPrimaryKeyOrder(db)}
+	if limit, ok := getLimit(db); ok {
+		r.full = len(primaryKeys) >= limit
+	}
+	for i, primaryKey := range primaryKeys {
+		intKey, err := strconv.ParseInt(primaryKey, 10, 64)
+		if err != nil {
+			r.order = 0
+			break
+		}
+		if i == 0 || intKey < r.lo {
+			r.lo = intKey
+		}
+		if i == 0 || intKey > r.hi {
+			r.hi = intKey
+		}
+	}
+	return r
+}
+
+// recordPage tracks the key range r of a newly cached page
+func (c *Gorm2Cache) recordPage(ctx context.Context, tableName string, key string, r pageRange) {
+	if !c.Config.PageRangeInvalidation {
+		return
+	}
+	if !c.pages.record(tableName, key, r) {
+		c.Logger.CtxInfo(ctx, "[recordPage] too many pages tracked for table %s, invalidate all pages", tableName)
+		_ = c.InvalidatePages(ctx, tableName)
+	}
+}
+
+// queryCachePrefix returns prefix of the key that results of query are cached with, see genQueryCacheKey
+func (c *Gorm2Cache) queryCachePrefix(db *gorm.DB, tableName string) string {
+	if isPageQuery(db) {
+		return util.GenPageCachePrefix(c.tableKeyPrefix(tableName), tableName)
+	}
+	return util.GenSearchCachePrefix(c.tableKeyPrefix(tableName), tableName)
+}
+
+// isPageQuery checks if the query is limited, namely a page of results
+func isPageQuery(db *gorm.DB) bool {
+	_, ok := getLimit(db)
+	return ok
+}
+
+func getLimit(db *gorm.DB) (int, bool) {
+	cla, ok := db.Statement.Clauses["LIMIT"]
+	if !ok {
+		return 0, false
+	}
+	limit, ok := cla.Expression.(clause.Limit)
+	if !ok || limit.Limit == nil || *limit.Limit < 0 {
+		return 0, false
+	}
+	return *limit.Limit, true
+}
+
+// getPrimaryKeyOrder returns 1 if query is ordered by primary key asc only, -1 if desc only, else 0
+func getPrimaryKeyOrder(db *gorm.DB) int {
+	if db.Statement.Schema == nil || db.Statement.Schema.PrioritizedPrimaryField == nil {
+		return 0
+	}
+	cla, ok := db.Statement.Clauses["ORDER BY"]
+	if !ok {
+		return 0
+	}
+	orderBy, ok := cla.Expression.(clause.OrderBy)
+	if !ok || len(orderBy.Columns) != 1 {
+		return 0
+	}
+	column := orderBy.Columns[0]
+	name, desc := column.Column.Name, column.Desc
+	if column.Column.Raw {
+		fields := strings.Fields(strings.ToLower(name))
+		if len(fields) == 0 || len(fields) > 2 {
+			return 0
+		}
+		name = fields[0]
+		if len(fields) == 2 {
+			if fields[1] != "asc" && fields[1] != "desc" {
+				return 0
+			}
+			desc = fields[1] == "desc"
+		}
+		if pos := strings.LastIndexByte(name, '.'); pos >= 0 {
+			name = name[pos+1:]
+		}
+		name = strings.Trim(name, "`\"")
+	}
+	if name != clause.PrimaryKey && name != db.Statement.Schema.PrioritizedPrimaryField.DBName {
+		return 0
+	}
+	if desc {
+		return -1
+	}
+	return 1
+}
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/asjdf/gorm-cache/config"
@@ -16,98 +17,136 @@ import (
 )
 
 // singleFlight 流程设计
-// 根据key lock住，等待结果。query before之前，会先判断是否有key，如果有，就等待结果，如果没有，就执行query before，然后执行query，然后把结果放到key里面，然后unlock，然后返回结果。
+// query before先查缓存，命中直接返回，不参与singleFlight。未命中时根据key lock住，等待结果：如果已有相同key的查询，就等待结果，如果没有，就执行query，然后把结果放到key里面，然后unlock，然后返回结果。
 // 等待完成后 进行一手返回 然后err设置为err.singleflightHit，afterQuery结束的时候进行一手检查
 
-func newQueryHandler(c *Gorm2Cache) *queryHandler {
-	return &queryHandler{cache: c}
+// NewQueryHandler creates the handler which serves queries from cache and populates cache with query results.
+// Use Bind to register it at the default position of db's query callbacks, or register BeforeQuery and
+// AfterQuery yourself around the callback which executes the query, e.g. on a custom callback chain.
+// BeforeQuery and AfterQuery of one handler must always run as a pair.
+func NewQueryHandler(c *Gorm2Cache) *QueryHandler {
+	return &QueryHandler{cache: c}
 }
 
-type queryHandler struct {
+type QueryHandler struct {
 	cache        *Gorm2Cache
 	singleFlight Group
 }
 
-func (h *queryHandler) Bind(db *gorm.DB) error {
-	err := db.Callback().Query().Before("gorm:query").Register("gorm:cache:before_query", h.BeforeQuery())
+// Bind registers the handler around CallbackAnchors of db's query callbacks
+func (h *QueryHandler) Bind(db *gorm.DB) error {
+	anchors := h.cache.callbackAnchors()
+	queryCallback := db.Callback().Query()
+	err := registerCallback(queryCallback.Get, queryCallback.Replace, queryCallback.Before(anchors.BeforeQuery).Register,
+		h.cache.CallbackName("before_query"), h.BeforeQuery())
 	if err != nil {
 		return err
 	}
-	err = db.Callback().Query().After("gorm:after_query").Register("gorm:cache:after_query", h.AfterQuery())
+	err = registerCallback(queryCallback.Get, queryCallback.Replace, queryCallback.After(anchors.AfterQuery).Register,
+		h.cache.CallbackName("after_query"), h.AfterQuery())
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (h *queryHandler) BeforeQuery() func(db *gorm.DB) {
+// BeforeQuery returns the callback which must run before the query is executed,
+// it fills db's dest and skips the query on cache hit
+func (h *QueryHandler) BeforeQuery() func(db *gorm.DB) {
+	return h.cache.recoverCallback("BeforeQuery", h.beforeQuery(), h.cache.degradeBeforeQuery)
+}
+
+// AfterQuery returns the callback which must run after the query is executed, it caches the query result
+func (h *QueryHandler) AfterQuery() func(db *gorm.DB) {
+	return h.cache.recoverCallback("AfterQuery", h.afterQuery(), nil)
+}
+
+func (h *QueryHandler) beforeQuery() func(db *gorm.DB) {
 	cache := h.cache
 	return func(db *gorm.DB) {
 		callbacks.BuildQuerySQL(db)
-		tableName := ""
-		if db.Statement.Schema != nil {
-			tableName = db.Statement.Schema.Table
-		} else {
-			tableName = db.Statement.Table
+		db.InstanceSet(cache.stmtKey("error"), db.Error)
+		tableName := cache.getTableName(db)
+		ctx := cache.logCtx(db, tableName)
+		cache.startExplain(db, tableName, db.Statement.SQL.String())
+
+		if !isPointerDest(db) {
+			cache.IncrBypassCount()
+			cache.Logger.CtxInfo(ctx, "[BeforeQuery] dest %T is not a non-nil pointer, bypass cache", db.Statement.Dest)
+			cache.explain(db, "dest %T is not a non-nil pointer, bypass cache", db.Statement.Dest)
+			db.InstanceSet(cache.stmtKey("bypass"), true)
+			return
+		}
+		if isFullTableLoad(ctx) {
+			// rows loaded for full table cache are kept by it
+			cache.explain(db, "loading full table cache, bypass cache")
+			db.InstanceSet(cache.stmtKey("bypass"), true)
+			return
+		}
+		if cache.Config.BypassNestedQueries && isNestedQuery(ctx) {
+			cache.IncrBypassCount()
+			cache.Logger.CtxInfo(ctx, "[BeforeQuery] nested query, bypass cache")
+			cache.explain(db, "nested query, bypass cache")
+			db.InstanceSet(cache.stmtKey("bypass"), true)
+			return
+		}
+		if cache.Config.MaxVarsForCaching > 0 && int64(len(db.Statement.Vars)) > cache.Config.MaxVarsForCaching {
+			cache.IncrBypassCount()
+			cache.Logger.CtxInfo(ctx, "[BeforeQuery] query has %d vars, more than max vars for caching, bypass cache",
+				len(db.Statement.Vars))
+			cache.explain(db, "query has %d vars, more than MaxVarsForCaching, bypass cache", len(db.Statement.Vars))
+			db.InstanceSet(cache.stmtKey("bypass"), true)
+			return
+		}
+		schemaless := cache.isSchemaless(db)
+		if schemaless && cache.Config.SchemalessQueryMode == config.SchemalessBypass {
+			cache.IncrBypassCount()
+			cache.Logger.CtxInfo(ctx, "[BeforeQuery] query of table %s without its model, bypass cache", tableName)
+			cache.explain(db, "query without model, bypass cache")
+			db.InstanceSet(cache.stmtKey("bypass"), true)
+			return
 		}
-		ctx := db.Statement.Context
 
-		sql := db.Statement.SQL.String()
-		db.InstanceSet("gorm:cache:sql", sql)
-		db.InstanceSet("gorm:cache:vars", db.Statement.Vars)
+		sql, vars := buildKeySQL(db, cache.Config.KeyIgnoredClauses)
+		searchKey := cache.genQueryCacheKey(db, tableName, sql, vars...)
+		db.InstanceSet(cache.stmtKey("sql"), sql)
+		db.InstanceSet(cache.stmtKey("search_key"), searchKey)
+		db.InstanceSet(cache.stmtKey("seq"), cache.seqs.load(tableName))
+		if cache.shouldKeepStale(tableName) {
+			db.InstanceSet(cache.stmtKey("stale_key"),
+				util.GenStaleCacheKey(cache.keyPrefix(tableName), tableName, cache.keySQL(sql), vars...))
+		}
+		cache.setLogKey(db, searchKey)
 
-		if util.ShouldCache(tableName, cache.Config.Tables) {
-			hit := false
+		if reason := cache.whyNotCacheQuery(db, tableName); reason != "" {
+			cache.explain(db, "%s, cache is not used", reason)
+		} else {
+			hit := noHit
 			defer func() {
-				if hit {
-					cache.IncrHitCount()
+				if hit != noHit {
+					cache.incrHit(hit)
+					cache.slideExpiration(ctx, db, tableName, hit, searchKey)
+					cache.explain(db, "served by %s hit", hit)
+					if !cache.Config.ShadowMode {
+						// hits in shadow mode are still served by the database
+						cache.setSource(db, sourceOfHit(hit))
+					}
 				} else {
 					cache.IncrMissCount()
+					cache.explain(db, "cache missed, query database")
 				}
 			}()
 
-			// singleFlight Check
-			singleFlightKey := util.GenSingleFlightKey(tableName, sql, db.Statement.Vars...)
-			h.singleFlight.mu.Lock()
-			if h.singleFlight.m == nil {
-				h.singleFlight.m = make(map[string]*call)
-			}
-			if c, ok := h.singleFlight.m[singleFlightKey]; ok {
-				c.dups++
-				h.singleFlight.mu.Unlock()
-				c.wg.Wait()
-
-				// 临时糊一个拷贝在这里 性能可能并不是那么好
-				d, err := json.Marshal(c.dest)
-				if err != nil {
-					_ = db.AddError(err)
-					return
-				}
-				err = json.Unmarshal(d, db.Statement.Dest)
-				if err != nil {
-					_ = db.AddError(err)
-					return
-				}
-				hit = true
-				db.RowsAffected = c.rowsAffected
-				db.Error = multierror.Append(util.SingleFlightHit) // 为保证后续流程不走，必须设一个error
-				if c.err != nil {
-					db.Error = multierror.Append(db.Error, c.err)
-				}
-				h.cache.Logger.CtxInfo(ctx, "[BeforeQuery] single flight hit for key %v", singleFlightKey)
-				return
-			}
-			c := &call{key: singleFlightKey}
-			c.wg.Add(1)
-			h.singleFlight.m[singleFlightKey] = c
-			h.singleFlight.mu.Unlock()
-			db.InstanceSet("gorm:cache:query:single_flight_call", c)
+			// the database query keeps the rest of the time if storage is slow
+			lookupCtx, cancelLookup := cache.lookupContext(ctx)
+			defer cancelLookup()
 
 			tryPrimaryCache := func() (hit bool) {
 				primaryKeys := getPrimaryKeysFromWhereClause(db)
-				cache.Logger.CtxInfo(ctx, "[BeforeQuery] parse primary keys = %v", primaryKeys)
+				cache.Logger.CtxInfo(ctx, "[BeforeQuery] parse primary keys = %v", cache.redact(primaryKeys))
 
 				if len(primaryKeys) == 0 {
+					cache.explain(db, "no primary keys in where clause, primary cache is not used")
 					return
 				}
 
@@ -115,40 +154,75 @@ func (h *queryHandler) BeforeQuery() func(db *gorm.DB) {
 				hasOtherClauseInWhere := hasOtherClauseExceptPrimaryField(db)
 				if hasOtherClauseInWhere {
 					// if query has other clauses, it can only query the database
+					cache.explain(db, "query has other clauses than primary keys, primary cache is not used")
+					return
+				}
+				if hasConflictingPrimaryConditions(db) {
+					// values of the conditions can't be put together as keys, nor paired up for composite keys
+					cache.explain(db, "primary keys are restricted by several conditions, primary cache is not used")
 					return
 				}
 
 				// primary cache hit
-				cacheValues, err := cache.BatchGetPrimaryCache(ctx, tableName, primaryKeys)
+				cacheValues, err := cache.BatchGetPrimaryCache(lookupCtx, getStatementTableName(db), primaryKeys)
 				if err != nil {
-					cache.Logger.CtxError(ctx, "[BeforeQuery] get primary cache value for key %v error: %v", primaryKeys, err)
+					if !errors.Is(err, storage.ErrCacheNotFound) {
+						cache.Logger.CtxError(ctx, "[BeforeQuery] get primary cache value for key %v error: %v",
+							cache.redact(primaryKeys), err)
+					}
+					cache.explain(db, "primary cache missed")
 					db.Error = nil
 					return
 				}
 				if len(cacheValues) != len(primaryKeys) {
+					cache.explain(db, "primary cache missed")
 					db.Error = nil
 					return
 				}
-				finalValue := ""
-
-				destKind := reflect.Indirect(reflect.ValueOf(db.Statement.Dest)).Kind()
-				if destKind == reflect.Struct && len(cacheValues) == 1 {
-					finalValue = cacheValues[0]
-				} else if (destKind == reflect.Array || destKind == reflect.Slice) && len(cacheValues) >= 1 {
-					finalValue = "[" + strings.Join(cacheValues, ",") + "]"
+				// like the database, keys cached as not found get no rows
+				foundKeys := make([]string, 0, len(primaryKeys))
+				foundValues := make([]string, 0, len(cacheValues))
+				for i, value := range cacheValues {
+					if value != primaryNotFoundValue {
+						foundKeys = append(foundKeys, primaryKeys[i])
+						foundValues = append(foundValues, value)
+					}
 				}
-				if len(finalValue) == 0 {
-					cache.Logger.CtxError(ctx, "[BeforeQuery] length of cache values and dest not matched")
-					db.Error = util.ErrCacheUnmarshal
+				if len(foundKeys) == 0 {
+					db.RowsAffected = 0
+					if db.Statement.RaiseErrorOnNotFound {
+						db.Error = util.RecordNotFoundCacheHit
+					} else {
+						resetDest(db)
+						db.Error = util.PrimaryCacheHit
+					}
+					hit = true
 					return
 				}
-
-				err = json.Unmarshal([]byte(finalValue), db.Statement.Dest)
+				rows, hydrated, err := hydratePrimaryHit(cache.jsonCodec(), db, foundKeys, foundValues)
 				if err != nil {
 					cache.Logger.CtxError(ctx, "[BeforeQuery] unmarshal final value error: %v", err)
-					db.Error = util.ErrCacheUnmarshal
+					cache.explain(db, "unmarshal primary cache error: %v", err)
+					// the entries are corrupt, evict them and read the database instead
+					corruptKeys := corruptPrimaryKeys(cache.jsonCodec(), db, foundKeys, foundValues)
+					cacheKeys := make([]string, 0, len(corruptKeys))
+					for _, key := range corruptKeys {
+						cacheKeys = append(cacheKeys, cache.genPrimaryCacheKey(getStatementTableName(db), key))
+					}
+					cache.evictCorrupt(ctx, tableName, cacheKeys)
+					resetDest(db)
+					db.Error = nil
+					return
+				}
+				if !hydrated {
+					cache.Logger.CtxInfo(ctx, "[BeforeQuery] results of primary keys %v can't be told from cache",
+						cache.redact(primaryKeys))
+					cache.explain(db, "results can't be told from primary cache, e.g. ordered by other columns")
+					db.Error = nil
 					return
 				}
+				// like the query, one row is affected by each object found
+				db.RowsAffected = int64(rows)
 				db.Error = util.PrimaryCacheHit
 				hit = true
 				return
@@ -156,148 +230,390 @@ func (h *queryHandler) BeforeQuery() func(db *gorm.DB) {
 
 			trySearchCache := func() (hit bool) {
 				// search cache hit
-				cacheValue, err := cache.GetSearchCache(ctx, tableName, sql, db.Statement.Vars...)
+				cacheValue, err := cache.storageOf(tableName).GetValue(lookupCtx, searchKey)
 				if err != nil {
 					if !errors.Is(err, storage.ErrCacheNotFound) {
 						cache.Logger.CtxError(ctx, "[BeforeQuery] get cache value for sql %s error: %v", sql, err)
 					}
+					cache.explain(db, "search cache missed")
 					db.Error = nil
 					return
 				}
-				cache.Logger.CtxInfo(ctx, "[BeforeQuery] get value: %s", cacheValue)
+				cache.Logger.CtxInfo(ctx, "[BeforeQuery] get value: %v", cache.redact(cacheValue))
 				if cacheValue == "recordNotFound" { // 应对缓存穿透
-					db.Error = util.RecordNotFoundCacheHit
+					db.RowsAffected = 0
+					if db.Statement.RaiseErrorOnNotFound {
+						db.Error = util.RecordNotFoundCacheHit
+					} else {
+						// the result was cached by First or Take with the same sql, Find gets empty result instead
+						resetDest(db)
+						db.Error = util.SearchCacheHit
+					}
 					hit = true
 					return
 				}
 				rowsAffectedPos := strings.Index(cacheValue, "|")
-				db.RowsAffected, err = strconv.ParseInt(cacheValue[:rowsAffectedPos], 10, 64)
+				if rowsAffectedPos < 0 {
+					cache.Logger.CtxError(ctx, "[BeforeQuery] rows affected not found in search cache")
+					cache.explain(db, "unmarshal search cache error: rows affected not found")
+					cache.evictCorrupt(ctx, tableName, []string{searchKey})
+					db.Error = nil
+					return
+				}
+				rowsAffected, err := strconv.ParseInt(cacheValue[:rowsAffectedPos], 10, 64)
 				if err != nil {
 					cache.Logger.CtxError(ctx, "[BeforeQuery] unmarshal rows affected cache error: %v", err)
+					cache.explain(db, "unmarshal search cache error: %v", err)
+					cache.evictCorrupt(ctx, tableName, []string{searchKey})
 					db.Error = nil
 					return
 				}
-				err = json.Unmarshal([]byte(cacheValue[rowsAffectedPos+1:]), db.Statement.Dest)
+				err = cache.jsonCodec().Unmarshal([]byte(cacheValue[rowsAffectedPos+1:]), db.Statement.Dest)
 				if err != nil {
 					cache.Logger.CtxError(ctx, "[BeforeQuery] unmarshal search cache error: %v", err)
+					cache.explain(db, "unmarshal search cache error: %v", err)
+					cache.evictCorrupt(ctx, tableName, []string{searchKey})
+					resetDest(db)
 					db.Error = nil
 					return
 				}
+				db.RowsAffected = rowsAffected
 				db.Error = util.SearchCacheHit
 				hit = true
 				return
 			}
 
-			if cache.Config.CacheLevel == config.CacheLevelAll || cache.Config.CacheLevel == config.CacheLevelOnlyPrimary {
-				if tryPrimaryCache() {
-					hit = true
-					return
+			lookup := func() hitKind {
+				if schemaless {
+					// rows can't be told apart by primary key without the model
+					cache.explain(db, "query without model, only search cache is used")
+					if cache.searchCacheEnabled() && trySearchCache() {
+						return searchHit
+					}
+					return noHit
+				}
+				if cache.isFullTable(tableName) && cache.tryFullTable(ctx, db, tableName) {
+					return searchHit
+				}
+				lookupPrimary := func() bool {
+					if !cache.primaryCacheEnabled() {
+						cache.explain(db, "primary cache is disabled by cache level")
+						return false
+					}
+					if !isModelDest(db) {
+						cache.explain(db, "dest %T is not complete models, e.g. it selects columns, primary cache is not used",
+							db.Statement.Dest)
+						return false
+					}
+					return tryPrimaryCache()
+				}
+				lookupSearch := func() bool {
+					if !cache.searchCacheEnabled() {
+						cache.explain(db, "search cache is disabled by cache level")
+						return false
+					}
+					return trySearchCache()
+				}
+				if util.ContainString(tableName, cache.Config.SearchFirstTables) {
+					if lookupSearch() {
+						return searchHit
+					}
+					if lookupPrimary() {
+						return primaryHit
+					}
+					return noHit
+				}
+				if lookupPrimary() {
+					return primaryHit
 				}
+				if lookupSearch() {
+					return searchHit
+				}
+				return noHit
 			}
-			if cache.Config.CacheLevel == config.CacheLevelAll || cache.Config.CacheLevel == config.CacheLevelOnlySearch {
-				if !hit && trySearchCache() {
-					hit = true
+			if cache.Config.ShadowMode {
+				// taking over results of another query in single flight would alter results
+				hit = cache.shadowLookup(db, lookup)
+				return
+			}
+			// cache is looked up before joining single flight, so that hits don't contend for it
+			hit = lookup()
+			if hit != noHit {
+				return
+			}
+
+			// singleFlight Check
+			if isNestedQuery(ctx) {
+				// query issued by hooks of a query in flight, waiting for flights here may wait for itself
+				cache.Logger.CtxInfo(ctx, "[BeforeQuery] nested query, skip single flight")
+				cache.explain(db, "nested query, skip single flight")
+			} else if joined, joinedHit := h.joinSingleFlight(ctx, db, util.GenSingleFlightKey(tableName, cache.keySQL(sql), vars...)); joined {
+				if joinedHit {
+					hit = singleFlightHit
 				}
+				return
+			}
+
+			if cache.Config.MaxConcurrentMissQueries > 0 && !isNestedQuery(ctx) {
+				hit = cache.acquireMissSlot(ctx, db, tableName, lookup)
+			}
+			if hit == noHit {
+				cache.startPrimaryBatch(db)
 			}
 		}
 	}
 }
 
-func (h *queryHandler) AfterQuery() func(db *gorm.DB) {
+func (h *QueryHandler) afterQuery() func(db *gorm.DB) {
 	cache := h.cache
 	return func(db *gorm.DB) {
+		// released after cache is populated, so queries waiting for the slot can be served from cache
+		defer cache.releaseMissSlot(db)
+		defer cache.finishExplain(db)
+		defer cache.finishSource(db)
 		func() {
-			tableName := ""
-			if db.Statement.Schema != nil {
-				tableName = db.Statement.Schema.Table
-			} else {
-				tableName = db.Statement.Table
+			// a panic here must not keep the single flight call below from being filled
+			defer cache.recoverPanic(db.Statement.Context, "AfterQuery")
+			if _, bypass := db.InstanceGet(cache.stmtKey("bypass")); bypass {
+				return
+			}
+			tableName := cache.getTableName(db)
+			ctx := cache.logCtx(db, tableName)
+			if cache.Config.ShadowMode {
+				cache.checkShadow(ctx, db)
 			}
-			ctx := db.Statement.Context
-			sqlObj, _ := db.InstanceGet("gorm:cache:sql")
+			sqlObj, _ := db.InstanceGet(cache.stmtKey("sql"))
 			sql := sqlObj.(string)
-			varObj, _ := db.InstanceGet("gorm:cache:vars")
-			vars := varObj.([]interface{})
+			searchKeyObj, _ := db.InstanceGet(cache.stmtKey("search_key"))
+			searchKey := searchKeyObj.(string)
 
-			if !util.ShouldCache(tableName, cache.Config.Tables) {
+			if db.Error != nil && db.Error != gorm.ErrRecordNotFound && cache.serveStale(ctx, db, tableName) {
+				cache.setSource(db, SourceStaleCache)
+				return
+			}
+
+			if isCanceledQuery(db) {
+				cache.Logger.CtxInfo(ctx, "[AfterQuery] query canceled, sql %s not cached", sql)
+				cache.explain(db, "query canceled, not cached")
+				return
+			}
+
+			if !cache.shouldCacheQuery(db, tableName) {
+				// the reason has been explained before query
+				return
+			}
+
+			if (db.Error == nil || db.Error == gorm.ErrRecordNotFound) && cache.inLagWindow(tableName) {
+				cache.Logger.CtxInfo(ctx, "[AfterQuery] table %s is in replica lag window, sql %s not cached", tableName, sql)
+				cache.explain(db, "table %s is in replica lag window, not cached", tableName)
+				return
+			}
+
+			if (db.Error == nil || db.Error == gorm.ErrRecordNotFound) && cache.inResetBarrier() {
+				cache.Logger.CtxInfo(ctx, "[AfterQuery] cache is being reset, sql %s not cached", sql)
+				cache.explain(db, "cache is being reset, not cached")
 				return
 			}
 
 			if db.Error == nil {
 				destValue := reflect.Indirect(reflect.ValueOf(db.Statement.Dest))
-				// 如果是结构体应该能提主键出来
-				// 如果是数组需要判断内部元素是不是结构体，不是结构体的都提不了主键
-				if destValue.Kind() == reflect.Slice || destValue.Kind() == reflect.Array {
-					if (destValue.Type().Elem().Kind() == reflect.Pointer && destValue.Type().Elem().Elem().Kind() != reflect.Struct) ||
-						(destValue.Type().Elem().Kind() != reflect.Pointer && destValue.Type().Elem().Kind() != reflect.Struct) {
-						return
-					}
-				}
+				// 只有完整的模型行才能提主键出来并写入主键缓存
+				// 聚合、Count、Pluck等结果只能作为整体写入搜索缓存
+				modelDest := isModelDest(db) && !cache.isSchemaless(db)
 
 				// error is nil -> cache not hit, we cache newly retrieved data
-				primaryKeys, objects := getObjectsAfterLoad(db)
+				var primaryKeys []string
+				var objects []interface{}
+				itemCnt := 1
+				// primary keys are needed by primary cache and page ranges of search cache
+				if modelDest && (cache.primaryCacheEnabled() || cache.Config.PageRangeInvalidation) {
+					primaryKeys, objects = getObjectsAfterLoad(db)
+					itemCnt = len(objects)
+				} else if destValue.Kind() == reflect.Slice || destValue.Kind() == reflect.Array {
+					itemCnt = destValue.Len()
+				}
+
+				// shared with waiters of the single flight call
+				payload := cache.destPayloadOf(db)
+
+				// the goroutines populating cache only use values taken from db here, as db is changed after query
+				exp := cache.explanationOf(db)
+				seq := cache.querySeq(db)
+				pinned := cache.isPinned(db, tableName)
+				rowsAffected := db.RowsAffected
+				destType := fmt.Sprintf("%T", db.Statement.Dest)
+				emptyResult := (destValue.Kind() == reflect.Slice || destValue.Kind() == reflect.Array) && destValue.Len() == 0
+				var negativeKeyValues []string
+				if emptyResult {
+					negativeKeyValues = getNegativeKeyValues(db)
+				}
+				queryPrefix := cache.queryCachePrefix(db, tableName)
+				pageQuery := isPageQuery(db)
+				page := pageRangeOf(db, primaryKeys)
+				staleKey := cache.staleKeyOf(db)
+				primaryTable := getStatementTableName(db)
+				preloadBatch := primaryBatchOf(db)
+				var missing []util.Kv
+				if cache.primaryCacheEnabled() && modelDest {
+					// keys looked up but not found are cached too, so that lookups of them don't miss forever
+					missing = cache.missingPrimaryKvs(db, primaryKeys)
+				}
 
 				var wg sync.WaitGroup
 				wg.Add(2)
 
-				go func() {
+				cache.goAsync(func() {
 					defer wg.Done()
+					defer cache.recoverPanic(ctx, "AfterQuery")
 
-					if cache.Config.CacheLevel == config.CacheLevelAll || cache.Config.CacheLevel == config.CacheLevelOnlySearch {
+					if cache.searchCacheEnabled() {
 						// cache search data
-						if cache.Config.CacheMaxItemCnt != 0 && int64(len(objects)) > cache.Config.CacheMaxItemCnt {
+						if cache.Config.CacheMaxItemCnt != 0 && int64(itemCnt) > cache.Config.CacheMaxItemCnt {
+							exp.add("%d items are more than CacheMaxItemCnt, search cache not set", itemCnt)
 							return
 						}
 
+						var ttl int64
+						kvPinned := pinned
+						if emptyResult {
+							if cache.Config.DisableEmptyResultCache {
+								cache.Logger.CtxInfo(ctx, "[AfterQuery] empty result for sql: %s, not cached", sql)
+								exp.add("empty result, search cache not set since DisableEmptyResultCache is on")
+								return
+							}
+							ttl = cache.Config.EmptyResultTTL
+							trackTTL := ttl
+							if trackTTL == 0 {
+								trackTTL = cache.Config.CacheTTL
+							}
+							if !cache.recordNegative(tableName, searchKey, negativeKeyValues, trackTTL) {
+								cache.Logger.CtxInfo(ctx, "[AfterQuery] too many empty results tracked for table %s, "+
+									"sql %s cached untracked", tableName, sql)
+								exp.add("too many empty results tracked, created rows invalidate the whole search cache")
+							}
+							kvPinned = false
+						}
+
 						cache.Logger.CtxInfo(ctx, "[AfterQuery] start to set search cache for sql: %s", sql)
-						cacheBytes, err := json.Marshal(db.Statement.Dest)
+						cacheBytes, err := payload.get()
 						if err != nil {
 							cache.Logger.CtxError(ctx, "[AfterQuery] cannot marshal cache for sql: %s, not cached", sql)
+							exp.add("marshal result error: %v, search cache not set", err)
 							return
 						}
-						cache.Logger.CtxInfo(ctx, "[AfterQuery] set cache: %v", string(cacheBytes))
-						err = cache.SetSearchCache(ctx, fmt.Sprintf("%d|", db.RowsAffected)+string(cacheBytes), tableName, sql, vars...)
+						cache.Logger.CtxInfo(ctx, "[AfterQuery] set cache: %v", cache.redact(string(cacheBytes)))
+						cache.recordDependencies(tableName, sql)
+						kv := util.Kv{
+							Key:    searchKey,
+							Value:  fmt.Sprintf("%d|", rowsAffected) + string(cacheBytes),
+							TTL:    ttl,
+							Pinned: kvPinned,
+						}
+						if !cache.beginWrite(ctx, tableName, kv) {
+							cache.Logger.CtxInfo(ctx, "[AfterQuery] sql %s is being or was recently cached with the same value, "+
+								"not rewritten", sql)
+							exp.add("search cache is being or was set with the same value within WriteDedupWindow, not rewritten")
+							return
+						}
+						written := false
+						defer func() { cache.endWrite(kv, written) }()
+						populated, err := cache.populateCache(ctx, tableName, seq, func(ctx context.Context) ([]string, error) {
+							return []string{kv.Key}, cache.storageOf(tableName).SetKey(ctx, kv)
+						}, func(ctx context.Context) {
+							cache.recordWrite(queryPrefix, kv)
+							if pageQuery {
+								cache.recordPage(ctx, tableName, searchKey, page)
+							}
+							cache.keepStale(ctx, tableName, staleKey, kv.Value)
+						})
 						if err != nil {
 							cache.Logger.CtxError(ctx, "[AfterQuery] set search cache for sql: %s error: %v", sql, err)
+							exp.add("set search cache error: %v", err)
 							return
 						}
+						if !populated {
+							cache.Logger.CtxInfo(ctx, "[AfterQuery] table %s invalidated during query, sql %s not cached",
+								tableName, sql)
+							exp.add("table %s invalidated during query, search cache not set", tableName)
+							return
+						}
+						written = true
 						cache.Logger.CtxInfo(ctx, "[AfterQuery] sql %s cached", sql)
+						exp.add("search cache set")
 					}
-				}()
+				})
 
-				go func() {
+				cache.goAsync(func() {
 					defer wg.Done()
+					defer cache.recoverPanic(ctx, "AfterQuery")
 
-					if cache.Config.CacheLevel == config.CacheLevelAll || cache.Config.CacheLevel == config.CacheLevelOnlyPrimary {
+					if cache.primaryCacheEnabled() {
 						// cache primary cache data
-						if len(primaryKeys) != len(objects) {
+						if !modelDest || len(primaryKeys) != len(objects) {
+							exp.add("dest %s is not complete models, primary cache not set", destType)
 							return
 						}
-						if cache.Config.CacheMaxItemCnt != 0 && int64(len(objects)) > cache.Config.CacheMaxItemCnt {
+						exceeded := cache.Config.CacheMaxItemCnt != 0 && int64(len(objects)) > cache.Config.CacheMaxItemCnt
+						if exceeded && cache.Config.MaxItemCntExceededMode != config.MaxItemCntExceededCachePrimary {
 							cache.Logger.CtxInfo(ctx, "[AfterQuery] objects length is more than max item count, not cached")
+							exp.add("%d objects are more than CacheMaxItemCnt, primary cache not set", len(objects))
 							return
 						}
 						kvs := make([]util.Kv, 0, len(objects))
 						for i := 0; i < len(objects); i++ {
-							jsonStr, err := json.Marshal(objects[i])
+							jsonStr, err := cache.jsonCodec().Marshal(objects[i])
 							if err != nil {
-								cache.Logger.CtxError(ctx, "[AfterQuery] object %v cannot marshal, not cached", objects[i])
+								cache.Logger.CtxError(ctx, "[AfterQuery] object %v cannot marshal, not cached",
+									cache.redact(objects[i]))
+								exp.add("marshal object error: %v, it's not set in primary cache", err)
 								continue
 							}
 							kvs = append(kvs, util.Kv{
-								Key:   primaryKeys[i],
-								Value: string(jsonStr),
+								Key:    primaryKeys[i],
+								Value:  string(jsonStr),
+								Pinned: pinned,
 							})
 						}
-						cache.Logger.CtxInfo(ctx, "[AfterQuery] start to set primary cache for kvs: %+v", kvs)
-						err := cache.BatchSetPrimaryKeyCache(ctx, tableName, kvs)
-						if err != nil {
-							cache.Logger.CtxError(ctx, "[AfterQuery] batch set primary key cache for key %v error: %v",
-								primaryKeys, err)
+						kvs = append(kvs, missing...)
+						if len(kvs) == 0 {
+							return
+						}
+						batches := [][]util.Kv{kvs}
+						if exceeded {
+							// rows are cached one bounded batch at a time, though the result as a whole isn't
+							batches = chunkKvs(kvs, cache.Config.CacheMaxItemCnt)
+							exp.add("%d objects are more than CacheMaxItemCnt, primary cache set in %d batches",
+								len(objects), len(batches))
+						} else if deferPrimaryCache(preloadBatch, primaryBatchItem{table: tableName, primaryTable: primaryTable,
+							seq: seq, kvs: kvs}) {
+							// written together with the query preloading it and its other preloads
+							exp.add("primary cache is set in batch with the preloading query")
+							return
+						}
+						cache.Logger.CtxInfo(ctx, "[AfterQuery] start to set primary cache for kvs: %+v", cache.redact(kvs))
+						for _, batch := range batches {
+							populated, err := cache.populateCache(ctx, tableName, seq, cache.primaryCacheSetter(primaryTable, batch),
+								func(ctx context.Context) {})
+							if err != nil {
+								cache.Logger.CtxError(ctx, "[AfterQuery] batch set primary key cache for key %v error: %v",
+									cache.redact(primaryKeys), err)
+								exp.add("set primary cache error: %v", err)
+								return
+							}
+							if !populated {
+								cache.Logger.CtxInfo(ctx, "[AfterQuery] table %s invalidated during query, primary cache not set",
+									tableName)
+								exp.add("table %s invalidated during query, primary cache not set", tableName)
+								return
+							}
+						}
+						exp.add("primary cache set for %d objects", len(kvs)-len(missing))
+						if len(missing) > 0 {
+							exp.add("%d keys not found are cached", len(missing))
 						}
 					}
-				}()
-				if !cache.Config.AsyncWrite {
+				})
+				if !cache.Config.AsyncCachePopulate {
 					wg.Wait()
 				}
 				return
@@ -305,20 +621,73 @@ func (h *queryHandler) AfterQuery() func(db *gorm.DB) {
 
 			// 应对缓存穿透 未来可能考虑使用其他过滤器实现：如布隆过滤器
 			if db.Error == gorm.ErrRecordNotFound && !cache.Config.DisableCachePenetrationProtect {
+				if kvs := cache.missingPrimaryKvs(db, nil); len(kvs) > 0 && cache.primaryCacheEnabled() {
+					cache.Logger.CtxInfo(ctx, "[AfterQuery] set primary cache of keys not found: %v", cache.redact(kvs))
+					populated, err := cache.populateCache(ctx, tableName, cache.querySeq(db),
+						cache.primaryCacheSetter(getStatementTableName(db), kvs),
+						func(ctx context.Context) {})
+					if err != nil {
+						cache.Logger.CtxError(ctx, "[AfterQuery] set primary cache of keys not found error: %v", err)
+						cache.explain(db, "set primary cache error: %v", err)
+					} else if populated {
+						cache.explain(db, "%d keys not found are cached", len(kvs))
+					}
+				}
+				if !cache.recordNegative(tableName, searchKey, getNegativeKeyValues(db), cache.Config.CacheTTL) {
+					cache.Logger.CtxInfo(ctx, "[AfterQuery] too many not-found results tracked for table %s, "+
+						"sql %s cached untracked", tableName, sql)
+					cache.explain(db, "too many not-found results tracked, created rows invalidate the whole search cache")
+				}
 				cache.Logger.CtxInfo(ctx, "[AfterQuery] set cache: %v", "recordNotFound")
-				err := cache.SetSearchCache(ctx, "recordNotFound", tableName, sql, vars...)
+				cache.recordDependencies(tableName, sql)
+				kv := util.Kv{Key: searchKey, Value: "recordNotFound"}
+				populated, err := cache.populateCache(ctx, tableName, cache.querySeq(db), func(ctx context.Context) ([]string, error) {
+					return []string{kv.Key}, cache.storageOf(tableName).SetKey(ctx, kv)
+				}, func(ctx context.Context) {
+					cache.recordWrite(cache.queryCachePrefix(db, tableName), kv)
+					if isPageQuery(db) {
+						cache.recordPage(ctx, tableName, searchKey, pageRangeOf(db, nil))
+					}
+				})
 				if err != nil {
 					cache.Logger.CtxError(ctx, "[AfterQuery] set search cache for sql: %s error: %v", sql, err)
+					cache.explain(db, "set search cache error: %v", err)
+					return
+				}
+				if !populated {
+					cache.Logger.CtxInfo(ctx, "[AfterQuery] table %s invalidated during query, sql %s not cached",
+						tableName, sql)
+					cache.explain(db, "table %s invalidated during query, not-found result not cached", tableName)
 					return
 				}
 				cache.Logger.CtxInfo(ctx, "[AfterQuery] sql %s cached", sql)
+				cache.explain(db, "not-found result cached")
 				return
 			}
+			if db.Error == gorm.ErrRecordNotFound {
+				cache.explain(db, "not-found result not cached since DisableCachePenetrationProtect is on")
+			} else if !isCacheSentinel(db.Error) {
+				cache.explain(db, "query error: %v, not cached", db.Error)
+			}
 		}()
 		// 之所以将上面的部分包在一个匿名函数中是为了方便
 		// 上面的cache完成后直接传播给其他等待中的goroutine
 		// 上面只处理非singleflight且无错误或记录不存在的情况
+		cache.flushPrimaryBatch(db)
 		h.fillCallAfterQuery(db)
+		if ctxObj, ok := db.InstanceGet(cache.stmtKey("ctx")); ok {
+			db.Statement.Context = ctxObj.(context.Context)
+		}
+
+		if cache.Config.VerifySamplesPerMinute > 0 && !cache.Config.ShadowMode {
+			cache.sampleVerify(db)
+		}
+
+		if cache.Config.TraceCacheHits {
+			annotateCacheHit(db)
+		}
+
+		servedFromCache := isServedFromCache(db.Error)
 
 		// 下面处理命中了缓存的情况
 		// 有以下几种err是专门用来传状态的：正常的cacheHit 这种情况不存在error
@@ -342,21 +711,129 @@ func (h *queryHandler) AfterQuery() func(db *gorm.DB) {
 		case util.SearchCacheHit, util.PrimaryCacheHit:
 			db.Error = nil
 		}
+
+		// gorm skips AfterFind hooks of queries served from cache
+		if servedFromCache && db.Error == nil && cache.Config.AfterCacheHit != nil {
+			cache.Config.AfterCacheHit(db)
+		}
+	}
+}
+
+// isServedFromCache checks if err tells that the query has been served from cache
+func isServedFromCache(err error) bool {
+	if merr, ok := err.(*multierror.Error); ok {
+		return errors.Is(merr.WrappedErrors()[0], util.SingleFlightHit)
+	}
+	return err == util.SearchCacheHit || err == util.PrimaryCacheHit
+}
+
+// annotateCacheHit prefixes sql of the statement served from cache with a comment telling the kind of hit,
+// gorm's trace log prints sql after all query callbacks run, so it's only visible there
+func annotateCacheHit(db *gorm.DB) {
+	var kind string
+	if merr, ok := db.Error.(*multierror.Error); ok && errors.Is(merr.WrappedErrors()[0], util.SingleFlightHit) {
+		kind = "single flight"
+	} else {
+		switch db.Error {
+		case util.SearchCacheHit, util.RecordNotFoundCacheHit:
+			kind = "search"
+		case util.PrimaryCacheHit:
+			kind = "primary"
+		default:
+			return
+		}
+	}
+	sql := db.Statement.SQL.String()
+	db.Statement.SQL.Reset()
+	db.Statement.SQL.WriteString("/* gorm-cache: " + kind + " hit */ " + sql)
+}
+
+// degradeBeforeQuery lets the query proceed uncached after BeforeQuery panicked
+func (c *Gorm2Cache) degradeBeforeQuery(db *gorm.DB) {
+	if errObj, ok := db.InstanceGet(c.stmtKey("error")); ok {
+		db.Error, _ = errObj.(error)
+	}
+	db.InstanceSet(c.stmtKey("bypass"), true)
+}
+
+// joinSingleFlight waits for the call in flight with the same key and takes over its results, joined reports if so.
+// Otherwise a new call is started, which is filled after query.
+func (h *QueryHandler) joinSingleFlight(ctx context.Context, db *gorm.DB, singleFlightKey string) (joined bool, hit bool) {
+	shard := h.singleFlight.shard(singleFlightKey)
+	shard.mu.Lock()
+	if shard.m == nil {
+		shard.m = make(map[string]*call)
+	}
+	if c, ok := shard.m[singleFlightKey]; ok {
+		c.dups++
+		shard.mu.Unlock()
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			// the waiter gives up rather than blocking until the query in flight finishes
+			h.cache.Logger.CtxInfo(ctx, "[BeforeQuery] context done while waiting for query in flight for key %v",
+				h.cache.redact(singleFlightKey))
+			db.Error = ctx.Err()
+			return true, false
+		}
+		if c.canceled {
+			h.cache.Logger.CtxInfo(ctx, "[BeforeQuery] query in flight for key %v was canceled, execute directly",
+				h.cache.redact(singleFlightKey))
+			return false, false
+		}
+
+		// the leader's dest is marshaled once for all waiters and its search cache
+		d, err := c.payload.get()
+		if err != nil {
+			_ = db.AddError(err)
+			return true, false
+		}
+		err = c.payload.codec.Unmarshal(d, db.Statement.Dest)
+		if err != nil {
+			_ = db.AddError(err)
+			return true, false
+		}
+		db.RowsAffected = c.rowsAffected
+		db.Error = multierror.Append(util.SingleFlightHit) // 为保证后续流程不走，必须设一个error
+		if c.err != nil {
+			db.Error = multierror.Append(db.Error, c.err)
+		}
+		h.cache.Logger.CtxInfo(ctx, "[BeforeQuery] single flight hit for key %v", h.cache.redact(singleFlightKey))
+		return true, true
+	}
+	if !h.singleFlight.reserve(h.cache.Config.MaxSingleFlightKeys) {
+		// too many keys in flight, execute directly without duplicate suppression
+		shard.mu.Unlock()
+		h.cache.IncrSingleFlightOverflowCount()
+		h.cache.Logger.CtxInfo(ctx, "[BeforeQuery] single flight is full, execute key %v directly",
+			h.cache.redact(singleFlightKey))
+		return false, false
 	}
+	c := &call{key: singleFlightKey, done: make(chan struct{})}
+	shard.m[singleFlightKey] = c
+	shard.mu.Unlock()
+	h.cache.addSingleFlightSize(1)
+	db.InstanceSet(h.cache.stmtKey("query:single_flight_call"), c)
+
+	// mark queries issued by hooks of this query as nested, the original context is restored after query
+	db.InstanceSet(h.cache.stmtKey("ctx"), db.Statement.Context)
+	db.Statement.Context = withNestedQuery(db.Statement.Context)
+	return false, false
 }
 
-func (h *queryHandler) fillCallAfterQuery(db *gorm.DB) {
-	if singleFlightCallObj, exist := db.InstanceGet("gorm:cache:query:single_flight_call"); exist {
+func (h *QueryHandler) fillCallAfterQuery(db *gorm.DB) {
+	if singleFlightCallObj, exist := db.InstanceGet(h.cache.stmtKey("query:single_flight_call")); exist {
 		c := singleFlightCallObj.(*call)
-		c.dest = db.Statement.Dest
+		c.payload = h.cache.destPayloadOf(db)
 		c.rowsAffected = db.RowsAffected
 		c.err = db.Error
-		c.wg.Done()
-
-		h.singleFlight.mu.Lock()
-		if !c.forgotten {
-			delete(h.singleFlight.m, c.key)
-		}
-		h.singleFlight.mu.Unlock()
+		c.canceled = isCanceledQuery(db)
+		close(c.done)
+
+		shard := h.singleFlight.shard(c.key)
+		shard.mu.Lock()
+		h.singleFlight.remove(shard, c)
+		shard.mu.Unlock()
+		h.cache.addSingleFlightSize(-1)
 	}
 }
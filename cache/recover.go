@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"context"
+	"runtime/debug"
+
+	"gorm.io/gorm"
+)
+
+// recoverCallback wraps callback fn with recover, so that a panic in cache never breaks the query path.
+// degrade is called after recovering to let the statement proceed uncached, it can be nil.
+func (c *Gorm2Cache) recoverCallback(funcName string, fn func(db *gorm.DB), degrade func(db *gorm.DB)) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		defer func() {
+			if r := recover(); r != nil {
+				c.handlePanic(db.Statement.Context, funcName, r)
+				if degrade != nil {
+					degrade(db)
+				}
+			}
+		}()
+		fn(db)
+	}
+}
+
+// recoverPanic recovers panic in goroutines started by callbacks, it must be deferred directly
+func (c *Gorm2Cache) recoverPanic(ctx context.Context, funcName string) {
+	if r := recover(); r != nil {
+		c.handlePanic(ctx, funcName, r)
+	}
+}
+
+func (c *Gorm2Cache) handlePanic(ctx context.Context, funcName string, r interface{}) {
+	c.IncrPanicCount()
+	c.Logger.CtxError(ctx, "[%s] recovered from panic: %v\n%s", funcName, r, debug.Stack())
+}
@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+)
+
+// withRetry wraps s so that its operations are retried as StorageRetry specifies
+func (c *Gorm2Cache) withRetry(s storage.DataStorage) storage.DataStorage {
+	policy := c.Config.StorageRetry
+	if policy == nil || policy.Attempts < 2 {
+		return s
+	}
+	return &retryStorage{DataStorage: s, policy: policy, logger: c.Logger}
+}
+
+// retryStorage retries failed operations of the storage it wraps
+type retryStorage struct {
+	storage.DataStorage
+	policy *config.RetryPolicy
+	logger util.LoggerInterface
+}
+
+func (r *retryStorage) retryable(err error) bool {
+	if r.policy.Retryable != nil {
+		return r.policy.Retryable(err)
+	}
+	return !errors.Is(err, storage.ErrCacheNotFound) && !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
+
+// do runs op and retries it with backoff while it fails with retryable errors
+func (r *retryStorage) do(ctx context.Context, read bool, op func() error) error {
+	err := op()
+	if read && !r.policy.RetryReads {
+		return err
+	}
+	backoff := r.policy.Backoff
+	for attempt := 1; err != nil && attempt < r.policy.Attempts && r.retryable(err); attempt++ {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			break
+		}
+		r.logger.CtxInfo(ctx, "[retryStorage] attempt %d failed: %v, retry in %v", attempt, err, backoff)
+		if backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return err
+			}
+		}
+		err = op()
+		backoff *= 2
+		if r.policy.MaxBackoff > 0 && backoff > r.policy.MaxBackoff {
+			backoff = r.policy.MaxBackoff
+		}
+	}
+	return err
+}
+
+func (r *retryStorage) BatchKeyExist(ctx context.Context, keys []string) (exists bool, err error) {
+	err = r.do(ctx, true, func() error {
+		exists, err = r.DataStorage.BatchKeyExist(ctx, keys)
+		return err
+	})
+	return exists, err
+}
+
+func (r *retryStorage) KeyExists(ctx context.Context, key string) (exists bool, err error) {
+	err = r.do(ctx, true, func() error {
+		exists, err = r.DataStorage.KeyExists(ctx, key)
+		return err
+	})
+	return exists, err
+}
+
+func (r *retryStorage) GetValue(ctx context.Context, key string) (value string, err error) {
+	err = r.do(ctx, true, func() error {
+		value, err = r.DataStorage.GetValue(ctx, key)
+		return err
+	})
+	return value, err
+}
+
+func (r *retryStorage) BatchGetValues(ctx context.Context, keys []string) (values []string, err error) {
+	err = r.do(ctx, true, func() error {
+		values, err = r.DataStorage.BatchGetValues(ctx, keys)
+		return err
+	})
+	return values, err
+}
+
+func (r *retryStorage) EntryCount(ctx context.Context, keyPrefix string) (cnt int64, err error) {
+	err = r.do(ctx, true, func() error {
+		cnt, err = r.DataStorage.EntryCount(ctx, keyPrefix)
+		return err
+	})
+	return cnt, err
+}
+
+func (r *retryStorage) Keys(ctx context.Context, keyPrefix string, cursor uint64, count int64) (keys []string,
+	next uint64, err error) {
+	err = r.do(ctx, true, func() error {
+		keys, next, err = r.DataStorage.Keys(ctx, keyPrefix, cursor, count)
+		return err
+	})
+	return keys, next, err
+}
+
+func (r *retryStorage) CleanCache(ctx context.Context) error {
+	return r.do(ctx, false, func() error {
+		return r.DataStorage.CleanCache(ctx)
+	})
+}
+
+func (r *retryStorage) DeleteKeysWithPrefix(ctx context.Context, keyPrefix string) error {
+	return r.do(ctx, false, func() error {
+		return r.DataStorage.DeleteKeysWithPrefix(ctx, keyPrefix)
+	})
+}
+
+func (r *retryStorage) DeleteKey(ctx context.Context, key string) error {
+	return r.do(ctx, false, func() error {
+		return r.DataStorage.DeleteKey(ctx, key)
+	})
+}
+
+func (r *retryStorage) BatchDeleteKeys(ctx context.Context, keys []string) error {
+	return r.do(ctx, false, func() error {
+		return r.DataStorage.BatchDeleteKeys(ctx, keys)
+	})
+}
+
+func (r *retryStorage) BatchSetKeys(ctx context.Context, kvs []util.Kv) error {
+	return r.do(ctx, false, func() error {
+		return r.DataStorage.BatchSetKeys(ctx, kvs)
+	})
+}
+
+func (r *retryStorage) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return r.do(ctx, false, func() error {
+		return r.DataStorage.Expire(ctx, key, ttl)
+	})
+}
+
+func (r *retryStorage) SetKey(ctx context.Context, kv util.Kv) error {
+	return r.do(ctx, false, func() error {
+		return r.DataStorage.SetKey(ctx, kv)
+	})
+}
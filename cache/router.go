@@ -0,0 +1,199 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+)
+
+// storageOf returns the storage which keeps cache of table, operations on it are retried as StorageRetry specifies
+// and values are checksummed if ValueChecksum is on
+func (c *Gorm2Cache) storageOf(tableName string) storage.DataStorage {
+	return c.wrapStorage(c.routeStorage(tableName))
+}
+
+// routeStorage returns the storage which keeps cache of table. Storages routed to by StorageRouter are initialized
+// on first use unless named in config, and an unavailableStorage is returned while the routed storage fails to
+// initialize, so that the table is uncached rather than cached in CacheStorage, where invalidations wouldn't go
+// once the routed storage is up.
+func (c *Gorm2Cache) routeStorage(tableName string) storage.DataStorage {
+	if c.Config.StorageRouter == nil {
+		return c.cache
+	}
+	s := c.Config.StorageRouter(tableName)
+	if s == nil || s == c.cache {
+		return c.cache
+	}
+	if _, ok := c.routedStorages.Load(s); ok {
+		return s
+	}
+	if err := c.initRoutedStorage(s); err != nil {
+		return &unavailableStorage{err: err}
+	}
+	return s
+}
+
+// routedInitRetryInterval is how long a routed storage failing to initialize is taken as unavailable before it's
+// initialized again
+const routedInitRetryInterval = 5 * time.Second
+
+type routedInitFailure struct {
+	err error
+	at  time.Time
+}
+
+// initRoutedStorage initializes s routed to by StorageRouter, it fails without initializing s again within
+// routedInitRetryInterval since it failed
+func (c *Gorm2Cache) initRoutedStorage(s storage.DataStorage) error {
+	if obj, ok := c.routedInitFailures.Load(s); ok {
+		if failure := obj.(*routedInitFailure); time.Since(failure.at) < routedInitRetryInterval {
+			return failure.err
+		}
+	}
+	err := s.Init(c.storageConfig(s))
+	if err != nil {
+		c.Logger.CtxError(context.Background(), "[initRoutedStorage] init storage %T error: %v", s, err)
+		c.routedInitFailures.Store(s, &routedInitFailure{err: err, at: time.Now()})
+		return err
+	}
+	c.routedInitFailures.Delete(s)
+	c.routedStorages.Store(s, struct{}{})
+	return nil
+}
+
+// initConfiguredRoutes initializes storages StorageRouter routes tables named in config to, so that Init fails
+// if any of them fails
+func (c *Gorm2Cache) initConfiguredRoutes() error {
+	if c.Config.StorageRouter == nil {
+		return nil
+	}
+	for _, tableName := range c.configuredTables() {
+		s := c.Config.StorageRouter(tableName)
+		if s == nil || s == c.cache {
+			continue
+		}
+		if _, ok := c.routedStorages.Load(s); ok {
+			continue
+		}
+		if err := c.initRoutedStorage(s); err != nil {
+			return fmt.Errorf("init storage %T of table %s: %w", s, tableName, err)
+		}
+	}
+	return nil
+}
+
+// storageUnavailable checks if the storage table is routed to is unavailable
+func (c *Gorm2Cache) storageUnavailable(tableName string) bool {
+	_, ok := c.routeStorage(tableName).(*unavailableStorage)
+	return ok
+}
+
+// unavailableStorage stands for a routed storage which fails to initialize: reads miss and writes are dropped,
+// while deletions fail since keys written by other processes sharing the storage can't be deleted
+type unavailableStorage struct {
+	storage.Null
+	err error
+}
+
+func (s *unavailableStorage) CleanCache(ctx context.Context) error {
+	return s.err
+}
+
+func (s *unavailableStorage) DeleteKeysWithPrefix(ctx context.Context, keyPrefix string) error {
+	return s.err
+}
+
+func (s *unavailableStorage) DeleteKey(ctx context.Context, key string) error {
+	return s.err
+}
+
+func (s *unavailableStorage) BatchDeleteKeys(ctx context.Context, keys []string) error {
+	return s.err
+}
+
+func (c *Gorm2Cache) storageConfig(s storage.DataStorage) *storage.Config {
+	conf := &storage.Config{
+		TTL:       c.Config.CacheTTL,
+		Debug:     c.Config.DebugMode,
+		Logger:    c.Logger,
+		Redact:    c.Config.LogRedactor,
+		KeyPrefix: c.keyPrefixOf(s),
+	}
+	// expired cache is retained only when it may be served
+	if len(c.Config.ServeStaleOnErrorTables) > 0 {
+		conf.GracePeriod = c.Config.StaleGracePeriod
+	}
+	return conf
+}
+
+// allStorages returns CacheStorage and the storages StorageRouter has routed to so far
+func (c *Gorm2Cache) allStorages() []storage.DataStorage {
+	storages := []storage.DataStorage{c.cache}
+	c.routedStorages.Range(func(key, _ interface{}) bool {
+		storages = append(storages, key.(storage.DataStorage))
+		return true
+	})
+	return storages
+}
+
+// keyPrefix returns prefix of cache keys of table
+func (c *Gorm2Cache) keyPrefix(tableName string) string {
+	return c.keyPrefixOf(c.routeStorage(tableName))
+}
+
+// keyPrefixOf returns prefix of cache keys kept in s, which is the prefix s provides if any, else KeyPrefix
+// if set, else it's generated from InstanceId
+func (c *Gorm2Cache) keyPrefixOf(s storage.DataStorage) string {
+	prefix := c.Config.KeyPrefix
+	if p, ok := s.(storage.KeyPrefixer); ok && p.KeyPrefix() != "" {
+		prefix = p.KeyPrefix()
+	}
+	if prefix == "" {
+		return util.GenKeyPrefix(c.InstanceId)
+	}
+	if c.Config.KeyPrefixWithInstance {
+		return prefix + ":" + c.InstanceId
+	}
+	return prefix
+}
+
+// checkKeyNamespaces checks at init that keys of the tables named in config can't fall into each other's
+// namespace, and that the key prefix is matched literally by storages deleting keys with a glob pattern
+func (c *Gorm2Cache) checkKeyNamespaces() error {
+	prefix := c.keyPrefixOf(c.cache)
+	if strings.ContainsAny(prefix, "*?[]\\") {
+		return fmt.Errorf("key prefix %q contains glob metacharacters, deleting its keys may delete keys of other prefixes",
+			prefix)
+	}
+	tables := c.configuredTables()
+	for _, a := range tables {
+		for _, b := range tables {
+			if a == b {
+				continue
+			}
+			if strings.HasPrefix(util.GenSearchCachePrefix(prefix, b)+":", util.GenSearchCachePrefix(prefix, a)+":") {
+				return fmt.Errorf("cache keys of table %q collide with keys of table %q", b, a)
+			}
+		}
+	}
+	return nil
+}
+
+// configuredTables returns tables named in config
+func (c *Gorm2Cache) configuredTables() []string {
+	var tables []string
+	for _, list := range [][]string{c.Config.Tables, c.Config.PinnedTables, c.Config.FullTableCacheTables,
+		c.Config.SearchFirstTables, c.Config.SlidingExpirationTables, c.Config.AsyncInvalidationTables,
+		c.Config.InvalidateBeforeWriteTables, c.Config.ServeStaleOnErrorTables} {
+		for _, tableName := range list {
+			if !util.ContainString(tableName, tables) {
+				tables = append(tables, tableName)
+			}
+		}
+	}
+	return tables
+}
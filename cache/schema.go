@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/asjdf/gorm-cache/util"
+	"gorm.io/gorm"
+)
+
+// OnSchemaChange purges all cache of table after its schema changed (e.g. a column was added or altered),
+// since cached payloads of the old schema may unmarshal into wrong zero values.
+// Migrations run through the cached db (e.g. AutoMigrate) call it automatically.
+func (c *Gorm2Cache) OnSchemaChange(ctx context.Context, tableName string) error {
+	if c.Config.TableNameResolver != nil {
+		tableName = c.Config.TableNameResolver(tableName)
+	}
+	c.Logger.CtxInfo(ctx, "[OnSchemaChange] purge all cache of table %s", tableName)
+	err := c.InvalidateAllPrimaryCache(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	return c.InvalidateSearchCache(ctx, tableName)
+}
+
+// AfterRaw purges cache of tables altered, dropped or truncated by raw sql, which includes migrations
+func AfterRaw(cache *Gorm2Cache) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil {
+			return
+		}
+		ctx := db.Statement.Context
+		for _, tableName := range util.GetAlteredTables(db.Statement.SQL.String()) {
+			err := cache.OnSchemaChange(ctx, tableName)
+			if err != nil {
+				cache.Logger.CtxError(ctx, "[AfterRaw] purging cache of table %s error: %v", tableName, err)
+			}
+		}
+	}
+}
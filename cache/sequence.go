@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// invalidationSeq numbers invalidations of every table, so that cache populated by a query which started
+// before an invalidation can be told apart and rejected
+type invalidationSeq struct {
+	all    int64    // bumped when the whole cache is reset
+	tables sync.Map // table name -> *int64
+}
+
+func (s *invalidationSeq) bump(tableName string) {
+	seq, _ := s.tables.LoadOrStore(tableName, new(int64))
+	atomic.AddInt64(seq.(*int64), 1)
+}
+
+func (s *invalidationSeq) bumpAll() {
+	atomic.AddInt64(&s.all, 1)
+}
+
+// load returns current sequence of table, it changes whenever the table or the whole cache is invalidated
+func (s *invalidationSeq) load(tableName string) int64 {
+	var seq int64
+	if v, ok := s.tables.Load(tableName); ok {
+		seq = atomic.LoadInt64(v.(*int64))
+	}
+	return seq + atomic.LoadInt64(&s.all)
+}
+
+// querySeq returns the invalidation sequence of table when the query of db started, -1 if the query didn't go
+// through BeforeQuery
+func (c *Gorm2Cache) querySeq(db *gorm.DB) int64 {
+	seqObj, ok := db.InstanceGet(c.stmtKey("seq"))
+	if !ok {
+		return -1
+	}
+	return seqObj.(int64)
+}
+
+// populateCache runs set, which writes cache keys for the result of a query, unless table has been invalidated
+// since seq the query started at. If an invalidation lands while set is running, the keys set returns are deleted
+// again. onPopulated is called once the cache is populated, which may be done later by a retry if set fails.
+// It reports whether the cache is populated.
+func (c *Gorm2Cache) populateCache(ctx context.Context, tableName string, seq int64,
+	set func(ctx context.Context) ([]string, error), onPopulated func(ctx context.Context)) (bool, error) {
+	if seq < 0 {
+		// query didn't go through BeforeQuery, nothing to compare with
+		_, err := set(ctx)
+		if err == nil {
+			onPopulated(ctx)
+		}
+		return err == nil, err
+	}
+	populated, err := c.populateSince(ctx, tableName, seq, set, onPopulated)
+	if err != nil {
+		c.retryPopulate(tableName, seq, set, onPopulated)
+	}
+	return populated, err
+}
+
+// populateSince runs set unless table has been invalidated since seq
+func (c *Gorm2Cache) populateSince(ctx context.Context, tableName string, seq int64,
+	set func(ctx context.Context) ([]string, error), onPopulated func(ctx context.Context)) (bool, error) {
+	if c.seqs.load(tableName) != seq {
+		return false, nil
+	}
+	keys, err := set(ctx)
+	if err != nil {
+		return false, err
+	}
+	if c.seqs.load(tableName) != seq {
+		c.Logger.CtxInfo(ctx, "[populateCache] table %s invalidated while populating, delete keys %v",
+			tableName, c.redact(keys))
+		return false, c.storageOf(tableName).BatchDeleteKeys(ctx, keys)
+	}
+	onPopulated(ctx)
+	return true, nil
+}
+
+// retryPopulate retries set in background as PopulateRetry specifies, until it succeeds or table is invalidated
+func (c *Gorm2Cache) retryPopulate(tableName string, seq int64,
+	set func(ctx context.Context) ([]string, error), onPopulated func(ctx context.Context)) {
+	policy := c.Config.PopulateRetry
+	if policy == nil || policy.Attempts <= 0 {
+		return
+	}
+	maxPending := policy.MaxPending
+	if maxPending <= 0 {
+		maxPending = 1000
+	}
+	ctx := context.Background()
+	if atomic.AddInt64(&c.populateRetries, 1) > maxPending {
+		atomic.AddInt64(&c.populateRetries, -1)
+		c.Logger.CtxInfo(ctx, "[retryPopulate] too many populations of table %s pending retry, dropped", tableName)
+		return
+	}
+	delay := policy.Delay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	c.goAsync(func() {
+		defer atomic.AddInt64(&c.populateRetries, -1)
+		defer c.recoverPanic(ctx, "retryPopulate")
+		for i := 0; i < policy.Attempts; i++ {
+			time.Sleep(delay)
+			delay *= 2
+			populated, err := c.populateSince(ctx, tableName, seq, set, onPopulated)
+			if err == nil {
+				if !populated {
+					c.Logger.CtxInfo(ctx, "[retryPopulate] table %s invalidated, retry given up", tableName)
+				}
+				return
+			}
+			c.Logger.CtxError(ctx, "[retryPopulate] retry %d of populating table %s error: %v", i+1, tableName, err)
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+
+	"github.com/asjdf/gorm-cache/util"
+	"gorm.io/gorm"
+)
+
+// shadowResult result the query would have been served from cache in ShadowMode
+type shadowResult struct {
+	dest     interface{}
+	notFound bool
+}
+
+// shadowLookup runs lookup with a copy of dest, so db is left as if the cache missed, and keeps the result
+// of a hit for checkShadow
+func (c *Gorm2Cache) shadowLookup(db *gorm.DB, lookup func() hitKind) hitKind {
+	dest, rowsAffected, err := db.Statement.Dest, db.RowsAffected, db.Error
+	defer func() {
+		db.Statement.Dest, db.RowsAffected, db.Error = dest, rowsAffected, err
+	}()
+	shadow := reflect.New(reflect.TypeOf(dest).Elem()).Interface()
+	db.Statement.Dest = shadow
+	hit := lookup()
+	if hit != noHit {
+		db.InstanceSet(c.stmtKey("shadow"), &shadowResult{
+			dest:     shadow,
+			notFound: db.Error == util.RecordNotFoundCacheHit,
+		})
+	}
+	return hit
+}
+
+// checkShadow compares result of the query with the one cache would have served, a mismatch means
+// the cache would have served outdated or wrong data
+func (c *Gorm2Cache) checkShadow(ctx context.Context, db *gorm.DB) {
+	obj, ok := db.InstanceGet(c.stmtKey("shadow"))
+	if !ok {
+		return
+	}
+	shadow := obj.(*shadowResult)
+	if db.Error != nil && db.Error != gorm.ErrRecordNotFound {
+		return
+	}
+	matched := shadow.notFound == (db.Error == gorm.ErrRecordNotFound)
+	if matched && !shadow.notFound {
+		cached, err := json.Marshal(shadow.dest)
+		if err != nil {
+			return
+		}
+		actual, err := json.Marshal(db.Statement.Dest)
+		if err != nil {
+			return
+		}
+		matched = bytes.Equal(cached, actual)
+	}
+	if !matched {
+		c.IncrShadowMismatchCount()
+		c.Logger.CtxInfo(ctx, "[AfterQuery] shadow hit mismatched, cached %v, actual %v",
+			c.redact(shadow.dest), c.redact(db.Statement.Dest))
+	}
+}
@@ -1,45 +1,117 @@
 package cache
 
-import "sync"
+import (
+	"sync"
+	"sync/atomic"
+
+	jsoniter "github.com/json-iterator/go"
+	"gorm.io/gorm"
+)
 
 // call is an in-flight or completed singleflight.Do call
 type call struct {
-	wg sync.WaitGroup
+	done chan struct{} // closed when the call is filled
 
 	key string
 
 	// These fields will storage final result and will
-	// be written once before the WaitGroup is done
-	// and are only read after the WaitGroup is done.
-	dest         interface{}
+	// be written once before done is closed
+	// and are only read after done is closed.
+	payload      *destPayload // dest of the query, waiters unmarshal it into their own dest
 	rowsAffected int64
 	err          error
+	canceled     bool // the query was canceled, so its result may be partial and isn't taken over
 
 	// forgotten indicates whether Forget was called with this call's key
 	// while the call was still in flight.
 	forgotten bool
 
-	// These fields are read and written with the singleFlight
-	// mutex held before the WaitGroup is done, and are read but
-	// not written after the WaitGroup is done.
+	// These fields are read and written with the mutex of the
+	// group shard held before done is closed, and are read but
+	// not written after done is closed.
 	dups int
 }
 
+// singleFlightShards count of shards of Group, keys are spread over them so that queries of
+// different keys rarely contend for one mutex
+const singleFlightShards = 32
+
+type groupShard struct {
+	mu sync.Mutex       // protects m
+	m  map[string]*call // lazily initialized
+}
+
 // Group represents a class of work and forms a namespace in
 // which units of work can be executed with duplicate suppression.
 type Group struct {
-	mu sync.Mutex       // protects m
-	m  map[string]*call // lazily initialized
+	shards [singleFlightShards]groupShard
+	size   int64 // calls in all shards
+}
+
+// shard returns the shard which key belongs to
+func (g *Group) shard(key string) *groupShard {
+	// inlined FNV-1a, which doesn't allocate
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &g.shards[h%singleFlightShards]
+}
+
+// reserve counts a new call in, it reports false if max calls are in flight already, 0 represents no limit
+func (g *Group) reserve(max int64) bool {
+	n := atomic.AddInt64(&g.size, 1)
+	if max > 0 && n > max {
+		atomic.AddInt64(&g.size, -1)
+		return false
+	}
+	return true
+}
+
+// remove deletes c from its shard unless it has been forgotten, the shard mutex must be held
+func (g *Group) remove(shard *groupShard, c *call) {
+	if !c.forgotten {
+		delete(shard.m, c.key)
+		atomic.AddInt64(&g.size, -1)
+	}
 }
 
 // Forget tells the singleflight to forget about a key.  Future calls
 // to Do for this key will call the function rather than waiting for
 // an earlier call to complete.
 func (g *Group) Forget(key string) {
-	g.mu.Lock()
-	if c, ok := g.m[key]; ok {
+	shard := g.shard(key)
+	shard.mu.Lock()
+	if c, ok := shard.m[key]; ok {
+		g.remove(shard, c)
 		c.forgotten = true
 	}
-	delete(g.m, key)
-	g.mu.Unlock()
+	shard.mu.Unlock()
+}
+
+// destPayload marshals dest of a query once, for both its search cache and the waiters of its single flight call
+type destPayload struct {
+	once  sync.Once
+	dest  interface{}
+	codec jsoniter.API
+	bytes []byte
+	err   error
+}
+
+func (p *destPayload) get() ([]byte, error) {
+	p.once.Do(func() {
+		p.bytes, p.err = p.codec.Marshal(p.dest)
+	})
+	return p.bytes, p.err
+}
+
+// destPayloadOf returns the payload of db's dest, which is created on first call
+func (c *Gorm2Cache) destPayloadOf(db *gorm.DB) *destPayload {
+	if p, ok := db.InstanceGet(c.stmtKey("payload")); ok {
+		return p.(*destPayload)
+	}
+	p := &destPayload{dest: db.Statement.Dest, codec: c.jsonCodec()}
+	db.InstanceSet(c.stmtKey("payload"), p)
+	return p
 }
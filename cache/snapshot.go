@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+)
+
+const defaultStatsSnapshotInterval = 60000
+
+// statsSnapshot counters of stats saved in storage
+type statsSnapshot struct {
+	HitCount                  uint64   `json:"hit"`
+	MissCount                 uint64   `json:"miss"`
+	BypassCount               uint64   `json:"bypass"`
+	PrimaryHitCount           uint64   `json:"primary_hit"`
+	SearchHitCount            uint64   `json:"search_hit"`
+	SingleFlightHitCount      uint64   `json:"single_flight_hit"`
+	SingleFlightOverflowCount uint64   `json:"single_flight_overflow"`
+	PanicCount                uint64   `json:"panic"`
+	ShadowMismatchCount       uint64   `json:"shadow_mismatch"`
+	VerifiedCount             uint64   `json:"verified"`
+	StaleServeCount           uint64   `json:"stale_serve"`
+	DivergenceCount           uint64   `json:"divergence"`
+	CorruptCount              uint64   `json:"corrupt"`
+	PayloadSizeCounts         []uint64 `json:"payload_size_counts"`
+	PayloadSizeSum            uint64   `json:"payload_size_sum"`
+}
+
+func (st *stats) snapshot() statsSnapshot {
+	s := statsSnapshot{
+		HitCount:                  st.HitCount(),
+		MissCount:                 st.MissCount(),
+		BypassCount:               st.BypassCount(),
+		PrimaryHitCount:           st.PrimaryHitCount(),
+		SearchHitCount:            st.SearchHitCount(),
+		SingleFlightHitCount:      st.SingleFlightHitCount(),
+		SingleFlightOverflowCount: st.SingleFlightOverflowCount(),
+		PanicCount:                st.PanicCount(),
+		ShadowMismatchCount:       st.ShadowMismatchCount(),
+		VerifiedCount:             st.VerifiedCount(),
+		StaleServeCount:           st.StaleServeCount(),
+		DivergenceCount:           st.DivergenceCount(),
+		CorruptCount:              st.CorruptCount(),
+		PayloadSizeCounts:         make([]uint64, len(st.payloadSizeCounts)),
+		PayloadSizeSum:            atomic.LoadUint64(&st.payloadSizeSum),
+	}
+	for i := range st.payloadSizeCounts {
+		s.PayloadSizeCounts[i] = atomic.LoadUint64(&st.payloadSizeCounts[i])
+	}
+	return s
+}
+
+// restore adds counters of snapshot to stats
+func (st *stats) restore(s statsSnapshot) {
+	atomic.AddUint64(&st.hitCount, s.HitCount)
+	atomic.AddUint64(&st.missCount, s.MissCount)
+	atomic.AddUint64(&st.bypassCount, s.BypassCount)
+	atomic.AddUint64(&st.primaryHitCount, s.PrimaryHitCount)
+	atomic.AddUint64(&st.searchHitCount, s.SearchHitCount)
+	atomic.AddUint64(&st.singleFlightHitCount, s.SingleFlightHitCount)
+	atomic.AddUint64(&st.singleFlightOverflowCount, s.SingleFlightOverflowCount)
+	atomic.AddUint64(&st.panicCount, s.PanicCount)
+	atomic.AddUint64(&st.shadowMismatchCount, s.ShadowMismatchCount)
+	atomic.AddUint64(&st.verifiedCount, s.VerifiedCount)
+	atomic.AddUint64(&st.staleServeCount, s.StaleServeCount)
+	atomic.AddUint64(&st.divergenceCount, s.DivergenceCount)
+	atomic.AddUint64(&st.corruptCount, s.CorruptCount)
+	for i := 0; i < len(s.PayloadSizeCounts) && i < len(st.payloadSizeCounts); i++ {
+		atomic.AddUint64(&st.payloadSizeCounts[i], s.PayloadSizeCounts[i])
+	}
+	atomic.AddUint64(&st.payloadSizeSum, s.PayloadSizeSum)
+}
+
+// statsSnapshotKey returns the key stats are saved under
+func (c *Gorm2Cache) statsSnapshotKey() string {
+	return util.GenStatsSnapshotKey(c.keyPrefixOf(c.cache), c.Config.StatsSnapshotKey)
+}
+
+// SaveStats saves stats in storage under StatsSnapshotKey, it does nothing if StatsSnapshotKey is empty
+func (c *Gorm2Cache) SaveStats(ctx context.Context) error {
+	if c.Config.StatsSnapshotKey == "" {
+		return nil
+	}
+	data, err := json.Marshal(c.stats.snapshot())
+	if err != nil {
+		return err
+	}
+	// unlike cache, the snapshot must outlive CacheTTL until the next restart
+	return c.wrapStorage(c.cache).SetKey(ctx, util.Kv{Key: c.statsSnapshotKey(), Value: string(data), Pinned: true})
+}
+
+// loadStats restores stats saved under StatsSnapshotKey
+func (c *Gorm2Cache) loadStats(ctx context.Context) error {
+	data, err := c.wrapStorage(c.cache).GetValue(ctx, c.statsSnapshotKey())
+	if errors.Is(err, storage.ErrCacheNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var s statsSnapshot
+	err = json.Unmarshal([]byte(data), &s)
+	if err != nil {
+		return err
+	}
+	c.stats.restore(s)
+	return nil
+}
+
+// startStatsSnapshot loads saved stats and saves stats every StatsSnapshotInterval until the cache is closed
+func (c *Gorm2Cache) startStatsSnapshot() {
+	if c.Config.StatsSnapshotKey == "" {
+		return
+	}
+	ctx := context.Background()
+	if err := c.loadStats(ctx); err != nil {
+		c.Logger.CtxError(ctx, "[startStatsSnapshot] load stats from %s error: %v", c.Config.StatsSnapshotKey, err)
+	}
+	interval := c.Config.StatsSnapshotInterval
+	if interval <= 0 {
+		interval = defaultStatsSnapshotInterval
+	}
+	c.snapshotStopped = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.closed:
+				close(c.snapshotStopped)
+				return
+			case <-ticker.C:
+			}
+			if err := c.SaveStats(ctx); err != nil {
+				c.Logger.CtxError(ctx, "[startStatsSnapshot] save stats to %s error: %v", c.Config.StatsSnapshotKey, err)
+			}
+		}
+	}()
+}
+
+// Close stops background work of the cache, stats are saved a last time if StatsSnapshotKey is set.
+// The cache keeps serving dbs it's attached to, detach them with DetachFromDB to stop using it.
+func (c *Gorm2Cache) Close() error {
+	first := false
+	c.closeOnce.Do(func() {
+		first = c.closed != nil
+		if first {
+			close(c.closed)
+		}
+	})
+	if !first || c.snapshotStopped == nil {
+		return nil
+	}
+	<-c.snapshotStopped
+	return c.SaveStats(context.Background())
+}
+
+// ResetStats resets all stats without touching cache, saved stats are reset as well
+func (c *Gorm2Cache) ResetStats() error {
+	c.stats.ResetHitCount()
+	return c.SaveStats(context.Background())
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+type sourceKey struct{}
+
+// Source where the result of a query came from
+type Source int32
+
+const (
+	// SourceUnknown the query didn't run through the cache
+	SourceUnknown Source = iota
+	// SourceDatabase the query was served by the database, either cache missed or it was bypassed
+	SourceDatabase
+	// SourcePrimaryCache the query was served by primary cache
+	SourcePrimaryCache
+	// SourceSearchCache the query was served by search cache, including full table cache
+	SourceSearchCache
+	// SourceSingleFlight the query took over the result of an identical query in flight
+	SourceSingleFlight
+	// SourceStaleCache the query failed in database and was served by its stale result
+	SourceStaleCache
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceDatabase:
+		return "database"
+	case SourcePrimaryCache:
+		return "primary cache"
+	case SourceSearchCache:
+		return "search cache"
+	case SourceSingleFlight:
+		return "single flight"
+	case SourceStaleCache:
+		return "stale cache"
+	default:
+		return "unknown"
+	}
+}
+
+// FromCache reports whether the result came from cache rather than the database, e.g. for an X-Cache: HIT header
+func (s Source) FromCache() bool {
+	return s == SourcePrimaryCache || s == SourceSearchCache || s == SourceSingleFlight || s == SourceStaleCache
+}
+
+func sourceOfHit(hit hitKind) Source {
+	switch hit {
+	case primaryHit:
+		return SourcePrimaryCache
+	case searchHit:
+		return SourceSearchCache
+	case singleFlightHit:
+		return SourceSingleFlight
+	default:
+		return SourceDatabase
+	}
+}
+
+// sourceRecorder keeps the source of the last query run within a context returned by WithSource
+type sourceRecorder struct {
+	last int32
+}
+
+// WithSource returns a copy of ctx in which the cache records where results of queries come from,
+// SourceFromCtx returns the source of the last query.
+func WithSource(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(sourceKey{}).(*sourceRecorder); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, sourceKey{}, &sourceRecorder{})
+}
+
+// SourceFromCtx returns the source of the last query run within ctx, which must be returned by WithSource.
+// Queries issued by the query, e.g. by Preload, finish before it, so it's the last one.
+// SourceUnknown if there is none.
+func SourceFromCtx(ctx context.Context) Source {
+	r, ok := ctx.Value(sourceKey{}).(*sourceRecorder)
+	if !ok {
+		return SourceUnknown
+	}
+	return Source(atomic.LoadInt32(&r.last))
+}
+
+// SourceOf returns the source of the query run by db, e.g. the *gorm.DB returned by Find.
+// SourceUnknown if the query didn't run through the cache.
+func (c *Gorm2Cache) SourceOf(db *gorm.DB) Source {
+	if obj, ok := db.InstanceGet(c.stmtKey("source")); ok {
+		return obj.(Source)
+	}
+	return SourceUnknown
+}
+
+// setSource records the source of the query of db
+func (c *Gorm2Cache) setSource(db *gorm.DB, source Source) {
+	db.InstanceSet(c.stmtKey("source"), source)
+}
+
+// finishSource makes the source of the query of db the last one of its context, the database if none was set
+func (c *Gorm2Cache) finishSource(db *gorm.DB) {
+	source := c.SourceOf(db)
+	if source == SourceUnknown {
+		source = SourceDatabase
+		c.setSource(db, source)
+	}
+	ctx := db.Statement.Context
+	if ctxObj, ok := db.InstanceGet(c.stmtKey("ctx")); ok {
+		ctx = ctxObj.(context.Context)
+	}
+	if ctx == nil {
+		return
+	}
+	if r, ok := ctx.Value(sourceKey{}).(*sourceRecorder); ok {
+		atomic.StoreInt32(&r.last, int32(source))
+	}
+}
@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/hashicorp/go-multierror"
+	"gorm.io/gorm"
+)
+
+// shouldKeepStale checks if results of queries of table are kept for serving when database fails
+func (c *Gorm2Cache) shouldKeepStale(tableName string) bool {
+	return (c.Config.CacheLevel == config.CacheLevelAll || c.Config.CacheLevel == config.CacheLevelOnlySearch) &&
+		util.ContainString(tableName, c.Config.ServeStaleOnErrorTables)
+}
+
+// staleKeyOf returns the key the result of the query of db is kept under for serving stale, "" if it's not kept
+func (c *Gorm2Cache) staleKeyOf(db *gorm.DB) string {
+	staleKey, ok := db.InstanceGet(c.stmtKey("stale_key"))
+	if !ok {
+		return ""
+	}
+	return staleKey.(string)
+}
+
+// keepStale keeps value, which has just been set as search cache of a query, under its staleKey
+// for StaleGracePeriod longer than CacheTTL, unless the storage retains expired cache itself
+func (c *Gorm2Cache) keepStale(ctx context.Context, tableName string, staleKey string, value string) {
+	if staleKey == "" {
+		return
+	}
+	if _, ok := c.routeStorage(tableName).(storage.StaleGetter); ok {
+		return
+	}
+	var ttl int64
+	if c.Config.CacheTTL > 0 {
+		ttl = c.Config.CacheTTL + c.Config.StaleGracePeriod
+	}
+	err := c.storageOf(tableName).SetKey(ctx, util.Kv{Key: staleKey, Value: value, TTL: ttl})
+	if err != nil {
+		c.Logger.CtxError(ctx, "[keepStale] set stale cache error: %v", err)
+	}
+}
+
+// serveStale fills db with the stale result of its query after the query failed in database, it reports if served
+func (c *Gorm2Cache) serveStale(ctx context.Context, db *gorm.DB, tableName string) bool {
+	staleKey, ok := db.InstanceGet(c.stmtKey("stale_key"))
+	if !ok || isCacheSentinel(db.Error) {
+		return false
+	}
+	value, key, err := c.getStale(ctx, db, tableName, staleKey.(string))
+	if err != nil {
+		return false
+	}
+	rowsAffectedPos := strings.Index(value, "|")
+	if rowsAffectedPos < 0 {
+		return false
+	}
+	rowsAffected, err := strconv.ParseInt(value[:rowsAffectedPos], 10, 64)
+	if err != nil {
+		c.evictCorrupt(ctx, tableName, []string{key})
+		return false
+	}
+	if err := c.jsonCodec().Unmarshal([]byte(value[rowsAffectedPos+1:]), db.Statement.Dest); err != nil {
+		c.Logger.CtxError(ctx, "[serveStale] unmarshal stale cache error: %v", err)
+		c.evictCorrupt(ctx, tableName, []string{key})
+		resetDest(db)
+		return false
+	}
+	c.Logger.CtxError(ctx, "[serveStale] query of table %s failed: %v, serve stale result", tableName, db.Error)
+	c.IncrStaleServeCount()
+	db.RowsAffected = rowsAffected
+	db.Error = nil
+	return true
+}
+
+// getStale gets the stale result of the query of db and the key it's read from, from its search cache retained
+// after expiration if the storage supports it, else from staleKey
+func (c *Gorm2Cache) getStale(ctx context.Context, db *gorm.DB, tableName string, staleKey string) (string, string, error) {
+	if s, ok := c.routeStorage(tableName).(storage.StaleGetter); ok {
+		searchKeyObj, _ := db.InstanceGet(c.stmtKey("search_key"))
+		searchKey := searchKeyObj.(string)
+		value, _, err := s.GetStale(ctx, searchKey)
+		if err != nil || !c.Config.ValueChecksum {
+			return value, searchKey, err
+		}
+		value, ok := openValue(value)
+		if !ok {
+			c.IncrCorruptCount()
+			return "", searchKey, storage.ErrCacheNotFound
+		}
+		return value, searchKey, nil
+	}
+	value, err := c.storageOf(tableName).GetValue(ctx, staleKey)
+	return value, staleKey, err
+}
+
+// isCacheSentinel checks if err is one of the errors the cache uses to pass states between callbacks
+func isCacheSentinel(err error) bool {
+	if _, ok := err.(*multierror.Error); ok {
+		return true
+	}
+	switch err {
+	case util.RecordNotFoundCacheHit, util.PrimaryCacheHit, util.SearchCacheHit, util.SingleFlightHit,
+		util.ErrCacheUnmarshal, util.ErrCacheLoadFailed:
+		return true
+	}
+	return false
+}
@@ -7,17 +7,103 @@ type StatsAccessor interface {
 	MissCount() uint64
 	LookupCount() uint64
 	HitRate() float64
+	PrimaryHitCount() uint64
+	SearchHitCount() uint64
+	SingleFlightHitCount() uint64
+	HitRateBreakdown() HitRateBreakdown
+	BypassCount() uint64
+	SingleFlightSize() int64
+	SingleFlightOverflowCount() uint64
+	PanicCount() uint64
+	ShadowMismatchCount() uint64
+	VerifiedCount() uint64
+	StaleServeCount() uint64
+	DivergenceCount() uint64
+	CorruptCount() uint64
+	PayloadSizeHistogram() PayloadSizeHistogram
+}
+
+// payloadSizeBuckets upper bounds in bytes of payload size histogram buckets
+var payloadSizeBuckets = [...]int{256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+
+// PayloadSizeHistogram sizes of values written to cache, Counts[i] is count of values no larger than
+// Buckets[i] (and larger than Buckets[i-1]), Counts[len(Buckets)] is count of values larger than all buckets
+type PayloadSizeHistogram struct {
+	Buckets []int
+	Counts  []uint64
+	Count   uint64 // count of all values
+	Sum     uint64 // total size of all values in bytes
+}
+
+// HitRateBreakdown hit rates of each kind of hit, they add up to HitRate
+type HitRateBreakdown struct {
+	Primary      float64 // served from primary cache
+	Search       float64 // served from search cache
+	SingleFlight float64 // took over result of the same query in flight
+}
+
+type hitKind int
+
+const (
+	noHit hitKind = iota
+	primaryHit
+	searchHit
+	singleFlightHit
+)
+
+func (k hitKind) String() string {
+	switch k {
+	case primaryHit:
+		return "primary"
+	case searchHit:
+		return "search"
+	case singleFlightHit:
+		return "single flight"
+	}
+	return "no"
 }
 
 // statistics
 type stats struct {
-	hitCount  uint64
-	missCount uint64
+	hitCount    uint64
+	missCount   uint64
+	bypassCount uint64
+
+	primaryHitCount      uint64
+	searchHitCount       uint64
+	singleFlightHitCount uint64
+
+	singleFlightSize          int64
+	singleFlightOverflowCount uint64
+	panicCount                uint64
+	shadowMismatchCount       uint64
+	verifiedCount             uint64
+	staleServeCount           uint64
+	divergenceCount           uint64
+	corruptCount              uint64
+
+	payloadSizeCounts [len(payloadSizeBuckets) + 1]uint64
+	payloadSizeSum    uint64
 }
 
 func (st *stats) ResetHitCount() {
 	atomic.StoreUint64(&st.hitCount, 0)
+	atomic.StoreUint64(&st.primaryHitCount, 0)
+	atomic.StoreUint64(&st.searchHitCount, 0)
+	atomic.StoreUint64(&st.singleFlightHitCount, 0)
 	atomic.StoreUint64(&st.missCount, 0)
+	atomic.StoreUint64(&st.bypassCount, 0)
+	atomic.StoreUint64(&st.singleFlightOverflowCount, 0)
+	atomic.StoreUint64(&st.panicCount, 0)
+	atomic.StoreUint64(&st.shadowMismatchCount, 0)
+	atomic.StoreUint64(&st.verifiedCount, 0)
+	atomic.StoreUint64(&st.staleServeCount, 0)
+	atomic.StoreUint64(&st.divergenceCount, 0)
+	atomic.StoreUint64(&st.corruptCount, 0)
+	for i := range st.payloadSizeCounts {
+		atomic.StoreUint64(&st.payloadSizeCounts[i], 0)
+	}
+	atomic.StoreUint64(&st.payloadSizeSum, 0)
 }
 
 // IncrHitCount increase hit count
@@ -25,21 +111,165 @@ func (st *stats) IncrHitCount() uint64 {
 	return atomic.AddUint64(&st.hitCount, 1)
 }
 
+// incrHit increase hit count and count of given kind of hit
+func (st *stats) incrHit(kind hitKind) {
+	switch kind {
+	case primaryHit:
+		atomic.AddUint64(&st.primaryHitCount, 1)
+	case searchHit:
+		atomic.AddUint64(&st.searchHitCount, 1)
+	case singleFlightHit:
+		atomic.AddUint64(&st.singleFlightHitCount, 1)
+	}
+	st.IncrHitCount()
+}
+
 // IncrMissCount increase miss count
 func (st *stats) IncrMissCount() uint64 {
 	return atomic.AddUint64(&st.missCount, 1)
 }
 
+// IncrBypassCount increase count of queries that bypassed cache
+func (st *stats) IncrBypassCount() uint64 {
+	return atomic.AddUint64(&st.bypassCount, 1)
+}
+
+// IncrSingleFlightOverflowCount increase count of queries executed directly because single flight was full
+func (st *stats) IncrSingleFlightOverflowCount() uint64 {
+	return atomic.AddUint64(&st.singleFlightOverflowCount, 1)
+}
+
+// IncrPanicCount increase count of panics recovered in callbacks
+func (st *stats) IncrPanicCount() uint64 {
+	return atomic.AddUint64(&st.panicCount, 1)
+}
+
+// IncrShadowMismatchCount increase count of shadow hits whose cached result differed from the database's
+func (st *stats) IncrShadowMismatchCount() uint64 {
+	return atomic.AddUint64(&st.shadowMismatchCount, 1)
+}
+
+// IncrVerifiedCount increase count of sampled cache hits verified against the database
+func (st *stats) IncrVerifiedCount() uint64 {
+	return atomic.AddUint64(&st.verifiedCount, 1)
+}
+
+// IncrDivergenceCount increase count of verified cache hits which differed from the database
+func (st *stats) IncrDivergenceCount() uint64 {
+	return atomic.AddUint64(&st.divergenceCount, 1)
+}
+
+// IncrCorruptCount increase count of cache entries which failed checksum or couldn't be unmarshaled
+func (st *stats) IncrCorruptCount() uint64 {
+	return atomic.AddUint64(&st.corruptCount, 1)
+}
+
+// IncrStaleServeCount increase count of failed queries served with stale results
+func (st *stats) IncrStaleServeCount() uint64 {
+	return atomic.AddUint64(&st.staleServeCount, 1)
+}
+
+func (st *stats) observePayloadSize(size int) {
+	bucket := len(payloadSizeBuckets)
+	for i, bound := range payloadSizeBuckets {
+		if size <= bound {
+			bucket = i
+			break
+		}
+	}
+	atomic.AddUint64(&st.payloadSizeCounts[bucket], 1)
+	atomic.AddUint64(&st.payloadSizeSum, uint64(size))
+}
+
+func (st *stats) addSingleFlightSize(delta int64) {
+	atomic.AddInt64(&st.singleFlightSize, delta)
+}
+
 // HitCount returns hit count
 func (st *stats) HitCount() uint64 {
 	return atomic.LoadUint64(&st.hitCount)
 }
 
+// PrimaryHitCount returns count of hits served from primary cache
+func (st *stats) PrimaryHitCount() uint64 {
+	return atomic.LoadUint64(&st.primaryHitCount)
+}
+
+// SearchHitCount returns count of hits served from search cache
+func (st *stats) SearchHitCount() uint64 {
+	return atomic.LoadUint64(&st.searchHitCount)
+}
+
+// SingleFlightHitCount returns count of hits which took over result of the same query in flight
+func (st *stats) SingleFlightHitCount() uint64 {
+	return atomic.LoadUint64(&st.singleFlightHitCount)
+}
+
 // MissCount returns miss count
 func (st *stats) MissCount() uint64 {
 	return atomic.LoadUint64(&st.missCount)
 }
 
+// BypassCount returns count of queries that bypassed cache, e.g. for having too many vars
+func (st *stats) BypassCount() uint64 {
+	return atomic.LoadUint64(&st.bypassCount)
+}
+
+// SingleFlightSize returns count of keys currently in flight
+func (st *stats) SingleFlightSize() int64 {
+	return atomic.LoadInt64(&st.singleFlightSize)
+}
+
+// SingleFlightOverflowCount returns count of queries executed directly because single flight was full
+func (st *stats) SingleFlightOverflowCount() uint64 {
+	return atomic.LoadUint64(&st.singleFlightOverflowCount)
+}
+
+// PanicCount returns count of panics recovered in callbacks
+func (st *stats) PanicCount() uint64 {
+	return atomic.LoadUint64(&st.panicCount)
+}
+
+// ShadowMismatchCount returns count of shadow hits whose cached result differed from the database's,
+// it's only counted in ShadowMode
+func (st *stats) ShadowMismatchCount() uint64 {
+	return atomic.LoadUint64(&st.shadowMismatchCount)
+}
+
+// VerifiedCount returns count of sampled cache hits verified against the database
+func (st *stats) VerifiedCount() uint64 {
+	return atomic.LoadUint64(&st.verifiedCount)
+}
+
+// DivergenceCount returns count of verified cache hits which differed from the database
+func (st *stats) DivergenceCount() uint64 {
+	return atomic.LoadUint64(&st.divergenceCount)
+}
+
+// CorruptCount returns count of cache entries which failed checksum or couldn't be unmarshaled, they are evicted
+func (st *stats) CorruptCount() uint64 {
+	return atomic.LoadUint64(&st.corruptCount)
+}
+
+// StaleServeCount returns count of failed queries served with stale results
+func (st *stats) StaleServeCount() uint64 {
+	return atomic.LoadUint64(&st.staleServeCount)
+}
+
+// PayloadSizeHistogram returns histogram of sizes of values written to cache
+func (st *stats) PayloadSizeHistogram() PayloadSizeHistogram {
+	h := PayloadSizeHistogram{
+		Buckets: append([]int(nil), payloadSizeBuckets[:]...),
+		Counts:  make([]uint64, len(st.payloadSizeCounts)),
+		Sum:     atomic.LoadUint64(&st.payloadSizeSum),
+	}
+	for i := range st.payloadSizeCounts {
+		h.Counts[i] = atomic.LoadUint64(&st.payloadSizeCounts[i])
+		h.Count += h.Counts[i]
+	}
+	return h
+}
+
 // LookupCount returns lookup count
 func (st *stats) LookupCount() uint64 {
 	return st.HitCount() + st.MissCount()
@@ -54,3 +284,16 @@ func (st *stats) HitRate() float64 {
 	}
 	return float64(hc) / float64(total)
 }
+
+// HitRateBreakdown returns hit rates of primary, search and single flight hits
+func (st *stats) HitRateBreakdown() HitRateBreakdown {
+	total := st.LookupCount()
+	if total == 0 {
+		return HitRateBreakdown{}
+	}
+	return HitRateBreakdown{
+		Primary:      float64(st.PrimaryHitCount()) / float64(total),
+		Search:       float64(st.SearchHitCount()) / float64(total),
+		SingleFlight: float64(st.SingleFlightHitCount()) / float64(total),
+	}
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asjdf/gorm-cache/util"
+)
+
+// Status summary of the cache for dashboards and health endpoints
+type Status struct {
+	StorageType     string    // type name of the storage, e.g. "Redis"
+	Healthy         bool      // whether storage responded to a health check
+	InstanceId      string    // instance id of the cache
+	KeyPrefix       string    // prefix of cache keys in storage
+	Tables          []string  // tables cached, nil represents all tables
+	HitRate         float64   // hit rate of all lookups
+	AsyncQueueDepth int64     // cache writes and invalidations running in background
+	PopulateRetries int64     // cache populations waiting for retry after failure, counted in AsyncQueueDepth too
+	LastError       string    // last error logged, empty if none
+	LastErrorAt     time.Time // when the last error was logged
+}
+
+// Status returns summary of the cache, it checks storage health within ctx
+func (c *Gorm2Cache) Status(ctx context.Context) Status {
+	storageType := reflect.TypeOf(c.cache)
+	for storageType.Kind() == reflect.Ptr {
+		storageType = storageType.Elem()
+	}
+	_, err := c.cache.KeyExists(ctx, util.GenHealthCheckKey(c.keyPrefixOf(c.cache)))
+	status := Status{
+		StorageType:     storageType.Name(),
+		Healthy:         err == nil,
+		InstanceId:      c.InstanceId,
+		KeyPrefix:       c.keyPrefixOf(c.cache),
+		Tables:          c.Config.Tables,
+		HitRate:         c.HitRate(),
+		AsyncQueueDepth: atomic.LoadInt64(&c.asyncQueueDepth),
+		PopulateRetries: atomic.LoadInt64(&c.populateRetries),
+	}
+	status.LastError, status.LastErrorAt = c.errorRecorder.last()
+	return status
+}
+
+// goAsync runs fn in a new goroutine, which is counted in async queue depth until fn returns
+func (c *Gorm2Cache) goAsync(fn func()) {
+	atomic.AddInt64(&c.asyncQueueDepth, 1)
+	go func() {
+		defer atomic.AddInt64(&c.asyncQueueDepth, -1)
+		fn()
+	}()
+}
+
+// errorRecorder remembers the last error logged
+type errorRecorder struct {
+	util.LoggerInterface
+
+	mu      sync.Mutex
+	lastErr string
+	lastAt  time.Time
+}
+
+func (l *errorRecorder) CtxError(ctx context.Context, format string, v ...interface{}) {
+	l.mu.Lock()
+	l.lastErr, l.lastAt = fmt.Sprintf(format, v...), time.Now()
+	l.mu.Unlock()
+	l.LoggerInterface.CtxError(ctx, format, v...)
+}
+
+func (l *errorRecorder) last() (string, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastErr, l.lastAt
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/asjdf/gorm-cache/util"
+	"gorm.io/gorm"
+)
+
+// verifySampler limits count of cache hits verified per minute
+type verifySampler struct {
+	mu          sync.Mutex
+	minute      int64
+	minuteCount int64
+}
+
+func (s *verifySampler) sample(maxPerMinute int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().Unix() / 60
+	if now != s.minute {
+		s.minute, s.minuteCount = now, 0
+	}
+	if s.minuteCount >= maxPerMinute {
+		return false
+	}
+	s.minuteCount++
+	return true
+}
+
+// sampleVerify verifies the query served from cache in background if it's sampled
+func (c *Gorm2Cache) sampleVerify(db *gorm.DB) {
+	if c.db == nil {
+		return
+	}
+	switch db.Error {
+	case util.SearchCacheHit, util.PrimaryCacheHit, util.RecordNotFoundCacheHit:
+	default:
+		return
+	}
+	if !c.verifySampler.sample(c.Config.VerifySamplesPerMinute) {
+		return
+	}
+
+	tableName := c.getTableName(db)
+	notFound := db.Error == util.RecordNotFoundCacheHit
+	// result is captured now, since caller may change dest after query returns
+	served, err := canonicalJSON(db.Statement.Dest)
+	if err != nil {
+		return
+	}
+	sql := db.Statement.SQL.String()
+	vars := append([]interface{}(nil), db.Statement.Vars...)
+	destType := reflect.TypeOf(db.Statement.Dest).Elem()
+
+	c.goAsync(func() {
+		ctx := context.Background()
+		defer c.recoverPanic(ctx, "verify")
+
+		fresh := reflect.New(destType).Interface()
+		result := c.db.Session(&gorm.Session{NewDB: true, Context: ctx}).Raw(sql, vars...).Scan(fresh)
+		if result.Error != nil {
+			c.Logger.CtxError(ctx, "[verify] query sql %s error: %v", sql, result.Error)
+			return
+		}
+		matched := notFound == (result.RowsAffected == 0)
+		if matched && !notFound {
+			actual, err := canonicalJSON(fresh)
+			if err != nil {
+				return
+			}
+			matched = served == actual
+		}
+		c.IncrVerifiedCount()
+		if !matched {
+			c.IncrDivergenceCount()
+			c.Logger.CtxError(ctx, "[verify] cache of table %s diverged from database for sql %s, cached %v, actual %v",
+				tableName, sql, c.redact(served), c.redact(fresh))
+		}
+	})
+}
+
+// canonicalJSON marshals v, elements of slices are sorted so that results in different order compare equal
+func canonicalJSON(v interface{}) (string, error) {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+	elems := make([]string, 0, value.Len())
+	for i := 0; i < value.Len(); i++ {
+		b, err := json.Marshal(value.Index(i).Interface())
+		if err != nil {
+			return "", err
+		}
+		elems = append(elems, string(b))
+	}
+	sort.Strings(elems)
+	b, err := json.Marshal(elems)
+	return string(b), err
+}
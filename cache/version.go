@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+)
+
+// tableVersionRefreshInterval in ms, a table version read from storage is reused within it,
+// so versions bumped by other processes take effect after it at most
+const tableVersionRefreshInterval = 1000
+
+type tableVersion struct {
+	value    string
+	loadedAt int64 // unix ms
+}
+
+// BumpTableVersion changes the version of table which is part of all its cache keys, so all cache of the table
+// is invalidated at once without scanning keys, e.g. after a bulk import. Keys of old versions are left to expire,
+// which pinned keys never do, so add tables in PinnedTables to AsyncInvalidationTables as well to have them deleted.
+// The version is kept in storage, so that other processes sharing the storage follow it.
+func (c *Gorm2Cache) BumpTableVersion(ctx context.Context, tableName string) error {
+	if c.Config.TableNameResolver != nil {
+		tableName = c.Config.TableNameResolver(tableName)
+	}
+	version := strconv.FormatInt(time.Now().UnixNano(), 36)
+	// the version of a pinned table is pinned as well, otherwise its cache would be orphaned once it expired
+	err := c.storageOf(tableName).SetKey(ctx, util.Kv{
+		Key:    util.GenTableVersionKey(c.keyPrefix(tableName), tableName),
+		Value:  version,
+		Pinned: util.ContainString(tableName, c.Config.PinnedTables),
+	})
+	if err != nil {
+		c.Logger.CtxError(ctx, "[BumpTableVersion] set version of table %s error: %v", tableName, err)
+		return err
+	}
+	c.tableVersions.Store(tableName, &tableVersion{value: version, loadedAt: time.Now().UnixMilli()})
+	c.markInvalidated(tableName)
+	c.pages.forget(tableName)
+	c.negatives.forget(tableName)
+	c.Logger.CtxInfo(ctx, "[BumpTableVersion] version of table %s bumped to %s", tableName, version)
+	return c.invalidateDependents(ctx, tableName)
+}
+
+// tableKeyPrefix returns prefix of primary, search and page cache keys of table, which contains the table version
+// if it has ever been bumped
+func (c *Gorm2Cache) tableKeyPrefix(tableName string) string {
+	prefix := c.keyPrefix(tableName)
+	if version := c.tableVersion(tableName); version != "" {
+		return prefix + ":v" + version
+	}
+	return prefix
+}
+
+// tableVersion returns current version of table, the one last read is used if storage fails
+func (c *Gorm2Cache) tableVersion(tableName string) string {
+	now := time.Now().UnixMilli()
+	var last *tableVersion
+	if v, ok := c.tableVersions.Load(tableName); ok {
+		last = v.(*tableVersion)
+		if now-last.loadedAt < tableVersionRefreshInterval {
+			return last.value
+		}
+	}
+	ctx := context.Background()
+	version, err := c.storageOf(tableName).GetValue(ctx, util.GenTableVersionKey(c.keyPrefix(tableName), tableName))
+	if err != nil && !errors.Is(err, storage.ErrCacheNotFound) {
+		c.Logger.CtxError(ctx, "[tableVersion] get version of table %s error: %v", tableName, err)
+		if last != nil {
+			return last.value
+		}
+		return ""
+	}
+	c.tableVersions.Store(tableName, &tableVersion{value: version, loadedAt: now})
+	return version
+}
@@ -0,0 +1,70 @@
+// Package caches exposes the cache under the names of go-gorm/caches, so that users switching from it
+// change the import path of call sites like db.Use(&caches.Caches{Conf: &caches.Config{Easer: true}}).
+// Config.Cacher is a storage.DataStorage rather than a Cacher of go-gorm/caches with Get and Store, as the cache
+// invalidates keys by prefix, so users setting a Cacher replace it with a storage, e.g. storage.NewRedis.
+package caches
+
+import (
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"gorm.io/gorm"
+)
+
+var _ gorm.Plugin = &Caches{}
+
+type Config struct {
+	// Easer merges identical queries running at the same time into one, the cache always does so,
+	// it's kept for compatibility
+	Easer bool
+	// Cacher keeps the cache, in-memory storage is used if nil. Unlike go-gorm/caches, it's a storage of this module,
+	// Cachers implementing Get and Store of go-gorm/caches can't be used.
+	Cacher storage.DataStorage
+	// TTL expires cache after it, 0 represents forever
+	TTL time.Duration
+	// Tables only cache data within given data tables (cache all if empty)
+	Tables []string
+}
+
+// Caches is a gorm plugin with the cache behind it, queries are cached and invalidated when tables are written
+type Caches struct {
+	Conf *Config
+
+	cache cache.Cache
+}
+
+func (c *Caches) Name() string {
+	return "gorm:caches"
+}
+
+func (c *Caches) Initialize(db *gorm.DB) error {
+	conf := c.Conf
+	if conf == nil {
+		conf = &Config{}
+	}
+	opts := []cache.Option{
+		cache.WithCacheLevel(config.CacheLevelAll),
+		cache.WithInvalidateWhenUpdate(true),
+		cache.WithTTL(conf.TTL),
+		cache.WithTables(conf.Tables...),
+	}
+	if conf.Cacher != nil {
+		opts = append(opts, cache.WithStorage(conf.Cacher))
+	}
+	gc, err := cache.New(opts...)
+	if err != nil {
+		return err
+	}
+	if err = gc.Initialize(db); err != nil {
+		return err
+	}
+	c.cache = gc
+	return nil
+}
+
+// Cache returns the cache behind the plugin for stats and manual invalidation, nil before the plugin is used
+func (c *Caches) Cache() cache.Cache {
+	return c.cache
+}
@@ -1,8 +1,14 @@
 package config
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/asjdf/gorm-cache/storage"
 	"github.com/asjdf/gorm-cache/util"
+	"gorm.io/gorm"
 )
 
 type CacheConfig struct {
@@ -12,32 +18,310 @@ type CacheConfig struct {
 	// CacheStorage choose proper storage medium
 	CacheStorage storage.DataStorage
 
+	// StorageFactory if not nil and CacheStorage is nil, it's called on init to create the storage lazily.
+	// In-memory storage is used only if both are nil, init fails if the chosen storage fails to initialize.
+	StorageFactory func() storage.DataStorage
+
+	// StorageRetry if not nil, storage operations failing with retryable errors (e.g. timeouts) are retried
+	StorageRetry *RetryPolicy
+
+	// LookupDeadlineFraction if in (0, 1), cache lookup of a query whose context has a deadline may take at most
+	// this fraction of the time left, e.g. 0.1 for 10%, so the database query still has the rest if storage slows
+	// down. Lookups running out of it are treated as misses.
+	LookupDeadlineFraction float64
+
+	// PopulateRetry if not nil, cache population failing (e.g. on a redis blip) is retried in background after
+	// delays instead of being dropped, so hit rate recovers soon after brief outages. Retries are given up once
+	// the table is invalidated.
+	PopulateRetry *PopulateRetryPolicy
+
+	// StorageRouter if not nil, cache of a table is kept in the storage it returns for the table,
+	// e.g. session tables in memory and catalog tables in redis. Returning nil falls back to CacheStorage.
+	// Storages of tables named in config, e.g. Tables, are initialized on init, which fails if any of them fails,
+	// others on first use. Tables of a storage failing to initialize are uncached until it's initialized, which is
+	// retried every 5s.
+	StorageRouter func(tableName string) storage.DataStorage
+
+	// KeyPrefix all cache keys start with it, so that processes using the same prefix share cache in a shared storage.
+	// Prefix provided by storage (e.g. RedisStoreConfig.KeyPrefix) takes precedence, and if neither is set,
+	// keys are prefixed by "gormcache:" and a random instance id.
+	KeyPrefix string
+
+	// KeyPrefixWithInstance if true, instance id of the cache is appended to the prefix above as a segment,
+	// so that caches sharing a storage and prefix are still isolated from each other
+	KeyPrefixWithInstance bool
+
 	// Tables only cache data within given data tables (cache all if empty)
 	Tables []string
 
+	// TableNameResolver maps the table name used by a statement (e.g. a physical shard table "orders_03")
+	// to the table name used in cache keys and invalidation (e.g. the logical table "orders").
+	// Tables is matched against the resolved name. Primary cache keys still keep the table name used by the statement,
+	// as rows of different shard tables may have the same primary keys. Resolved names must be resolved to themselves.
+	TableNameResolver func(table string) string
+
 	// InvalidateWhenUpdate
 	// if user update/delete/create something in DB, we invalidate all cached data to ensure consistency,
 	// else we do nothing to outdated cache.
 	InvalidateWhenUpdate bool
 
-	// AsyncWrite if true, then we will write cache in async mode
+	// InvalidateBeforeWriteTables cache of these tables is invalidated before the write is executed as well as after it
+	// (double delete around write), which narrows the window in which readers see outdated cache.
+	// It only works when InvalidateWhenUpdate is on.
+	InvalidateBeforeWriteTables []string
+
+	// CacheRelevantColumns columns which cached queries of a table depend on, keyed by table name. An update of the
+	// table assigning none of them nor primary key, e.g. only updated_at or counters, doesn't invalidate cache after it,
+	// though it's still invalidated before the update for InvalidateBeforeWriteTables. Tables not in it are
+	// invalidated by all updates.
+	CacheRelevantColumns map[string][]string
+
+	// DirtyMarkerTTL in ms, if not 0, every write puts dirty markers of the table and of the primary keys it writes
+	// (of all rows if they are unknown) into storage before invalidating. While the markers exist, queries starting
+	// on the table read the database and don't populate cache, which closes the race where a read refills cache with
+	// data older than the write. Queries looking up primary keys only are affected by markers of their keys.
+	DirtyMarkerTTL int64
+
+	// DirtyMarkerTTLDuration dirty marker ttl, takes precedence over DirtyMarkerTTL if not 0
+	DirtyMarkerTTLDuration time.Duration
+
+	// AsyncWrite if true, then we will write cache in async mode.
+	// It's a shorthand for turning on both AsyncCachePopulate and AsyncInvalidate.
 	AsyncWrite bool
 
+	// AsyncCachePopulate if true, cache is populated after query in async mode, which saves query latency
+	AsyncCachePopulate bool
+
+	// PopulatePrimaryOnCreate if true, rows created by Create or CreateInBatches are set in primary cache from dest,
+	// one batch per insert, so that reads right after an import hit cache. Rows in dest must be complete, i.e. no
+	// column but primary key may be filled by database defaults. Creates with Select or Omit and upserts aren't cached.
+	// If the transaction creating rows rolls back, they stay in cache until invalidated or expired.
+	PopulatePrimaryOnCreate bool
+
+	// AsyncInvalidate if true, cache is invalidated after create/update/delete in async mode,
+	// so following reads may see outdated cache for a short while
+	AsyncInvalidate bool
+
 	// CacheTTL cache ttl in ms, where 0 represents forever
 	CacheTTL int64
 
+	// CacheTTLDuration cache ttl, takes precedence over CacheTTL if not 0
+	CacheTTLDuration time.Duration
+
+	// ReplicaLagWindow in ms, if not 0, cache of a table won't be populated within this window after the
+	// table's last invalidation, so that reads from a lagging replica can't put outdated data back into cache
+	ReplicaLagWindow int64
+
+	// ReplicaLagWindowDuration replica lag window, takes precedence over ReplicaLagWindow if not 0
+	ReplicaLagWindowDuration time.Duration
+
+	// ResetBarrierWindow in ms, if not 0, no cache is populated while ResetCache is running and within this window
+	// after it, so that queries in flight can't pollute the cache which has just been cleared
+	ResetBarrierWindow int64
+
+	// ResetBarrierWindowDuration reset barrier window, takes precedence over ResetBarrierWindow if not 0
+	ResetBarrierWindowDuration time.Duration
+
+	// PageRangeInvalidation if true, creating or deleting rows only invalidates the cached pages (queries with LIMIT)
+	// whose primary key range may contain the rows, else all pages of the table are invalidated.
+	// Page ranges are tracked in process memory, so only turn it on if no other process writes the tables.
+	PageRangeInvalidation bool
+
+	// SlidingExpirationTables ttl of cache of these tables is extended to CacheTTL on every hit, so frequently read
+	// entries stay while others expire. It takes effect when CacheTTL is set.
+	SlidingExpirationTables []string
+
+	// AsyncInvalidationTables cache of these tables is invalidated by bumping the table version, then keys of the former
+	// version are deleted by a job in background, whose progress is reported by Gorm2Cache.InvalidationJobs.
+	// It keeps callbacks from being blocked by deleting many keys, but invalidates all cache of the table at once,
+	// so it suits tables with large cache.
+	AsyncInvalidationTables []string
+
+	// PinnedTables cache of these tables never expires and isn't evicted when storage is full, it's only removed
+	// by invalidation. It suits small, rarely changing tables (e.g. dimension tables) which are fully resident in
+	// cache. Cache of a single query can be pinned by running it within a context returned by cache.WithPinned.
+	// Empty and not-found results keep their own ttl.
+	PinnedTables []string
+
+	// FullTableCacheTables these tables are loaded entirely into process memory on first access (or by
+	// Gorm2Cache.WarmUpFullTables), then queries of complete models with simple conditions (comparisons of columns
+	// with values, IN, IS NULL, AND, OR, NOT), ORDER BY columns, LIMIT and OFFSET are answered by filtering rows in
+	// memory. Other queries go the usual way. A table is loaded again after CacheTTL passes or it's invalidated,
+	// by this process at once, or by other processes sharing the storage within a second. Queries comparing or
+	// ordering by strings go the usual way unless FullTableBinaryCollation is on, so it suits small dimension
+	// tables keyed by ids. Tables having more rows than CacheMaxItemCnt are not loaded.
+	FullTableCacheTables []string
+
+	// FullTableBinaryCollation if true, strings of FullTableCacheTables are compared byte by byte in memory, which
+	// only matches binary collations, e.g. utf8mb4_bin of MySQL or the default one of SQLite. Case insensitive
+	// collations, e.g. the default ones of MySQL, compare them differently in =, IN and ORDER BY.
+	FullTableBinaryCollation bool
+
+	// SearchFirstTables search cache of these tables is looked up before primary cache, which suits tables mostly
+	// queried by complex conditions, so that their hits don't wait for a primary cache lookup first.
+	// Primary cache is looked up first for other tables, which suits key-value tables.
+	SearchFirstTables []string
+
+	// SchemalessQueryMode how queries of tables without their model are cached, e.g. db.Table("x").Find(&maps),
+	// db.Table("x").Pluck("name", &names) or queries scanning rows of table x into another struct.
+	// Results of such queries are keyed by the table name given to Table, see SchemalessQueryMode.
+	SchemalessQueryMode SchemalessQueryMode
+
+	// AfterCacheHit if not nil, it's called after a query is served from cache with dest filled, since gorm doesn't
+	// call AfterFind hooks for such queries. Set it to cache.CallAfterFind to call the hooks like gorm does.
+	AfterCacheHit func(db *gorm.DB)
+
+	// OnInvalidate if not nil, it's called after cache of table is invalidated, with the invalidated primary keys,
+	// or nil keys if all search or primary cache of the table is invalidated. Use it to mirror invalidations to caches
+	// derived from the table, e.g. purging CDN. One write may call it more than once, e.g. for search cache and for
+	// primary cache. It runs in the goroutine invalidating cache, which is a background one with AsyncInvalidate.
+	OnInvalidate func(ctx context.Context, tableName string, keys []string)
+
+	// ServeStaleOnErrorTables if a query of these tables fails in database (e.g. timeout or failover), the result
+	// last cached for it is served instead of the error, even if the cache has expired since.
+	// Storages implementing storage.StaleGetter retain cache for StaleGracePeriod after it expires, other storages
+	// keep a copy of results for StaleGracePeriod longer than CacheTTL, which survives invalidation as well.
+	// It only works with search cache.
+	ServeStaleOnErrorTables []string
+
+	// StaleGracePeriod in ms, how long results are kept for ServeStaleOnErrorTables after CacheTTL
+	StaleGracePeriod int64
+
+	// StaleGracePeriodDuration stale grace period, takes precedence over StaleGracePeriod if not 0
+	StaleGracePeriodDuration time.Duration
+
 	// CacheMaxItemCnt for given query, if objects retrieved are more than this cnt,
 	// then we choose not to cache for this query. 0 represents caching all queries.
 	CacheMaxItemCnt int64
 
-	// DisableCachePenetration if true, then we will not cache nil result
+	// MaxItemCntExceededMode what's cached for queries retrieving more objects than CacheMaxItemCnt, nothing by default
+	MaxItemCntExceededMode MaxItemCntExceededMode
+
+	// PrimaryCacheBatchSize objects set in primary cache are written in batches of at most this cnt,
+	// so a large result set doesn't build one giant pipeline. 0 represents writing all objects at once.
+	PrimaryCacheBatchSize int64
+
+	// PrimaryCacheBatchPause wait between two batches of PrimaryCacheBatchSize, other goroutines
+	// are only yielded to if 0
+	PrimaryCacheBatchPause time.Duration
+
+	// WriteDedupWindow in ms, if not 0, a search cache key isn't written again with the same value while it's being
+	// written, e.g. by identical queries missing cache concurrently, or within this window after it was written if
+	// the key is still in storage, which is checked instead, so keys deleted or evicted are written again
+	WriteDedupWindow int64
+
+	// WriteDedupWindowDuration write dedup window, takes precedence over WriteDedupWindow if not 0
+	WriteDedupWindowDuration time.Duration
+
+	// WriteDedupSize max count of recently written keys remembered for WriteDedupWindow, 1000 if 0
+	WriteDedupSize int
+
+	// EncodeDBValues if true, fields of types which are scanned from database by themselves (sql.Scanner and
+	// driver.Valuer) but have their own JSON marshaling, which may not tell NULL from zero values, are cached
+	// as the values they store in database, so they round-trip exactly. sql.Null* and gorm.DeletedAt
+	// round-trip either way. Values cached before it's changed can't be read and are queried from database.
+	EncodeDBValues bool
+
+	// ValueChecksum if true, values are written with a CRC-32 checksum which is validated on read, entries failing
+	// it (e.g. partially written) are evicted and read as a miss. Values written without checksum fail it as well.
+	ValueChecksum bool
+
+	// MaxVarsForCaching if a query has more vars than this cnt (e.g. a huge IN list),
+	// then it bypasses cache entirely. 0 represents no limit.
+	MaxVarsForCaching int64
+
+	// MaxSingleFlightKeys max count of keys in flight at the same time, queries beyond it are executed
+	// directly without duplicate suppression. 0 represents no limit.
+	MaxSingleFlightKeys int64
+
+	// MaxConcurrentMissQueries max count of queries of a table which missed cache and query the database at the same
+	// time, e.g. the first wave after a restart. Queries beyond it wait until a query finishes, then they look up cache
+	// again. Queries issued by model hooks aren't limited. 0 represents no limit.
+	MaxConcurrentMissQueries int64
+
+	// BypassNestedQueries if true, queries issued by model hooks (e.g. AfterFind) of a query in flight bypass cache,
+	// else they share cache with others but never wait for single flight
+	BypassNestedQueries bool
+
+	// DisableCachePenetration if true, then we will not cache nil result, neither primary keys looked up but not found
 	DisableCachePenetrationProtect bool
 
+	// DisableEmptyResultCache if true, Find queries returning zero rows are not cached in search cache
+	// and always hit the database.
+	DisableEmptyResultCache bool
+
+	// EmptyResultTTL ttl in ms for cached empty Find results, where 0 represents CacheTTL
+	EmptyResultTTL int64
+
+	// EmptyResultTTLDuration ttl for cached empty Find results, takes precedence over EmptyResultTTL if not 0
+	EmptyResultTTLDuration time.Duration
+
+	// StripSQLComments if true, comments in sql (e.g. injected trace ids) are ignored when generating
+	// search and singleflight keys. Optimizer hints (/*+ ... */) are always kept.
+	StripSQLComments bool
+
+	// KeyIgnoredClauses names of clauses (e.g. a custom hint clause) that don't change query results,
+	// they are left out when generating search and singleflight keys. Clauses of gorm queries change results
+	// (e.g. ORDER BY changes order of rows), so they are rejected.
+	KeyIgnoredClauses []string
+
+	// CallbackAnchors the gorm callbacks that cache callbacks are registered around,
+	// use it to order cache callbacks relative to other plugins. Default anchors are used if nil.
+	CallbackAnchors *CallbackAnchors
+
+	// CallbackNamePrefix callbacks of the cache are named CallbackNamePrefix:name, or CallbackNamePrefix:InstanceId:name
+	// if another cache on the db has those names, DefaultCallbackNamePrefix if empty. Change it if other plugins
+	// register callbacks with the default prefix.
+	CallbackNamePrefix string
+
+	// StatsSnapshotKey if not empty, stats are saved in CacheStorage under this key every StatsSnapshotInterval
+	// and loaded from it on init, so long-term stats survive restarts. The key never expires and is namespaced under
+	// the key prefix of CacheStorage, which must not vary with the instance to survive restarts, e.g. KeyPrefix is set
+	// without KeyPrefixWithInstance. Instances sharing the key overwrite each other.
+	StatsSnapshotKey string
+
+	// StatsSnapshotInterval in ms, interval of saving stats, 60000 if 0
+	StatsSnapshotInterval int64
+
+	// StatsSnapshotIntervalDuration interval of saving stats, takes precedence over StatsSnapshotInterval if not 0
+	StatsSnapshotIntervalDuration time.Duration
+
+	// ShadowMode if true, cache is looked up and populated as usual but query results are never served from it,
+	// every query hits the database. Hit counts tell the would-be hit rate, and ShadowMismatchCount tells how often
+	// the cached result differed from the database's, so caching can be evaluated on real traffic before turning it on.
+	ShadowMode bool
+
+	// VerifySamplesPerMinute if not 0, up to this many cache hits per minute are verified in background by executing
+	// their queries against the database again and comparing results, VerifiedCount and DivergenceCount of stats
+	// tell how often cache served data differing from the database
+	VerifySamplesPerMinute int64
+
+	// TraceCacheHits if true, sql of queries served from cache is prefixed with a comment like
+	// "/* gorm-cache: search hit */" in gorm's trace log, so slow query analysis can tell them from database queries
+	TraceCacheHits bool
+
 	// DebugMode indicate if we're in debug mode (will print access log)
 	DebugMode bool
 
 	// DebugLogger
 	DebugLogger util.LoggerInterface
+
+	// LogCtxFieldsFunc extracts fields (e.g. request id, trace id) from ctx, which the default logger appends
+	// to every log line. Custom DebugLogger receives ctx and should extract them itself.
+	LogCtxFieldsFunc util.CtxFieldsFunc
+
+	// LogRedactor if not nil, cache keys, vars, primary keys and cached values are rewritten by it before they are
+	// logged, e.g. util.MaskRedactor or util.HashRedactor
+	LogRedactor util.Redactor
+
+	// DebugSampleRate if greater than 1, only 1 in DebugSampleRate operations (queries and writes) print info logs
+	DebugSampleRate uint64
+
+	// DebugMaxSampledPerSecond max count of operations printing info logs per second, 0 represents no limit
+	DebugMaxSampledPerSecond int64
+
+	// DebugTables only operations on these tables print info logs (all if empty), error logs are always printed
+	DebugTables []string
 }
 
 type CacheLevel int
@@ -48,3 +332,142 @@ const (
 	CacheLevelOnlySearch  CacheLevel = 2
 	CacheLevelAll         CacheLevel = 3
 )
+
+type SchemalessQueryMode int
+
+const (
+	// SchemalessSearchOnly results of schemaless queries are cached in search cache only, as rows can't be
+	// told apart by primary key without the model
+	SchemalessSearchOnly SchemalessQueryMode = 0
+	// SchemalessBypass schemaless queries always query the database
+	SchemalessBypass SchemalessQueryMode = 1
+)
+
+type MaxItemCntExceededMode int
+
+const (
+	// MaxItemCntExceededSkip queries exceeding CacheMaxItemCnt are cached in neither search nor primary cache
+	MaxItemCntExceededSkip MaxItemCntExceededMode = 0
+	// MaxItemCntExceededCachePrimary objects of queries exceeding CacheMaxItemCnt are still set in primary cache,
+	// in batches of at most CacheMaxItemCnt objects, while the result as a whole isn't set in search cache
+	MaxItemCntExceededCachePrimary MaxItemCntExceededMode = 1
+)
+
+// RetryPolicy how failed storage operations are retried
+type RetryPolicy struct {
+	Attempts   int                  // max attempts of an operation including the first one, no retry if less than 2
+	Backoff    time.Duration        // wait before the first retry, doubled before each further retry
+	MaxBackoff time.Duration        // upper bound of wait between retries, no bound if 0
+	Retryable  func(err error) bool // classifies retryable errors, all errors except cache misses and ctx errors if nil
+	// RetryReads if false, reads are never retried, since a read retried on a tight latency budget may delay the query
+	// longer than querying the database. No operation is retried beyond ctx deadline either way.
+	RetryReads bool
+}
+
+// PopulateRetryPolicy how failed cache population is retried in background
+type PopulateRetryPolicy struct {
+	Attempts   int           // max retries after the first failure, no retry if less than 1
+	Delay      time.Duration // wait before the first retry, doubled before each further retry, 1s if 0
+	MaxPending int64         // max populations waiting for retry, further failed ones are dropped, 1000 if 0
+}
+
+// CallbackAnchors names of the callbacks that cache callbacks are registered relative to
+type CallbackAnchors struct {
+	BeforeQuery string // cache lookup runs before this query callback
+	AfterQuery  string // cache population runs after this query callback
+	AfterCreate string // invalidation runs after (and for InvalidateBeforeWriteTables also before) this create callback
+	AfterUpdate string // invalidation runs after (and for InvalidateBeforeWriteTables also before) this update callback
+	AfterDelete string // invalidation runs after (and for InvalidateBeforeWriteTables also before) this delete callback
+}
+
+// DefaultCallbackNamePrefix prefix of callback names if CallbackNamePrefix is empty
+const DefaultCallbackNamePrefix = "gorm:cache"
+
+var DefaultCallbackAnchors = &CallbackAnchors{
+	BeforeQuery: "gorm:query",
+	AfterQuery:  "gorm:after_query",
+	AfterCreate: "gorm:create",
+	AfterUpdate: "gorm:update",
+	AfterDelete: "gorm:delete",
+}
+
+// Validate checks if the config is usable
+func (c *CacheConfig) Validate() error {
+	if c.CacheLevel < CacheLevelOff || c.CacheLevel > CacheLevelAll {
+		return fmt.Errorf("unknown cache level %d", c.CacheLevel)
+	}
+	if c.SchemalessQueryMode < SchemalessSearchOnly || c.SchemalessQueryMode > SchemalessBypass {
+		return fmt.Errorf("unknown schemaless query mode %d", c.SchemalessQueryMode)
+	}
+	if c.MaxItemCntExceededMode < MaxItemCntExceededSkip || c.MaxItemCntExceededMode > MaxItemCntExceededCachePrimary {
+		return fmt.Errorf("unknown max item count exceeded mode %d", c.MaxItemCntExceededMode)
+	}
+	if c.CacheTTL < 0 {
+		return fmt.Errorf("cache ttl must not be negative, got %d", c.CacheTTL)
+	}
+	if c.EmptyResultTTL < 0 {
+		return fmt.Errorf("empty result ttl must not be negative, got %d", c.EmptyResultTTL)
+	}
+	if c.VerifySamplesPerMinute < 0 {
+		return fmt.Errorf("verify samples per minute must not be negative, got %d", c.VerifySamplesPerMinute)
+	}
+	if c.StorageRetry != nil && (c.StorageRetry.Attempts < 0 || c.StorageRetry.Backoff < 0 || c.StorageRetry.MaxBackoff < 0) {
+		return fmt.Errorf("storage retry attempts and backoff must not be negative")
+	}
+	if c.PopulateRetry != nil && (c.PopulateRetry.Attempts < 0 || c.PopulateRetry.Delay < 0 || c.PopulateRetry.MaxPending < 0) {
+		return fmt.Errorf("populate retry attempts, delay and max pending must not be negative")
+	}
+	if c.LookupDeadlineFraction < 0 || c.LookupDeadlineFraction >= 1 {
+		return fmt.Errorf("lookup deadline fraction must be in [0, 1), got %v", c.LookupDeadlineFraction)
+	}
+	if c.CacheMaxItemCnt < 0 {
+		return fmt.Errorf("cache max item count must not be negative, got %d", c.CacheMaxItemCnt)
+	}
+	if c.PrimaryCacheBatchSize < 0 || c.PrimaryCacheBatchPause < 0 {
+		return fmt.Errorf("primary cache batch size and pause must not be negative")
+	}
+	if c.WriteDedupWindow < 0 || c.WriteDedupSize < 0 {
+		return fmt.Errorf("write dedup window and size must not be negative")
+	}
+	if c.DirtyMarkerTTL < 0 || c.ReplicaLagWindow < 0 || c.ResetBarrierWindow < 0 || c.StaleGracePeriod < 0 {
+		return fmt.Errorf("dirty marker ttl, replica lag window, reset barrier window and stale grace period must not be negative")
+	}
+	for _, d := range []time.Duration{c.CacheTTLDuration, c.EmptyResultTTLDuration, c.DirtyMarkerTTLDuration,
+		c.ReplicaLagWindowDuration, c.ResetBarrierWindowDuration, c.StatsSnapshotIntervalDuration,
+		c.StaleGracePeriodDuration, c.WriteDedupWindowDuration} {
+		if d < 0 {
+			return fmt.Errorf("durations must not be negative, got %v", d)
+		}
+	}
+	for _, name := range c.KeyIgnoredClauses {
+		if util.ContainString(strings.ToUpper(strings.TrimSpace(name)), resultClauses) {
+			return fmt.Errorf("clause %s changes query results, it can't be in key ignored clauses", name)
+		}
+	}
+	return nil
+}
+
+// resultClauses clauses that queries are built with, which change query results
+var resultClauses = []string{"SELECT", "FROM", "WHERE", "GROUP BY", "ORDER BY", "LIMIT", "FOR"}
+
+// ApplyDurations converts duration fields which are set into their ms counterparts, e.g. CacheTTLDuration
+// into CacheTTL. It's called by cache on init.
+func (c *CacheConfig) ApplyDurations() {
+	for _, f := range []struct {
+		ms *int64
+		d  time.Duration
+	}{
+		{&c.CacheTTL, c.CacheTTLDuration},
+		{&c.EmptyResultTTL, c.EmptyResultTTLDuration},
+		{&c.DirtyMarkerTTL, c.DirtyMarkerTTLDuration},
+		{&c.ReplicaLagWindow, c.ReplicaLagWindowDuration},
+		{&c.ResetBarrierWindow, c.ResetBarrierWindowDuration},
+		{&c.StatsSnapshotInterval, c.StatsSnapshotIntervalDuration},
+		{&c.StaleGracePeriod, c.StaleGracePeriodDuration},
+		{&c.WriteDedupWindow, c.WriteDedupWindowDuration},
+	} {
+		if f.d != 0 {
+			*f.ms = util.DurationToMillis(f.d)
+		}
+	}
+}
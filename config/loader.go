@@ -0,0 +1,184 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/yaml.v3"
+)
+
+// Settings plain settings of cache which deployments can change without code changes,
+// they are loaded by FromEnv or FromYAML and turned into CacheConfig
+type Settings struct {
+	Storage              string        `yaml:"storage"`     // memory (default), gcache, redis or null
+	Address              string        `yaml:"address"`     // address of redis
+	Password             string        `yaml:"password"`    // password of redis
+	DB                   int           `yaml:"db"`          // db of redis
+	KeyPrefix            string        `yaml:"key_prefix"`  // key prefix of redis store, random if empty
+	MaxSize              int64         `yaml:"max_size"`    // max items of memory or gcache storage, 1000 if 0
+	CacheLevel           string        `yaml:"cache_level"` // off, primary, search or all (default)
+	TTL                  time.Duration `yaml:"ttl"`         // e.g. 5s, 0 represents forever
+	Tables               []string      `yaml:"tables"`      // cache all tables if empty
+	InvalidateWhenUpdate *bool         `yaml:"invalidate_when_update"`
+	AsyncWrite           bool          `yaml:"async_write"`
+	MaxItemCount         int64         `yaml:"max_item_count"`
+	Debug                bool          `yaml:"debug"`
+}
+
+// env names of settings read by FromEnv
+const (
+	EnvStorage              = "GORM_CACHE_STORAGE"
+	EnvAddress              = "GORM_CACHE_ADDRESS"
+	EnvPassword             = "GORM_CACHE_PASSWORD"
+	EnvDB                   = "GORM_CACHE_DB"
+	EnvKeyPrefix            = "GORM_CACHE_KEY_PREFIX"
+	EnvMaxSize              = "GORM_CACHE_MAX_SIZE"
+	EnvCacheLevel           = "GORM_CACHE_LEVEL"
+	EnvTTL                  = "GORM_CACHE_TTL"
+	EnvTables               = "GORM_CACHE_TABLES" // comma separated
+	EnvInvalidateWhenUpdate = "GORM_CACHE_INVALIDATE_WHEN_UPDATE"
+	EnvAsyncWrite           = "GORM_CACHE_ASYNC_WRITE"
+	EnvMaxItemCount         = "GORM_CACHE_MAX_ITEM_COUNT"
+	EnvDebug                = "GORM_CACHE_DEBUG"
+)
+
+// FromEnv creates CacheConfig from GORM_CACHE_* environment variables
+func FromEnv() (*CacheConfig, error) {
+	s := &Settings{
+		Storage:    os.Getenv(EnvStorage),
+		Address:    os.Getenv(EnvAddress),
+		Password:   os.Getenv(EnvPassword),
+		KeyPrefix:  os.Getenv(EnvKeyPrefix),
+		CacheLevel: os.Getenv(EnvCacheLevel),
+	}
+	if v := os.Getenv(EnvTables); v != "" {
+		for _, table := range strings.Split(v, ",") {
+			if table = strings.TrimSpace(table); table != "" {
+				s.Tables = append(s.Tables, table)
+			}
+		}
+	}
+
+	var err error
+	parse := func(name string, fn func(v string) error) {
+		v := os.Getenv(name)
+		if v == "" || err != nil {
+			return
+		}
+		if e := fn(v); e != nil {
+			err = fmt.Errorf("invalid %s %q: %v", name, v, e)
+		}
+	}
+	parse(EnvDB, func(v string) (e error) {
+		s.DB, e = strconv.Atoi(v)
+		return
+	})
+	parse(EnvMaxSize, func(v string) (e error) {
+		s.MaxSize, e = strconv.ParseInt(v, 10, 64)
+		return
+	})
+	parse(EnvTTL, func(v string) (e error) {
+		s.TTL, e = time.ParseDuration(v)
+		return
+	})
+	parse(EnvInvalidateWhenUpdate, func(v string) error {
+		b, e := strconv.ParseBool(v)
+		s.InvalidateWhenUpdate = &b
+		return e
+	})
+	parse(EnvAsyncWrite, func(v string) (e error) {
+		s.AsyncWrite, e = strconv.ParseBool(v)
+		return
+	})
+	parse(EnvMaxItemCount, func(v string) (e error) {
+		s.MaxItemCount, e = strconv.ParseInt(v, 10, 64)
+		return
+	})
+	parse(EnvDebug, func(v string) (e error) {
+		s.Debug, e = strconv.ParseBool(v)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.CacheConfig()
+}
+
+// FromYAML creates CacheConfig from yaml file at path, keys are the yaml tags of Settings
+func FromYAML(path string) (*CacheConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Settings{}
+	if err := yaml.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	return s.CacheConfig()
+}
+
+// CacheConfig creates CacheConfig from the settings, the storage is created but not initialized
+func (s *Settings) CacheConfig() (*CacheConfig, error) {
+	conf := &CacheConfig{
+		CacheLevel:           CacheLevelAll,
+		InvalidateWhenUpdate: true,
+		CacheTTLDuration:     s.TTL,
+		Tables:               s.Tables,
+		AsyncWrite:           s.AsyncWrite,
+		CacheMaxItemCnt:      s.MaxItemCount,
+		DebugMode:            s.Debug,
+	}
+	if s.InvalidateWhenUpdate != nil {
+		conf.InvalidateWhenUpdate = *s.InvalidateWhenUpdate
+	}
+
+	switch strings.ToLower(s.CacheLevel) {
+	case "", "all":
+	case "off":
+		conf.CacheLevel = CacheLevelOff
+	case "primary":
+		conf.CacheLevel = CacheLevelOnlyPrimary
+	case "search":
+		conf.CacheLevel = CacheLevelOnlySearch
+	default:
+		return nil, fmt.Errorf("unknown cache level %q", s.CacheLevel)
+	}
+
+	maxSize := s.MaxSize
+	if maxSize == 0 {
+		maxSize = storage.DefaultMemStoreConfig.MaxSize
+	}
+	switch strings.ToLower(s.Storage) {
+	case "", "memory":
+		conf.CacheStorage = storage.NewMem(&storage.MemStoreConfig{MaxSize: maxSize})
+	case "gcache":
+		conf.CacheStorage = storage.NewGcache(gcache.New(int(maxSize)).ARC())
+	case "null":
+		conf.CacheStorage = storage.NewNull()
+	case "redis":
+		if s.Address == "" {
+			return nil, fmt.Errorf("address of redis storage is required")
+		}
+		conf.CacheStorage = storage.NewRedis(&storage.RedisStoreConfig{
+			KeyPrefix: s.KeyPrefix,
+			Options: &redis.Options{
+				Addr:     s.Address,
+				Password: s.Password,
+				DB:       s.DB,
+			},
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage %q", s.Storage)
+	}
+
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
@@ -5,11 +5,14 @@ go 1.18
 require (
 	github.com/bluele/gcache v0.0.2
 	github.com/glebarez/sqlite v1.7.0
+	github.com/google/uuid v1.3.0
 	github.com/hashicorp/go-multierror v1.1.1
 	github.com/json-iterator/go v1.1.12
 	github.com/karlseguin/ccache/v3 v3.0.3
+	github.com/modern-go/reflect2 v1.0.2
 	github.com/redis/go-redis/v9 v9.0.2
 	github.com/smartystreets/goconvey v1.7.2
+	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/gorm v1.24.5
 )
 
@@ -18,7 +21,6 @@ require (
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/glebarez/go-sqlite v1.20.3 // indirect
-	github.com/google/uuid v1.3.0 // indirect
 	github.com/gopherjs/gopherjs v1.17.2 // indirect
 	github.com/hashicorp/errwrap v1.0.0 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
@@ -26,7 +28,6 @@ require (
 	github.com/jtolds/gls v4.20.0+incompatible // indirect
 	github.com/mattn/go-isatty v0.0.17 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
-	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/remyoudompheng/bigfft v0.0.0-20230126093431-47fa9a501578 // indirect
 	github.com/smartystreets/assertions v1.13.0 // indirect
 	golang.org/x/sys v0.4.0 // indirect
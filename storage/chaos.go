@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/asjdf/gorm-cache/util"
+)
+
+var _ DataStorage = &Chaos{}
+var _ KeyPrefixer = &Chaos{}
+
+var ErrChaosInjected = errors.New("chaos injected error")
+
+// ChaosConfig faults Chaos injects, rates are between 0 and 1
+type ChaosConfig struct {
+	Latency            time.Duration // delay added to operations
+	LatencyRate        float64       // rate of operations delayed by Latency
+	ErrorRate          float64       // rate of operations failing with Err before reaching storage
+	PartialFailureRate float64       // rate of batch operations applied to only part of keys, writes then fail with Err
+	Err                error         // error injected, ErrChaosInjected if nil
+}
+
+// NewChaos wraps storage s with fault injection, it's meant for testing how services and the cache
+// behave when storage misbehaves. Key prefix of s is kept, other optional interfaces of s are hidden.
+func NewChaos(s DataStorage, config *ChaosConfig) *Chaos {
+	c := &Chaos{storage: s}
+	c.SetConfig(config)
+	return c
+}
+
+type Chaos struct {
+	storage DataStorage
+	config  atomic.Value // *ChaosConfig
+}
+
+// SetConfig replaces faults injected from now on, nil turns off fault injection
+func (c *Chaos) SetConfig(config *ChaosConfig) {
+	if config == nil {
+		config = &ChaosConfig{}
+	}
+	c.config.Store(config)
+}
+
+func (c *Chaos) KeyPrefix() string {
+	if p, ok := c.storage.(KeyPrefixer); ok {
+		return p.KeyPrefix()
+	}
+	return ""
+}
+
+// inject delays and fails the operation as configured
+func (c *Chaos) inject(ctx context.Context) error {
+	conf := c.config.Load().(*ChaosConfig)
+	if conf.Latency > 0 && hit(conf.LatencyRate) {
+		select {
+		case <-time.After(conf.Latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if hit(conf.ErrorRate) {
+		return c.err()
+	}
+	return nil
+}
+
+// partial returns count of n items a batch operation is applied to, and whether it's cut short
+func (c *Chaos) partial(n int) (int, bool) {
+	if n == 0 || !hit(c.config.Load().(*ChaosConfig).PartialFailureRate) {
+		return n, false
+	}
+	return rand.Intn(n), true
+}
+
+func (c *Chaos) err() error {
+	if err := c.config.Load().(*ChaosConfig).Err; err != nil {
+		return err
+	}
+	return ErrChaosInjected
+}
+
+func hit(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
+
+func (c *Chaos) Init(config *Config) error {
+	return c.storage.Init(config)
+}
+
+func (c *Chaos) CleanCache(ctx context.Context) error {
+	if err := c.inject(ctx); err != nil {
+		return err
+	}
+	return c.storage.CleanCache(ctx)
+}
+
+func (c *Chaos) BatchKeyExist(ctx context.Context, keys []string) (bool, error) {
+	if err := c.inject(ctx); err != nil {
+		return false, err
+	}
+	return c.storage.BatchKeyExist(ctx, keys)
+}
+
+func (c *Chaos) KeyExists(ctx context.Context, key string) (bool, error) {
+	if err := c.inject(ctx); err != nil {
+		return false, err
+	}
+	return c.storage.KeyExists(ctx, key)
+}
+
+func (c *Chaos) GetValue(ctx context.Context, key string) (string, error) {
+	if err := c.inject(ctx); err != nil {
+		return "", err
+	}
+	return c.storage.GetValue(ctx, key)
+}
+
+// BatchGetValues on partial failure returns values of only part of keys
+func (c *Chaos) BatchGetValues(ctx context.Context, keys []string) ([]string, error) {
+	if err := c.inject(ctx); err != nil {
+		return nil, err
+	}
+	values, err := c.storage.BatchGetValues(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := c.partial(len(values))
+	return values[:n], nil
+}
+
+func (c *Chaos) EntryCount(ctx context.Context, keyPrefix string) (int64, error) {
+	if err := c.inject(ctx); err != nil {
+		return 0, err
+	}
+	return c.storage.EntryCount(ctx, keyPrefix)
+}
+
+func (c *Chaos) Keys(ctx context.Context, keyPrefix string, cursor uint64, count int64) ([]string, uint64, error) {
+	if err := c.inject(ctx); err != nil {
+		return nil, 0, err
+	}
+	return c.storage.Keys(ctx, keyPrefix, cursor, count)
+}
+
+func (c *Chaos) DeleteKeysWithPrefix(ctx context.Context, keyPrefix string) error {
+	if err := c.inject(ctx); err != nil {
+		return err
+	}
+	return c.storage.DeleteKeysWithPrefix(ctx, keyPrefix)
+}
+
+func (c *Chaos) DeleteKey(ctx context.Context, key string) error {
+	if err := c.inject(ctx); err != nil {
+		return err
+	}
+	return c.storage.DeleteKey(ctx, key)
+}
+
+// BatchDeleteKeys on partial failure deletes only part of keys and fails
+func (c *Chaos) BatchDeleteKeys(ctx context.Context, keys []string) error {
+	if err := c.inject(ctx); err != nil {
+		return err
+	}
+	n, cut := c.partial(len(keys))
+	if n > 0 {
+		if err := c.storage.BatchDeleteKeys(ctx, keys[:n]); err != nil {
+			return err
+		}
+	}
+	if cut {
+		return c.err()
+	}
+	return nil
+}
+
+// BatchSetKeys on partial failure sets only part of kvs and fails
+func (c *Chaos) BatchSetKeys(ctx context.Context, kvs []util.Kv) error {
+	if err := c.inject(ctx); err != nil {
+		return err
+	}
+	n, cut := c.partial(len(kvs))
+	if n > 0 {
+		if err := c.storage.BatchSetKeys(ctx, kvs[:n]); err != nil {
+			return err
+		}
+	}
+	if cut {
+		return c.err()
+	}
+	return nil
+}
+
+func (c *Chaos) SetKey(ctx context.Context, kv util.Kv) error {
+	if err := c.inject(ctx); err != nil {
+		return err
+	}
+	return c.storage.SetKey(ctx, kv)
+}
+
+func (c *Chaos) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	if err := c.inject(ctx); err != nil {
+		return err
+	}
+	return c.storage.Expire(ctx, key, ttl)
+}
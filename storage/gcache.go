@@ -10,6 +10,7 @@ import (
 )
 
 var _ DataStorage = &Gcache{}
+var _ MemoryReporter = &Gcache{}
 
 func NewGcache(builder *gcache.CacheBuilder) *Gcache {
 	if builder == nil {
@@ -28,8 +29,8 @@ type Gcache struct {
 
 func (g *Gcache) Init(config *Config) error {
 	g.once.Do(func() {
-		if config.TTL != 0 {
-			g.builder.Expiration(time.Duration(config.TTL) * time.Microsecond)
+		if ttl := config.TTLMillis(); ttl != 0 {
+			g.builder.Expiration(time.Duration(ttl) * time.Millisecond)
 		}
 		g.cache = g.builder.Build()
 	})
@@ -57,6 +58,9 @@ func (g *Gcache) GetValue(ctx context.Context, key string) (string, error) {
 	g.RLock()
 	defer g.RUnlock()
 	v, err := g.cache.Get(key)
+	if err == gcache.KeyNotFoundError {
+		return "", ErrCacheNotFound
+	}
 	if err != nil {
 		return "", err
 	}
@@ -69,6 +73,9 @@ func (g *Gcache) BatchGetValues(ctx context.Context, keys []string) ([]string, e
 	values := make([]string, 0, len(keys))
 	for _, key := range keys {
 		v, err := g.cache.Get(key)
+		if err == gcache.KeyNotFoundError {
+			return nil, ErrCacheNotFound
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -84,18 +91,69 @@ func (g *Gcache) CleanCache(ctx context.Context) error {
 	return nil
 }
 
+// Keys iterates keys in lexical order, cursor is the offset in it
+func (g *Gcache) Keys(ctx context.Context, keyPrefix string, cursor uint64, count int64) ([]string, uint64, error) {
+	g.RLock()
+	defer g.RUnlock()
+	keys := make([]string, 0)
+	for _, k := range g.cache.Keys(true) {
+		if key, ok := k.(string); ok && strings.HasPrefix(key, keyPrefix+":") {
+			keys = append(keys, key)
+		}
+	}
+	keys, next := pageKeys(keys, cursor, count)
+	return keys, next, nil
+}
+
 func (g *Gcache) DeleteKeysWithPrefix(ctx context.Context, keyPrefix string) error {
 	g.Lock()
 	defer g.Unlock()
 	all := g.cache.Keys(false)
 	for _, k := range all {
-		if key, ok := k.(string); ok && strings.HasPrefix(key, keyPrefix) {
+		if key, ok := k.(string); ok && strings.HasPrefix(key, keyPrefix+":") {
 			g.cache.Remove(key)
 		}
 	}
 	return nil
 }
 
+func (g *Gcache) countKeysWithPrefix(ctx context.Context, keyPrefix string) (int64, error) {
+	g.RLock()
+	defer g.RUnlock()
+	var cnt int64
+	for _, k := range g.cache.Keys(true) {
+		if key, ok := k.(string); ok && strings.HasPrefix(key, keyPrefix+":") {
+			cnt++
+		}
+	}
+	return cnt, nil
+}
+
+func (g *Gcache) EntryCount(ctx context.Context, keyPrefix string) (int64, error) {
+	if keyPrefix == "" {
+		g.RLock()
+		defer g.RUnlock()
+		return int64(g.cache.Len(true)), nil
+	}
+	return g.countKeysWithPrefix(ctx, keyPrefix)
+}
+
+// MemoryUsage returns total size of keys and values, which doesn't include overhead of the cache
+func (g *Gcache) MemoryUsage(ctx context.Context, keyPrefix string) (int64, error) {
+	g.RLock()
+	defer g.RUnlock()
+	var size int64
+	for k, v := range g.cache.GetALL(true) {
+		key, ok := k.(string)
+		if !ok || (keyPrefix != "" && !strings.HasPrefix(key, keyPrefix+":")) {
+			continue
+		}
+		value, _ := v.(string)
+		size += int64(len(key) + len(value))
+	}
+	return size, nil
+}
+
 func (g *Gcache) DeleteKey(ctx context.Context, key string) error {
 	g.Lock()
 	defer g.Unlock()
@@ -116,7 +174,7 @@ func (g *Gcache) BatchSetKeys(ctx context.Context, kvs []util.Kv) error {
 	g.Lock()
 	defer g.Unlock()
 	for _, kv := range kvs {
-		if err := g.SetKey(ctx, kv); err != nil {
+		if err := g.set(kv); err != nil {
 			return err
 		}
 	}
@@ -126,5 +184,30 @@ func (g *Gcache) BatchSetKeys(ctx context.Context, kvs []util.Kv) error {
 func (g *Gcache) SetKey(ctx context.Context, kv util.Kv) error {
 	g.Lock()
 	defer g.Unlock()
+	return g.set(kv)
+}
+
+// Expire sets the value of key again with ttl, since gcache can't change ttl in place
+func (g *Gcache) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	g.Lock()
+	defer g.Unlock()
+	v, err := g.cache.Get(key)
+	if err == gcache.KeyNotFoundError {
+		return ErrCacheNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return g.set(util.Kv{Key: key, Value: v.(string), TTL: util.DurationToMillis(ttl)})
+}
+
+// set sets kv, a pinned kv never expires but gcache may still evict it when full
+func (g *Gcache) set(kv util.Kv) error {
+	if kv.Pinned {
+		return g.cache.SetWithExpire(kv.Key, kv.Value, pinnedExpiration)
+	}
+	if kv.TTL > 0 {
+		return g.cache.SetWithExpire(kv.Key, kv.Value, time.Duration(kv.TTL)*time.Millisecond)
+	}
 	return g.cache.Set(kv.Key, kv.Value)
 }
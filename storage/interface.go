@@ -3,17 +3,50 @@ package storage
 import (
 	"context"
 	"errors"
+	"sort"
+	"time"
+
 	"github.com/asjdf/gorm-cache/util"
 )
 
+// pinnedExpiration is the expiration of pinned kvs in storages which can't keep keys without one
+const pinnedExpiration = 100 * 365 * 24 * time.Hour
+
 var (
 	ErrCacheNotFound = errors.New("cache not found")
+	ErrNotSupported  = errors.New("operation not supported by storage")
 )
 
 type Config struct {
-	TTL    int64
-	Debug  bool
-	Logger util.LoggerInterface
+	TTL         int64         // ttl in ms, where 0 represents forever
+	TTLDuration time.Duration // takes precedence over TTL if not 0
+	Debug       bool
+	Logger      util.LoggerInterface
+	Redact      util.Redactor // rewrites keys before they are logged, nil keeps them as is
+
+	// GracePeriod in ms, storages implementing StaleGetter retain expired keys for it
+	GracePeriod         int64
+	GracePeriodDuration time.Duration // takes precedence over GracePeriod if not 0
+
+	// KeyPrefix cache keys kept in the storage start with it, storages without a prefix of their own clean cache
+	// and keep their internal keys under it
+	KeyPrefix string
+}
+
+// TTLMillis returns ttl in ms
+func (c *Config) TTLMillis() int64 {
+	if c.TTLDuration != 0 {
+		return util.DurationToMillis(c.TTLDuration)
+	}
+	return c.TTL
+}
+
+// GracePeriodMillis returns grace period in ms
+func (c *Config) GracePeriodMillis() int64 {
+	if c.GracePeriodDuration != 0 {
+		return util.DurationToMillis(c.GracePeriodDuration)
+	}
+	return c.GracePeriod
 }
 
 type DataStorage interface {
@@ -25,11 +58,63 @@ type DataStorage interface {
 	KeyExists(ctx context.Context, key string) (bool, error)
 	GetValue(ctx context.Context, key string) (string, error)
 	BatchGetValues(ctx context.Context, keys []string) ([]string, error)
+	// EntryCount counts keys in the namespace keyPrefix, or all keys of the storage if keyPrefix is empty.
+	// Storages which can't count keys return ErrNotSupported.
+	EntryCount(ctx context.Context, keyPrefix string) (int64, error)
+	// Keys iterates keys in the namespace keyPrefix, it returns about count keys from cursor and the cursor to continue
+	// with, which is 0 when iteration is done. Start iteration with cursor 0.
+	// Like redis SCAN, keys added or removed during iteration may or may not be returned.
+	Keys(ctx context.Context, keyPrefix string, cursor uint64, count int64) ([]string, uint64, error)
 
 	// write
+	// DeleteKeysWithPrefix deletes keys in the namespace keyPrefix, i.e. keys starting with keyPrefix + ":"
 	DeleteKeysWithPrefix(ctx context.Context, keyPrefix string) error
 	DeleteKey(ctx context.Context, key string) error
 	BatchDeleteKeys(ctx context.Context, keys []string) error
 	BatchSetKeys(ctx context.Context, kvs []util.Kv) error
 	SetKey(ctx context.Context, kv util.Kv) error
+	// Expire sets ttl of key without rewriting its value, 0 represents storage default ttl.
+	// It returns ErrCacheNotFound if key doesn't exist.
+	Expire(ctx context.Context, key string, ttl time.Duration) error
+}
+
+// pageKeys sorts keys and returns count of them from offset cursor, along with the offset to continue with
+// which is 0 at the end. count of 0 or less returns 10 keys like redis SCAN.
+func pageKeys(keys []string, cursor uint64, count int64) ([]string, uint64) {
+	if count <= 0 {
+		count = 10
+	}
+	sort.Strings(keys)
+	if cursor >= uint64(len(keys)) {
+		return nil, 0
+	}
+	end := cursor + uint64(count)
+	if end >= uint64(len(keys)) {
+		return keys[cursor:], 0
+	}
+	return keys[cursor:end], end
+}
+
+// MemoryReporter is optionally implemented by DataStorage to report memory taken by its keys
+type MemoryReporter interface {
+	// MemoryUsage returns bytes taken by keys in the namespace keyPrefix, or by all keys if keyPrefix is empty
+	MemoryUsage(ctx context.Context, keyPrefix string) (int64, error)
+}
+
+// StaleGetter is optionally implemented by DataStorage which retains keys for Config.GracePeriod after they expire
+type StaleGetter interface {
+	// GetStale returns value of key like GetValue, but keeps returning it during the grace period after key expires,
+	// in which case stale is true. Deleted keys are not returned.
+	GetStale(ctx context.Context, key string) (value string, stale bool, err error)
+}
+
+// TTLGetter is optionally implemented by DataStorage which can tell how long keys live on
+type TTLGetter interface {
+	// TTL returns remaining ttl of key, 0 if key never expires. It returns ErrCacheNotFound if key doesn't exist.
+	TTL(ctx context.Context, key string) (time.Duration, error)
+}
+
+// KeyPrefixer is optionally implemented by DataStorage whose keys share a prefix, cache keys are generated with it
+type KeyPrefixer interface {
+	KeyPrefix() string
 }
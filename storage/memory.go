@@ -2,8 +2,8 @@ package storage
 
 import (
 	"context"
-	"fmt"
 	"github.com/karlseguin/ccache/v3"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,6 +11,9 @@ import (
 )
 
 var _ DataStorage = &Memory{}
+var _ MemoryReporter = &Memory{}
+var _ StaleGetter = &Memory{}
+var _ TTLGetter = &Memory{}
 
 type MemStoreConfig struct {
 	MaxSize int64 // maximal items in primary cache
@@ -32,15 +35,18 @@ type Memory struct {
 
 	cache *ccache.Cache[string]
 	ttl   int64
+	grace time.Duration
 
 	once sync.Once
 }
 
 func (m *Memory) Init(conf *Config) error {
 	m.once.Do(func() {
-		c := ccache.New(ccache.Configure[string]().MaxSize(m.config.MaxSize))
+		// pinned items are tracked and never released, so that they aren't evicted
+		c := ccache.New(ccache.Configure[string]().MaxSize(m.config.MaxSize).Track())
 		m.cache = c
-		m.ttl = conf.TTL
+		m.ttl = conf.TTLMillis()
+		m.grace = time.Duration(conf.GracePeriodMillis()) * time.Millisecond
 	})
 	return nil
 }
@@ -52,8 +58,7 @@ func (m *Memory) CleanCache(ctx context.Context) error {
 
 func (m *Memory) BatchKeyExist(ctx context.Context, keys []string) (bool, error) {
 	for _, key := range keys {
-		item := m.cache.Get(key)
-		if item == nil || item.Expired() {
+		if !m.fresh(m.cache.Get(key)) {
 			return false, nil
 		}
 	}
@@ -61,37 +66,88 @@ func (m *Memory) BatchKeyExist(ctx context.Context, keys []string) (bool, error)
 }
 
 func (m *Memory) KeyExists(ctx context.Context, key string) (bool, error) {
-	item := m.cache.Get(key)
-	return item != nil && !item.Expired(), nil
+	return m.fresh(m.cache.Get(key)), nil
 }
 
 func (m *Memory) GetValue(ctx context.Context, key string) (string, error) {
 	item := m.cache.Get(key)
-	if item == nil || item.Expired() {
+	if !m.fresh(item) {
 		return "", ErrCacheNotFound
 	}
 	return item.Value(), nil
 }
 
+// GetStale returns value of key until its grace period is over, since items are kept for ttl plus grace period
+func (m *Memory) GetStale(ctx context.Context, key string) (string, bool, error) {
+	item := m.cache.Get(key)
+	if item == nil || item.Expired() {
+		return "", false, ErrCacheNotFound
+	}
+	return item.Value(), !m.fresh(item), nil
+}
+
 func (m *Memory) BatchGetValues(ctx context.Context, keys []string) ([]string, error) {
 	values := make([]string, 0, len(keys))
 	for _, key := range keys {
 		item := m.cache.Get(key)
-		if item != nil && !item.Expired() {
+		if m.fresh(item) {
 			values = append(values, item.Value())
 		}
 	}
 	if len(values) != len(keys) {
-		return nil, fmt.Errorf("cannot get items")
+		return nil, ErrCacheNotFound
 	}
 	return values, nil
 }
 
+// Keys iterates keys in lexical order, cursor is the offset in it
+func (m *Memory) Keys(ctx context.Context, keyPrefix string, cursor uint64, count int64) ([]string, uint64, error) {
+	keys := make([]string, 0)
+	m.cache.ForEachFunc(func(key string, item *ccache.Item[string]) bool {
+		if strings.HasPrefix(key, keyPrefix+":") && m.fresh(item) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	keys, next := pageKeys(keys, cursor, count)
+	return keys, next, nil
+}
+
 func (m *Memory) DeleteKeysWithPrefix(ctx context.Context, keyPrefix string) error {
-	m.cache.DeletePrefix(keyPrefix)
+	m.cache.DeletePrefix(keyPrefix + ":")
 	return nil
 }
 
+func (m *Memory) countKeysWithPrefix(ctx context.Context, keyPrefix string) (int64, error) {
+	var cnt int64
+	m.cache.ForEachFunc(func(key string, item *ccache.Item[string]) bool {
+		if strings.HasPrefix(key, keyPrefix+":") && m.fresh(item) {
+			cnt++
+		}
+		return true
+	})
+	return cnt, nil
+}
+
+func (m *Memory) EntryCount(ctx context.Context, keyPrefix string) (int64, error) {
+	if keyPrefix == "" {
+		return int64(m.cache.ItemCount()), nil
+	}
+	return m.countKeysWithPrefix(ctx, keyPrefix)
+}
+
+// MemoryUsage returns total size of keys and values, which doesn't include overhead of the cache
+func (m *Memory) MemoryUsage(ctx context.Context, keyPrefix string) (int64, error) {
+	var size int64
+	m.cache.ForEachFunc(func(key string, item *ccache.Item[string]) bool {
+		if (keyPrefix == "" || strings.HasPrefix(key, keyPrefix+":")) && m.fresh(item) {
+			size += int64(len(key) + len(item.Value()))
+		}
+		return true
+	})
+	return size, nil
+}
+
 func (m *Memory) DeleteKey(ctx context.Context, key string) error {
 	m.cache.Delete(key)
 	return nil
@@ -106,20 +162,54 @@ func (m *Memory) BatchDeleteKeys(ctx context.Context, keys []string) error {
 
 func (m *Memory) BatchSetKeys(ctx context.Context, kvs []util.Kv) error {
 	for _, kv := range kvs {
-		if m.ttl > 0 {
-			m.cache.Set(kv.Key, kv.Value, time.Duration(util.RandFloatingInt64(m.ttl))*time.Millisecond)
-		} else {
-			m.cache.Set(kv.Key, kv.Value, time.Duration(util.RandFloatingInt64(24))*time.Hour)
-		}
+		m.set(kv)
 	}
 	return nil
 }
 
 func (m *Memory) SetKey(ctx context.Context, kv util.Kv) error {
-	if m.ttl > 0 {
-		m.cache.Set(kv.Key, kv.Value, time.Duration(util.RandFloatingInt64(m.ttl))*time.Millisecond)
-	} else {
-		m.cache.Set(kv.Key, kv.Value, time.Duration(util.RandFloatingInt64(24))*time.Hour)
+	m.set(kv)
+	return nil
+}
+
+// Expire replaces the item of key with one expiring after ttl
+func (m *Memory) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	item := m.cache.Get(key)
+	if !m.fresh(item) {
+		return ErrCacheNotFound
 	}
+	m.set(util.Kv{Key: key, Value: item.Value(), TTL: util.DurationToMillis(ttl)})
 	return nil
 }
+
+// TTL returns time left until item of key expires, grace period excluded
+func (m *Memory) TTL(ctx context.Context, key string) (time.Duration, error) {
+	item := m.cache.Get(key)
+	if !m.fresh(item) {
+		return 0, ErrCacheNotFound
+	}
+	ttl := time.Until(item.Expires().Add(-m.grace))
+	if ttl > pinnedExpiration/2 {
+		// pinned items are set with pinnedExpiration
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// fresh checks if item exists and hasn't expired, items are kept for grace period after they expire
+func (m *Memory) fresh(item *ccache.Item[string]) bool {
+	return item != nil && time.Now().Before(item.Expires().Add(-m.grace))
+}
+
+func (m *Memory) set(kv util.Kv) {
+	switch {
+	case kv.Pinned:
+		m.cache.TrackingSet(kv.Key, kv.Value, pinnedExpiration)
+	case kv.TTL > 0:
+		m.cache.Set(kv.Key, kv.Value, time.Duration(util.RandFloatingInt64(kv.TTL))*time.Millisecond+m.grace)
+	case m.ttl > 0:
+		m.cache.Set(kv.Key, kv.Value, time.Duration(util.RandFloatingInt64(m.ttl))*time.Millisecond+m.grace)
+	default:
+		m.cache.Set(kv.Key, kv.Value, time.Duration(util.RandFloatingInt64(24))*time.Hour+m.grace)
+	}
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/asjdf/gorm-cache/util"
+)
+
+var _ DataStorage = &Null{}
+
+// NewNull returns a storage keeping nothing, every read misses and every write is dropped.
+// It measures the overhead of the plugin itself, see cache.WithPassthrough.
+func NewNull() *Null {
+	return &Null{}
+}
+
+type Null struct{}
+
+func (n *Null) Init(config *Config) error {
+	return nil
+}
+
+func (n *Null) CleanCache(ctx context.Context) error {
+	return nil
+}
+
+func (n *Null) BatchKeyExist(ctx context.Context, keys []string) (bool, error) {
+	return false, nil
+}
+
+func (n *Null) KeyExists(ctx context.Context, key string) (bool, error) {
+	return false, nil
+}
+
+func (n *Null) GetValue(ctx context.Context, key string) (string, error) {
+	return "", ErrCacheNotFound
+}
+
+func (n *Null) BatchGetValues(ctx context.Context, keys []string) ([]string, error) {
+	return nil, ErrCacheNotFound
+}
+
+func (n *Null) EntryCount(ctx context.Context, keyPrefix string) (int64, error) {
+	return 0, nil
+}
+
+func (n *Null) Keys(ctx context.Context, keyPrefix string, cursor uint64, count int64) ([]string, uint64, error) {
+	return nil, 0, nil
+}
+
+func (n *Null) DeleteKeysWithPrefix(ctx context.Context, keyPrefix string) error {
+	return nil
+}
+
+func (n *Null) DeleteKey(ctx context.Context, key string) error {
+	return nil
+}
+
+func (n *Null) BatchDeleteKeys(ctx context.Context, keys []string) error {
+	return nil
+}
+
+func (n *Null) BatchSetKeys(ctx context.Context, kvs []util.Kv) error {
+	return nil
+}
+
+func (n *Null) SetKey(ctx context.Context, kv util.Kv) error {
+	return nil
+}
+
+func (n *Null) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	return ErrCacheNotFound
+}
@@ -2,7 +2,11 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/asjdf/gorm-cache/util"
@@ -10,53 +14,107 @@ import (
 )
 
 var _ DataStorage = &Redis{}
+var _ KeyPrefixer = &Redis{}
+var _ MemoryReporter = &Redis{}
+var _ StaleGetter = &Redis{}
+var _ TTLGetter = &Redis{}
 
 type RedisStoreConfig struct {
-	KeyPrefix string // key prefix will be random if not set
+	// KeyPrefix all keys of the store start with it, cache keys are generated with it as well.
+	// If not set, keys start with the prefix configured in the cache, see config.CacheConfig.KeyPrefix.
+	KeyPrefix string
 
-	Client  *redis.Client // if Client is not nil, Options will be ignored
-	Options *redis.Options
+	// the client is UniversalClient if not nil, else Client if not nil, else a client created with Options.
+	// UniversalClient must be a *redis.Client, *redis.ClusterClient or *redis.Ring. Keys of a cluster or ring are
+	// spread over nodes, so multi-key commands are pipelined per key and keys are deleted by prefix by scanning
+	// every master node, which is slower than the Lua scripts used on a single node.
+	UniversalClient redis.UniversalClient
+	Client          *redis.Client
+	Options         *redis.Options
+
+	// TTL if not 0, overrides ttl of cache kept in this store
+	TTL time.Duration
+
+	// ReadClientFunc if not nil, cache lookups (Exists, Get and MGet) use the client it returns for ctx,
+	// e.g. a client of a nearby replica when ctx carries a read preference. Returning nil uses the client above.
+	// ctx is the context of the gorm statement, so values set by db.WithContext are visible to it.
+	ReadClientFunc func(ctx context.Context) redis.UniversalClient
 }
 
+// NewRedis creates redis store with config, which is required
 func NewRedis(config ...*RedisStoreConfig) *Redis {
 	if len(config) == 0 {
 		panic("redis config is required")
 	}
-	if config[0].KeyPrefix == "" {
-		config[0].KeyPrefix = util.GormCachePrefix + ":" + util.GenInstanceId()
-	}
 	r := &Redis{
-		keyPrefix: config[0].KeyPrefix,
+		keyPrefix:      config[0].KeyPrefix,
+		ttlOverride:    config[0].TTL,
+		readClientFunc: config[0].ReadClientFunc,
 	}
-	if config[0].Client != nil {
+	switch {
+	case config[0].UniversalClient != nil:
+		r.client = config[0].UniversalClient
+	case config[0].Client != nil:
 		r.client = config[0].Client
-		return r
+	default:
+		r.client = redis.NewClient(config[0].Options)
 	}
-	r.client = redis.NewClient(config[0].Options)
 	return r
 }
 
 type Redis struct {
-	client    *redis.Client
-	ttl       int64
-	logger    util.LoggerInterface
-	keyPrefix string
+	client         redis.UniversalClient
+	readClientFunc func(ctx context.Context) redis.UniversalClient
+	ttl            int64
+	ttlOverride    time.Duration
+	grace          time.Duration
+	logger         util.LoggerInterface
+	redact         util.Redactor
+	keyPrefix      string
+	namespace      string // keys of the store start with it, keyPrefix if set, else the prefix of the cache
 
 	batchExistSha string
 	cleanCacheSha string
 
-	once sync.Once
+	// initMu guards initialized, which is only set once Init succeeds, so that a failed Init can be retried
+	initMu      sync.Mutex
+	initialized bool
 }
 
 func (r *Redis) Init(conf *Config) error {
-	var err error
-	r.once.Do(func() {
-		r.ttl = conf.TTL
-		r.logger = conf.Logger
-		r.logger.SetIsDebug(conf.Debug)
-		err = r.initScripts()
-	})
-	return err
+	r.initMu.Lock()
+	defer r.initMu.Unlock()
+	if r.initialized {
+		return nil
+	}
+	switch r.client.(type) {
+	case *redis.Client, *redis.ClusterClient, *redis.Ring:
+	default:
+		return fmt.Errorf("redis client %T is not supported, use *redis.Client, *redis.ClusterClient or *redis.Ring",
+			r.client)
+	}
+	r.ttl = conf.TTLMillis()
+	if r.ttlOverride != 0 {
+		r.ttl = util.DurationToMillis(r.ttlOverride)
+	}
+	r.grace = time.Duration(conf.GracePeriodMillis()) * time.Millisecond
+	r.logger = conf.Logger
+	r.redact = conf.Redact
+	r.logger.SetIsDebug(conf.Debug)
+	r.namespace = r.keyPrefix
+	if r.namespace == "" {
+		r.namespace = conf.KeyPrefix
+	}
+	if r.namespace == "" {
+		r.namespace = util.GormCachePrefix
+	}
+	if !isSharded(r.client) {
+		if err := r.initScripts(); err != nil {
+			return err
+		}
+	}
+	r.initialized = true
+	return nil
 }
 
 func (r *Redis) initScripts() error {
@@ -94,16 +152,113 @@ func (r *Redis) initScripts() error {
 	return nil
 }
 
+func (r *Redis) redactKey(key string) interface{} {
+	if r.redact == nil {
+		return key
+	}
+	return r.redact(key)
+}
+
+// KeyPrefix returns prefix of all keys of the store
+func (r *Redis) KeyPrefix() string {
+	return r.keyPrefix
+}
+
+// readClient returns the client which cache lookups within ctx use
+func (r *Redis) readClient(ctx context.Context) redis.UniversalClient {
+	if r.readClientFunc != nil {
+		if client := r.readClientFunc(ctx); client != nil {
+			return client
+		}
+	}
+	return r.client
+}
+
+// isSharded checks if keys of client are spread over nodes, so that scripts and multi-key commands can't be used
+func isSharded(client redis.UniversalClient) bool {
+	switch client.(type) {
+	case *redis.ClusterClient, *redis.Ring:
+		return true
+	}
+	return false
+}
+
+// forEachNode calls fn with client of every node keys of client are spread over, concurrently for a cluster or ring
+func forEachNode(ctx context.Context, client redis.UniversalClient,
+	fn func(ctx context.Context, node redis.UniversalClient) error) error {
+	switch c := client.(type) {
+	case *redis.ClusterClient:
+		return c.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return fn(ctx, node)
+		})
+	case *redis.Ring:
+		return c.ForEachShard(ctx, func(ctx context.Context, node *redis.Client) error {
+			return fn(ctx, node)
+		})
+	}
+	return fn(ctx, client)
+}
+
+// deleteMatching deletes keys matching pattern, on every node if the client is sharded
+func (r *Redis) deleteMatching(ctx context.Context, pattern string) error {
+	if !isSharded(r.client) {
+		return r.client.EvalSha(ctx, r.cleanCacheSha, []string{"0"}, pattern).Err()
+	}
+	return forEachNode(ctx, r.client, func(ctx context.Context, node redis.UniversalClient) error {
+		var cursor uint64
+		for {
+			keys, next, err := node.Scan(ctx, cursor, pattern, 1000).Result()
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				// keys on a node may belong to different slots, which DEL doesn't take at once
+				_, err = node.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+					for _, key := range keys {
+						pipeliner.Del(ctx, key)
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	})
+}
+
 func (r *Redis) CleanCache(ctx context.Context) error {
-	result := r.client.EvalSha(ctx, r.cleanCacheSha, []string{"0"}, r.keyPrefix+":*")
-	if result.Err() != nil {
-		r.logger.CtxError(ctx, "[CleanCache] clean cache error: %v", result.Err())
-		return result.Err()
+	err := r.deleteMatching(ctx, r.namespace+":*")
+	if err != nil {
+		r.logger.CtxError(ctx, "[CleanCache] clean cache error: %v", err)
+		return err
 	}
 	return nil
 }
 
 func (r *Redis) BatchKeyExist(ctx context.Context, keys []string) (bool, error) {
+	if isSharded(r.client) {
+		cmds, err := r.client.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+			for _, key := range keys {
+				pipeliner.Exists(ctx, key)
+			}
+			return nil
+		})
+		if err != nil {
+			r.logger.CtxError(ctx, "[BatchKeyExist] exists error: %v", err)
+			return false, err
+		}
+		for _, cmd := range cmds {
+			if cmd.(*redis.IntCmd).Val() == 0 {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
 	result := r.client.EvalSha(ctx, r.batchExistSha, keys)
 	if result.Err() != nil {
 		r.logger.CtxError(ctx, "[BatchKeyExist] eval script error: %v", result.Err())
@@ -113,7 +268,7 @@ func (r *Redis) BatchKeyExist(ctx context.Context, keys []string) (bool, error)
 }
 
 func (r *Redis) KeyExists(ctx context.Context, key string) (bool, error) {
-	result := r.client.Exists(ctx, key)
+	result := r.readClient(ctx).Exists(ctx, key)
 	if result.Err() != nil {
 		r.logger.CtxError(ctx, "[KeyExists] exists error: %v", result.Err())
 		return false, result.Err()
@@ -124,16 +279,70 @@ func (r *Redis) KeyExists(ctx context.Context, key string) (bool, error) {
 	return false, nil
 }
 
+// TTL returns PTTL of key, the stale copy of key isn't taken into account
+func (r *Redis) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.readClient(ctx).PTTL(ctx, key).Result()
+	if err != nil {
+		r.logger.CtxError(ctx, "[TTL] pttl key %v error: %v", r.redactKey(key), err)
+		return 0, err
+	}
+	switch {
+	case ttl == -2:
+		return 0, ErrCacheNotFound
+	case ttl < 0:
+		// key exists without ttl
+		return 0, nil
+	}
+	return ttl, nil
+}
+
 func (r *Redis) GetValue(ctx context.Context, key string) (data string, err error) {
-	data, err = r.client.Get(ctx, key).Result()
+	data, err = r.readClient(ctx).Get(ctx, key).Result()
 	if err == redis.Nil {
 		err = ErrCacheNotFound
 	}
 	return
 }
 
+// GetStale falls back to the stale copy of key, which is kept for grace period longer than key
+func (r *Redis) GetStale(ctx context.Context, key string) (string, bool, error) {
+	data, err := r.readClient(ctx).Get(ctx, key).Result()
+	if err != redis.Nil {
+		return data, false, err
+	}
+	if r.grace <= 0 {
+		return "", false, ErrCacheNotFound
+	}
+	data, err = r.readClient(ctx).Get(ctx, r.staleKey(key)).Result()
+	if err == redis.Nil {
+		return "", false, ErrCacheNotFound
+	}
+	return data, err == nil, err
+}
+
 func (r *Redis) BatchGetValues(ctx context.Context, keys []string) ([]string, error) {
-	result := r.client.MGet(ctx, keys...)
+	client := r.readClient(ctx)
+	if isSharded(client) {
+		cmds, err := client.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+			for _, key := range keys {
+				pipeliner.Get(ctx, key)
+			}
+			return nil
+		})
+		if err != nil && err != redis.Nil {
+			r.logger.CtxError(ctx, "[BatchGetValues] get error: %v", err)
+			return nil, err
+		}
+		// like MGET, values of keys not found are left out
+		strs := make([]string, 0, len(cmds))
+		for _, cmd := range cmds {
+			if cmd.Err() == nil {
+				strs = append(strs, cmd.(*redis.StringCmd).Val())
+			}
+		}
+		return strs, nil
+	}
+	result := client.MGet(ctx, keys...)
 	if result.Err() != nil {
 		r.logger.CtxError(ctx, "[BatchGetValues] mget error: %v", result.Err())
 		return nil, result.Err()
@@ -148,21 +357,160 @@ func (r *Redis) BatchGetValues(ctx context.Context, keys []string) ([]string, er
 	return strs, nil
 }
 
+// nodeCursorBits count of low bits of cursors returned by Keys on a cluster or ring which keep the SCAN cursor
+// of a node, the bits above keep the index of the node
+const nodeCursorBits = 48
+
+// Keys iterates keys with SCAN, cursor is the cursor of SCAN. On a cluster or ring every node is scanned in turn,
+// and the cursor keeps the index of the node being scanned as well.
+func (r *Redis) Keys(ctx context.Context, keyPrefix string, cursor uint64, count int64) ([]string, uint64, error) {
+	if !isSharded(r.client) {
+		keys, next, err := r.readClient(ctx).Scan(ctx, cursor, keyPrefix+":*", count).Result()
+		if err != nil {
+			r.logger.CtxError(ctx, "[Keys] scan error: %v", err)
+			return nil, 0, err
+		}
+		return keys, next, nil
+	}
+	nodes, err := r.nodes(ctx)
+	if err != nil {
+		r.logger.CtxError(ctx, "[Keys] list nodes error: %v", err)
+		return nil, 0, err
+	}
+	idx := int(cursor >> nodeCursorBits)
+	if idx >= len(nodes) {
+		return nil, 0, nil
+	}
+	keys, next, err := nodes[idx].Scan(ctx, cursor&(1<<nodeCursorBits-1), keyPrefix+":*", count).Result()
+	if err != nil {
+		r.logger.CtxError(ctx, "[Keys] scan error: %v", err)
+		return nil, 0, err
+	}
+	if next>>nodeCursorBits != 0 {
+		return nil, 0, fmt.Errorf("scan cursor %d of node %d is out of range", next, idx)
+	}
+	if next == 0 {
+		// continue with the next node
+		idx++
+		if idx == len(nodes) {
+			return keys, 0, nil
+		}
+	}
+	return keys, uint64(idx)<<nodeCursorBits | next, nil
+}
+
+// nodes returns clients of the nodes keys of a cluster or ring are spread over, in order of their addresses
+func (r *Redis) nodes(ctx context.Context) ([]redis.UniversalClient, error) {
+	var mu sync.Mutex
+	nodes := make([]redis.UniversalClient, 0)
+	err := forEachNode(ctx, r.client, func(ctx context.Context, node redis.UniversalClient) error {
+		mu.Lock()
+		nodes = append(nodes, node)
+		mu.Unlock()
+		return nil
+	})
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].(*redis.Client).Options().Addr < nodes[j].(*redis.Client).Options().Addr
+	})
+	return nodes, err
+}
+
 func (r *Redis) DeleteKeysWithPrefix(ctx context.Context, keyPrefix string) error {
-	result := r.client.EvalSha(ctx, r.cleanCacheSha, []string{"0"}, keyPrefix+":*")
-	return result.Err()
+	err := r.deleteMatching(ctx, keyPrefix+":*")
+	if err != nil || r.grace <= 0 {
+		return err
+	}
+	return r.deleteMatching(ctx, r.staleKey(keyPrefix)+":*")
+}
+
+func (r *Redis) countKeysWithPrefix(ctx context.Context, keyPrefix string) (int64, error) {
+	var cnt int64
+	err := forEachNode(ctx, r.client, func(ctx context.Context, node redis.UniversalClient) error {
+		iter := node.Scan(ctx, 0, keyPrefix+":*", 1000).Iterator()
+		for iter.Next(ctx) {
+			atomic.AddInt64(&cnt, 1)
+		}
+		return iter.Err()
+	})
+	return cnt, err
+}
+
+// EntryCount counts keys with DBSIZE if keyPrefix is empty, else by scanning keys
+func (r *Redis) EntryCount(ctx context.Context, keyPrefix string) (int64, error) {
+	if keyPrefix == "" {
+		var size int64
+		err := forEachNode(ctx, r.client, func(ctx context.Context, node redis.UniversalClient) error {
+			n, err := node.DBSize(ctx).Result()
+			atomic.AddInt64(&size, n)
+			return err
+		})
+		return size, err
+	}
+	return r.countKeysWithPrefix(ctx, keyPrefix)
+}
+
+// MemoryUsage sums MEMORY USAGE of scanned keys, keys of the whole db are scanned if keyPrefix is empty
+func (r *Redis) MemoryUsage(ctx context.Context, keyPrefix string) (int64, error) {
+	match := "*"
+	if keyPrefix != "" {
+		match = keyPrefix + ":*"
+	}
+	var size int64
+	err := forEachNode(ctx, r.client, func(ctx context.Context, node redis.UniversalClient) error {
+		var cursor uint64
+		for {
+			keys, next, err := node.Scan(ctx, cursor, match, 1000).Result()
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				cmds, err := node.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+					for _, key := range keys {
+						pipeliner.MemoryUsage(ctx, key)
+					}
+					return nil
+				})
+				if err != nil && err != redis.Nil {
+					return err
+				}
+				for _, cmd := range cmds {
+					// keys removed since they were scanned are skipped
+					atomic.AddInt64(&size, cmd.(*redis.IntCmd).Val())
+				}
+			}
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	})
+	return size, err
 }
 
 func (r *Redis) DeleteKey(ctx context.Context, key string) error {
-	return r.client.Del(ctx, key).Err()
+	return r.BatchDeleteKeys(ctx, []string{key})
 }
 
 func (r *Redis) BatchDeleteKeys(ctx context.Context, keys []string) error {
+	if r.grace > 0 {
+		for _, key := range keys[:len(keys):len(keys)] {
+			keys = append(keys, r.staleKey(key))
+		}
+	}
+	if isSharded(r.client) {
+		_, err := r.client.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+			for _, key := range keys {
+				pipeliner.Del(ctx, key)
+			}
+			return nil
+		})
+		return err
+	}
 	return r.client.Del(ctx, keys...).Err()
 }
 
 func (r *Redis) BatchSetKeys(ctx context.Context, kvs []util.Kv) error {
-	if r.ttl == 0 {
+	if r.ttl == 0 && !hasKvTTL(kvs) && !isSharded(r.client) {
 		spreads := make([]interface{}, 0, len(kvs))
 		for _, kv := range kvs {
 			spreads = append(spreads, kv.Key)
@@ -172,10 +520,9 @@ func (r *Redis) BatchSetKeys(ctx context.Context, kvs []util.Kv) error {
 	}
 	_, err := r.client.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
 		for _, kv := range kvs {
-			result := pipeliner.Set(ctx, kv.Key, kv.Value, time.Duration(util.RandFloatingInt64(r.ttl))*time.Millisecond)
-			if result.Err() != nil {
-				r.logger.CtxError(ctx, "[BatchSetKeys] set key %s error: %v", kv.Key, result.Err())
-				return result.Err()
+			if err := r.set(ctx, pipeliner, kv); err != nil {
+				r.logger.CtxError(ctx, "[BatchSetKeys] set key %v error: %v", r.redactKey(kv.Key), err)
+				return err
 			}
 		}
 		return nil
@@ -184,5 +531,77 @@ func (r *Redis) BatchSetKeys(ctx context.Context, kvs []util.Kv) error {
 }
 
 func (r *Redis) SetKey(ctx context.Context, kv util.Kv) error {
-	return r.client.Set(ctx, kv.Key, kv.Value, time.Duration(util.RandFloatingInt64(r.ttl))*time.Millisecond).Err()
+	if r.grace <= 0 {
+		return r.client.Set(ctx, kv.Key, kv.Value, r.expiration(kv)).Err()
+	}
+	_, err := r.client.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		return r.set(ctx, pipeliner, kv)
+	})
+	return err
+}
+
+// set sets kv in pipeliner, along with its stale copy if grace period is set and kv expires
+func (r *Redis) set(ctx context.Context, pipeliner redis.Pipeliner, kv util.Kv) error {
+	expiration := r.expiration(kv)
+	if err := pipeliner.Set(ctx, kv.Key, kv.Value, expiration).Err(); err != nil {
+		return err
+	}
+	if r.grace <= 0 || expiration <= 0 {
+		return nil
+	}
+	return pipeliner.Set(ctx, r.staleKey(kv.Key), kv.Value, expiration+r.grace).Err()
+}
+
+// staleKey returns key of the stale copy of key, it is outside namespaces of cache keys so that they aren't counted
+func (r *Redis) staleKey(key string) string {
+	return r.namespace + ":~" + strings.TrimPrefix(key, r.namespace)
+}
+
+func (r *Redis) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	var ok bool
+	var err error
+	expiration := r.expiration(util.Kv{Key: key, TTL: util.DurationToMillis(ttl)})
+	if expiration > 0 {
+		ok, err = r.client.PExpire(ctx, key, expiration).Result()
+	} else {
+		// PERSIST returns false for keys without ttl as well
+		_, err = r.client.Persist(ctx, key).Result()
+		if err == nil {
+			var n int64
+			n, err = r.client.Exists(ctx, key).Result()
+			ok = n == 1
+		}
+	}
+	if err != nil {
+		r.logger.CtxError(ctx, "[Expire] expire key %v error: %v", r.redactKey(key), err)
+		return err
+	}
+	if !ok {
+		return ErrCacheNotFound
+	}
+	if r.grace > 0 && expiration > 0 {
+		// the stale copy lives on for grace period after key
+		r.client.PExpire(ctx, r.staleKey(key), expiration+r.grace)
+	}
+	return nil
+}
+
+// expiration returns the expiration for kv, 0 represents no expiration
+func (r *Redis) expiration(kv util.Kv) time.Duration {
+	if kv.Pinned {
+		return 0
+	}
+	if kv.TTL > 0 {
+		return time.Duration(util.RandFloatingInt64(kv.TTL)) * time.Millisecond
+	}
+	return time.Duration(util.RandFloatingInt64(r.ttl)) * time.Millisecond
+}
+
+func hasKvTTL(kvs []util.Kv) bool {
+	for _, kv := range kvs {
+		if kv.TTL > 0 {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,80 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type aggregateResult struct {
+	Total int64
+}
+
+func TestAggregateCache(t *testing.T) {
+	Convey("test aggregate query cache", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelAll,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+			CacheTTL:             5000,
+		})
+		So(err, ShouldBeNil)
+
+		Convey("count is not served from primary cache", func() {
+			models := make([]*TestModel, 0)
+			result := db.Where("id IN (?)", []int{1, 2}).Find(&models)
+			So(result.Error, ShouldBeNil)
+
+			var count int64
+			result = db.Model(&TestModel{}).Where("id IN (?)", []int{1, 2}).Count(&count)
+			So(result.Error, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+
+			count = 0
+			result = db.Model(&TestModel{}).Where("id IN (?)", []int{1, 2}).Count(&count)
+			So(result.Error, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+			So(c.HitCount(), ShouldEqual, 1)
+		})
+
+		Convey("aggregates are cached and invalidated with their table", func() {
+			sum := func() int64 {
+				agg := aggregateResult{}
+				result := db.Model(&TestModel{}).Select("sum(value1) as total").Where("id IN (?)", []int{1, 2}).Find(&agg)
+				So(result.Error, ShouldBeNil)
+				return agg.Total
+			}
+
+			So(sum(), ShouldEqual, 3)
+			So(sum(), ShouldEqual, 3)
+			So(c.HitCount(), ShouldEqual, 1)
+
+			result := db.Model(&TestModel{}).Where("id = ?", 1).Update("value1", 10)
+			So(result.Error, ShouldBeNil)
+			defer db.Model(&TestModel{}).Where("id = ?", 1).Update("value1", 1)
+
+			So(sum(), ShouldEqual, 12)
+			So(c.HitCount(), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestInvalidDest(t *testing.T) {
+	Convey("test query with invalid dest", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelAll,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+			CacheTTL:     5000,
+		})
+		So(err, ShouldBeNil)
+
+		var model *TestModel
+		So(func() {
+			_ = db.Model(&TestModel{}).Where("id = ?", 1).Find(model)
+		}, ShouldNotPanic)
+		So(c.BypassCount(), ShouldEqual, 1)
+	})
+}
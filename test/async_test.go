@@ -0,0 +1,46 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAsyncPopulateSyncInvalidate(t *testing.T) {
+	Convey("test async cache populate with sync invalidate", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelAll,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+			AsyncCachePopulate:   true,
+		})
+		So(err, ShouldBeNil)
+		gc := c.(*cache.Gorm2Cache)
+
+		model := new(TestModel)
+		result := db.Where("id = ?", 1).First(model)
+		So(result.Error, ShouldBeNil)
+		So(waitFor(func() bool {
+			return gc.Status(context.Background()).AsyncQueueDepth == 0
+		}), ShouldBeTrue)
+		oldValue := model.Value1
+
+		result = db.Model(&TestModel{}).Where("id = ?", 1).UpdateColumn("value1", oldValue+1)
+		So(result.Error, ShouldBeNil)
+
+		// invalidation has finished when update returns
+		model = new(TestModel)
+		result = db.Where("id = ?", 1).First(model)
+		So(result.Error, ShouldBeNil)
+		So(model.Value1, ShouldEqual, oldValue+1)
+		So(c.HitCount(), ShouldEqual, 0)
+
+		result = db.Model(&TestModel{}).Where("id = ?", 1).UpdateColumn("value1", oldValue)
+		So(result.Error, ShouldBeNil)
+	})
+}
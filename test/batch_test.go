@@ -0,0 +1,126 @@
+package test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testModelAuthor struct {
+	ID      int64              `gorm:"column:id;primaryKey"`
+	Name    string             `gorm:"column:name"`
+	Books   []*testModelBook   `gorm:"foreignKey:AuthorID"`
+	Reviews []*testModelReview `gorm:"foreignKey:AuthorID"`
+}
+
+func (testModelAuthor) TableName() string {
+	return TestModelTableName + "_authors"
+}
+
+type testModelBook struct {
+	ID       int64  `gorm:"column:id;primaryKey"`
+	AuthorID int64  `gorm:"column:author_id"`
+	Title    string `gorm:"column:title"`
+}
+
+func (testModelBook) TableName() string {
+	return TestModelTableName + "_books"
+}
+
+type testModelReview struct {
+	ID       int64  `gorm:"column:id;primaryKey"`
+	AuthorID int64  `gorm:"column:author_id"`
+	Content  string `gorm:"column:content"`
+}
+
+func (testModelReview) TableName() string {
+	return TestModelTableName + "_reviews"
+}
+
+// countingStorage counts batch writes to the storage it wraps
+type countingStorage struct {
+	storage.DataStorage
+	batchSets int64
+}
+
+func (s *countingStorage) BatchSetKeys(ctx context.Context, kvs []util.Kv) error {
+	atomic.AddInt64(&s.batchSets, 1)
+	return s.DataStorage.BatchSetKeys(ctx, kvs)
+}
+
+func TestPrimaryCacheBatch(t *testing.T) {
+	Convey("test primary cache of several tables is set in batch", t, func() {
+		ctx := context.Background()
+		err := originalDB.AutoMigrate(&testModelAuthor{}, &testModelBook{}, &testModelReview{})
+		So(err, ShouldBeNil)
+		defer originalDB.Migrator().DropTable(&testModelAuthor{}, &testModelBook{}, &testModelReview{})
+		err = originalDB.Create(&testModelAuthor{
+			ID:      1,
+			Name:    "a",
+			Books:   []*testModelBook{{ID: 1, Title: "b1"}, {ID: 2, Title: "b2"}},
+			Reviews: []*testModelReview{{ID: 1, Content: "r1"}},
+		}).Error
+		So(err, ShouldBeNil)
+
+		s := &countingStorage{DataStorage: storage.NewGcache(gcache.New(1000))}
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelOnlyPrimary,
+			CacheStorage:         s,
+			InvalidateWhenUpdate: true,
+			CacheTTL:             5000,
+		})
+		So(err, ShouldBeNil)
+		gc := c.(*cache.Gorm2Cache)
+
+		exists := func(tableName string, primaryKeys ...string) bool {
+			ok, err := gc.BatchPrimaryKeyExists(ctx, tableName, primaryKeys)
+			So(err, ShouldBeNil)
+			return ok
+		}
+
+		Convey("preloaded objects are set with the preloading query in one round trip", func() {
+			authors := make([]*testModelAuthor, 0)
+			err := db.Preload("Books").Preload("Reviews").Where("name = ?", "a").Find(&authors).Error
+			So(err, ShouldBeNil)
+			So(len(authors), ShouldEqual, 1)
+			So(len(authors[0].Books), ShouldEqual, 2)
+			So(len(authors[0].Reviews), ShouldEqual, 1)
+
+			So(atomic.LoadInt64(&s.batchSets), ShouldEqual, 1)
+			So(exists(testModelAuthor{}.TableName(), "1"), ShouldBeTrue)
+			So(exists(testModelBook{}.TableName(), "1", "2"), ShouldBeTrue)
+			So(exists(testModelReview{}.TableName(), "1"), ShouldBeTrue)
+
+			books := make([]*testModelBook, 0)
+			So(db.Where("id IN (?)", []int64{1, 2}).Find(&books).Error, ShouldBeNil)
+			So(len(books), ShouldEqual, 2)
+			So(c.PrimaryHitCount(), ShouldEqual, 1)
+		})
+
+		Convey("tables can be set and invalidated together", func() {
+			err := gc.BatchSetPrimaryKeyCaches(ctx, map[string][]util.Kv{
+				testModelBook{}.TableName():   {{Key: "1", Value: `{"id":1,"author_id":1,"title":"b1"}`}},
+				testModelReview{}.TableName(): {{Key: "1", Value: `{"id":1,"author_id":1,"content":"r1"}`}},
+			})
+			So(err, ShouldBeNil)
+			So(atomic.LoadInt64(&s.batchSets), ShouldEqual, 1)
+			So(exists(testModelBook{}.TableName(), "1"), ShouldBeTrue)
+			So(exists(testModelReview{}.TableName(), "1"), ShouldBeTrue)
+
+			err = gc.BatchInvalidatePrimaryCaches(ctx, map[string][]string{
+				testModelBook{}.TableName():   {"1"},
+				testModelReview{}.TableName(): {"1"},
+			})
+			So(err, ShouldBeNil)
+			So(exists(testModelBook{}.TableName(), "1"), ShouldBeFalse)
+			So(exists(testModelReview{}.TableName(), "1"), ShouldBeFalse)
+		})
+	})
+}
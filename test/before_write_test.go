@@ -0,0 +1,84 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+func TestInvalidateBeforeWrite(t *testing.T) {
+	Convey("test invalidate before write", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:                  config.CacheLevelOnlySearch,
+			CacheStorage:                storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate:        true,
+			InvalidateBeforeWriteTables: []string{TestModelTableName},
+			CacheTTL:                    5000,
+		})
+		So(err, ShouldBeNil)
+
+		find := func(db *gorm.DB) {
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 = ?", 1).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 1)
+		}
+		find(db)
+		find(db)
+		So(c.HitCount(), ShouldEqual, 1)
+
+		// query the cache while the update is not executed yet
+		err = db.Callback().Update().Before("gorm:update").After(c.(*cache.Gorm2Cache).CallbackName("before_update")).
+			Register("test:read_during_update", func(tx *gorm.DB) {
+				find(tx.Session(&gorm.Session{NewDB: true}))
+			})
+		So(err, ShouldBeNil)
+
+		result := db.Model(&TestModel{}).Where("value1 = ?", 1).UpdateColumn("value1", 1)
+		So(result.Error, ShouldBeNil)
+		So(c.HitCount(), ShouldEqual, 1)
+		So(c.MissCount(), ShouldEqual, 2)
+	})
+	Convey("test invalidate primary cache of the model before write", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:                  config.CacheLevelOnlyPrimary,
+			CacheStorage:                storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate:        true,
+			InvalidateBeforeWriteTables: []string{TestModelTableName},
+			CacheTTL:                    5000,
+		})
+		So(err, ShouldBeNil)
+		gc := c.(*cache.Gorm2Cache)
+		ctx := context.Background()
+
+		cached := func(primaryKey string) bool {
+			exists, err := gc.BatchPrimaryKeyExists(ctx, TestModelTableName, []string{primaryKey})
+			So(err, ShouldBeNil)
+			return exists
+		}
+		for _, id := range []int64{13, 14} {
+			model := new(TestModel)
+			So(db.Where("id = ?", id).First(model).Error, ShouldBeNil)
+		}
+		So(waitFor(func() bool { return cached("13") && cached("14") }), ShouldBeTrue)
+
+		model := &TestModel{}
+		So(db.Where("id = ?", 13).First(model).Error, ShouldBeNil)
+		result := db.Model(model).Update("value9", "13")
+		So(result.Error, ShouldBeNil)
+		So(cached("13"), ShouldBeFalse)
+		// other rows are kept
+		So(cached("14"), ShouldBeTrue)
+
+		result = db.Save(model)
+		So(result.Error, ShouldBeNil)
+		So(cached("13"), ShouldBeFalse)
+		So(cached("14"), ShouldBeTrue)
+	})
+}
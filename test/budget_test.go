@@ -0,0 +1,42 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLookupDeadlineFraction(t *testing.T) {
+	Convey("test cache lookup takes a fraction of ctx deadline", t, func() {
+		So((&config.CacheConfig{LookupDeadlineFraction: 1}).Validate(), ShouldNotBeNil)
+
+		chaos := storage.NewChaos(storage.NewGcache(gcache.New(1000)), nil)
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:             config.CacheLevelAll,
+			CacheStorage:           chaos,
+			LookupDeadlineFraction: 0.2,
+		})
+		So(err, ShouldBeNil)
+
+		models := make([]*TestModel, 0)
+		So(db.Where("value1 < ?", 3).Find(&models).Error, ShouldBeNil)
+		chaos.SetConfig(&storage.ChaosConfig{Latency: time.Second, LatencyRate: 1})
+
+		// without the budget, the lookup would take all the time and the query would fail
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		So(db.WithContext(ctx).Where("value1 < ?", 3).Find(&models).Error, ShouldBeNil)
+		So(len(models), ShouldEqual, 2)
+		So(c.SearchHitCount(), ShouldEqual, 0)
+
+		// queries without deadline wait for the cache
+		chaos.SetConfig(&storage.ChaosConfig{Latency: 50 * time.Millisecond, LatencyRate: 1})
+		So(db.Where("value1 < ?", 3).Find(&models).Error, ShouldBeNil)
+		So(c.SearchHitCount(), ShouldEqual, 1)
+	})
+}
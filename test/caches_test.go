@@ -0,0 +1,35 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/caches"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCachesCompat(t *testing.T) {
+	Convey("test go-gorm/caches compatible plugin", t, func() {
+		db, err := forkDB(originalDB)
+		So(err, ShouldBeNil)
+
+		plugin := &caches.Caches{Conf: &caches.Config{
+			Easer:  true,
+			Cacher: storage.NewGcache(gcache.New(1000)),
+		}}
+		So(plugin.Cache(), ShouldBeNil)
+		So(db.Use(plugin), ShouldBeNil)
+		So(plugin.Cache(), ShouldNotBeNil)
+
+		models := make([]*TestModel, 0)
+		So(db.Where("value1 < ?", 3).Find(&models).Error, ShouldBeNil)
+		So(waitFor(func() bool {
+			return plugin.Cache().(*cache.Gorm2Cache).Status(context.Background()).AsyncQueueDepth == 0
+		}), ShouldBeTrue)
+		So(db.Where("value1 < ?", 3).Find(&models).Error, ShouldBeNil)
+		So(plugin.Cache().SearchHitCount(), ShouldEqual, 1)
+	})
+}
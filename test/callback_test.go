@@ -0,0 +1,79 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+func TestCallbackRegistration(t *testing.T) {
+	Convey("test callback registration", t, func() {
+		Convey("attaching twice doesn't register callbacks twice", func() {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:   config.CacheLevelOnlySearch,
+				CacheStorage: storage.NewGcache(gcache.New(1000)),
+				CacheTTL:     5000,
+			})
+			So(err, ShouldBeNil)
+			c.AttachToDB(db)
+
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 < ?", 5).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(c.MissCount(), ShouldEqual, 1)
+
+			result = db.Where("value1 < ?", 5).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(c.HitCount(), ShouldEqual, 1)
+		})
+
+		Convey("custom anchors are honored", func() {
+			anchors := *config.DefaultCallbackAnchors
+			anchors.AfterQuery = "gorm:query"
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:      config.CacheLevelOnlySearch,
+				CacheStorage:    storage.NewGcache(gcache.New(1000)),
+				CacheTTL:        5000,
+				CallbackAnchors: &anchors,
+			})
+			So(err, ShouldBeNil)
+
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 < ?", 5).Find(&models)
+			So(result.Error, ShouldBeNil)
+			result = db.Where("value1 < ?", 5).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(c.HitCount(), ShouldEqual, 1)
+		})
+
+		Convey("callbacks are named with the configured prefix", func() {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:         config.CacheLevelOnlySearch,
+				CacheStorage:       storage.NewGcache(gcache.New(1000)),
+				CacheTTL:           5000,
+				CallbackNamePrefix: "app:cache",
+			})
+			So(err, ShouldBeNil)
+			gc := c.(*cache.Gorm2Cache)
+			So(gc.CallbackName("before_query"), ShouldEqual, "app:cache:before_query")
+			So(db.Callback().Query().Get(gc.CallbackName("before_query")), ShouldNotBeNil)
+			So(db.Callback().Query().Get("gorm:cache:before_query"), ShouldBeNil)
+
+			// callbacks of other tools with the default prefix are kept
+			called := false
+			err = db.Callback().Query().Before("gorm:query").Register("gorm:cache:before_query",
+				func(db *gorm.DB) { called = true })
+			So(err, ShouldBeNil)
+			c.AttachToDB(db)
+			models := make([]*TestModel, 0)
+			So(db.Where("value1 < ?", 5).Find(&models).Error, ShouldBeNil)
+			So(called, ShouldBeTrue)
+			So(c.LookupCount(), ShouldEqual, 1)
+		})
+	})
+}
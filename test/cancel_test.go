@@ -0,0 +1,96 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+type cancelKey struct{}
+
+func TestCanceledQuery(t *testing.T) {
+	Convey("test canceled queries", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlySearch,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+		})
+		So(err, ShouldBeNil)
+		gc := c.(*cache.Gorm2Cache)
+
+		Convey("results of canceled queries are not cached", func() {
+			// cancels the context right after the query, as if it's canceled while rows are scanned
+			err = db.Callback().Query().After("gorm:query").Before(gc.CallbackName("after_query")).
+				Register("test:cancel", func(db *gorm.DB) {
+					if cancel, ok := db.Statement.Context.Value(cancelKey{}).(context.CancelFunc); ok {
+						cancel()
+					}
+				})
+			So(err, ShouldBeNil)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			models := make([]*TestModel, 0)
+			So(db.WithContext(context.WithValue(ctx, cancelKey{}, cancel)).Where("value1 = ?", 1).Find(&models).Error,
+				ShouldBeNil)
+			So(waitFor(func() bool { return gc.Status(context.Background()).AsyncQueueDepth == 0 }), ShouldBeTrue)
+
+			models = make([]*TestModel, 0)
+			So(db.Where("value1 = ?", 1).Find(&models).Error, ShouldBeNil)
+			So(c.HitCount(), ShouldEqual, 0)
+			So(c.MissCount(), ShouldEqual, 2)
+		})
+
+		Convey("results of canceled queries are not taken over", func() {
+			So(blockQuery(c, db), ShouldBeNil)
+			ch := make(chan struct{})
+			ctx, cancel := context.WithCancel(context.WithValue(context.Background(), blockKey{}, ch))
+			done := make(chan error, 2)
+			go func() {
+				models := make([]*TestModel, 0)
+				done <- db.WithContext(ctx).Where("value1 = ?", 1).Find(&models).Error
+			}()
+			So(waitFor(func() bool { return c.SingleFlightSize() == 1 }), ShouldBeTrue)
+			go func() {
+				models := make([]*TestModel, 0)
+				done <- db.Where("value1 = ?", 1).Find(&models).Error
+			}()
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+			close(ch)
+			// the canceled query fails while the other queries database itself, in either order
+			errs := []error{<-done, <-done}
+			So(errs[0] == nil, ShouldNotEqual, errs[1] == nil)
+			So(c.SingleFlightHitCount(), ShouldEqual, 0)
+		})
+
+		Convey("waiters whose context is canceled stop waiting", func() {
+			So(blockQuery(c, db), ShouldBeNil)
+			ch := make(chan struct{})
+			done := make(chan error, 1)
+			go func() {
+				models := make([]*TestModel, 0)
+				done <- db.WithContext(context.WithValue(context.Background(), blockKey{}, ch)).
+					Where("value1 = ?", 1).Find(&models).Error
+			}()
+			So(waitFor(func() bool { return c.SingleFlightSize() == 1 }), ShouldBeTrue)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			models := make([]*TestModel, 0)
+			err := db.WithContext(ctx).Where("value1 = ?", 1).Find(&models).Error
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+			So(c.SingleFlightSize(), ShouldEqual, 1)
+
+			close(ch)
+			So(<-done, ShouldBeNil)
+			So(c.SingleFlightSize(), ShouldEqual, 0)
+		})
+	})
+}
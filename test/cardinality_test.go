@@ -0,0 +1,59 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// plainStorage hides optional interfaces of the storage it wraps, and can't count keys
+type plainStorage struct {
+	storage.DataStorage
+}
+
+func (s *plainStorage) EntryCount(ctx context.Context, keyPrefix string) (int64, error) {
+	return 0, storage.ErrNotSupported
+}
+
+func TestPayloadSizeAndKeyCount(t *testing.T) {
+	Convey("test payload size histogram and key count", t, func() {
+		for _, s := range []storage.DataStorage{
+			storage.NewGcache(gcache.New(1000)),
+			&plainStorage{storage.NewGcache(gcache.New(1000))},
+		} {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:           config.CacheLevelOnlySearch,
+				CacheStorage:         s,
+				InvalidateWhenUpdate: true,
+				CacheTTL:             5000,
+			})
+			So(err, ShouldBeNil)
+
+			for i := 1; i <= 2; i++ {
+				models := make([]*TestModel, 0)
+				result := db.Where("value1 = ?", i).Find(&models)
+				So(result.Error, ShouldBeNil)
+				So(len(models), ShouldEqual, 1)
+			}
+			histogram := c.PayloadSizeHistogram()
+			So(histogram.Count, ShouldEqual, 2)
+			So(histogram.Counts[0], ShouldEqual, 2)
+			So(histogram.Sum, ShouldBeBetween, 0, 256*2)
+
+			cnt, err := c.(*cache.Gorm2Cache).TableKeyCount(context.Background(), TestModelTableName)
+			So(err, ShouldBeNil)
+			So(cnt, ShouldEqual, 2)
+
+			result := db.Model(&TestModel{}).Where("value1 = ?", 1).UpdateColumn("value1", 1)
+			So(result.Error, ShouldBeNil)
+			cnt, err = c.(*cache.Gorm2Cache).TableKeyCount(context.Background(), TestModelTableName)
+			So(err, ShouldBeNil)
+			So(cnt, ShouldEqual, 0)
+		}
+	})
+}
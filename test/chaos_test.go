@@ -0,0 +1,57 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChaosStorage(t *testing.T) {
+	Convey("test chaos storage", t, func() {
+		s := storage.NewChaos(storage.NewGcache(gcache.New(1000)), nil)
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlyPrimary,
+			CacheStorage: s,
+		})
+		So(err, ShouldBeNil)
+
+		find := func() {
+			models := make([]*TestModel, 0)
+			result := db.Where("id IN (?)", []int{1, 2}).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 2)
+		}
+		find()
+		find()
+		So(c.HitCount(), ShouldEqual, 1)
+
+		Convey("queries fall back to database on errors", func() {
+			s.SetConfig(&storage.ChaosConfig{ErrorRate: 1})
+			find()
+			So(c.HitCount(), ShouldEqual, 1)
+		})
+
+		Convey("partially loaded primary cache misses", func() {
+			s.SetConfig(&storage.ChaosConfig{PartialFailureRate: 1})
+			find()
+			So(c.HitCount(), ShouldEqual, 1)
+
+			err := s.BatchSetKeys(context.Background(), []util.Kv{{Key: "a", Value: "1"}})
+			So(err, ShouldEqual, storage.ErrChaosInjected)
+		})
+
+		Convey("latency is injected", func() {
+			s.SetConfig(&storage.ChaosConfig{Latency: 50 * time.Millisecond, LatencyRate: 1})
+			start := time.Now()
+			find()
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+			So(c.HitCount(), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// truncatingStorage truncates values read from the storage it wraps while truncate is set, like partial writes,
+// and counts deletions
+type truncatingStorage struct {
+	storage.DataStorage
+	truncate int32
+	deletes  int64
+}
+
+func (s *truncatingStorage) cut(value string) string {
+	if atomic.LoadInt32(&s.truncate) == 0 {
+		return value
+	}
+	return value[:len(value)/2]
+}
+
+func (s *truncatingStorage) GetValue(ctx context.Context, key string) (string, error) {
+	value, err := s.DataStorage.GetValue(ctx, key)
+	return s.cut(value), err
+}
+
+func (s *truncatingStorage) BatchGetValues(ctx context.Context, keys []string) ([]string, error) {
+	values, err := s.DataStorage.BatchGetValues(ctx, keys)
+	for i := range values {
+		values[i] = s.cut(values[i])
+	}
+	return values, err
+}
+
+func (s *truncatingStorage) BatchDeleteKeys(ctx context.Context, keys []string) error {
+	atomic.AddInt64(&s.deletes, int64(len(keys)))
+	return s.DataStorage.BatchDeleteKeys(ctx, keys)
+}
+
+func TestValueChecksum(t *testing.T) {
+	Convey("test corrupt cache entries are evicted and read as a miss", t, func() {
+		newDB := func(level config.CacheLevel, checksum bool) (*cache.Gorm2Cache, *truncatingStorage, func() []*TestModel) {
+			s := &truncatingStorage{DataStorage: storage.NewGcache(gcache.New(1000))}
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:    level,
+				CacheStorage:  s,
+				CacheTTL:      5000,
+				ValueChecksum: checksum,
+			})
+			So(err, ShouldBeNil)
+			return c.(*cache.Gorm2Cache), s, func() []*TestModel {
+				models := make([]*TestModel, 0)
+				So(db.Where("id IN (?)", []int64{1, 2, 3}).Find(&models).Error, ShouldBeNil)
+				return models
+			}
+		}
+		check := func(c *cache.Gorm2Cache, s *truncatingStorage, find func() []*TestModel) {
+			So(len(find()), ShouldEqual, 3)
+			So(waitFor(func() bool { return len(find()) == 3 && c.HitCount() > 0 }), ShouldBeTrue)
+
+			atomic.StoreInt32(&s.truncate, 1)
+			hits := c.HitCount()
+			models := find()
+			atomic.StoreInt32(&s.truncate, 0)
+			So(len(models), ShouldEqual, 3)
+			for i, m := range models {
+				So(m.ID, ShouldEqual, i+1)
+			}
+			So(c.HitCount(), ShouldEqual, hits)
+			So(c.CorruptCount(), ShouldBeGreaterThan, 0)
+			So(atomic.LoadInt64(&s.deletes), ShouldBeGreaterThan, 0)
+
+			// the result is cached again
+			So(waitFor(func() bool { return len(find()) == 3 && c.HitCount() > hits }), ShouldBeTrue)
+		}
+
+		Convey("values failing checksum in primary cache", func() {
+			check(newDB(config.CacheLevelOnlyPrimary, true))
+		})
+
+		Convey("values failing checksum in search cache", func() {
+			check(newDB(config.CacheLevelOnlySearch, true))
+		})
+
+		Convey("values which can't be unmarshaled in primary cache without checksum", func() {
+			check(newDB(config.CacheLevelOnlyPrimary, false))
+		})
+
+		Convey("values which can't be unmarshaled in search cache without checksum", func() {
+			check(newDB(config.CacheLevelOnlySearch, false))
+		})
+
+		Convey("values without checksum fail it", func() {
+			c, s, find := newDB(config.CacheLevelOnlySearch, false)
+			So(len(find()), ShouldEqual, 3)
+			So(waitFor(func() bool { return len(find()) == 3 && c.HitCount() > 0 }), ShouldBeTrue)
+
+			c.Config.ValueChecksum = true
+			So(len(find()), ShouldEqual, 3)
+			So(c.CorruptCount(), ShouldBeGreaterThan, 0)
+			So(atomic.LoadInt64(&s.deletes), ShouldBeGreaterThan, 0)
+		})
+	})
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func TestClauseKeying(t *testing.T) {
+	Convey("test clause aware key generation", t, func() {
+		Convey("locking reads are never cached", func() {
+			err := searchCache.ResetCache()
+			So(err, ShouldBeNil)
+
+			for i := 0; i < 2; i++ {
+				models := make([]*TestModel, 0)
+				result := searchDB.Clauses(clause.Locking{Strength: "UPDATE"}).Where("value1 < ?", 5).Find(&models)
+				So(result.Error, ShouldBeNil)
+				So(len(models), ShouldEqual, 4)
+			}
+			So(searchCache.HitCount(), ShouldEqual, 0)
+			So(searchCache.MissCount(), ShouldEqual, 0)
+		})
+
+		Convey("query option is part of the key", func() {
+			err := searchCache.ResetCache()
+			So(err, ShouldBeNil)
+
+			models := make([]*TestModel, 0)
+			result := searchDB.Where("value1 < ?", 5).Find(&models)
+			So(result.Error, ShouldBeNil)
+
+			result = searchDB.Set("gorm:query_option", "/* option */").Where("value1 < ?", 5).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(searchCache.HitCount(), ShouldEqual, 0)
+		})
+
+		Convey("ignored clauses are left out of the key", func() {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:        config.CacheLevelOnlySearch,
+				CacheStorage:      storage.NewGcache(gcache.New(1000)),
+				CacheTTL:          5000,
+				KeyIgnoredClauses: []string{traceClauseName},
+			})
+			So(err, ShouldBeNil)
+
+			models := make([]*TestModel, 0)
+			sql := originalDB.Session(&gorm.Session{DryRun: true}).Clauses(traceClause("a")).Where("value1 < ?", 5).
+				Find(&models).Statement.SQL.String()
+			So(sql, ShouldContainSubstring, "/* trace a */")
+
+			result := db.Clauses(traceClause("a")).Where("value1 < ?", 5).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(c.HitCount(), ShouldEqual, 0)
+
+			models = make([]*TestModel, 0)
+			result = db.Clauses(traceClause("b")).Where("value1 < ?", 5).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 4)
+			So(c.HitCount(), ShouldEqual, 1)
+		})
+
+		Convey("clauses changing results can't be ignored", func() {
+			So((&config.CacheConfig{KeyIgnoredClauses: []string{"ORDER BY"}}).Validate(), ShouldNotBeNil)
+			So((&config.CacheConfig{KeyIgnoredClauses: []string{"limit"}}).Validate(), ShouldNotBeNil)
+			So((&config.CacheConfig{KeyIgnoredClauses: []string{traceClauseName}}).Validate(), ShouldBeNil)
+
+			_, err := cache.NewGorm2Cache(&config.CacheConfig{
+				CacheLevel:        config.CacheLevelOnlySearch,
+				CacheStorage:      storage.NewGcache(gcache.New(1000)),
+				KeyIgnoredClauses: []string{"WHERE"},
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+const traceClauseName = "TRACE"
+
+// traceClause appends a trace comment to queries, which doesn't change their results
+type traceClause string
+
+func (t traceClause) ModifyStatement(stmt *gorm.Statement) {
+	stmt.Clauses[traceClauseName] = clause.Clause{Expression: clause.Expr{SQL: "/* trace " + string(t) + " */"}}
+	stmt.BuildClauses = []string{"SELECT", "FROM", "WHERE", "GROUP BY", "ORDER BY", "LIMIT", "FOR", traceClauseName}
+}
+
+func (t traceClause) Build(clause.Builder) {}
+
+func TestMaxVarsForCaching(t *testing.T) {
+	Convey("test max vars for caching", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:        config.CacheLevelAll,
+			CacheStorage:      storage.NewGcache(gcache.New(1000)),
+			CacheTTL:          5000,
+			MaxVarsForCaching: 3,
+		})
+		So(err, ShouldBeNil)
+
+		for i := 0; i < 2; i++ {
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 IN (?)", []int{1, 2, 3, 4}).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 4)
+		}
+		So(c.HitCount(), ShouldEqual, 0)
+		So(c.MissCount(), ShouldEqual, 0)
+		So(c.BypassCount(), ShouldEqual, 2)
+
+		models := make([]*TestModel, 0)
+		result := db.Where("value1 IN (?)", []int{1, 2, 3}).Find(&models)
+		So(result.Error, ShouldBeNil)
+		So(c.MissCount(), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompositePrimaryKey(t *testing.T) {
+	Convey("test composite primary key", t, func() {
+		ctx := context.Background()
+		err := originalDB.AutoMigrate(&testModelTag{})
+		So(err, ShouldBeNil)
+		defer originalDB.Migrator().DropTable(&testModelTag{})
+		err = originalDB.Create([]*testModelTag{{ModelID: 1, Tag: "a"}, {ModelID: 1, Tag: "b"}, {ModelID: 2, Tag: "a"}}).Error
+		So(err, ShouldBeNil)
+
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelOnlyPrimary,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+			CacheTTL:             5000,
+		})
+		So(err, ShouldBeNil)
+		gc := c.(*cache.Gorm2Cache)
+		exists := func(primaryKeys ...string) bool {
+			ok, err := gc.BatchPrimaryKeyExists(ctx, testModelTagTableName, primaryKeys)
+			So(err, ShouldBeNil)
+			return ok
+		}
+
+		tags := make([]*testModelTag, 0)
+		So(db.Where("model_id IN (?)", []int64{1, 2}).Find(&tags).Error, ShouldBeNil)
+		So(len(tags), ShouldEqual, 3)
+		// rows are cached by values of all primary fields
+		So(exists("1:a", "1:b", "2:a"), ShouldBeTrue)
+		So(exists("1"), ShouldBeFalse)
+
+		Convey("row value IN conditions are served from primary cache", func() {
+			tags := make([]*testModelTag, 0)
+			err := db.Where("(model_id, tag) IN ?", [][]interface{}{{2, "a"}, {1, "b"}}).Find(&tags).Error
+			So(err, ShouldBeNil)
+			So(c.PrimaryHitCount(), ShouldEqual, 1)
+			So(tags, ShouldResemble, []*testModelTag{{ModelID: 1, Tag: "b"}, {ModelID: 2, Tag: "a"}})
+
+			tags = make([]*testModelTag, 0)
+			err = db.Where("(tag, model_id) IN ((?, ?))", "a", 1).Find(&tags).Error
+			So(err, ShouldBeNil)
+			So(c.PrimaryHitCount(), ShouldEqual, 2)
+			So(tags, ShouldResemble, []*testModelTag{{ModelID: 1, Tag: "a"}})
+		})
+
+		Convey("conditions on every primary field are served from primary cache", func() {
+			tags := make([]*testModelTag, 0)
+			So(db.Where("model_id = ?", 1).Where("tag IN (?)", []string{"a", "b"}).Find(&tags).Error, ShouldBeNil)
+			So(c.PrimaryHitCount(), ShouldEqual, 1)
+			So(len(tags), ShouldEqual, 2)
+		})
+
+		Convey("IN conditions on several primary fields aren't paired up", func() {
+			tags := make([]*testModelTag, 0)
+			err := db.Where("model_id IN (?)", []int64{1, 2}).Where("tag IN (?)", []string{"a", "b"}).Find(&tags).Error
+			So(err, ShouldBeNil)
+			So(c.PrimaryHitCount(), ShouldEqual, 0)
+			So(len(tags), ShouldEqual, 3)
+		})
+
+		Convey("IN lists of differing lengths on primary fields aren't paired up", func() {
+			tags := make([]*testModelTag, 0)
+			err := db.Where("model_id IN (?)", []int64{1, 2}).Where("tag IN (?)", []string{"a"}).
+				Where("tag IN (?)", []string{"a", "b"}).Find(&tags).Error
+			So(err, ShouldBeNil)
+			So(c.PrimaryHitCount(), ShouldEqual, 0)
+			So(len(tags), ShouldEqual, 2)
+		})
+
+		Convey("deleting a row invalidates its key only", func() {
+			So(db.Delete(&testModelTag{ModelID: 1, Tag: "a"}).Error, ShouldBeNil)
+			So(exists("1:a"), ShouldBeFalse)
+			So(exists("1:b", "2:a"), ShouldBeTrue)
+		})
+	})
+}
+
+func TestConflictingPrimaryConditions(t *testing.T) {
+	Convey("test primary cache isn't used when primary key is restricted by different conditions", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlyPrimary,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+			CacheTTL:     5000,
+		})
+		So(err, ShouldBeNil)
+
+		models := make([]*TestModel, 0)
+		So(db.Where("id IN (?)", []int64{1, 2, 3}).Find(&models).Error, ShouldBeNil)
+		So(len(models), ShouldEqual, 3)
+
+		models = make([]*TestModel, 0)
+		So(db.Where("id IN (?)", []int64{1, 2}).Where("id IN (?)", []int64{2, 3}).Find(&models).Error, ShouldBeNil)
+		So(len(models), ShouldEqual, 1)
+		So(models[0].ID, ShouldEqual, 2)
+
+		models = make([]*TestModel, 0)
+		So(db.Where("id = ?", 1).Where("id = ?", 2).Find(&models).Error, ShouldBeNil)
+		So(len(models), ShouldEqual, 0)
+		So(c.PrimaryHitCount(), ShouldEqual, 0)
+
+		// the same condition twice is fine
+		So(db.Where("id = ?", 1).Where("id IN (?)", []int64{1}).Find(&models).Error, ShouldBeNil)
+		So(len(models), ShouldEqual, 1)
+		So(c.PrimaryHitCount(), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,180 @@
+package test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReplicaLagWindow(t *testing.T) {
+	Convey("test replica lag window", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelOnlySearch,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+			CacheTTL:             5000,
+			ReplicaLagWindow:     200,
+		})
+		So(err, ShouldBeNil)
+
+		find := func() {
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 BETWEEN ? AND ?", 5, 6).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 2)
+		}
+
+		find()
+		find()
+		So(c.HitCount(), ShouldEqual, 1)
+
+		result := db.Model(&TestModel{}).Where("id = ?", 5).Update("value9", "5")
+		So(result.Error, ShouldBeNil)
+
+		// populations within the window are dropped
+		find()
+		find()
+		So(c.HitCount(), ShouldEqual, 1)
+
+		time.Sleep(250 * time.Millisecond)
+		find()
+		find()
+		So(c.HitCount(), ShouldEqual, 2)
+	})
+}
+
+func TestReadYourWrites(t *testing.T) {
+	Convey("test read your writes context", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlySearch,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+			CacheTTL:     5000,
+		})
+		So(err, ShouldBeNil)
+
+		find := func(ctx context.Context) *TestModel {
+			model := new(TestModel)
+			result := db.WithContext(ctx).Where("value1 = ?", 7).First(model)
+			So(result.Error, ShouldBeNil)
+			return model
+		}
+
+		find(context.Background())
+		find(context.Background())
+		So(c.HitCount(), ShouldEqual, 1)
+
+		ctx := cache.WithReadYourWrites(context.Background())
+		find(ctx)
+		So(c.HitCount(), ShouldEqual, 2)
+
+		result := db.WithContext(ctx).Model(&TestModel{}).Where("id = ?", 7).Update("value9", "seven")
+		So(result.Error, ShouldBeNil)
+		defer db.Model(&TestModel{}).Where("id = ?", 7).Update("value9", "7")
+
+		So(find(ctx).Value9, ShouldEqual, "seven")
+		So(c.HitCount(), ShouldEqual, 2)
+
+		// other contexts are not affected
+		So(find(context.Background()).Value9, ShouldEqual, "7")
+		So(c.HitCount(), ShouldEqual, 3)
+	})
+}
+
+// existsCountingStorage counts key existence checks of the storage it wraps
+type existsCountingStorage struct {
+	storage.DataStorage
+	exists int64
+}
+
+func (s *existsCountingStorage) KeyExists(ctx context.Context, key string) (bool, error) {
+	atomic.AddInt64(&s.exists, 1)
+	return s.DataStorage.KeyExists(ctx, key)
+}
+
+func TestDirtyMarker(t *testing.T) {
+	Convey("test dirty marker of primary keys on write", t, func() {
+		s := &existsCountingStorage{DataStorage: storage.NewGcache(gcache.New(1000))}
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelOnlyPrimary,
+			CacheStorage:         s,
+			InvalidateWhenUpdate: true,
+			CacheTTL:             5000,
+			DirtyMarkerTTL:       200,
+		})
+		So(err, ShouldBeNil)
+
+		find := func(id int64) {
+			model := new(TestModel)
+			So(db.Where("id = ?", id).First(model).Error, ShouldBeNil)
+			So(model.ID, ShouldEqual, id)
+		}
+
+		find(10)
+		find(11)
+		So(waitFor(func() bool { find(10); find(11); return c.PrimaryHitCount() >= 2 }), ShouldBeTrue)
+
+		result := db.Model(&TestModel{}).Where("id = ?", 11).Update("value9", "11")
+		So(result.Error, ShouldBeNil)
+
+		// rows not written are still served from cache
+		hits := c.PrimaryHitCount()
+		find(10)
+		So(c.PrimaryHitCount(), ShouldEqual, hits+1)
+		find(11)
+		So(c.PrimaryHitCount(), ShouldEqual, hits+1)
+
+		// markers are checked once per query, for all rows and for its key
+		checks := atomic.LoadInt64(&s.exists)
+		find(10)
+		So(atomic.LoadInt64(&s.exists)-checks, ShouldEqual, 2)
+
+		// writes of unknown rows mark all rows dirty
+		result = db.Model(&TestModel{}).Where("value1 = ?", 12).Update("value9", "12")
+		So(result.Error, ShouldBeNil)
+		hits = c.PrimaryHitCount()
+		find(10)
+		So(c.PrimaryHitCount(), ShouldEqual, hits)
+	})
+
+	Convey("test dirty marker on write", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelOnlySearch,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+			CacheTTL:             5000,
+			DirtyMarkerTTL:       200,
+		})
+		So(err, ShouldBeNil)
+
+		find := func() {
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 BETWEEN ? AND ?", 8, 9).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 2)
+		}
+
+		find()
+		find()
+		So(c.HitCount(), ShouldEqual, 1)
+
+		result := db.Model(&TestModel{}).Where("id = ?", 8).Update("value9", "8")
+		So(result.Error, ShouldBeNil)
+
+		// while the marker exists queries go to database and are not cached
+		find()
+		find()
+		So(c.HitCount(), ShouldEqual, 1)
+
+		time.Sleep(250 * time.Millisecond)
+		find()
+		find()
+		So(c.HitCount(), ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,54 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCachedFindAndCount(t *testing.T) {
+	Convey("test cached find and count", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelOnlySearch,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+		})
+		So(err, ShouldBeNil)
+		gc := c.(*cache.Gorm2Cache)
+
+		var total int64
+		So(db.Model(&TestModel{}).Where("id <= ?", 30).Count(&total).Error, ShouldBeNil)
+
+		findAndCount := func() ([]*TestModel, int64) {
+			models := make([]*TestModel, 0)
+			var count int64
+			query := db.Model(&TestModel{}).Where("id <= ?", 30).Order("id").Offset(10).Limit(10)
+			So(gc.CachedFindAndCount(query, &models, &count), ShouldBeNil)
+			So(waitFor(func() bool { return gc.Status(context.Background()).AsyncQueueDepth == 0 }), ShouldBeTrue)
+			return models, count
+		}
+
+		models, count := findAndCount()
+		So(len(models), ShouldEqual, 10)
+		So(models[0].ID, ShouldEqual, 11)
+		So(count, ShouldEqual, total)
+		// the count run by Count above is shared
+		So(c.SearchHitCount(), ShouldEqual, 1)
+
+		models, count = findAndCount()
+		So(len(models), ShouldEqual, 10)
+		So(models[0].ID, ShouldEqual, 11)
+		So(count, ShouldEqual, total)
+		So(c.SearchHitCount(), ShouldEqual, 3)
+
+		// one invalidation clears both
+		So(gc.InvalidateSearchCache(context.Background(), TestModelTableName), ShouldBeNil)
+		findAndCount()
+		So(c.SearchHitCount(), ShouldEqual, 3)
+	})
+}
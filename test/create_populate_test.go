@@ -0,0 +1,53 @@
+package test
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPopulatePrimaryOnCreate(t *testing.T) {
+	Convey("test primary cache populated by creates", t, func() {
+		s := &countingStorage{DataStorage: storage.NewGcache(gcache.New(1000))}
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:              config.CacheLevelOnlyPrimary,
+			CacheStorage:            s,
+			InvalidateWhenUpdate:    true,
+			CacheTTL:                5000,
+			PopulatePrimaryOnCreate: true,
+		})
+		So(err, ShouldBeNil)
+		ids := []int64{2000001, 2000002, 2000003, 2000004, 2000005}
+		defer originalDB.Where("id IN (?)", ids).Delete(&TestModel{})
+
+		Convey("rows created in batches are served from primary cache", func() {
+			models := make([]*TestModel, 0, len(ids))
+			for _, id := range ids {
+				models = append(models, &TestModel{ID: id, Value1: id, Value9: "created"})
+			}
+			So(db.CreateInBatches(models, 2).Error, ShouldBeNil)
+			So(atomic.LoadInt64(&s.batchSets), ShouldEqual, 3)
+
+			found := make([]*TestModel, 0)
+			So(db.Where("id IN (?)", ids).Find(&found).Error, ShouldBeNil)
+			So(c.PrimaryHitCount(), ShouldEqual, 1)
+			So(len(found), ShouldEqual, len(ids))
+			So(found[4].Value1, ShouldEqual, ids[4])
+			So(found[4].Value9, ShouldEqual, "created")
+		})
+
+		Convey("rows created with omitted columns aren't cached", func() {
+			So(db.Omit("value9").Create(&TestModel{ID: ids[0], Value1: ids[0], Value9: "omitted"}).Error, ShouldBeNil)
+			So(atomic.LoadInt64(&s.batchSets), ShouldEqual, 0)
+
+			model := &TestModel{}
+			So(db.Where("id = ?", ids[0]).First(model).Error, ShouldBeNil)
+			So(c.PrimaryHitCount(), ShouldEqual, 0)
+			So(model.Value9, ShouldEqual, "")
+		})
+	})
+}
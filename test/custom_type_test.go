@@ -0,0 +1,171 @@
+package test
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	"github.com/google/uuid"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// testDecimal is a fixed point number like decimal.Decimal, a struct with its own string and database form
+type testDecimal struct {
+	cents int64
+}
+
+func (d testDecimal) String() string {
+	sign := ""
+	cents := d.cents
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func (d testDecimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *testDecimal) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d testDecimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+func (d *testDecimal) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		return d.parse(v)
+	case []byte:
+		return d.parse(string(v))
+	}
+	return fmt.Errorf("can't scan %T into testDecimal", src)
+}
+
+func (d *testDecimal) parse(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	d.cents = int64(f*100 + 0.5)
+	if f < 0 {
+		d.cents = int64(f*100 - 0.5)
+	}
+	return nil
+}
+
+// testJSON is a JSON document like datatypes.JSON
+type testJSON json.RawMessage
+
+func (j testJSON) MarshalJSON() ([]byte, error) {
+	return json.RawMessage(j).MarshalJSON()
+}
+
+func (j *testJSON) UnmarshalJSON(data []byte) error {
+	*j = append((*j)[0:0], data...)
+	return nil
+}
+
+func (j testJSON) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+func (j *testJSON) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		*j = testJSON(v)
+	case []byte:
+		*j = append(testJSON(nil), v...)
+	case nil:
+		*j = nil
+	default:
+		return fmt.Errorf("can't scan %T into testJSON", src)
+	}
+	return nil
+}
+
+type testModelCustomType struct {
+	ID     uuid.UUID   `gorm:"primaryKey;type:text"`
+	Amount testDecimal `gorm:"type:text"`
+	Attrs  testJSON    `gorm:"type:text"`
+}
+
+func TestCustomTypeRoundTrip(t *testing.T) {
+	Convey("test models of uuid, decimal and json types round-trip through cache", t, func() {
+		So(originalDB.AutoMigrate(&testModelCustomType{}), ShouldBeNil)
+		defer originalDB.Migrator().DropTable(&testModelCustomType{})
+		ids := []uuid.UUID{uuid.New(), uuid.New()}
+		So(originalDB.Create(&[]*testModelCustomType{
+			{ID: ids[0], Amount: testDecimal{cents: 150}, Attrs: testJSON(`{"a":[1,2]}`)},
+			{ID: ids[1], Amount: testDecimal{cents: -5}},
+		}).Error, ShouldBeNil)
+
+		for _, encodeDBValues := range []bool{false, true} {
+			Convey("EncodeDBValues "+strconv.FormatBool(encodeDBValues), func() {
+				c, db, err := newCachedDB(&config.CacheConfig{
+					CacheLevel:     config.CacheLevelAll,
+					CacheStorage:   storage.NewGcache(gcache.New(1000)),
+					CacheTTL:       5000,
+					EncodeDBValues: encodeDBValues,
+				})
+				So(err, ShouldBeNil)
+				gc := c.(*cache.Gorm2Cache)
+
+				// primary cache is set by the first query and keyed by the canonical form of uuid
+				models := make([]*testModelCustomType, 0)
+				So(db.Where("id IN (?)", ids).Find(&models).Error, ShouldBeNil)
+				So(len(models), ShouldEqual, 2)
+				exists, err := gc.BatchPrimaryKeyExists(context.Background(), "test_model_custom_types", []string{ids[0].String(), ids[1].String()})
+				So(err, ShouldBeNil)
+				So(exists, ShouldBeTrue)
+
+				check := func(m *testModelCustomType, id uuid.UUID) {
+					So(m.ID, ShouldEqual, id)
+					if id == ids[0] {
+						So(m.Amount.String(), ShouldEqual, "1.50")
+						So(strings.ReplaceAll(string(m.Attrs), " ", ""), ShouldEqual, `{"a":[1,2]}`)
+					} else {
+						So(m.Amount.String(), ShouldEqual, "-0.05")
+						if encodeDBValues {
+							So(len(m.Attrs), ShouldEqual, 0)
+						} else {
+							// NULL is told from the JSON null document by the database only
+							So(string(m.Attrs), ShouldBeIn, "", "null")
+						}
+					}
+				}
+
+				// a single uuid is one key, not 16 bytes
+				for _, id := range ids {
+					models = make([]*testModelCustomType, 0)
+					So(db.Where("id IN (?)", id).Find(&models).Error, ShouldBeNil)
+					So(len(models), ShouldEqual, 1)
+					check(models[0], id)
+
+					m := &testModelCustomType{}
+					So(db.Where("id = ?", id.String()).First(m).Error, ShouldBeNil)
+					check(m, id)
+				}
+				So(gc.PrimaryHitCount(), ShouldEqual, 4)
+			})
+		}
+	})
+}
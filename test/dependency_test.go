@@ -0,0 +1,56 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReferencedTables(t *testing.T) {
+	Convey("test referenced tables extraction", t, func() {
+		So(util.GetReferencedTables("SELECT * FROM `users` WHERE id IN (SELECT user_id FROM \"orders\")"),
+			ShouldResemble, []string{"users", "orders"})
+		So(util.GetReferencedTables("SELECT * FROM a, db.b LEFT JOIN c ON a.id = c.id WHERE v = 'from d'"),
+			ShouldResemble, []string{"a", "b", "c"})
+	})
+}
+
+func TestSubqueryDependency(t *testing.T) {
+	Convey("test subquery dependency invalidation", t, func() {
+		subTable := TestModelTableName + "_sub"
+		err := originalDB.Table(subTable).AutoMigrate(&TestModel{})
+		So(err, ShouldBeNil)
+		defer originalDB.Migrator().DropTable(subTable)
+		err = originalDB.Table(subTable).Create([]*TestModel{{ID: 1}, {ID: 2}, {ID: 3}}).Error
+		So(err, ShouldBeNil)
+
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelOnlySearch,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+			CacheTTL:             5000,
+		})
+		So(err, ShouldBeNil)
+
+		find := func() int {
+			models := make([]*TestModel, 0)
+			result := db.Where("id IN (?)", db.Table(subTable).Select("id")).Find(&models)
+			So(result.Error, ShouldBeNil)
+			return len(models)
+		}
+
+		So(find(), ShouldEqual, 3)
+		So(find(), ShouldEqual, 3)
+		So(c.HitCount(), ShouldEqual, 1)
+
+		// writing to the subquery table invalidates the outer query
+		err = db.Table(subTable).Create(&TestModel{ID: 4}).Error
+		So(err, ShouldBeNil)
+		So(find(), ShouldEqual, 4)
+		So(c.HitCount(), ShouldEqual, 1)
+	})
+}
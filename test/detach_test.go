@@ -0,0 +1,45 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDetachFromDB(t *testing.T) {
+	Convey("test detaching cache from db", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelOnlySearch,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+		})
+		So(err, ShouldBeNil)
+		find := func() {
+			models := make([]*TestModel, 0)
+			So(db.Where("value1 = ?", 1).Find(&models).Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 1)
+		}
+		find()
+		So(c.LookupCount(), ShouldEqual, 1)
+
+		So(c.DetachFromDB(db), ShouldBeNil)
+		So(db.Plugins[c.Name()], ShouldBeNil)
+		find()
+		find()
+		So(c.LookupCount(), ShouldEqual, 1)
+		So(c.SearchHitCount(), ShouldEqual, 0)
+
+		// detaching again does nothing
+		So(c.DetachFromDB(db), ShouldBeNil)
+
+		Convey("cache can be used again after detached", func() {
+			So(db.Use(c), ShouldBeNil)
+			find()
+			So(c.LookupCount(), ShouldEqual, 2)
+			So(c.SearchHitCount(), ShouldEqual, 1)
+		})
+	})
+}
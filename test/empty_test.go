@@ -0,0 +1,43 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEmptyResultCache(t *testing.T) {
+	Convey("test empty find result cache", t, func() {
+		find := func(disable bool) uint64 {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:              config.CacheLevelOnlySearch,
+				CacheStorage:            storage.NewGcache(gcache.New(1000)),
+				CacheTTL:                5000,
+				DisableEmptyResultCache: disable,
+				EmptyResultTTL:          1000,
+			})
+			So(err, ShouldBeNil)
+
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 > ?", testSize*10).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(c.HitCount(), ShouldEqual, 0)
+
+			result = db.Where("value1 > ?", testSize*10).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 0)
+			return c.HitCount()
+		}
+
+		Convey("empty results are cached by default", func() {
+			So(find(false), ShouldEqual, 1)
+		})
+
+		Convey("empty results are not cached when disabled", func() {
+			So(find(true), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,76 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSlidingExpiration(t *testing.T) {
+	Convey("test sliding expiration", t, func() {
+		newCache := func(tables []string) (func(), cache.Cache) {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:              config.CacheLevelAll,
+				CacheStorage:            storage.NewGcache(gcache.New(1000)),
+				CacheTTL:                300,
+				SlidingExpirationTables: tables,
+			})
+			So(err, ShouldBeNil)
+			return func() {
+				models := make([]*TestModel, 0)
+				So(db.Where("value1 = ?", 1).Find(&models).Error, ShouldBeNil)
+				So(len(models), ShouldEqual, 1)
+				So(waitFor(func() bool {
+					return c.(*cache.Gorm2Cache).Status(context.Background()).AsyncQueueDepth == 0
+				}), ShouldBeTrue)
+			}, c
+		}
+
+		Convey("hits keep entries warm", func() {
+			find, c := newCache([]string{TestModelTableName})
+			find()
+			for i := 0; i < 4; i++ {
+				time.Sleep(150 * time.Millisecond)
+				find()
+			}
+			So(c.HitCount(), ShouldEqual, 4)
+		})
+
+		Convey("entries of other tables expire", func() {
+			find, c := newCache(nil)
+			find()
+			for i := 0; i < 4; i++ {
+				time.Sleep(150 * time.Millisecond)
+				find()
+			}
+			So(c.HitCount(), ShouldBeLessThan, 4)
+		})
+	})
+}
+
+func TestStorageExpire(t *testing.T) {
+	Convey("test storage expire", t, func() {
+		ctx := context.Background()
+		for _, s := range []storage.DataStorage{storage.NewMem(), storage.NewGcache(gcache.New(1000))} {
+			So(s.Init(&storage.Config{Logger: &util.DefaultLogger{}}), ShouldBeNil)
+			So(s.SetKey(ctx, util.Kv{Key: "expire:a", Value: "1"}), ShouldBeNil)
+			So(s.Expire(ctx, "expire:a", 50*time.Millisecond), ShouldBeNil)
+			value, err := s.GetValue(ctx, "expire:a")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, "1")
+			time.Sleep(100 * time.Millisecond)
+			exists, err := s.KeyExists(ctx, "expire:a")
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeFalse)
+
+			So(s.Expire(ctx, "expire:b", time.Second), ShouldEqual, storage.ErrCacheNotFound)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExplain(t *testing.T) {
+	Convey("test explain why a query is or isn't cached", t, func() {
+		Convey("nothing is recorded without WithExplain", func() {
+			So(cache.ExplainLast(context.Background()), ShouldBeNil)
+			So(cache.ExplainLast(cache.WithExplain(context.Background())), ShouldBeNil)
+		})
+
+		Convey("table is not cached", func() {
+			_, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:   config.CacheLevelAll,
+				CacheStorage: storage.NewGcache(gcache.New(1000)),
+				Tables:       []string{"other_table"},
+			})
+			So(err, ShouldBeNil)
+
+			ctx := cache.WithExplain(context.Background())
+			models := make([]*TestModel, 0)
+			So(db.WithContext(ctx).Where("value1 < ?", 5).Find(&models).Error, ShouldBeNil)
+			e := cache.ExplainLast(ctx)
+			So(e, ShouldNotBeNil)
+			So(e.Table, ShouldEqual, TestModelTableName)
+			So(e.SQL, ShouldContainSubstring, "value1 <")
+			So(strings.Join(e.Steps, "\n"), ShouldContainSubstring, "not in Tables")
+		})
+
+		Convey("result exceeds max item count, then a hit", func() {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:      config.CacheLevelOnlySearch,
+				CacheStorage:    storage.NewGcache(gcache.New(1000)),
+				CacheMaxItemCnt: 3,
+			})
+			So(err, ShouldBeNil)
+
+			ctx := cache.WithExplain(context.Background())
+			models := make([]*TestModel, 0)
+			So(db.WithContext(ctx).Where("value1 < ?", 10).Find(&models).Error, ShouldBeNil)
+			steps := strings.Join(cache.ExplainLast(ctx).Steps, "\n")
+			So(steps, ShouldContainSubstring, "cache missed")
+			So(steps, ShouldContainSubstring, "CacheMaxItemCnt")
+
+			So(db.WithContext(ctx).Where("value1 < ?", 3).Find(&models).Error, ShouldBeNil)
+			So(waitFor(func() bool {
+				return c.(*cache.Gorm2Cache).Status(context.Background()).AsyncQueueDepth == 0
+			}), ShouldBeTrue)
+			So(strings.Join(cache.ExplainLast(ctx).Steps, "\n"), ShouldContainSubstring, "search cache set")
+
+			So(db.WithContext(ctx).Where("value1 < ?", 3).Find(&models).Error, ShouldBeNil)
+			So(c.SearchHitCount(), ShouldEqual, 1)
+			So(strings.Join(cache.ExplainLast(ctx).Steps, "\n"), ShouldContainSubstring, "served by search hit")
+		})
+	})
+}
@@ -0,0 +1,57 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFingerprintQuery(t *testing.T) {
+	Convey("test fingerprint query", t, func() {
+		s := storage.NewGcache(gcache.New(1000))
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelAll,
+			CacheStorage: s,
+		})
+		So(err, ShouldBeNil)
+		gc := c.(*cache.Gorm2Cache)
+		ctx := context.Background()
+
+		Convey("search query", func() {
+			table, keys, searchKey := gc.FingerprintQuery(db.Model(&TestModel{}).Where("value1 = ?", 1))
+			So(table, ShouldEqual, TestModelTableName)
+			So(keys, ShouldBeEmpty)
+			So(searchKey, ShouldNotBeEmpty)
+
+			exists, err := s.KeyExists(ctx, searchKey)
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeFalse)
+
+			models := make([]*TestModel, 0)
+			So(db.Where("value1 = ?", 1).Find(&models).Error, ShouldBeNil)
+			exists, err = s.KeyExists(ctx, searchKey)
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeTrue)
+		})
+
+		Convey("primary query", func() {
+			query := db.Model(&TestModel{}).Where("id IN (?)", []int{1, 2})
+			table, keys, _ := gc.FingerprintQuery(query)
+			So(table, ShouldEqual, TestModelTableName)
+			So(len(keys), ShouldEqual, 2)
+			// fingerprinting doesn't alter the query
+			So(query.Statement.SQL.Len(), ShouldEqual, 0)
+
+			models := make([]*TestModel, 0)
+			So(db.Where("id IN (?)", []int{1, 2}).Find(&models).Error, ShouldBeNil)
+			exists, err := s.BatchKeyExist(ctx, keys)
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+func TestPrimaryHitSemantics(t *testing.T) {
+	Convey("test primary cache hits follow query semantics", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlyPrimary,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+		})
+		So(err, ShouldBeNil)
+		ids := []int{3, 1, 2}
+		models := make([]*TestModel, 0)
+		So(db.Where("id IN (?)", ids).Find(&models).Error, ShouldBeNil)
+		So(waitFor(func() bool {
+			return c.(*cache.Gorm2Cache).Status(context.Background()).AsyncQueueDepth == 0
+		}), ShouldBeTrue)
+
+		idsOf := func(models []*TestModel) []int64 {
+			res := make([]int64, 0, len(models))
+			for _, model := range models {
+				res = append(res, model.ID)
+			}
+			return res
+		}
+
+		Convey("first and last", func() {
+			model := new(TestModel)
+			So(db.Where("id IN (?)", ids).First(model).Error, ShouldBeNil)
+			So(model.ID, ShouldEqual, 1)
+			model = new(TestModel)
+			So(db.Where("id IN (?)", ids).Last(model).Error, ShouldBeNil)
+			So(model.ID, ShouldEqual, 3)
+			So(c.PrimaryHitCount(), ShouldEqual, 2)
+		})
+
+		Convey("find into struct", func() {
+			model := new(TestModel)
+			result := db.Where("id IN (?)", ids).Find(model)
+			So(result.Error, ShouldBeNil)
+			So(result.RowsAffected, ShouldEqual, 1)
+			So(model.ID, ShouldEqual, 1)
+			So(c.PrimaryHitCount(), ShouldEqual, 1)
+		})
+
+		Convey("order, offset and limit", func() {
+			models := make([]*TestModel, 0)
+			So(db.Where("id IN (?)", ids).Order("id desc").Find(&models).Error, ShouldBeNil)
+			So(idsOf(models), ShouldResemble, []int64{3, 2, 1})
+			models = make([]*TestModel, 0)
+			So(db.Where("id IN (?)", ids).Offset(1).Limit(1).Find(&models).Error, ShouldBeNil)
+			So(idsOf(models), ShouldResemble, []int64{2})
+			So(c.PrimaryHitCount(), ShouldEqual, 2)
+		})
+
+		Convey("results which can't be told from cache come from database", func() {
+			models := make([]*TestModel, 0)
+			So(db.Where("id IN (?)", ids).Order("value1").Find(&models).Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 3)
+			models = make([]*TestModel, 0)
+			So(db.Where("id IN (?)", ids).Offset(5).Find(&models).Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 0)
+			So(c.PrimaryHitCount(), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestNotFoundHitSemantics(t *testing.T) {
+	Convey("test cached not-found results follow query semantics", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlySearch,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+		})
+		So(err, ShouldBeNil)
+
+		model := new(TestModel)
+		So(db.Where("id = ?", 100000).Take(model).Error, ShouldEqual, gorm.ErrRecordNotFound)
+		So(waitFor(func() bool {
+			return c.(*cache.Gorm2Cache).Status(context.Background()).AsyncQueueDepth == 0
+		}), ShouldBeTrue)
+
+		// same sql as Take
+		models := []*TestModel{{ID: 1}}
+		result := db.Where("id = ?", 100000).Limit(1).Find(&models)
+		So(result.Error, ShouldBeNil)
+		So(result.RowsAffected, ShouldEqual, 0)
+		So(len(models), ShouldEqual, 0)
+
+		So(db.Where("id = ?", 100000).Take(model).Error, ShouldEqual, gorm.ErrRecordNotFound)
+		So(c.SearchHitCount(), ShouldEqual, 2)
+	})
+}
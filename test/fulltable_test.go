@@ -0,0 +1,135 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+type testModelFull struct {
+	ID     int64 `gorm:"primaryKey"`
+	Code   string
+	Value1 int64
+	Value2 *int64
+}
+
+const testModelFullTableName = TestModelTableName + "_full"
+
+func (testModelFull) TableName() string {
+	return testModelFullTableName
+}
+
+func TestFullTableCache(t *testing.T) {
+	Convey("test full table cache", t, func() {
+		err := originalDB.AutoMigrate(&testModelFull{})
+		So(err, ShouldBeNil)
+		defer originalDB.Migrator().DropTable(&testModelFull{})
+		two := int64(2)
+		err = originalDB.Create([]*testModelFull{
+			{ID: 1, Code: "a", Value1: 3, Value2: &two},
+			{ID: 2, Code: "b", Value1: 1},
+			{ID: 3, Code: "c", Value1: 5, Value2: &two},
+			{ID: 4, Code: "d", Value1: 3},
+			{ID: 5, Code: "e", Value1: 4},
+		}).Error
+		So(err, ShouldBeNil)
+
+		sharedStorage := storage.NewGcache(gcache.New(1000))
+		conf := func(binary bool) *config.CacheConfig {
+			return &config.CacheConfig{
+				CacheLevel:           config.CacheLevelAll,
+				CacheStorage:         sharedStorage,
+				KeyPrefix:            "test_full",
+				InvalidateWhenUpdate: true,
+				FullTableCacheTables: []string{testModelFullTableName},
+				// sqlite compares strings byte by byte by default
+				FullTableBinaryCollation: binary,
+			}
+		}
+		c, db, err := newCachedDB(conf(true))
+		So(err, ShouldBeNil)
+		So(c.(*cache.Gorm2Cache).WarmUpFullTables(context.Background(), &testModelFull{}), ShouldBeNil)
+
+		ids := func(db *gorm.DB, query func(tx *gorm.DB) *gorm.DB) []int64 {
+			models := make([]*testModelFull, 0)
+			So(query(db.Model(&testModelFull{})).Find(&models).Error, ShouldBeNil)
+			res := make([]int64, 0, len(models))
+			for _, m := range models {
+				res = append(res, m.ID)
+			}
+			return res
+		}
+
+		Convey("simple queries are answered in memory", func() {
+			queries := []func(tx *gorm.DB) *gorm.DB{
+				func(tx *gorm.DB) *gorm.DB { return tx },
+				func(tx *gorm.DB) *gorm.DB { return tx.Where("value1 > ?", 2).Order("value1 desc, id") },
+				func(tx *gorm.DB) *gorm.DB { return tx.Where("code IN (?)", []string{"a", "e"}) },
+				func(tx *gorm.DB) *gorm.DB { return tx.Where(&testModelFull{Value1: 3}) },
+				func(tx *gorm.DB) *gorm.DB { return tx.Where("value1 = ?", 1).Or("value1 = ?", 5) },
+				func(tx *gorm.DB) *gorm.DB { return tx.Not("code = ?", "a").Where("value2 IS NULL") },
+				func(tx *gorm.DB) *gorm.DB { return tx.Where("value2 <> ?", 3) },
+				func(tx *gorm.DB) *gorm.DB { return tx.Order("value1").Order("id desc").Limit(2).Offset(1) },
+			}
+			for i, query := range queries {
+				So(ids(db, query), ShouldResemble, ids(originalDB, query))
+				So(c.SearchHitCount(), ShouldEqual, i+1)
+			}
+
+			model := new(testModelFull)
+			So(db.Where("code = ?", "c").First(model).Error, ShouldBeNil)
+			So(model.ID, ShouldEqual, 3)
+			So(*model.Value2, ShouldEqual, 2)
+			So(db.Where("code = ?", "z").First(model).Error, ShouldEqual, gorm.ErrRecordNotFound)
+			So(c.SearchHitCount(), ShouldEqual, len(queries)+2)
+		})
+
+		Convey("other queries go to database", func() {
+			query := func(tx *gorm.DB) *gorm.DB { return tx.Where("code LIKE ?", "%a%") }
+			So(ids(db, query), ShouldResemble, []int64{1})
+			So(c.SearchHitCount(), ShouldEqual, 0)
+		})
+
+		Convey("table is loaded again after invalidation", func() {
+			query := func(tx *gorm.DB) *gorm.DB { return tx.Where("value1 >= ?", 5) }
+			So(ids(db, query), ShouldResemble, []int64{3})
+			So(db.Create(&testModelFull{ID: 6, Code: "f", Value1: 6}).Error, ShouldBeNil)
+			So(ids(db, query), ShouldResemble, []int64{3, 6})
+			So(c.SearchHitCount(), ShouldEqual, 2)
+		})
+
+		Convey("strings are compared in database unless collation is binary", func() {
+			other, otherDB, err := newCachedDB(conf(false))
+			So(err, ShouldBeNil)
+			query := func(tx *gorm.DB) *gorm.DB { return tx.Where("code = ?", "a") }
+			So(ids(otherDB, query), ShouldResemble, []int64{1})
+			So(other.SearchHitCount(), ShouldEqual, 0)
+			query = func(tx *gorm.DB) *gorm.DB { return tx.Order("code desc").Limit(1) }
+			So(ids(otherDB, query), ShouldResemble, []int64{5})
+			So(other.SearchHitCount(), ShouldEqual, 0)
+
+			query = func(tx *gorm.DB) *gorm.DB { return tx.Where("value1 = ?", 1) }
+			So(ids(otherDB, query), ShouldResemble, []int64{2})
+			So(other.SearchHitCount(), ShouldEqual, 1)
+		})
+
+		Convey("table is loaded again after invalidation by another process sharing the storage", func() {
+			query := func(tx *gorm.DB) *gorm.DB { return tx.Where("value1 >= ?", 5) }
+			So(ids(db, query), ShouldResemble, []int64{3})
+
+			_, otherDB, err := newCachedDB(conf(true))
+			So(err, ShouldBeNil)
+			So(otherDB.Create(&testModelFull{ID: 6, Code: "f", Value1: 6}).Error, ShouldBeNil)
+			time.Sleep(1100 * time.Millisecond)
+			So(ids(db, query), ShouldResemble, []int64{3, 6})
+			So(c.SearchHitCount(), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,35 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGcacheBatchSetKeys(t *testing.T) {
+	Convey("test gcache sets keys in batch without taking its lock again", t, func() {
+		s := storage.NewGcache(gcache.New(1000))
+		ctx := context.Background()
+		So(s.Init(&storage.Config{}), ShouldBeNil)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- s.BatchSetKeys(ctx, []util.Kv{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}})
+		}()
+		select {
+		case err := <-done:
+			So(err, ShouldBeNil)
+		case <-time.After(time.Second):
+			So("BatchSetKeys deadlocked", ShouldBeEmpty)
+		}
+
+		values, err := s.BatchGetValues(ctx, []string{"a", "b"})
+		So(err, ShouldBeNil)
+		So(values, ShouldResemble, []string{"1", "2"})
+	})
+}
@@ -0,0 +1,39 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQueryHandler(t *testing.T) {
+	Convey("test query handler registered on custom positions", t, func() {
+		db, err := forkDB(originalDB)
+		So(err, ShouldBeNil)
+		c, err := cache.NewGorm2Cache(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlySearch,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+		})
+		So(err, ShouldBeNil)
+
+		handler := cache.NewQueryHandler(c.(*cache.Gorm2Cache))
+		err = db.Callback().Query().Before("gorm:query").Register("custom:before_query", handler.BeforeQuery())
+		So(err, ShouldBeNil)
+		err = db.Callback().Query().After("gorm:query").Register("custom:after_query", handler.AfterQuery())
+		So(err, ShouldBeNil)
+
+		for i := 0; i < 2; i++ {
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 = ?", 1).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 1)
+			So(models[0].Value1, ShouldEqual, 1)
+		}
+		So(c.MissCount(), ShouldEqual, 1)
+		So(c.HitCount(), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,98 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHitKinds(t *testing.T) {
+	Convey("test hit counts of each kind", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelAll,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+		})
+		So(err, ShouldBeNil)
+		So(blockQuery(c, db), ShouldBeNil)
+
+		// the second query waits for the blocked one and takes over its result
+		ch := make(chan struct{})
+		done := make(chan error, 2)
+		go func() {
+			models := make([]*TestModel, 0)
+			done <- db.WithContext(context.WithValue(context.Background(), blockKey{}, ch)).
+				Where("value1 = ?", 1).Find(&models).Error
+		}()
+		So(waitFor(func() bool { return c.SingleFlightSize() == 1 }), ShouldBeTrue)
+		go func() {
+			models := make([]*TestModel, 0)
+			done <- db.Where("value1 = ?", 1).Find(&models).Error
+		}()
+		time.Sleep(50 * time.Millisecond)
+		close(ch)
+		So(<-done, ShouldBeNil)
+		So(<-done, ShouldBeNil)
+		So(c.SingleFlightHitCount(), ShouldEqual, 1)
+
+		models := make([]*TestModel, 0)
+		result := db.Where("value1 = ?", 1).Find(&models)
+		So(result.Error, ShouldBeNil)
+		So(c.SearchHitCount(), ShouldEqual, 1)
+
+		model := new(TestModel)
+		result = db.Where("id = ?", models[0].ID).First(model)
+		So(result.Error, ShouldBeNil)
+		So(c.PrimaryHitCount(), ShouldEqual, 1)
+
+		So(c.HitCount(), ShouldEqual, 3)
+		So(c.MissCount(), ShouldEqual, 1)
+		breakdown := c.HitRateBreakdown()
+		So(breakdown.Primary, ShouldEqual, 0.25)
+		So(breakdown.Search, ShouldEqual, 0.25)
+		So(breakdown.SingleFlight, ShouldEqual, 0.25)
+	})
+}
+
+func TestHitRowsAffected(t *testing.T) {
+	Convey("test rows affected of cache hits", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelAll,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+		})
+		So(err, ShouldBeNil)
+
+		find := func(query interface{}, args ...interface{}) int64 {
+			models := make([]*TestModel, 0)
+			result := db.Where(query, args...).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(result.RowsAffected, ShouldEqual, len(models))
+			return result.RowsAffected
+		}
+		waitAsync := func() {
+			So(waitFor(func() bool {
+				return c.(*cache.Gorm2Cache).Status(context.Background()).AsyncQueueDepth == 0
+			}), ShouldBeTrue)
+		}
+
+		cnt := find("value1 = ?", 1)
+		waitAsync()
+		So(find("value1 = ?", 1), ShouldEqual, cnt) // search cache hit
+
+		So(find("id IN (?)", []int{1, 2, 3}), ShouldEqual, 3)
+		waitAsync()
+		So(find("id IN (?)", []int{1, 2, 3}), ShouldEqual, 3) // primary cache hit
+
+		model := new(TestModel)
+		result := db.Where("id = ?", 1).First(model)
+		So(result.Error, ShouldBeNil)
+		So(result.RowsAffected, ShouldEqual, 1)
+		So(c.SearchHitCount(), ShouldEqual, 1)
+		So(c.PrimaryHitCount(), ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,73 @@
+package test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+var afterFindCount int64
+
+type testModelHook struct {
+	ID       int64 `gorm:"primaryKey"`
+	Value1   int64
+	Computed int64 `gorm:"-" json:"-"`
+}
+
+const testModelHookTableName = TestModelTableName + "_hook"
+
+func (testModelHook) TableName() string {
+	return testModelHookTableName
+}
+
+func (m *testModelHook) AfterFind(tx *gorm.DB) error {
+	atomic.AddInt64(&afterFindCount, 1)
+	m.Computed = m.Value1 * 10
+	return nil
+}
+
+func TestAfterCacheHit(t *testing.T) {
+	Convey("test after cache hit hook", t, func() {
+		err := originalDB.AutoMigrate(&testModelHook{})
+		So(err, ShouldBeNil)
+		defer originalDB.Migrator().DropTable(&testModelHook{})
+		err = originalDB.Create([]*testModelHook{{ID: 1, Value1: 1}, {ID: 2, Value1: 2}}).Error
+		So(err, ShouldBeNil)
+
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:    config.CacheLevelAll,
+			CacheStorage:  storage.NewGcache(gcache.New(1000)),
+			AfterCacheHit: cache.CallAfterFind,
+		})
+		So(err, ShouldBeNil)
+		atomic.StoreInt64(&afterFindCount, 0)
+
+		find := func() []*testModelHook {
+			models := make([]*testModelHook, 0)
+			So(db.Where("value1 > ?", 0).Find(&models).Error, ShouldBeNil)
+			So(waitFor(func() bool {
+				return c.(*cache.Gorm2Cache).Status(context.Background()).AsyncQueueDepth == 0
+			}), ShouldBeTrue)
+			return models
+		}
+		find()
+		So(atomic.LoadInt64(&afterFindCount), ShouldEqual, 2)
+
+		models := find()
+		So(c.SearchHitCount(), ShouldEqual, 1)
+		So(atomic.LoadInt64(&afterFindCount), ShouldEqual, 4)
+		So(models[1].Computed, ShouldEqual, 20)
+
+		model := new(testModelHook)
+		So(db.Where("id = ?", 2).First(model).Error, ShouldBeNil)
+		So(c.PrimaryHitCount(), ShouldEqual, 1)
+		So(model.Computed, ShouldEqual, 20)
+	})
+}
@@ -0,0 +1,87 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheHeaders(t *testing.T) {
+	Convey("test http cache headers of cached results", t, func() {
+		ctx := context.Background()
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelAll,
+			CacheStorage: storage.NewMem(storage.DefaultMemStoreConfig),
+			CacheTTL:     60000,
+		})
+		So(err, ShouldBeNil)
+		gc := c.(*cache.Gorm2Cache)
+
+		Convey("search cache", func() {
+			models := make([]*TestModel, 0)
+			tx := db.Where("id <= ?", 3).Find(&models)
+			So(tx.Error, ShouldBeNil)
+			header := http.Header{}
+			gc.WriteCacheHeaders(header, gc.SourceOf(tx), 0)
+			So(header.Get("X-Cache"), ShouldEqual, "MISS")
+			So(header.Get("Cache-Control"), ShouldEqual, "no-cache")
+
+			tx = db.Where("id <= ?", 3).Find(&models)
+			So(tx.Error, ShouldBeNil)
+			So(gc.SourceOf(tx), ShouldEqual, cache.SourceSearchCache)
+			ttl, err := gc.TTLOf(ctx, tx)
+			So(err, ShouldBeNil)
+			So(ttl, ShouldBeGreaterThan, 0)
+			So(ttl, ShouldBeLessThanOrEqualTo, 2*time.Minute)
+
+			header = http.Header{}
+			gc.WriteCacheHeaders(header, gc.SourceOf(tx), ttl)
+			So(header.Get("X-Cache"), ShouldEqual, "HIT")
+			So(header.Get("Cache-Control"), ShouldEqual, "max-age="+strconv.FormatInt(int64(ttl/time.Second), 10))
+			So(header.Get("Age"), ShouldNotBeEmpty)
+		})
+
+		Convey("primary cache", func() {
+			So(db.Where("id IN ?", []int{1, 2}).Find(&[]*TestModel{}).Error, ShouldBeNil)
+			model := &TestModel{}
+			tx := db.Where("id = ?", 1).First(model)
+			So(tx.Error, ShouldBeNil)
+			So(gc.SourceOf(tx), ShouldEqual, cache.SourcePrimaryCache)
+			ttl, err := gc.TTLOf(ctx, tx)
+			So(err, ShouldBeNil)
+			So(ttl, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("uncached result", func() {
+			models := make([]*TestModel, 0)
+			tx := db.Where("id <= ?", 3).Find(&models)
+			So(tx.Error, ShouldBeNil)
+			So(gc.InvalidateSearchCache(ctx, TestModelTableName), ShouldBeNil)
+			_, err := gc.TTLOf(ctx, tx)
+			So(errors.Is(err, storage.ErrCacheNotFound), ShouldBeTrue)
+		})
+
+		Convey("storage which can't tell ttl", func() {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:   config.CacheLevelAll,
+				CacheStorage: storage.NewGcache(gcache.New(1000)),
+				CacheTTL:     60000,
+			})
+			So(err, ShouldBeNil)
+			models := make([]*TestModel, 0)
+			tx := db.Where("id <= ?", 3).Find(&models)
+			So(tx.Error, ShouldBeNil)
+			_, err = c.(*cache.Gorm2Cache).TTLOf(ctx, tx)
+			So(errors.Is(err, storage.ErrNotSupported), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testModelAsync struct {
+	ID     int64 `gorm:"primaryKey"`
+	Value1 int64
+}
+
+const testModelAsyncTableName = TestModelTableName + "_async"
+
+func (testModelAsync) TableName() string {
+	return testModelAsyncTableName
+}
+
+func TestAsyncInvalidation(t *testing.T) {
+	Convey("test async invalidation", t, func() {
+		err := originalDB.AutoMigrate(&testModelAsync{})
+		So(err, ShouldBeNil)
+		defer originalDB.Migrator().DropTable(&testModelAsync{})
+		err = originalDB.Create([]*testModelAsync{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}}).Error
+		So(err, ShouldBeNil)
+
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:              config.CacheLevelAll,
+			CacheStorage:            storage.NewMem(),
+			CacheTTL:                5000,
+			AsyncInvalidationTables: []string{testModelAsyncTableName},
+		})
+		So(err, ShouldBeNil)
+		gc := c.(*cache.Gorm2Cache)
+		ctx := context.Background()
+
+		find := func(maxId int) {
+			models := make([]*testModelAsync, 0)
+			So(db.Where("id <= ?", maxId).Find(&models).Error, ShouldBeNil)
+			So(waitFor(func() bool { return gc.Status(ctx).AsyncQueueDepth == 0 }), ShouldBeTrue)
+		}
+		for i := 1; i <= 20; i++ {
+			find(i)
+		}
+		So(c.HitCount(), ShouldEqual, 0)
+
+		So(gc.InvalidateSearchCache(ctx, testModelAsyncTableName), ShouldBeNil)
+		// invalidated at once, while keys are deleted in background
+		find(1)
+		So(c.HitCount(), ShouldEqual, 0)
+
+		So(waitFor(func() bool {
+			jobs := gc.InvalidationJobs()
+			return len(jobs) == 1 && jobs[0].Done
+		}), ShouldBeTrue)
+		job := gc.InvalidationJobs()[0]
+		So(job.TableName, ShouldEqual, testModelAsyncTableName)
+		So(job.Err, ShouldBeEmpty)
+		// 20 search results and 5 objects
+		So(job.Total, ShouldEqual, 25)
+		So(job.Deleted, ShouldEqual, 25)
+
+		// cache written during the job is kept
+		find(1)
+		So(c.HitCount(), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,70 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testModelTag struct {
+	ModelID int64  `gorm:"column:model_id;primaryKey"`
+	Tag     string `gorm:"column:tag;primaryKey"`
+}
+
+const testModelTagTableName = TestModelTableName + "_tags"
+
+func (testModelTag) TableName() string {
+	return testModelTagTableName
+}
+
+func TestJoinTableInvalidation(t *testing.T) {
+	Convey("test join table invalidation", t, func() {
+		err := originalDB.AutoMigrate(&testModelTag{})
+		So(err, ShouldBeNil)
+		defer originalDB.Migrator().DropTable(&testModelTag{})
+		err = originalDB.Create(&testModelTag{ModelID: 1, Tag: "a"}).Error
+		So(err, ShouldBeNil)
+
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelOnlySearch,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			Tables:               []string{TestModelTableName},
+			InvalidateWhenUpdate: true,
+			CacheTTL:             5000,
+		})
+		So(err, ShouldBeNil)
+
+		find := func() int {
+			models := make([]*TestModel, 0)
+			result := db.Joins("JOIN "+testModelTagTableName+" ON "+testModelTagTableName+".model_id = "+
+				TestModelTableName+".id").Where(testModelTagTableName+".tag = ?", "a").Find(&models)
+			So(result.Error, ShouldBeNil)
+			return len(models)
+		}
+		So(find(), ShouldEqual, 1)
+		So(find(), ShouldEqual, 1)
+		So(c.HitCount(), ShouldEqual, 1)
+
+		Convey("writing the join table through gorm invalidates queries joining it", func() {
+			err = db.Create(&testModelTag{ModelID: 2, Tag: "a"}).Error
+			So(err, ShouldBeNil)
+			So(find(), ShouldEqual, 2)
+			So(c.HitCount(), ShouldEqual, 1)
+		})
+
+		Convey("InvalidateJoin invalidates queries joining it", func() {
+			err = originalDB.Exec("INSERT INTO "+testModelTagTableName+" (model_id, tag) VALUES (?, ?)", 3, "a").Error
+			So(err, ShouldBeNil)
+			So(find(), ShouldEqual, 1)
+
+			err = c.(*cache.Gorm2Cache).InvalidateJoin(context.Background(), testModelTagTableName, 3)
+			So(err, ShouldBeNil)
+			So(find(), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,50 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/asjdf/gorm-cache/util"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNormalizeSQL(t *testing.T) {
+	Convey("test sql normalization", t, func() {
+		mysql := "SELECT * FROM `gorm_cache_model`  WHERE `id` = ?"
+		postgres := "SELECT * FROM \"gorm_cache_model\" WHERE \"id\" = $1"
+		sqlserver := "SELECT *\n\tFROM gorm_cache_model WHERE id = @p1 "
+		So(util.NormalizeSQL(mysql), ShouldEqual, "SELECT * FROM `gorm_cache_model` WHERE `id` = ?")
+		So(util.NormalizeSQL(postgres), ShouldEqual, "SELECT * FROM \"gorm_cache_model\" WHERE \"id\" = ?")
+		So(util.NormalizeSQL(sqlserver), ShouldEqual, "SELECT * FROM gorm_cache_model WHERE id = ?")
+
+		// quoted strings and identifiers are kept untouched
+		So(util.NormalizeSQL("SELECT * FROM t WHERE v = 'a  \"b\" $1'"), ShouldEqual,
+			"SELECT * FROM t WHERE v = 'a  \"b\" $1'")
+		So(util.NormalizeSQL("SELECT * FROM t WHERE v = 'it''s  ok'"), ShouldEqual,
+			"SELECT * FROM t WHERE v = 'it''s  ok'")
+		So(util.NormalizeSQL("SELECT \"a  b\" FROM t WHERE v = \"$1\""), ShouldEqual,
+			"SELECT \"a  b\" FROM t WHERE v = \"$1\"")
+
+		// queries differing in quoted strings or identifiers only are keyed apart
+		So(util.NormalizeSQL("SELECT * FROM t WHERE v = \"x\""), ShouldNotEqual,
+			util.NormalizeSQL("SELECT * FROM t WHERE v = x"))
+		So(util.NormalizeSQL("SELECT `a b` FROM t"), ShouldNotEqual, util.NormalizeSQL("SELECT a b FROM t"))
+
+		So(util.GenSearchCacheKey("id", "t", "SELECT  *  FROM `t`\nWHERE `v` = $1", 1), ShouldEqual,
+			util.GenSearchCacheKey("id", "t", "SELECT * FROM `t` WHERE `v` = ?", 1))
+	})
+}
+
+func TestStripSQLComments(t *testing.T) {
+	Convey("test sql comment stripping", t, func() {
+		a := "/* traceparent=00-aaa-01 */ SELECT * FROM t WHERE id = ? -- req 1\n"
+		b := "/* traceparent=00-bbb-01 */ SELECT * FROM t WHERE id = ?"
+		So(util.NormalizeSQL(util.StripSQLComments(a)), ShouldEqual, "SELECT * FROM t WHERE id = ?")
+		So(util.NormalizeSQL(util.StripSQLComments(b)), ShouldEqual, "SELECT * FROM t WHERE id = ?")
+
+		// optimizer hints and literals are kept
+		So(util.StripSQLComments("SELECT /*+ MAX_EXECUTION_TIME(10) */ * FROM t"), ShouldEqual,
+			"SELECT /*+ MAX_EXECUTION_TIME(10) */ * FROM t")
+		So(util.StripSQLComments("SELECT * FROM t WHERE v = '/* x */ -- y'"), ShouldEqual,
+			"SELECT * FROM t WHERE v = '/* x */ -- y'")
+	})
+}
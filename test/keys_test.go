@@ -0,0 +1,66 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStorageKeys(t *testing.T) {
+	Convey("test iterating storage keys", t, func() {
+		ctx := context.Background()
+		for _, s := range []storage.DataStorage{storage.NewMem(), storage.NewGcache(gcache.New(1000))} {
+			So(s.Init(&storage.Config{Logger: &util.DefaultLogger{}}), ShouldBeNil)
+			for i := 0; i < 25; i++ {
+				So(s.SetKey(ctx, util.Kv{Key: fmt.Sprintf("keys:%02d", i), Value: "1"}), ShouldBeNil)
+			}
+			So(s.SetKey(ctx, util.Kv{Key: "keys_other:1", Value: "1"}), ShouldBeNil)
+
+			var all []string
+			var cursor uint64
+			pages := 0
+			for {
+				keys, next, err := s.Keys(ctx, "keys", cursor, 10)
+				So(err, ShouldBeNil)
+				all = append(all, keys...)
+				pages++
+				if next == 0 {
+					break
+				}
+				cursor = next
+			}
+			So(pages, ShouldEqual, 3)
+			So(len(all), ShouldEqual, 25)
+			So(all[0], ShouldEqual, "keys:00")
+			So(all[24], ShouldEqual, "keys:24")
+		}
+	})
+}
+
+func TestStorageEntryCount(t *testing.T) {
+	Convey("test storage entry count and memory usage", t, func() {
+		ctx := context.Background()
+		for _, s := range []storage.DataStorage{storage.NewMem(), storage.NewGcache(gcache.New(1000))} {
+			So(s.Init(&storage.Config{Logger: &util.DefaultLogger{}}), ShouldBeNil)
+			So(s.SetKey(ctx, util.Kv{Key: "count:a", Value: "12345"}), ShouldBeNil)
+			So(s.SetKey(ctx, util.Kv{Key: "count:b", Value: "12345"}), ShouldBeNil)
+			So(s.SetKey(ctx, util.Kv{Key: "other:a", Value: "1"}), ShouldBeNil)
+
+			cnt, err := s.EntryCount(ctx, "count")
+			So(err, ShouldBeNil)
+			So(cnt, ShouldEqual, 2)
+			cnt, err = s.EntryCount(ctx, "")
+			So(err, ShouldBeNil)
+			So(cnt, ShouldEqual, 3)
+
+			size, err := s.(storage.MemoryReporter).MemoryUsage(ctx, "count")
+			So(err, ShouldBeNil)
+			So(size, ShouldEqual, 2*(len("count:a")+len("12345")))
+		}
+	})
+}
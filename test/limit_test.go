@@ -0,0 +1,74 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMaxConcurrentMissQueries(t *testing.T) {
+	Convey("test max concurrent miss queries", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:               config.CacheLevelAll,
+			CacheStorage:             storage.NewGcache(gcache.New(1000)),
+			MaxConcurrentMissQueries: 1,
+		})
+		So(err, ShouldBeNil)
+		So(blockQuery(c, db), ShouldBeNil)
+
+		// the first query takes the only slot and is blocked
+		ch := make(chan struct{})
+		first := make(chan error)
+		go func() {
+			models := make([]*TestModel, 0)
+			first <- db.WithContext(context.WithValue(context.Background(), blockKey{}, ch)).
+				Where("id IN (?)", []int{1, 2}).Find(&models).Error
+		}()
+		So(waitFor(func() bool { return c.SingleFlightSize() == 1 }), ShouldBeTrue)
+
+		// another query of the table waits for the slot
+		second := make(chan error)
+		model := new(TestModel)
+		go func() {
+			second <- db.Where("id = ?", 1).First(model).Error
+		}()
+		select {
+		case <-second:
+			t.Fatal("query should wait for the slot")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		// then it's served from cache the first query populated
+		close(ch)
+		So(<-first, ShouldBeNil)
+		So(<-second, ShouldBeNil)
+		So(model.ID, ShouldEqual, 1)
+		So(c.PrimaryHitCount(), ShouldEqual, 1)
+
+		Convey("waiting query gives up when ctx is done", func() {
+			ch := make(chan struct{})
+			done := make(chan error)
+			go func() {
+				models := make([]*TestModel, 0)
+				done <- db.WithContext(context.WithValue(context.Background(), blockKey{}, ch)).
+					Where("value1 = ?", 3).Find(&models).Error
+			}()
+			So(waitFor(func() bool { return c.SingleFlightSize() == 1 }), ShouldBeTrue)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			models := make([]*TestModel, 0)
+			err := db.WithContext(ctx).Where("value1 = ?", 4).Find(&models).Error
+			So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+
+			close(ch)
+			So(<-done, ShouldBeNil)
+		})
+	})
+}
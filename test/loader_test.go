@@ -0,0 +1,54 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfigLoader(t *testing.T) {
+	Convey("test config loader", t, func() {
+		Convey("load from env", func() {
+			t.Setenv(config.EnvStorage, "gcache")
+			t.Setenv(config.EnvTTL, "5s")
+			t.Setenv(config.EnvTables, "a, b")
+			t.Setenv(config.EnvCacheLevel, "search")
+			t.Setenv(config.EnvInvalidateWhenUpdate, "false")
+			conf, err := config.FromEnv()
+			So(err, ShouldBeNil)
+			So(conf.CacheStorage, ShouldHaveSameTypeAs, &storage.Gcache{})
+			So(conf.CacheTTLDuration, ShouldEqual, 5*time.Second)
+			So(conf.Tables, ShouldResemble, []string{"a", "b"})
+			So(conf.CacheLevel, ShouldEqual, config.CacheLevelOnlySearch)
+			So(conf.InvalidateWhenUpdate, ShouldBeFalse)
+
+			t.Setenv(config.EnvTTL, "5")
+			_, err = config.FromEnv()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("load from yaml", func() {
+			path := filepath.Join(t.TempDir(), "cache.yaml")
+			err := os.WriteFile(path, []byte("storage: memory\nttl: 1m\ntables: [users]\nmax_item_count: 50\n"), 0o644)
+			So(err, ShouldBeNil)
+			conf, err := config.FromYAML(path)
+			So(err, ShouldBeNil)
+			So(conf.CacheStorage, ShouldHaveSameTypeAs, &storage.Memory{})
+			So(conf.CacheTTLDuration, ShouldEqual, time.Minute)
+			So(conf.Tables, ShouldResemble, []string{"users"})
+			So(conf.CacheMaxItemCnt, ShouldEqual, 50)
+			So(conf.CacheLevel, ShouldEqual, config.CacheLevelAll)
+			So(conf.InvalidateWhenUpdate, ShouldBeTrue)
+
+			err = os.WriteFile(path, []byte("storage: redis\n"), 0o644)
+			So(err, ShouldBeNil)
+			_, err = config.FromYAML(path)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,190 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// recordLogger records logs printed
+type recordLogger struct {
+	mu    sync.Mutex
+	infos []string
+	lines []string
+}
+
+func (l *recordLogger) SetIsDebug(debug bool) {}
+
+func (l *recordLogger) CtxInfo(ctx context.Context, format string, v ...interface{}) {
+	l.mu.Lock()
+	l.infos = append(l.infos, format)
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+	l.mu.Unlock()
+}
+
+func (l *recordLogger) CtxError(ctx context.Context, format string, v ...interface{}) {
+	l.mu.Lock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+	l.mu.Unlock()
+}
+
+func (l *recordLogger) contains(substr string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *recordLogger) infoCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.infos)
+}
+
+func TestSampledLogging(t *testing.T) {
+	Convey("test sampled debug logging", t, func() {
+		find := func(conf *config.CacheConfig, value int) {
+			_, db, err := newCachedDB(conf)
+			So(err, ShouldBeNil)
+			models := make([]*TestModel, 0)
+			So(db.Where("value1 = ?", value).Find(&models).Error, ShouldBeNil)
+		}
+
+		Convey("only operations on debug tables print logs", func() {
+			logger := &recordLogger{}
+			find(&config.CacheConfig{
+				CacheLevel:   config.CacheLevelOnlySearch,
+				CacheStorage: storage.NewGcache(gcache.New(1000)),
+				DebugMode:    true,
+				DebugLogger:  logger,
+				DebugTables:  []string{"other_table"},
+			}, 1)
+			So(logger.infoCount(), ShouldEqual, 0)
+
+			find(&config.CacheConfig{
+				CacheLevel:   config.CacheLevelOnlySearch,
+				CacheStorage: storage.NewGcache(gcache.New(1000)),
+				DebugMode:    true,
+				DebugLogger:  logger,
+				DebugTables:  []string{TestModelTableName},
+			}, 1)
+			So(logger.infoCount(), ShouldBeGreaterThan, 0)
+		})
+
+		Convey("1 in sample rate operations print logs", func() {
+			logger := &recordLogger{}
+			conf := &config.CacheConfig{
+				CacheLevel:      config.CacheLevelOnlySearch,
+				CacheStorage:    storage.NewGcache(gcache.New(1000)),
+				DebugMode:       true,
+				DebugLogger:     logger,
+				DebugSampleRate: 1000,
+			}
+			_, db, err := newCachedDB(conf)
+			So(err, ShouldBeNil)
+			models := make([]*TestModel, 0)
+			So(db.Where("value1 = ?", 1).Find(&models).Error, ShouldBeNil)
+			cnt := logger.infoCount()
+			So(cnt, ShouldBeGreaterThan, 0)
+
+			So(db.Where("value1 = ?", 2).Find(&models).Error, ShouldBeNil)
+			So(logger.infoCount(), ShouldEqual, cnt)
+		})
+	})
+}
+
+func TestLogRedaction(t *testing.T) {
+	Convey("test log redaction", t, func() {
+		find := func(redactor util.Redactor) *recordLogger {
+			logger := &recordLogger{}
+			_, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:   config.CacheLevelAll,
+				CacheStorage: storage.NewGcache(gcache.New(1000)),
+				DebugMode:    true,
+				DebugLogger:  logger,
+				LogRedactor:  redactor,
+			})
+			So(err, ShouldBeNil)
+			models := make([]*TestModel, 0)
+			So(db.Where("id IN ?", []int64{1, 2}).Find(&models).Error, ShouldBeNil)
+			So(db.Where("id IN ?", []int64{1, 2}).Find(&models).Error, ShouldBeNil)
+			return logger
+		}
+
+		So(find(nil).contains(`"ID":1`), ShouldBeTrue)
+		So(find(util.MaskRedactor).contains(`"ID":1`), ShouldBeFalse)
+		So(find(util.HashRedactor).contains(`"ID":1`), ShouldBeFalse)
+		So(find(util.HashRedactor).contains("sha256:"), ShouldBeTrue)
+	})
+}
+
+type requestIDKey struct{}
+
+func TestLogCtxFields(t *testing.T) {
+	Convey("test ctx fields in default logger", t, func() {
+		r, w, err := os.Pipe()
+		So(err, ShouldBeNil)
+		stdout := os.Stdout
+		os.Stdout = w
+
+		logger := &util.DefaultLogger{CtxFieldsFunc: func(ctx context.Context) map[string]interface{} {
+			return map[string]interface{}{"request_id": ctx.Value(requestIDKey{}), "app": "test"}
+		}}
+		logger.SetIsDebug(true)
+		logger.CtxInfo(context.WithValue(context.Background(), requestIDKey{}, "r-100%"), "[Test] hello %s", "world")
+
+		os.Stdout = stdout
+		So(w.Close(), ShouldBeNil)
+		out, err := io.ReadAll(r)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEndWith, "[INFO] [Test] hello world app=test request_id=r-100%\n")
+	})
+}
+
+func TestJSONLogger(t *testing.T) {
+	Convey("test json logger", t, func() {
+		buf := &bytes.Buffer{}
+		_, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlySearch,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+			DebugMode:    true,
+			DebugLogger:  util.NewJSONLogger(buf),
+		})
+		So(err, ShouldBeNil)
+		models := make([]*TestModel, 0)
+		So(db.Where("value1 = ?", 1).Find(&models).Error, ShouldBeNil)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		So(len(lines), ShouldBeGreaterThan, 0)
+		found := false
+		for _, line := range lines {
+			entry := make(map[string]interface{})
+			So(json.Unmarshal([]byte(line), &entry), ShouldBeNil)
+			So(entry["ts"], ShouldNotBeEmpty)
+			So(entry["level"], ShouldBeIn, "info", "error")
+			if entry["op"] == "AfterQuery" {
+				found = true
+				So(entry["table"], ShouldEqual, TestModelTableName)
+				So(entry["key"], ShouldNotBeEmpty)
+				So(entry["latency_ms"], ShouldNotBeNil)
+			}
+		}
+		So(found, ShouldBeTrue)
+	})
+}
@@ -0,0 +1,46 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLookupOrder(t *testing.T) {
+	Convey("test lookup order of primary and search cache", t, func() {
+		query := func(searchFirst []string) cache.Cache {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:        config.CacheLevelAll,
+				CacheStorage:      storage.NewGcache(gcache.New(1000)),
+				SearchFirstTables: searchFirst,
+			})
+			So(err, ShouldBeNil)
+			for i := 0; i < 2; i++ {
+				models := make([]*TestModel, 0)
+				So(db.Where("id IN (?)", []int{1, 2}).Find(&models).Error, ShouldBeNil)
+				So(len(models), ShouldEqual, 2)
+				So(waitFor(func() bool {
+					return c.(*cache.Gorm2Cache).Status(context.Background()).AsyncQueueDepth == 0
+				}), ShouldBeTrue)
+			}
+			return c
+		}
+
+		Convey("primary cache is looked up first by default", func() {
+			c := query(nil)
+			So(c.PrimaryHitCount(), ShouldEqual, 1)
+			So(c.SearchHitCount(), ShouldEqual, 0)
+		})
+
+		Convey("search cache is looked up first for search first tables", func() {
+			c := query([]string{TestModelTableName})
+			So(c.PrimaryHitCount(), ShouldEqual, 0)
+			So(c.SearchHitCount(), ShouldEqual, 1)
+		})
+	})
+}
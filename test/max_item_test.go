@@ -0,0 +1,56 @@
+package test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+func TestMaxItemCntExceeded(t *testing.T) {
+	Convey("test queries retrieving more objects than CacheMaxItemCnt", t, func() {
+		ctx := context.Background()
+		newDB := func(mode config.MaxItemCntExceededMode) (*cache.Gorm2Cache, *gorm.DB, *countingStorage) {
+			s := &countingStorage{DataStorage: storage.NewGcache(gcache.New(1000))}
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:             config.CacheLevelAll,
+				CacheStorage:           s,
+				CacheTTL:               5000,
+				CacheMaxItemCnt:        2,
+				MaxItemCntExceededMode: mode,
+			})
+			So(err, ShouldBeNil)
+			models := make([]*TestModel, 0)
+			So(db.Where("id <= ?", 5).Find(&models).Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 5)
+			return c.(*cache.Gorm2Cache), db, s
+		}
+
+		Convey("nothing is cached by default", func() {
+			c, _, s := newDB(config.MaxItemCntExceededSkip)
+			So(atomic.LoadInt64(&s.batchSets), ShouldEqual, 0)
+			exists, err := c.BatchPrimaryKeyExists(ctx, TestModelTableName, []string{"1"})
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeFalse)
+		})
+
+		Convey("objects are set in primary cache in bounded batches", func() {
+			c, db, s := newDB(config.MaxItemCntExceededCachePrimary)
+			So(atomic.LoadInt64(&s.batchSets), ShouldEqual, 3)
+			exists, err := c.BatchPrimaryKeyExists(ctx, TestModelTableName, []string{"1", "2", "3", "4", "5"})
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeTrue)
+
+			// the result as a whole isn't cached
+			models := make([]*TestModel, 0)
+			So(db.Where("id <= ?", 5).Find(&models).Error, ShouldBeNil)
+			So(c.SearchHitCount(), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,68 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMultipleInstances(t *testing.T) {
+	Convey("test multiple cache instances on one db", t, func() {
+		err := originalDB.AutoMigrate(&testModelTag{})
+		So(err, ShouldBeNil)
+		defer originalDB.Migrator().DropTable(&testModelTag{})
+		err = originalDB.Create(&testModelTag{ModelID: 1, Tag: "a"}).Error
+		So(err, ShouldBeNil)
+
+		modelCache, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlySearch,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+			Tables:       []string{TestModelTableName},
+		})
+		So(err, ShouldBeNil)
+		tagCache, err := cache.NewGorm2Cache(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelOnlySearch,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			Tables:               []string{testModelTagTableName},
+			InvalidateWhenUpdate: true,
+		})
+		So(err, ShouldBeNil)
+		So(db.Use(tagCache), ShouldBeNil)
+
+		// the first cache keeps callback names of former versions
+		So(modelCache.(*cache.Gorm2Cache).CallbackName("after_query"), ShouldEqual, "gorm:cache:after_query")
+		gc := tagCache.(*cache.Gorm2Cache)
+		So(gc.CallbackName("after_query"), ShouldEqual, "gorm:cache:"+gc.InstanceId+":after_query")
+		So(db.Callback().Query().Get("gorm:cache:after_query"), ShouldNotBeNil)
+		So(db.Callback().Query().Get(gc.CallbackName("after_query")), ShouldNotBeNil)
+
+		for i := 0; i < 2; i++ {
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 = ?", 1).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 1)
+
+			tags := make([]*testModelTag, 0)
+			result = db.Where("model_id = ?", 1).Find(&tags)
+			So(result.Error, ShouldBeNil)
+			So(len(tags), ShouldEqual, 1)
+			So(tags[0].Tag, ShouldEqual, "a")
+		}
+		So(modelCache.HitCount(), ShouldEqual, 1)
+		So(modelCache.MissCount(), ShouldEqual, 1)
+		So(tagCache.HitCount(), ShouldEqual, 1)
+		So(tagCache.MissCount(), ShouldEqual, 1)
+
+		err = db.Create(&testModelTag{ModelID: 1, Tag: "b"}).Error
+		So(err, ShouldBeNil)
+		tags := make([]*testModelTag, 0)
+		result := db.Where("model_id = ?", 1).Find(&tags)
+		So(result.Error, ShouldBeNil)
+		So(len(tags), ShouldEqual, 2)
+		So(modelCache.HitCount(), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,75 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testModelExtra struct {
+	ID     int64 `gorm:"column:id;primaryKey"`
+	Value1 int64 `gorm:"column:value1"`
+}
+
+const testModelExtraTableName = TestModelTableName + ":extra"
+
+func (testModelExtra) TableName() string {
+	return testModelExtraTableName
+}
+
+func TestKeyNamespaceIsolation(t *testing.T) {
+	Convey("test key namespace isolation", t, func() {
+		Convey("delimiters in table names are escaped", func() {
+			So(util.EscapeKeySegment("users:extra"), ShouldEqual, "users%3Aextra")
+			So(util.EscapeKeySegment("users%3Aextra"), ShouldEqual, "users%253Aextra")
+			So(util.EscapeKeySegment("users*"), ShouldEqual, "users%2A")
+
+			key := util.GenSearchCacheKey("k", "users:extra", "SELECT 1")
+			So(strings.HasPrefix(key, util.GenSearchCachePrefix("k", "users")+":"), ShouldBeFalse)
+			key = util.GenPrimaryCacheKey("k", "users:extra", "1")
+			So(strings.HasPrefix(key, util.GenPrimaryCachePrefix("k", "users")+":"), ShouldBeFalse)
+		})
+
+		Convey("invalidating a table keeps cache of tables whose names extend it", func() {
+			err := originalDB.AutoMigrate(&testModelExtra{})
+			So(err, ShouldBeNil)
+			defer originalDB.Migrator().DropTable(&testModelExtra{})
+			err = originalDB.Create(&testModelExtra{ID: 1, Value1: 1}).Error
+			So(err, ShouldBeNil)
+
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:   config.CacheLevelOnlySearch,
+				CacheStorage: storage.NewGcache(gcache.New(1000)),
+				CacheTTL:     5000,
+			})
+			So(err, ShouldBeNil)
+
+			models := make([]*TestModel, 0)
+			So(db.Where("value1 = ?", 1).Find(&models).Error, ShouldBeNil)
+			extras := make([]*testModelExtra, 0)
+			So(db.Where("value1 = ?", 1).Find(&extras).Error, ShouldBeNil)
+
+			err = c.(*cache.Gorm2Cache).InvalidateSearchCache(context.Background(), TestModelTableName)
+			So(err, ShouldBeNil)
+			So(db.Where("value1 = ?", 1).Find(&extras).Error, ShouldBeNil)
+			So(len(extras), ShouldEqual, 1)
+			So(c.SearchHitCount(), ShouldEqual, 1)
+		})
+
+		Convey("key prefix with glob metacharacters is rejected at init", func() {
+			_, err := cache.NewGorm2Cache(&config.CacheConfig{
+				CacheLevel:   config.CacheLevelOnlySearch,
+				CacheStorage: storage.NewGcache(gcache.New(1000)),
+				KeyPrefix:    "app*",
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
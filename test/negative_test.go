@@ -0,0 +1,106 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+func TestCreateInvalidatesNegatives(t *testing.T) {
+	Convey("test create invalidates matching not-found results", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlySearch,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+			CacheTTL:     5000,
+		})
+		So(err, ShouldBeNil)
+
+		createdID, otherID := int64(testSize*10+1), int64(testSize*10+2)
+		defer originalDB.Delete(&TestModel{}, createdID)
+
+		first := func(id int64) error {
+			model := new(TestModel)
+			return db.Where("id = ?", id).First(model).Error
+		}
+		So(first(createdID), ShouldEqual, gorm.ErrRecordNotFound)
+		So(first(otherID), ShouldEqual, gorm.ErrRecordNotFound)
+		So(first(createdID), ShouldEqual, gorm.ErrRecordNotFound)
+		So(c.HitCount(), ShouldEqual, 1)
+
+		err = db.Create(&TestModel{ID: createdID, Value1: createdID}).Error
+		So(err, ShouldBeNil)
+
+		So(first(createdID), ShouldBeNil)
+		So(first(otherID), ShouldEqual, gorm.ErrRecordNotFound)
+		So(c.HitCount(), ShouldEqual, 2)
+	})
+}
+
+func TestUntrackedNegatives(t *testing.T) {
+	Convey("test not-found results beyond the tracked ones", t, func() {
+		createdID, otherID := int64(testSize*10+1), int64(testSize*10+2)
+		defer originalDB.Delete(&TestModel{}, createdID)
+		missingIDs := func(from int64, n int) []int64 {
+			ids := make([]int64, 0, n)
+			for i := 0; i < n; i++ {
+				ids = append(ids, from+int64(i))
+			}
+			return ids
+		}
+
+		Convey("are cached and invalidated along with the whole search cache on create", func() {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:   config.CacheLevelOnlySearch,
+				CacheStorage: storage.NewGcache(gcache.New(1000)),
+				CacheTTL:     5000,
+			})
+			So(err, ShouldBeNil)
+			first := func(ids []int64) error {
+				return db.Where("id IN (?)", ids).First(new(TestModel)).Error
+			}
+			many := missingIDs(int64(testSize*20), 10001)
+			So(first(many), ShouldEqual, gorm.ErrRecordNotFound)
+			So(first([]int64{otherID}), ShouldEqual, gorm.ErrRecordNotFound)
+			So(first(many), ShouldEqual, gorm.ErrRecordNotFound)
+			So(first([]int64{otherID}), ShouldEqual, gorm.ErrRecordNotFound)
+			So(c.HitCount(), ShouldEqual, 2)
+
+			So(db.Create(&TestModel{ID: createdID, Value1: createdID}).Error, ShouldBeNil)
+			So(first([]int64{otherID}), ShouldEqual, gorm.ErrRecordNotFound)
+			So(c.HitCount(), ShouldEqual, 2)
+		})
+
+		Convey("expire with EmptyResultTTL", func() {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:     config.CacheLevelOnlySearch,
+				CacheStorage:   storage.NewGcache(gcache.New(1000)),
+				CacheTTL:       5000,
+				EmptyResultTTL: 100,
+			})
+			So(err, ShouldBeNil)
+			find := func(ids []int64) {
+				models := make([]*TestModel, 0)
+				So(db.Where("id IN (?)", ids).Find(&models).Error, ShouldBeNil)
+				So(len(models), ShouldEqual, 0)
+			}
+			find(missingIDs(int64(testSize*20), 6000))
+			time.Sleep(1200 * time.Millisecond)
+
+			// the expired ones make room for others, which are tracked
+			others := missingIDs(int64(testSize*40), 6000)
+			find(others)
+			So(db.Where("id = ?", otherID).First(new(TestModel)).Error, ShouldEqual, gorm.ErrRecordNotFound)
+			find(others)
+			So(c.HitCount(), ShouldEqual, 1)
+
+			So(db.Create(&TestModel{ID: createdID, Value1: createdID}).Error, ShouldBeNil)
+			So(db.Where("id = ?", otherID).First(new(TestModel)).Error, ShouldEqual, gorm.ErrRecordNotFound)
+			So(c.HitCount(), ShouldEqual, 2)
+		})
+	})
+}
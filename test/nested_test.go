@@ -0,0 +1,79 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+type nestedKey struct{}
+
+// reenterQuery registers a callback which issues the same query again like an AfterFind hook does
+func reenterQuery(c cache.Cache, db *gorm.DB) error {
+	return db.Callback().Query().After("gorm:query").Before(c.(*cache.Gorm2Cache).CallbackName("after_query")).
+		Register("test:reenter", func(db *gorm.DB) {
+			if db.Statement.Context.Value(nestedKey{}) != nil {
+				return
+			}
+			models := make([]*TestModel, 0)
+			_ = db.Session(&gorm.Session{NewDB: true}).
+				WithContext(context.WithValue(db.Statement.Context, nestedKey{}, true)).Where("value1 = ?", 1).Find(&models).Error
+		})
+}
+
+func findWithTimeout(db *gorm.DB) error {
+	done := make(chan error, 1)
+	go func() {
+		models := make([]*TestModel, 0)
+		done <- db.Where("value1 = ?", 1).Find(&models).Error
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		return gorm.ErrInvalidTransaction
+	}
+}
+
+func TestNestedQuery(t *testing.T) {
+	Convey("test nested query", t, func() {
+		Convey("nested query shares cache without waiting for single flight", func() {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:   config.CacheLevelOnlySearch,
+				CacheStorage: storage.NewGcache(gcache.New(1000)),
+				CacheTTL:     5000,
+			})
+			So(err, ShouldBeNil)
+			So(reenterQuery(c, db), ShouldBeNil)
+
+			So(findWithTimeout(db), ShouldBeNil)
+			So(c.SingleFlightSize(), ShouldEqual, 0)
+			So(c.MissCount(), ShouldEqual, 2)
+
+			So(findWithTimeout(db), ShouldBeNil)
+			So(c.HitCount(), ShouldEqual, 2)
+		})
+
+		Convey("nested query bypasses cache", func() {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:          config.CacheLevelOnlySearch,
+				CacheStorage:        storage.NewGcache(gcache.New(1000)),
+				CacheTTL:            5000,
+				BypassNestedQueries: true,
+			})
+			So(err, ShouldBeNil)
+			So(reenterQuery(c, db), ShouldBeNil)
+
+			So(findWithTimeout(db), ShouldBeNil)
+			So(c.MissCount(), ShouldEqual, 1)
+			So(c.BypassCount(), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,133 @@
+package test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+// apiNullString is a nullable string marshaled the way APIs like it, as "" if NULL
+type apiNullString struct {
+	sql.NullString
+}
+
+func (s apiNullString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String)
+}
+
+func (s *apiNullString) UnmarshalJSON(data []byte) error {
+	err := json.Unmarshal(data, &s.String)
+	s.Valid = s.String != ""
+	return err
+}
+
+func (s apiNullString) Value() (driver.Value, error) {
+	return s.NullString.Value()
+}
+
+type testModelNullable struct {
+	ID      int64 `gorm:"primaryKey"`
+	Str     sql.NullString
+	Int     sql.NullInt64
+	Float   sql.NullFloat64
+	Bool    sql.NullBool
+	Time    sql.NullTime
+	Deleted gorm.DeletedAt
+	API     apiNullString
+	APIPtr  *apiNullString
+}
+
+func TestNullRoundTrip(t *testing.T) {
+	Convey("test NULL and zero values round-trip through cache", t, func() {
+		So(originalDB.AutoMigrate(&testModelNullable{}), ShouldBeNil)
+		defer originalDB.Migrator().DropTable(&testModelNullable{})
+		now := time.Now().UTC()
+		So(originalDB.Create(&[]*testModelNullable{
+			{ID: 1},
+			{
+				ID:     2,
+				Str:    sql.NullString{Valid: true},
+				Int:    sql.NullInt64{Valid: true},
+				Float:  sql.NullFloat64{Float64: 0.1, Valid: true},
+				Bool:   sql.NullBool{Valid: true},
+				Time:   sql.NullTime{Time: now, Valid: true},
+				API:    apiNullString{sql.NullString{Valid: true}},
+				APIPtr: &apiNullString{sql.NullString{String: "a", Valid: true}},
+			},
+		}).Error, ShouldBeNil)
+
+		fresh := make([]*testModelNullable, 0)
+		So(originalDB.Order("id").Find(&fresh).Error, ShouldBeNil)
+		So(len(fresh), ShouldEqual, 2)
+
+		// primary cache is looked up by queries of primary keys only, Unscoped drops the soft delete condition
+		cached := func(encodeDBValues bool) (search []*testModelNullable, primary []*testModelNullable) {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:     config.CacheLevelAll,
+				CacheStorage:   storage.NewGcache(gcache.New(1000)),
+				CacheTTL:       5000,
+				EncodeDBValues: encodeDBValues,
+			})
+			So(err, ShouldBeNil)
+			for i := 0; i < 2; i++ {
+				search = make([]*testModelNullable, 0)
+				So(db.Where("id > ?", 0).Order("id").Find(&search).Error, ShouldBeNil)
+				primary = make([]*testModelNullable, 0)
+				for _, id := range []int64{1, 2} {
+					m := &testModelNullable{}
+					So(db.Unscoped().Where("id = ?", id).First(m).Error, ShouldBeNil)
+					primary = append(primary, m)
+				}
+			}
+			gc := c.(*cache.Gorm2Cache)
+			So(gc.SearchHitCount(), ShouldBeGreaterThan, 0)
+			So(gc.PrimaryHitCount(), ShouldBeGreaterThan, 0)
+			return
+		}
+
+		Convey("sql.Null* and gorm.DeletedAt round-trip by default", func() {
+			search, primary := cached(false)
+			for _, models := range [][]*testModelNullable{search, primary} {
+				So(len(models), ShouldEqual, 2)
+				for i, m := range models {
+					So(m.Str, ShouldResemble, fresh[i].Str)
+					So(m.Int, ShouldResemble, fresh[i].Int)
+					So(m.Float, ShouldResemble, fresh[i].Float)
+					So(m.Bool, ShouldResemble, fresh[i].Bool)
+					So(m.Time.Valid, ShouldEqual, fresh[i].Time.Valid)
+					So(m.Time.Time.Equal(fresh[i].Time.Time), ShouldBeTrue)
+					So(m.Deleted, ShouldResemble, fresh[i].Deleted)
+				}
+			}
+			// the empty string is told from NULL by the database, not by its JSON
+			So(fresh[1].API.Valid, ShouldBeTrue)
+			So(search[1].API.Valid, ShouldBeFalse)
+		})
+
+		Convey("types with their own JSON marshaling round-trip with EncodeDBValues", func() {
+			search, primary := cached(true)
+			for _, models := range [][]*testModelNullable{search, primary} {
+				So(len(models), ShouldEqual, 2)
+				for i, m := range models {
+					So(m.Str, ShouldResemble, fresh[i].Str)
+					So(m.Int, ShouldResemble, fresh[i].Int)
+					So(m.Float, ShouldResemble, fresh[i].Float)
+					So(m.Time.Valid, ShouldEqual, fresh[i].Time.Valid)
+					So(m.Time.Time.Equal(fresh[i].Time.Time), ShouldBeTrue)
+					So(m.Deleted.Valid, ShouldEqual, fresh[i].Deleted.Valid)
+					So(m.API, ShouldResemble, fresh[i].API)
+					So(m.APIPtr, ShouldResemble, fresh[i].APIPtr)
+				}
+			}
+		})
+	})
+}
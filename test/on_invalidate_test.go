@@ -0,0 +1,78 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type invalidation struct {
+	table string
+	keys  []string
+}
+
+func TestOnInvalidate(t *testing.T) {
+	Convey("test invalidation hook", t, func() {
+		var mu sync.Mutex
+		var invalidations []invalidation
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelAll,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+			OnInvalidate: func(ctx context.Context, tableName string, keys []string) {
+				mu.Lock()
+				defer mu.Unlock()
+				invalidations = append(invalidations, invalidation{table: tableName, keys: keys})
+			},
+		})
+		So(err, ShouldBeNil)
+		taken := func() []invalidation {
+			mu.Lock()
+			defer mu.Unlock()
+			taken := invalidations
+			invalidations = nil
+			return taken
+		}
+
+		Convey("writes report invalidated primary keys and tables", func() {
+			So(db.Model(&TestModel{ID: 1}).Update("value2", 10).Error, ShouldBeNil)
+			defer originalDB.Model(&TestModel{ID: 1}).Update("value2", 1)
+			// search and primary cache may be invalidated in either order
+			invalidations := taken()
+			So(len(invalidations), ShouldEqual, 2)
+			So(invalidations, ShouldContain, invalidation{table: TestModelTableName, keys: []string{"1"}})
+			So(invalidations, ShouldContain, invalidation{table: TestModelTableName})
+		})
+
+		Convey("invalidating cache manually reports it", func() {
+			gc := c.(*cache.Gorm2Cache)
+			So(gc.BatchInvalidatePrimaryCache(context.Background(), TestModelTableName, []string{"2", "3"}), ShouldBeNil)
+			So(gc.InvalidateSearchCache(context.Background(), TestModelTableName), ShouldBeNil)
+			So(taken(), ShouldResemble, []invalidation{
+				{table: TestModelTableName, keys: []string{"2", "3"}},
+				{table: TestModelTableName},
+			})
+		})
+
+		Convey("panics of the hook are recovered", func() {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:           config.CacheLevelOnlySearch,
+				CacheStorage:         storage.NewGcache(gcache.New(1000)),
+				InvalidateWhenUpdate: true,
+				OnInvalidate: func(ctx context.Context, tableName string, keys []string) {
+					panic("hook")
+				},
+			})
+			So(err, ShouldBeNil)
+			So(db.Model(&TestModel{ID: 1}).Update("value2", 10).Error, ShouldBeNil)
+			defer originalDB.Model(&TestModel{ID: 1}).Update("value2", 1)
+			So(c.PanicCount(), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,58 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOptions(t *testing.T) {
+	Convey("test functional options", t, func() {
+		Convey("defaults and options are applied", func() {
+			c, err := cache.New(
+				cache.WithStorage(storage.NewGcache(gcache.New(1000))),
+				cache.WithTTL(5*time.Second),
+				cache.WithTables(TestModelTableName),
+			)
+			So(err, ShouldBeNil)
+			conf := c.(*cache.Gorm2Cache).Config
+			So(conf.CacheLevel, ShouldEqual, config.CacheLevelAll)
+			So(conf.InvalidateWhenUpdate, ShouldBeTrue)
+			So(conf.CacheTTL, ShouldEqual, 5000)
+			So(conf.Tables, ShouldResemble, []string{TestModelTableName})
+
+			db, err := forkDB(originalDB)
+			So(err, ShouldBeNil)
+			So(db.Use(c), ShouldBeNil)
+			for i := 0; i < 2; i++ {
+				models := make([]*TestModel, 0)
+				result := db.Where("value1 = ?", 1).Find(&models)
+				So(result.Error, ShouldBeNil)
+				So(len(models), ShouldEqual, 1)
+			}
+			So(c.HitCount(), ShouldEqual, 1)
+		})
+
+		Convey("sub millisecond ttl is not treated as forever", func() {
+			c, err := cache.New(cache.WithTTL(time.Microsecond))
+			So(err, ShouldBeNil)
+			So(c.(*cache.Gorm2Cache).Config.CacheTTL, ShouldEqual, 1)
+		})
+
+		Convey("invalid config is rejected", func() {
+			_, err := cache.New(cache.WithCacheLevel(config.CacheLevel(5)))
+			So(err, ShouldNotBeNil)
+			_, err = cache.New(cache.WithMaxItemCount(-1))
+			So(err, ShouldNotBeNil)
+			_, err = cache.New(cache.WithConfig(func(conf *config.CacheConfig) {
+				conf.EmptyResultTTL = -1
+			}))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
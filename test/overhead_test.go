@@ -0,0 +1,85 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"gorm.io/gorm"
+)
+
+// overhead budgets are the most time queries may take through the plugin, relative to the same queries without the
+// plugin. Keep them in sync with README.
+const (
+	cacheLevelOffOverheadBudget = 2.5
+	passthroughOverheadBudget   = 4.0
+)
+
+func newBenchDB(tb testing.TB, opts ...cache.Option) *gorm.DB {
+	db, err := forkDB(originalDB)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if opts == nil {
+		return db
+	}
+	c, err := cache.New(opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := db.Use(c); err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+func benchmarkQueries(b *testing.B, db *gorm.DB) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := int64(i%testSize) + 1
+		model := &TestModel{}
+		if err := db.Where("id = ?", id).First(model).Error; err != nil {
+			b.Fatal(err)
+		}
+		models := make([]*TestModel, 0)
+		if err := db.Where("value1 = ?", id).Find(&models).Error; err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQueryWithoutPlugin(b *testing.B) {
+	benchmarkQueries(b, newBenchDB(b))
+}
+
+func BenchmarkQueryCacheLevelOff(b *testing.B) {
+	benchmarkQueries(b, newBenchDB(b, cache.WithPassthrough(), cache.WithCacheLevel(config.CacheLevelOff)))
+}
+
+func BenchmarkQueryPassthrough(b *testing.B) {
+	benchmarkQueries(b, newBenchDB(b, cache.WithPassthrough()))
+}
+
+func TestOverheadBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip("benchmarks are skipped in short mode")
+	}
+	baseline := testing.Benchmark(BenchmarkQueryWithoutPlugin)
+	for _, c := range []struct {
+		name      string
+		benchmark func(b *testing.B)
+		budget    float64
+	}{
+		{"cache level off", BenchmarkQueryCacheLevelOff, cacheLevelOffOverheadBudget},
+		{"passthrough", BenchmarkQueryPassthrough, passthroughOverheadBudget},
+	} {
+		result := testing.Benchmark(c.benchmark)
+		ratio := float64(result.NsPerOp()) / float64(baseline.NsPerOp())
+		t.Logf("without plugin: %v, %s: %v, ratio %.2f", baseline, c.name, result, ratio)
+		if ratio > c.budget {
+			t.Errorf("%s takes %.2f times as long as queries without plugin, over budget %.2f",
+				c.name, ratio, c.budget)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPageRangeInvalidation(t *testing.T) {
+	Convey("test page range invalidation", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:            config.CacheLevelOnlySearch,
+			CacheStorage:          storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate:  true,
+			CacheTTL:              5000,
+			PageRangeInvalidation: true,
+		})
+		So(err, ShouldBeNil)
+		defer originalDB.Where("id = ?", 1000).Delete(&TestModel{})
+
+		ascPage := func() {
+			models := make([]*TestModel, 0)
+			result := db.Where("id > ?", 150).Order("id").Limit(5).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 5)
+		}
+		descPage := func() {
+			models := make([]*TestModel, 0)
+			result := db.Order("id desc").Limit(3).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 3)
+		}
+
+		ascPage()
+		descPage()
+		ascPage()
+		descPage()
+		So(c.HitCount(), ShouldEqual, 2)
+
+		// a new row at the end only changes the last page
+		result := db.Create(&TestModel{ID: 1000})
+		So(result.Error, ShouldBeNil)
+
+		ascPage()
+		So(c.HitCount(), ShouldEqual, 3)
+		descPage()
+		So(c.HitCount(), ShouldEqual, 3)
+		descPage()
+		So(c.HitCount(), ShouldEqual, 4)
+
+		result = db.Where("id = ?", 1000).Delete(&TestModel{})
+		So(result.Error, ShouldBeNil)
+
+		ascPage()
+		So(c.HitCount(), ShouldEqual, 5)
+		descPage()
+		So(c.HitCount(), ShouldEqual, 5)
+
+		// InvalidatePages drops all pages
+		err = c.(*cache.Gorm2Cache).InvalidatePages(context.Background(), TestModelTableName)
+		So(err, ShouldBeNil)
+		ascPage()
+		So(c.HitCount(), ShouldEqual, 5)
+	})
+}
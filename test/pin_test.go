@@ -0,0 +1,80 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+func TestPinnedCache(t *testing.T) {
+	Convey("test pinned cache", t, func() {
+		ctx := context.Background()
+		find := func(c cache.Cache, db *gorm.DB, value int) {
+			models := make([]*TestModel, 0)
+			So(db.Where("value1 < ?", value).Find(&models).Error, ShouldBeNil)
+			So(waitFor(func() bool {
+				return c.(*cache.Gorm2Cache).Status(ctx).AsyncQueueDepth == 0
+			}), ShouldBeTrue)
+		}
+
+		Convey("cache of pinned tables doesn't expire until it's invalidated", func() {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:   config.CacheLevelAll,
+				CacheStorage: storage.NewMem(&storage.MemStoreConfig{MaxSize: 1000}),
+				CacheTTL:     50,
+				PinnedTables: []string{TestModelTableName},
+			})
+			So(err, ShouldBeNil)
+
+			find(c, db, 5)
+			time.Sleep(100 * time.Millisecond)
+			find(c, db, 5)
+			So(c.SearchHitCount(), ShouldEqual, 1)
+
+			err = c.(*cache.Gorm2Cache).InvalidateSearchCache(ctx, TestModelTableName)
+			So(err, ShouldBeNil)
+			find(c, db, 5)
+			So(c.SearchHitCount(), ShouldEqual, 1)
+		})
+
+		Convey("queries within WithPinned context are pinned", func() {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:   config.CacheLevelAll,
+				CacheStorage: storage.NewMem(&storage.MemStoreConfig{MaxSize: 1000}),
+				CacheTTL:     50,
+			})
+			So(err, ShouldBeNil)
+
+			pinnedDB := db.WithContext(cache.WithPinned(ctx))
+			find(c, pinnedDB, 5)
+			find(c, db, 6)
+			time.Sleep(100 * time.Millisecond)
+			find(c, db, 5)
+			find(c, db, 6)
+			So(c.SearchHitCount(), ShouldEqual, 1)
+		})
+
+		Convey("pinned cache isn't evicted when storage is full", func() {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:   config.CacheLevelOnlySearch,
+				CacheStorage: storage.NewMem(&storage.MemStoreConfig{MaxSize: 5}),
+			})
+			So(err, ShouldBeNil)
+
+			find(c, db.WithContext(cache.WithPinned(ctx)), 5)
+			for i := 10; i < 30; i++ {
+				find(c, db, i)
+			}
+			// eviction is done in background
+			time.Sleep(50 * time.Millisecond)
+			find(c, db, 5)
+			So(c.SearchHitCount(), ShouldEqual, 1)
+		})
+	})
+}
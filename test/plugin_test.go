@@ -0,0 +1,88 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+func TestGormConfigPlugins(t *testing.T) {
+	Convey("test cache registered through gorm config plugins", t, func() {
+		find := func(db *gorm.DB) {
+			for i := 0; i < 2; i++ {
+				models := make([]*TestModel, 0)
+				So(db.Where("value1 = ?", 1).Find(&models).Error, ShouldBeNil)
+				So(len(models), ShouldEqual, 1)
+			}
+		}
+
+		Convey("cache created by options", func() {
+			plugins, err := cache.Plugins(cache.WithCacheLevel(config.CacheLevelOnlySearch))
+			So(err, ShouldBeNil)
+			db, err := gorm.Open(originalDB.Dialector, &gorm.Config{Plugins: plugins})
+			So(err, ShouldBeNil)
+			find(db)
+			for name, plugin := range plugins {
+				So(db.Plugins[name], ShouldEqual, plugin)
+				So(plugin.(cache.Cache).SearchHitCount(), ShouldEqual, 1)
+			}
+		})
+
+		Convey("cache constructed as a struct literal is initialized lazily", func() {
+			c := &cache.Gorm2Cache{Config: &config.CacheConfig{
+				CacheLevel:   config.CacheLevelOnlySearch,
+				CacheStorage: storage.NewGcache(gcache.New(1000)),
+			}}
+			db, err := gorm.Open(originalDB.Dialector, &gorm.Config{Plugins: map[string]gorm.Plugin{"cache": c}})
+			So(err, ShouldBeNil)
+			So(c.InstanceId, ShouldNotBeEmpty)
+			find(db)
+			So(c.SearchHitCount(), ShouldEqual, 1)
+
+			// using it on another db doesn't initialize it again
+			instanceId := c.InstanceId
+			db, err = forkDB(originalDB)
+			So(err, ShouldBeNil)
+			So(db.Use(c), ShouldBeNil)
+			So(c.InstanceId, ShouldEqual, instanceId)
+		})
+
+		Convey("caches constructed as struct literals are used and detached by their own names", func() {
+			newCache := func() *cache.Gorm2Cache {
+				return &cache.Gorm2Cache{Config: &config.CacheConfig{
+					CacheLevel:   config.CacheLevelOnlySearch,
+					CacheStorage: storage.NewGcache(gcache.New(1000)),
+				}}
+			}
+			a, b := newCache(), newCache()
+			db, err := forkDB(originalDB)
+			So(err, ShouldBeNil)
+			So(db.Use(a), ShouldBeNil)
+			So(db.Use(b), ShouldBeNil)
+			So(a.Name(), ShouldNotEqual, b.Name())
+			So(db.Plugins[a.Name()], ShouldEqual, a)
+			So(db.Plugins[b.Name()], ShouldEqual, b)
+
+			So(a.DetachFromDB(db), ShouldBeNil)
+			_, ok := db.Plugins[a.Name()]
+			So(ok, ShouldBeFalse)
+			So(db.Plugins[b.Name()], ShouldEqual, b)
+			So(len(db.Plugins), ShouldEqual, 1)
+			find(db)
+			So(a.SearchHitCount(), ShouldEqual, 0)
+			So(b.SearchHitCount(), ShouldEqual, 1)
+		})
+
+		Convey("cache without config fails to open", func() {
+			_, err := gorm.Open(originalDB.Dialector, &gorm.Config{
+				Plugins: map[string]gorm.Plugin{"cache": &cache.Gorm2Cache{}},
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,49 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPopulateRetry(t *testing.T) {
+	Convey("test failed cache population is retried", t, func() {
+		ctx := context.Background()
+		chaos := storage.NewChaos(storage.NewGcache(gcache.New(1000)), &storage.ChaosConfig{ErrorRate: 1})
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlySearch,
+			CacheStorage: chaos,
+			PopulateRetry: &config.PopulateRetryPolicy{
+				Attempts: 3,
+				Delay:    50 * time.Millisecond,
+			},
+		})
+		So(err, ShouldBeNil)
+		gc := c.(*cache.Gorm2Cache)
+
+		models := make([]*TestModel, 0)
+		So(db.Where("value1 < ?", 3).Find(&models).Error, ShouldBeNil)
+		So(gc.Status(ctx).PopulateRetries, ShouldEqual, 1)
+
+		Convey("cache is populated once storage recovers", func() {
+			chaos.SetConfig(nil)
+			So(waitFor(func() bool { return gc.Status(ctx).AsyncQueueDepth == 0 }), ShouldBeTrue)
+			So(db.Where("value1 < ?", 3).Find(&models).Error, ShouldBeNil)
+			So(c.SearchHitCount(), ShouldEqual, 1)
+		})
+
+		Convey("retry is given up once the table is invalidated", func() {
+			chaos.SetConfig(nil)
+			So(gc.InvalidateSearchCache(ctx, TestModelTableName), ShouldBeNil)
+			So(waitFor(func() bool { return gc.Status(ctx).AsyncQueueDepth == 0 }), ShouldBeTrue)
+			So(db.Where("value1 < ?", 3).Find(&models).Error, ShouldBeNil)
+			So(c.SearchHitCount(), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,111 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+// prefixedStorage provides a key prefix for the storage it wraps
+type prefixedStorage struct {
+	*storage.Gcache
+	prefix string
+}
+
+func (s *prefixedStorage) KeyPrefix() string {
+	return s.prefix
+}
+
+func TestStorageKeyPrefix(t *testing.T) {
+	Convey("test key prefix provided by storage", t, func() {
+		s := &prefixedStorage{Gcache: storage.NewGcache(gcache.New(1000)), prefix: "myapp"}
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelAll,
+			CacheStorage: s,
+		})
+		So(err, ShouldBeNil)
+		So(c.(*cache.Gorm2Cache).Status(context.Background()).KeyPrefix, ShouldEqual, "myapp")
+
+		models := make([]*TestModel, 0)
+		result := db.Where("value1 = ?", 1).Find(&models)
+		So(result.Error, ShouldBeNil)
+
+		ctx := context.Background()
+		cnt, err := s.EntryCount(ctx, "myapp:s:"+TestModelTableName)
+		So(err, ShouldBeNil)
+		So(cnt, ShouldEqual, 1)
+		cnt, err = s.EntryCount(ctx, "myapp:p:"+TestModelTableName)
+		So(err, ShouldBeNil)
+		So(cnt, ShouldEqual, 1)
+	})
+}
+
+func TestConfigKeyPrefix(t *testing.T) {
+	Convey("test key prefix in config", t, func() {
+		s := storage.NewGcache(gcache.New(1000))
+		newCache := func() (cache.Cache, *gorm.DB) {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:            config.CacheLevelOnlySearch,
+				CacheStorage:          s,
+				KeyPrefix:             "myapp",
+				KeyPrefixWithInstance: true,
+			})
+			So(err, ShouldBeNil)
+			return c, db
+		}
+		c1, db1 := newCache()
+		c2, db2 := newCache()
+		prefix := c1.(*cache.Gorm2Cache).Status(context.Background()).KeyPrefix
+		So(prefix, ShouldEqual, "myapp:"+c1.(*cache.Gorm2Cache).InstanceId)
+
+		for _, db := range []*gorm.DB{db1, db2} {
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 = ?", 1).Find(&models)
+			So(result.Error, ShouldBeNil)
+		}
+		ctx := context.Background()
+		cnt, err := s.EntryCount(ctx, "myapp")
+		So(err, ShouldBeNil)
+		So(cnt, ShouldEqual, 2)
+
+		// resetting one cache keeps keys of the other
+		So(c1.ResetCache(), ShouldBeNil)
+		cnt, err = s.EntryCount(ctx, "myapp")
+		So(err, ShouldBeNil)
+		So(cnt, ShouldEqual, 1)
+		cnt, err = c2.(*cache.Gorm2Cache).TableKeyCount(ctx, TestModelTableName)
+		So(err, ShouldBeNil)
+		So(cnt, ShouldEqual, 1)
+	})
+}
+
+func TestRedisConfigKeyPrefix(t *testing.T) {
+	Convey("test key prefix in config is used by redis store without a prefix of its own", t, func() {
+		client, hook := newFakeRedisClient()
+		defer client.Close()
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelAll,
+			CacheStorage: storage.NewRedis(&storage.RedisStoreConfig{Client: client}),
+			KeyPrefix:    "myapp",
+		})
+		So(err, ShouldBeNil)
+		So(c.(*cache.Gorm2Cache).Status(context.Background()).KeyPrefix, ShouldEqual, "myapp")
+
+		models := make([]*TestModel, 0)
+		So(db.Where("value1 = ?", 1).Find(&models).Error, ShouldBeNil)
+		So(waitFor(func() bool { return len(hook.keys()) >= 2 }), ShouldBeTrue)
+		for _, key := range hook.keys() {
+			So(strings.HasPrefix(key, "myapp:"), ShouldBeTrue)
+		}
+
+		So(c.ResetCache(), ShouldBeNil)
+		So(hook.keys(), ShouldBeEmpty)
+	})
+}
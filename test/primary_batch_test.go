@@ -0,0 +1,58 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPrimaryCacheBatchSize(t *testing.T) {
+	Convey("test primary cache written in batches of PrimaryCacheBatchSize", t, func() {
+		ctx := context.Background()
+		s := &countingStorage{DataStorage: storage.NewGcache(gcache.New(1000))}
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:             config.CacheLevelAll,
+			CacheStorage:           s,
+			CacheTTL:               5000,
+			PrimaryCacheBatchSize:  3,
+			PrimaryCacheBatchPause: time.Millisecond,
+		})
+		So(err, ShouldBeNil)
+		gc := c.(*cache.Gorm2Cache)
+
+		Convey("a large result set is split into batches", func() {
+			models := make([]*TestModel, 0)
+			So(db.Where("id <= ?", 10).Find(&models).Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 10)
+			So(atomic.LoadInt64(&s.batchSets), ShouldEqual, 4)
+			exists, err := gc.BatchPrimaryKeyExists(ctx, TestModelTableName,
+				[]string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"})
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeTrue)
+		})
+
+		Convey("a result set within the batch size is written at once", func() {
+			models := make([]*TestModel, 0)
+			So(db.Where("id <= ?", 3).Find(&models).Error, ShouldBeNil)
+			So(atomic.LoadInt64(&s.batchSets), ShouldEqual, 1)
+		})
+
+		Convey("writing stops when ctx is done between batches", func() {
+			cancelCtx, cancel := context.WithCancel(ctx)
+			cancel()
+			kvs := []util.Kv{{Key: "1", Value: "{}"}, {Key: "2", Value: "{}"}, {Key: "3", Value: "{}"}, {Key: "4", Value: "{}"}}
+			err := gc.BatchSetPrimaryKeyCache(cancelCtx, TestModelTableName, kvs)
+			So(errors.Is(err, context.Canceled), ShouldBeTrue)
+			So(atomic.LoadInt64(&s.batchSets), ShouldEqual, 1)
+		})
+	})
+}
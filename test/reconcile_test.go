@@ -0,0 +1,70 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+func TestPrimaryKeysNotFound(t *testing.T) {
+	Convey("test primary keys looked up but not found", t, func() {
+		ctx := context.Background()
+		const missingID = 1000001
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelOnlyPrimary,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+			CacheTTL:             5000,
+		})
+		So(err, ShouldBeNil)
+		exists := func(primaryKeys ...string) bool {
+			ok, err := c.(*cache.Gorm2Cache).BatchPrimaryKeyExists(ctx, TestModelTableName, primaryKeys)
+			So(err, ShouldBeNil)
+			return ok
+		}
+
+		Convey("only rows found are served from primary cache", func() {
+			for i := 0; i < 2; i++ {
+				models := make([]*TestModel, 0)
+				So(db.Where("id IN (?)", []int64{1, 2, missingID}).Find(&models).Error, ShouldBeNil)
+				So(len(models), ShouldEqual, 2)
+				So(models[0].ID, ShouldEqual, 1)
+				So(models[1].ID, ShouldEqual, 2)
+			}
+			So(c.PrimaryHitCount(), ShouldEqual, 1)
+		})
+
+		Convey("not found results are served from primary cache", func() {
+			for i := 0; i < 2; i++ {
+				model := &TestModel{}
+				So(db.Where("id = ?", missingID).First(model).Error, ShouldEqual, gorm.ErrRecordNotFound)
+				models := make([]*TestModel, 0)
+				So(db.Where("id = ?", missingID).Find(&models).Error, ShouldBeNil)
+				So(len(models), ShouldEqual, 0)
+			}
+			So(c.PrimaryHitCount(), ShouldEqual, 3)
+
+			Convey("creating rows of the keys invalidates them", func() {
+				So(db.Create(&TestModel{ID: missingID, Value1: 1}).Error, ShouldBeNil)
+				defer originalDB.Delete(&TestModel{ID: missingID})
+				model := &TestModel{}
+				So(db.Where("id = ?", missingID).First(model).Error, ShouldBeNil)
+				So(model.ID, ShouldEqual, missingID)
+			})
+		})
+
+		Convey("keys aren't told missing when LIMIT cuts results short", func() {
+			models := make([]*TestModel, 0)
+			So(db.Where("id IN (?)", []int64{1, missingID}).Limit(1).Find(&models).Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 1)
+			So(exists("1"), ShouldBeTrue)
+			So(exists("1000001"), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,49 @@
+package test
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPanicRecovery(t *testing.T) {
+	Convey("test panic recovery in callbacks", t, func() {
+		var panicking int32
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelAll,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+			CacheTTL:             5000,
+			TableNameResolver: func(table string) string {
+				if atomic.LoadInt32(&panicking) == 1 {
+					panic("resolver broken")
+				}
+				return table
+			},
+		})
+		So(err, ShouldBeNil)
+
+		atomic.StoreInt32(&panicking, 1)
+		models := make([]*TestModel, 0)
+		result := db.Where("value1 = ?", 1).Find(&models)
+		So(result.Error, ShouldBeNil)
+		So(len(models), ShouldEqual, 1)
+		So(c.PanicCount(), ShouldEqual, 1)
+		So(c.BypassCount(), ShouldEqual, 0)
+
+		result = db.Model(&TestModel{}).Where("value1 = ?", 1).UpdateColumn("value1", 1)
+		So(result.Error, ShouldBeNil)
+		So(c.PanicCount(), ShouldEqual, 2)
+
+		atomic.StoreInt32(&panicking, 0)
+		models = make([]*TestModel, 0)
+		result = db.Where("value1 = ?", 1).Find(&models)
+		So(result.Error, ShouldBeNil)
+		So(len(models), ShouldEqual, 1)
+		So(c.MissCount(), ShouldEqual, 1)
+	})
+}
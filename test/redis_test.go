@@ -0,0 +1,277 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/redis/go-redis/v9"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// scriptLoadHook serves SCRIPT LOAD without a redis server, failing the first fails calls
+type scriptLoadHook struct {
+	fails int
+	loads int
+}
+
+func (h *scriptLoadHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *scriptLoadHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if cmd.Name() != "script" {
+			return next(ctx, cmd)
+		}
+		h.loads++
+		if h.loads <= h.fails {
+			err := errors.New("redis is loading the dataset in memory")
+			cmd.SetErr(err)
+			return err
+		}
+		cmd.(*redis.StringCmd).SetVal("sha")
+		return nil
+	}
+}
+
+func (h *scriptLoadHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+// fakeRedisHook serves the commands the redis store sends from memory, so that it's tested without a redis server.
+// Expiration isn't kept.
+type fakeRedisHook struct {
+	mu      sync.Mutex
+	data    map[string]string
+	scripts []string
+}
+
+func newFakeRedisClient() (*redis.Client, *fakeRedisHook) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	hook := &fakeRedisHook{data: make(map[string]string)}
+	client.AddHook(hook)
+	return client, hook
+}
+
+// keys returns stored keys in order
+func (h *fakeRedisHook) keys() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]string, 0, len(h.data))
+	for key := range h.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (h *fakeRedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *fakeRedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		return h.process(cmd)
+	}
+}
+
+func (h *fakeRedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		var firstErr error
+		for _, cmd := range cmds {
+			if err := h.process(cmd); err != nil && err != redis.Nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		return firstErr
+	}
+}
+
+func (h *fakeRedisHook) process(cmd redis.Cmder) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	args := make([]string, 0, len(cmd.Args()))
+	for _, arg := range cmd.Args() {
+		args = append(args, fmt.Sprint(arg))
+	}
+	exists := func(keys []string) int64 {
+		var n int64
+		for _, key := range keys {
+			if _, ok := h.data[key]; ok {
+				n++
+			}
+		}
+		return n
+	}
+	switch cmd.Name() {
+	case "script":
+		h.scripts = append(h.scripts, args[2])
+		cmd.(*redis.StringCmd).SetVal(fmt.Sprint(len(h.scripts) - 1))
+	case "evalsha":
+		var idx int
+		fmt.Sscan(args[1], &idx)
+		if strings.Contains(h.scripts[idx], "'del'") {
+			// the clean cache script deletes keys matching its argument
+			for key := range h.data {
+				if ok, _ := path.Match(args[len(args)-1], key); ok {
+					delete(h.data, key)
+				}
+			}
+			cmd.(*redis.Cmd).SetVal(int64(1))
+			break
+		}
+		// the batch exist script checks keys after the key count
+		keys := args[3:]
+		cmd.(*redis.Cmd).SetVal(map[bool]int64{true: 1, false: 0}[exists(keys) == int64(len(keys))])
+	case "exists":
+		cmd.(*redis.IntCmd).SetVal(exists(args[1:]))
+	case "get":
+		value, ok := h.data[args[1]]
+		if !ok {
+			cmd.SetErr(redis.Nil)
+			return redis.Nil
+		}
+		cmd.(*redis.StringCmd).SetVal(value)
+	case "mget":
+		values := make([]interface{}, 0, len(args)-1)
+		for _, key := range args[1:] {
+			if value, ok := h.data[key]; ok {
+				values = append(values, value)
+			} else {
+				values = append(values, nil)
+			}
+		}
+		cmd.(*redis.SliceCmd).SetVal(values)
+	case "set":
+		h.data[args[1]] = args[2]
+		cmd.(*redis.StatusCmd).SetVal("OK")
+	case "mset":
+		for i := 1; i+1 < len(args); i += 2 {
+			h.data[args[i]] = args[i+1]
+		}
+		cmd.(*redis.StatusCmd).SetVal("OK")
+	case "del":
+		n := exists(args[1:])
+		for _, key := range args[1:] {
+			delete(h.data, key)
+		}
+		cmd.(*redis.IntCmd).SetVal(n)
+	case "pexpire":
+		cmd.(*redis.BoolCmd).SetVal(exists(args[1:2]) == 1)
+	case "persist":
+		cmd.(*redis.BoolCmd).SetVal(false)
+	case "pttl":
+		cmd.(*redis.DurationCmd).SetVal(time.Duration(-1))
+	case "scan":
+		match := "*"
+		for i := 2; i+1 < len(args); i++ {
+			if strings.EqualFold(args[i], "match") {
+				match = args[i+1]
+			}
+		}
+		keys := make([]string, 0)
+		for key := range h.data {
+			if ok, _ := path.Match(match, key); ok {
+				keys = append(keys, key)
+			}
+		}
+		cmd.(*redis.ScanCmd).SetVal(keys, 0)
+	case "ping":
+		cmd.(*redis.StatusCmd).SetVal("PONG")
+	case "dbsize":
+		cmd.(*redis.IntCmd).SetVal(int64(len(h.data)))
+	default:
+		err := fmt.Errorf("command %s isn't supported by the fake redis", cmd.Name())
+		cmd.SetErr(err)
+		return err
+	}
+	return nil
+}
+
+// wrappedRedisClient is a client of its own type, which the redis store can't tell how keys are spread over nodes
+type wrappedRedisClient struct {
+	redis.UniversalClient
+}
+
+func TestRedisClients(t *testing.T) {
+	Convey("test clients the redis store supports", t, func() {
+		conf := &storage.Config{Logger: &util.DefaultLogger{}}
+
+		Convey("cluster clients don't load scripts, which can't reach keys on other nodes", func() {
+			// nothing listens on the address, so Init fails if it talks to the cluster
+			client := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{"127.0.0.1:1"}, MaxRetries: -1})
+			defer client.Close()
+			So(storage.NewRedis(&storage.RedisStoreConfig{UniversalClient: client}).Init(conf), ShouldBeNil)
+		})
+
+		Convey("clients of other types are rejected", func() {
+			client := &wrappedRedisClient{UniversalClient: redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})}
+			defer client.Close()
+			So(storage.NewRedis(&storage.RedisStoreConfig{UniversalClient: client}).Init(conf), ShouldNotBeNil)
+		})
+
+		Convey("keys of every node of a ring are iterated", func() {
+			hooks := make([]*fakeRedisHook, 0)
+			ring := redis.NewRing(&redis.RingOptions{
+				Addrs: map[string]string{"a": "127.0.0.1:1", "b": "127.0.0.1:2"},
+				NewClient: func(opt *redis.Options) *redis.Client {
+					client := redis.NewClient(opt)
+					hook := &fakeRedisHook{data: make(map[string]string)}
+					client.AddHook(hook)
+					hooks = append(hooks, hook)
+					return client
+				},
+			})
+			defer ring.Close()
+			s := storage.NewRedis(&storage.RedisStoreConfig{UniversalClient: ring})
+			So(s.Init(conf), ShouldBeNil)
+
+			ctx := context.Background()
+			kvs := make([]util.Kv, 0)
+			for i := 0; i < 20; i++ {
+				kvs = append(kvs, util.Kv{Key: fmt.Sprintf("app:%d", i), Value: "1"})
+			}
+			So(s.BatchSetKeys(ctx, kvs), ShouldBeNil)
+			So(len(hooks), ShouldEqual, 2)
+			for _, hook := range hooks {
+				So(hook.keys(), ShouldNotBeEmpty)
+			}
+
+			keys := make([]string, 0)
+			var cursor uint64
+			for {
+				page, next, err := s.Keys(ctx, "app", cursor, 3)
+				So(err, ShouldBeNil)
+				keys = append(keys, page...)
+				if next == 0 {
+					break
+				}
+				cursor = next
+			}
+			So(len(keys), ShouldEqual, 20)
+		})
+
+		Convey("init failing is retried", func() {
+			client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+			defer client.Close()
+			hook := &scriptLoadHook{fails: 1}
+			client.AddHook(hook)
+			s := storage.NewRedis(&storage.RedisStoreConfig{Client: client})
+			So(s.Init(conf), ShouldNotBeNil)
+			So(s.Init(conf), ShouldBeNil)
+			So(hook.loads, ShouldEqual, 3)
+			// it isn't initialized again once it succeeds
+			So(s.Init(conf), ShouldBeNil)
+			So(hook.loads, ShouldEqual, 3)
+		})
+	})
+}
@@ -0,0 +1,73 @@
+package test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+// prefixDeleteCountingStorage counts prefix deletions of the storage it wraps
+type prefixDeleteCountingStorage struct {
+	storage.DataStorage
+	prefixDeletes int64
+}
+
+func (s *prefixDeleteCountingStorage) DeleteKeysWithPrefix(ctx context.Context, keyPrefix string) error {
+	atomic.AddInt64(&s.prefixDeletes, 1)
+	return s.DataStorage.DeleteKeysWithPrefix(ctx, keyPrefix)
+}
+
+func TestDuplicateRegistration(t *testing.T) {
+	Convey("test registering the cache on a db more than once", t, func() {
+		run := func(register func(db *gorm.DB, attach func(db *gorm.DB))) (lookups uint64, prefixDeletes int64) {
+			s := &prefixDeleteCountingStorage{DataStorage: storage.NewGcache(gcache.New(1000))}
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:           config.CacheLevelOnlySearch,
+				CacheStorage:         s,
+				InvalidateWhenUpdate: true,
+			})
+			So(err, ShouldBeNil)
+			register(db, c.AttachToDB)
+
+			for i := 0; i < 3; i++ {
+				models := make([]*TestModel, 0)
+				So(db.Where("value1 = ?", 1).Find(&models).Error, ShouldBeNil)
+			}
+			So(db.Model(&TestModel{ID: 1}).Update("value2", 1).Error, ShouldBeNil)
+			return c.LookupCount(), atomic.LoadInt64(&s.prefixDeletes)
+		}
+
+		lookups, prefixDeletes := run(func(db *gorm.DB, attach func(db *gorm.DB)) {})
+		So(lookups, ShouldEqual, 3)
+
+		Convey("attaching again replaces callbacks", func() {
+			l, d := run(func(db *gorm.DB, attach func(db *gorm.DB)) {
+				attach(db)
+				attach(db)
+			})
+			So(l, ShouldEqual, lookups)
+			So(d, ShouldEqual, prefixDeletes)
+		})
+
+		Convey("using again is rejected by gorm and keeps callbacks", func() {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:   config.CacheLevelOnlySearch,
+				CacheStorage: storage.NewGcache(gcache.New(1000)),
+			})
+			So(err, ShouldBeNil)
+			So(db.Use(c), ShouldEqual, gorm.ErrRegistered)
+			for i := 0; i < 2; i++ {
+				models := make([]*TestModel, 0)
+				So(db.Where("value1 = ?", 1).Find(&models).Error, ShouldBeNil)
+			}
+			So(c.LookupCount(), ShouldEqual, 2)
+			So(c.SearchHitCount(), ShouldEqual, 1)
+		})
+	})
+}
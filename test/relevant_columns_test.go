@@ -0,0 +1,46 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCacheRelevantColumns(t *testing.T) {
+	Convey("test updates of cache irrelevant columns", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelAll,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+			CacheTTL:             5000,
+			CacheRelevantColumns: map[string][]string{TestModelTableName: {"value1"}},
+		})
+		So(err, ShouldBeNil)
+		find := func() []*TestModel {
+			models := make([]*TestModel, 0)
+			So(db.Where("value1 = ?", 1).Find(&models).Error, ShouldBeNil)
+			return models
+		}
+		So(len(find()), ShouldEqual, 1)
+
+		Convey("updates assigning only irrelevant columns keep cache", func() {
+			So(db.Model(&TestModel{ID: 1}).Update("value2", 10).Error, ShouldBeNil)
+			defer originalDB.Model(&TestModel{ID: 1}).Update("value2", 1)
+			So(db.Model(&TestModel{}).Where("id = ?", 1).Updates(map[string]interface{}{"value3": 10, "value4": 10}).Error,
+				ShouldBeNil)
+			defer originalDB.Model(&TestModel{}).Where("id = ?", 1).Updates(map[string]interface{}{"value3": 1, "value4": 1})
+			So(len(find()), ShouldEqual, 1)
+			So(c.SearchHitCount(), ShouldEqual, 1)
+		})
+
+		Convey("updates assigning relevant columns invalidate cache", func() {
+			So(db.Model(&TestModel{ID: 1}).Updates(map[string]interface{}{"value1": 100, "value2": 10}).Error, ShouldBeNil)
+			defer originalDB.Model(&TestModel{ID: 1}).Updates(map[string]interface{}{"value1": 1, "value2": 1})
+			So(len(find()), ShouldEqual, 0)
+			So(c.SearchHitCount(), ShouldEqual, 0)
+		})
+	})
+}
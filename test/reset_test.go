@@ -0,0 +1,39 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResetBarrier(t *testing.T) {
+	Convey("test reset barrier", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:         config.CacheLevelOnlySearch,
+			CacheStorage:       storage.NewGcache(gcache.New(1000)),
+			ResetBarrierWindow: 200,
+		})
+		So(err, ShouldBeNil)
+		So(c.ResetCache(), ShouldBeNil)
+
+		find := func() {
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 = ?", 1).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 1)
+		}
+
+		find()
+		find()
+		So(c.HitCount(), ShouldEqual, 0)
+
+		time.Sleep(250 * time.Millisecond)
+		find()
+		find()
+		So(c.HitCount(), ShouldEqual, 1)
+	})
+}
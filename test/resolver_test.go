@@ -0,0 +1,105 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTableNameResolver(t *testing.T) {
+	Convey("test table name resolver", t, func() {
+		shardTable := TestModelTableName + "_01"
+		err := originalDB.Table(shardTable).AutoMigrate(&TestModel{})
+		So(err, ShouldBeNil)
+		defer originalDB.Migrator().DropTable(shardTable)
+		err = originalDB.Table(shardTable).Create(&TestModel{ID: 1, Value1: 1}).Error
+		So(err, ShouldBeNil)
+
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelOnlySearch,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+			CacheTTL:             5000,
+			TableNameResolver: func(table string) string {
+				return strings.TrimSuffix(table, "_01")
+			},
+		})
+		So(err, ShouldBeNil)
+
+		find := func() {
+			models := make([]*TestModel, 0)
+			result := db.Table(shardTable).Where("value1 = ?", 1).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 1)
+		}
+
+		find()
+		find()
+		So(c.HitCount(), ShouldEqual, 1)
+
+		// writing to the logical table invalidates queries on its shards
+		result := db.Model(&TestModel{}).Where("id = ?", 1).Update("value9", "1")
+		So(result.Error, ShouldBeNil)
+
+		find()
+		So(c.HitCount(), ShouldEqual, 1)
+	})
+
+	Convey("test rows of shard tables with the same primary key are cached apart", t, func() {
+		shardTables := []string{TestModelTableName + "_01", TestModelTableName + "_02"}
+		for i, shardTable := range shardTables {
+			err := originalDB.Table(shardTable).AutoMigrate(&TestModel{})
+			So(err, ShouldBeNil)
+			defer originalDB.Migrator().DropTable(shardTable)
+			err = originalDB.Table(shardTable).Create(&TestModel{ID: 1, Value1: int64(i + 1)}).Error
+			So(err, ShouldBeNil)
+		}
+
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelOnlyPrimary,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+			CacheTTL:             5000,
+			TableNameResolver: func(table string) string {
+				return strings.TrimSuffix(strings.TrimSuffix(table, "_01"), "_02")
+			},
+		})
+		So(err, ShouldBeNil)
+
+		find := func() {
+			for i, shardTable := range shardTables {
+				model := &TestModel{}
+				So(db.Table(shardTable).Where("id = ?", 1).First(model).Error, ShouldBeNil)
+				So(model.Value1, ShouldEqual, i+1)
+			}
+		}
+
+		find()
+		So(waitFor(func() bool { find(); return c.PrimaryHitCount() >= 2 }), ShouldBeTrue)
+
+		// updating a row of one shard keeps primary cache of the other one
+		hits := c.PrimaryHitCount()
+		result := db.Table(shardTables[0]).Where("id = ?", 1).Update("value1", 3)
+		So(result.Error, ShouldBeNil)
+		model := &TestModel{}
+		So(db.Table(shardTables[0]).Where("id = ?", 1).First(model).Error, ShouldBeNil)
+		So(model.Value1, ShouldEqual, 3)
+		So(c.PrimaryHitCount(), ShouldEqual, hits)
+		So(db.Table(shardTables[1]).Where("id = ?", 1).First(model).Error, ShouldBeNil)
+		So(model.Value1, ShouldEqual, 2)
+		So(c.PrimaryHitCount(), ShouldEqual, hits+1)
+
+		// invalidating the logical table invalidates rows of its shards
+		So(originalDB.Table(shardTables[1]).Where("id = ?", 1).Update("value1", 4).Error, ShouldBeNil)
+		So(c.(*cache.Gorm2Cache).InvalidateAllPrimaryCache(context.Background(), TestModelTableName), ShouldBeNil)
+		So(db.Table(shardTables[1]).Where("id = ?", 1).First(model).Error, ShouldBeNil)
+		So(model.Value1, ShouldEqual, 4)
+		So(c.PrimaryHitCount(), ShouldEqual, hits+1)
+	})
+}
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var errFlaky = errors.New("flaky storage error")
+
+// flakyStorage fails the next failures reads and writes of values
+type flakyStorage struct {
+	*storage.Gcache
+	failures int64
+}
+
+func (s *flakyStorage) fail() bool {
+	return atomic.AddInt64(&s.failures, -1) >= 0
+}
+
+func (s *flakyStorage) GetValue(ctx context.Context, key string) (string, error) {
+	if s.fail() {
+		return "", errFlaky
+	}
+	return s.Gcache.GetValue(ctx, key)
+}
+
+func (s *flakyStorage) SetKey(ctx context.Context, kv util.Kv) error {
+	if s.fail() {
+		return errFlaky
+	}
+	return s.Gcache.SetKey(ctx, kv)
+}
+
+func TestStorageRetry(t *testing.T) {
+	Convey("test storage retry", t, func() {
+		s := &flakyStorage{Gcache: storage.NewGcache(gcache.New(1000))}
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlySearch,
+			CacheStorage: s,
+			StorageRetry: &config.RetryPolicy{Attempts: 3, Backoff: time.Millisecond},
+		})
+		So(err, ShouldBeNil)
+
+		find := func() {
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 = ?", 1).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 1)
+		}
+
+		// the lookup isn't retried, while setting cache is retried twice
+		atomic.StoreInt64(&s.failures, 3)
+		find()
+		So(atomic.LoadInt64(&s.failures), ShouldBeLessThan, 0)
+		find()
+		So(c.HitCount(), ShouldEqual, 1)
+
+		// reads are retried if allowed
+		c.(*cache.Gorm2Cache).Config.StorageRetry.RetryReads = true
+		atomic.StoreInt64(&s.failures, 2)
+		find()
+		So(c.HitCount(), ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,125 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// downStorage fails to initialize
+type downStorage struct {
+	*storage.Gcache
+}
+
+func (s *downStorage) Init(conf *storage.Config) error {
+	return errors.New("storage is down")
+}
+
+func TestStorageRouter(t *testing.T) {
+	Convey("test storage router", t, func() {
+		err := originalDB.AutoMigrate(&testModelTag{})
+		So(err, ShouldBeNil)
+		defer originalDB.Migrator().DropTable(&testModelTag{})
+		err = originalDB.Create(&testModelTag{ModelID: 1, Tag: "a"}).Error
+		So(err, ShouldBeNil)
+
+		defaultStorage := storage.NewGcache(gcache.New(1000))
+		tagStorage := storage.NewGcache(gcache.New(1000))
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlySearch,
+			CacheStorage: defaultStorage,
+			StorageRouter: func(tableName string) storage.DataStorage {
+				if tableName == testModelTagTableName {
+					return tagStorage
+				}
+				return nil
+			},
+		})
+		So(err, ShouldBeNil)
+		instanceId := c.(*cache.Gorm2Cache).InstanceId
+
+		for i := 0; i < 2; i++ {
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 = ?", 1).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 1)
+
+			tags := make([]*testModelTag, 0)
+			result = db.Where("model_id = ?", 1).Find(&tags)
+			So(result.Error, ShouldBeNil)
+			So(len(tags), ShouldEqual, 1)
+		}
+		So(c.HitCount(), ShouldEqual, 2)
+
+		ctx := context.Background()
+		count := func(s *storage.Gcache, tableName string) int64 {
+			cnt, err := s.EntryCount(ctx, util.GenSearchCachePrefix(util.GenKeyPrefix(instanceId), tableName))
+			So(err, ShouldBeNil)
+			return cnt
+		}
+		So(count(defaultStorage, TestModelTableName), ShouldEqual, 1)
+		So(count(defaultStorage, testModelTagTableName), ShouldEqual, 0)
+		So(count(tagStorage, TestModelTableName), ShouldEqual, 0)
+		So(count(tagStorage, testModelTagTableName), ShouldEqual, 1)
+
+		So(c.ResetCache(), ShouldBeNil)
+		So(count(defaultStorage, TestModelTableName), ShouldEqual, 0)
+		So(count(tagStorage, testModelTagTableName), ShouldEqual, 0)
+	})
+}
+
+func TestStorageRouterUnavailable(t *testing.T) {
+	Convey("test tables routed to a storage failing to initialize", t, func() {
+		err := originalDB.AutoMigrate(&testModelTag{})
+		So(err, ShouldBeNil)
+		defer originalDB.Migrator().DropTable(&testModelTag{})
+		err = originalDB.Create(&testModelTag{ModelID: 1, Tag: "a"}).Error
+		So(err, ShouldBeNil)
+
+		defaultStorage := storage.NewGcache(gcache.New(1000))
+		conf := func(tables []string) *config.CacheConfig {
+			return &config.CacheConfig{
+				CacheLevel:   config.CacheLevelOnlySearch,
+				CacheStorage: defaultStorage,
+				Tables:       tables,
+				StorageRouter: func(tableName string) storage.DataStorage {
+					if tableName == testModelTagTableName {
+						return &downStorage{Gcache: storage.NewGcache(gcache.New(1000))}
+					}
+					return nil
+				},
+			}
+		}
+
+		Convey("init fails if the table is named in config", func() {
+			_, err := cache.NewGorm2Cache(conf([]string{TestModelTableName, testModelTagTableName}))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("the table is uncached instead of cached in CacheStorage", func() {
+			c, db, err := newCachedDB(conf(nil))
+			So(err, ShouldBeNil)
+			for i := 0; i < 2; i++ {
+				tags := make([]*testModelTag, 0)
+				result := db.Where("model_id = ?", 1).Find(&tags)
+				So(result.Error, ShouldBeNil)
+				So(len(tags), ShouldEqual, 1)
+			}
+			So(c.HitCount(), ShouldEqual, 0)
+			cnt, err := defaultStorage.EntryCount(context.Background(),
+				util.GenSearchCachePrefix(util.GenKeyPrefix(c.(*cache.Gorm2Cache).InstanceId), testModelTagTableName))
+			So(err, ShouldBeNil)
+			So(cnt, ShouldEqual, 0)
+
+			// writes fail to invalidate the table, which is logged, but succeed
+			So(db.Where("model_id = ?", 1).Delete(&testModelTag{}).Error, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,61 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testModelWithExtra struct {
+	TestModel
+	Extra int64 `gorm:"column:extra;default:7"`
+}
+
+func TestAlteredTables(t *testing.T) {
+	Convey("test altered tables extraction", t, func() {
+		So(util.GetAlteredTables("ALTER TABLE `users` ADD `age` bigint"), ShouldResemble, []string{"users"})
+		So(util.GetAlteredTables("DROP TABLE IF EXISTS \"a\", db.b CASCADE"), ShouldResemble, []string{"a", "b"})
+		So(util.GetAlteredTables("/* migrate */ TRUNCATE TABLE users"), ShouldResemble, []string{"users"})
+		So(util.GetAlteredTables("SELECT * FROM users"), ShouldBeNil)
+	})
+}
+
+func TestSchemaChangeInvalidation(t *testing.T) {
+	Convey("test schema change invalidation", t, func() {
+		schemaTable := TestModelTableName + "_schema"
+		err := originalDB.Table(schemaTable).AutoMigrate(&TestModel{})
+		So(err, ShouldBeNil)
+		defer originalDB.Migrator().DropTable(schemaTable)
+		err = originalDB.Table(schemaTable).Create(&TestModel{ID: 1, Value1: 1}).Error
+		So(err, ShouldBeNil)
+
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlySearch,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+			CacheTTL:     5000,
+		})
+		So(err, ShouldBeNil)
+
+		find := func() []*testModelWithExtra {
+			models := make([]*testModelWithExtra, 0)
+			result := db.Table(schemaTable).Where("value1 = ?", 1).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 1)
+			return models
+		}
+		So(find()[0].Extra, ShouldEqual, 0)
+		So(c.HitCount(), ShouldEqual, 0)
+		So(find()[0].Extra, ShouldEqual, 0)
+		So(c.HitCount(), ShouldEqual, 1)
+
+		// migration adds the column, results cached before it are purged
+		err = db.Table(schemaTable).AutoMigrate(&testModelWithExtra{})
+		So(err, ShouldBeNil)
+		So(find()[0].Extra, ShouldEqual, 7)
+		So(c.HitCount(), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,88 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type valueResult struct {
+	ID     int64 `gorm:"column:id"`
+	Value1 int64 `gorm:"column:value1"`
+}
+
+func TestSchemalessQuery(t *testing.T) {
+	Convey("test queries of tables without their model", t, func() {
+		ctx := context.Background()
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelAll,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+			CacheTTL:             5000,
+		})
+		So(err, ShouldBeNil)
+
+		Convey("maps are served from search cache", func() {
+			for i := 0; i < 2; i++ {
+				rows := make([]map[string]interface{}, 0)
+				So(db.Table(TestModelTableName).Where("value1 = ?", 1).Find(&rows).Error, ShouldBeNil)
+				So(len(rows), ShouldEqual, 1)
+			}
+			So(c.SearchHitCount(), ShouldEqual, 1)
+		})
+
+		Convey("pluck is served from search cache", func() {
+			for i := 0; i < 2; i++ {
+				var values []string
+				So(db.Table(TestModelTableName).Where("id IN (?)", []int64{1, 2}).Pluck("value9", &values).Error,
+					ShouldBeNil)
+				So(values, ShouldResemble, []string{"1", "2"})
+			}
+			So(c.SearchHitCount(), ShouldEqual, 1)
+		})
+
+		Convey("rows scanned into another struct are keyed by the table", func() {
+			find := func() []*valueResult {
+				results := make([]*valueResult, 0)
+				So(db.Table(TestModelTableName).Where("id IN (?)", []int64{1, 2}).Find(&results).Error, ShouldBeNil)
+				return results
+			}
+			So(len(find()), ShouldEqual, 2)
+			So(len(find()), ShouldEqual, 2)
+			So(c.SearchHitCount(), ShouldEqual, 1)
+			So(c.PrimaryHitCount(), ShouldEqual, 0)
+
+			// they aren't cached as rows of the struct's own table
+			exists, err := c.(*cache.Gorm2Cache).BatchPrimaryKeyExists(ctx, "value_results", []string{"1"})
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeFalse)
+
+			// writes of the table invalidate them
+			So(db.Model(&TestModel{ID: 1}).Update("value1", 100).Error, ShouldBeNil)
+			defer originalDB.Model(&TestModel{ID: 1}).Update("value1", 1)
+			results := find()
+			So(c.SearchHitCount(), ShouldEqual, 1)
+			So(results[0].Value1, ShouldEqual, 100)
+		})
+
+		Convey("they always query the database in bypass mode", func() {
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:          config.CacheLevelAll,
+				CacheStorage:        storage.NewGcache(gcache.New(1000)),
+				SchemalessQueryMode: config.SchemalessBypass,
+			})
+			So(err, ShouldBeNil)
+			for i := 0; i < 2; i++ {
+				var values []string
+				So(db.Table(TestModelTableName).Where("id = ?", 1).Pluck("value9", &values).Error, ShouldBeNil)
+				So(values, ShouldResemble, []string{"1"})
+			}
+			So(c.HitCount(), ShouldEqual, 0)
+		})
+	})
+}
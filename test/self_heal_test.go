@@ -0,0 +1,110 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// keyRecordingStorage records keys written to the storage it wraps, so that tests can overwrite their values
+type keyRecordingStorage struct {
+	storage.DataStorage
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+func (s *keyRecordingStorage) record(kvs ...util.Kv) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil {
+		s.keys = make(map[string]struct{})
+	}
+	for _, kv := range kvs {
+		s.keys[kv.Key] = struct{}{}
+	}
+}
+
+func (s *keyRecordingStorage) SetKey(ctx context.Context, kv util.Kv) error {
+	s.record(kv)
+	return s.DataStorage.SetKey(ctx, kv)
+}
+
+func (s *keyRecordingStorage) BatchSetKeys(ctx context.Context, kvs []util.Kv) error {
+	s.record(kvs...)
+	return s.DataStorage.BatchSetKeys(ctx, kvs)
+}
+
+// poison overwrites values of written keys matching match with value, it returns count of keys overwritten
+func (s *keyRecordingStorage) poison(match func(key string) bool, value string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for key := range s.keys {
+		if match(key) {
+			_ = s.DataStorage.SetKey(context.Background(), util.Kv{Key: key, Value: value})
+			count++
+		}
+	}
+	return count
+}
+
+func TestSelfHealing(t *testing.T) {
+	Convey("test entries which can't be unmarshaled are evicted and the query reads the database", t, func() {
+		newDB := func(level config.CacheLevel) (*cache.Gorm2Cache, *keyRecordingStorage, func() []*TestModel) {
+			s := &keyRecordingStorage{DataStorage: storage.NewGcache(gcache.New(1000))}
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:   level,
+				CacheStorage: s,
+				CacheTTL:     5000,
+			})
+			So(err, ShouldBeNil)
+			return c.(*cache.Gorm2Cache), s, func() []*TestModel {
+				models := make([]*TestModel, 0)
+				So(db.Where("id IN (?)", []int64{1, 2, 3}).Find(&models).Error, ShouldBeNil)
+				So(len(models), ShouldEqual, 3)
+				for i, m := range models {
+					So(m.ID, ShouldEqual, i+1)
+				}
+				return models
+			}
+		}
+
+		Convey("only the offending primary key is evicted", func() {
+			c, s, find := newDB(config.CacheLevelOnlyPrimary)
+			find()
+			So(waitFor(func() bool { find(); return c.PrimaryHitCount() > 0 }), ShouldBeTrue)
+
+			So(s.poison(func(key string) bool { return strings.HasSuffix(key, ":p:"+TestModelTableName+":2") },
+				`{"id":"two"}`), ShouldEqual, 1)
+			hits := c.PrimaryHitCount()
+			find()
+			So(c.PrimaryHitCount(), ShouldEqual, hits)
+			So(c.CorruptCount(), ShouldEqual, 1)
+
+			// the result is cached again and served from cache
+			So(waitFor(func() bool { find(); return c.PrimaryHitCount() > hits }), ShouldBeTrue)
+		})
+
+		Convey("the offending search cache key is evicted", func() {
+			c, s, find := newDB(config.CacheLevelOnlySearch)
+			find()
+			So(waitFor(func() bool { find(); return c.SearchHitCount() > 0 }), ShouldBeTrue)
+
+			So(s.poison(func(key string) bool { return !strings.Contains(key, ":p:") }, "3|[{"), ShouldBeGreaterThan, 0)
+			hits := c.SearchHitCount()
+			find()
+			So(c.SearchHitCount(), ShouldEqual, hits)
+			So(c.CorruptCount(), ShouldBeGreaterThan, 0)
+
+			So(waitFor(func() bool { find(); return c.SearchHitCount() > hits }), ShouldBeTrue)
+		})
+	})
+}
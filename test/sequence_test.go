@@ -0,0 +1,62 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+func TestInvalidationDuringQuery(t *testing.T) {
+	Convey("test invalidation during query", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelAll,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+		})
+		So(err, ShouldBeNil)
+		gc := c.(*cache.Gorm2Cache)
+
+		invalidate := true
+		// invalidates the table after the query read database but before its result is cached
+		err = db.Callback().Query().After("gorm:query").Before(gc.CallbackName("after_query")).
+			Register("test:invalidate", func(db *gorm.DB) {
+				if !invalidate {
+					return
+				}
+				So(gc.InvalidateAllPrimaryCache(context.Background(), TestModelTableName), ShouldBeNil)
+				So(gc.InvalidateSearchCache(context.Background(), TestModelTableName), ShouldBeNil)
+			})
+		So(err, ShouldBeNil)
+
+		models := make([]*TestModel, 0)
+		result := db.Where("value1 = ?", 1).Find(&models)
+		So(result.Error, ShouldBeNil)
+		So(len(models), ShouldEqual, 1)
+
+		model := new(TestModel)
+		result = db.Where("id = ?", 1).First(model)
+		So(result.Error, ShouldBeNil)
+
+		invalidate = false
+		model = new(TestModel)
+		result = db.Where("id = ?", 1).First(model)
+		So(result.Error, ShouldBeNil)
+		So(c.HitCount(), ShouldEqual, 0)
+		models = make([]*TestModel, 0)
+		result = db.Where("value1 = ?", 1).Find(&models)
+		So(result.Error, ShouldBeNil)
+		So(c.HitCount(), ShouldEqual, 0)
+
+		// results of queries without invalidation are cached as usual
+		models = make([]*TestModel, 0)
+		result = db.Where("value1 = ?", 1).Find(&models)
+		So(result.Error, ShouldBeNil)
+		So(c.HitCount(), ShouldEqual, 1)
+	})
+}
@@ -163,3 +163,16 @@ func forkDB(db *gorm.DB) (newDB *gorm.DB, err error) {
 	})
 	return
 }
+
+// newCachedDB forks the original db and attaches a newly created cache with given config
+func newCachedDB(conf *config.CacheConfig) (cache.Cache, *gorm.DB, error) {
+	db, err := forkDB(originalDB)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := cache.NewGorm2Cache(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, db, db.Use(c)
+}
@@ -0,0 +1,53 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestShadowMode(t *testing.T) {
+	Convey("test shadow mode", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelAll,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+			ShadowMode:   true,
+		})
+		So(err, ShouldBeNil)
+
+		model := new(TestModel)
+		result := db.Where("id = ?", 1).First(model)
+		So(result.Error, ShouldBeNil)
+		oldValue := model.Value1
+		So(c.HitCount(), ShouldEqual, 0)
+
+		model = new(TestModel)
+		result = db.Where("id = ?", 1).First(model)
+		So(result.Error, ShouldBeNil)
+		So(c.HitCount(), ShouldEqual, 1)
+		So(c.ShadowMismatchCount(), ShouldEqual, 0)
+
+		// updated behind the cache, the would-be hit is outdated but the result comes from database
+		result = originalDB.Model(&TestModel{}).Where("id = ?", 1).UpdateColumn("value1", oldValue+1)
+		So(result.Error, ShouldBeNil)
+		defer originalDB.Model(&TestModel{}).Where("id = ?", 1).UpdateColumn("value1", oldValue)
+
+		model = new(TestModel)
+		result = db.Where("id = ?", 1).First(model)
+		So(result.Error, ShouldBeNil)
+		So(model.Value1, ShouldEqual, oldValue+1)
+		So(c.HitCount(), ShouldEqual, 2)
+		So(c.ShadowMismatchCount(), ShouldEqual, 1)
+
+		// record not found is compared too
+		result = db.Where("id = ?", -1).First(new(TestModel))
+		So(result.Error, ShouldNotBeNil)
+		result = db.Where("id = ?", -1).First(new(TestModel))
+		So(result.Error, ShouldNotBeNil)
+		So(c.HitCount(), ShouldEqual, 3)
+		So(c.ShadowMismatchCount(), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,164 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+type blockKey struct{}
+
+// blockQuery registers a callback which blocks queries with blockKey in context until the channel is closed
+func blockQuery(c cache.Cache, db *gorm.DB) error {
+	return db.Callback().Query().Before("gorm:query").After(c.(*cache.Gorm2Cache).CallbackName("before_query")).
+		Register("test:block", func(db *gorm.DB) {
+			if ch, ok := db.Statement.Context.Value(blockKey{}).(chan struct{}); ok {
+				<-ch
+			}
+		})
+}
+
+func waitFor(cond func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestSingleFlightCap(t *testing.T) {
+	Convey("test single flight cap", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:          config.CacheLevelOnlySearch,
+			CacheStorage:        storage.NewGcache(gcache.New(1000)),
+			CacheTTL:            5000,
+			MaxSingleFlightKeys: 1,
+		})
+		So(err, ShouldBeNil)
+		So(blockQuery(c, db), ShouldBeNil)
+
+		ch := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			models := make([]*TestModel, 0)
+			done <- db.WithContext(context.WithValue(context.Background(), blockKey{}, ch)).
+				Where("value1 = ?", 1).Find(&models).Error
+		}()
+		So(waitFor(func() bool { return c.SingleFlightSize() == 1 }), ShouldBeTrue)
+
+		models := make([]*TestModel, 0)
+		result := db.Where("value1 = ?", 2).Find(&models)
+		So(result.Error, ShouldBeNil)
+		So(len(models), ShouldEqual, 1)
+		So(c.SingleFlightOverflowCount(), ShouldEqual, 1)
+
+		close(ch)
+		So(<-done, ShouldBeNil)
+		So(c.SingleFlightSize(), ShouldEqual, 0)
+	})
+}
+
+// blockingStorage blocks reads of the storage it wraps with blockKey in context until the channel is closed
+type blockingStorage struct {
+	storage.DataStorage
+}
+
+func (s *blockingStorage) GetValue(ctx context.Context, key string) (string, error) {
+	if ch, ok := ctx.Value(blockKey{}).(chan struct{}); ok {
+		<-ch
+	}
+	return s.DataStorage.GetValue(ctx, key)
+}
+
+func TestSingleFlightAfterLookup(t *testing.T) {
+	Convey("test cache hits don't join single flight", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlySearch,
+			CacheStorage: &blockingStorage{DataStorage: storage.NewGcache(gcache.New(1000))},
+			CacheTTL:     5000,
+		})
+		So(err, ShouldBeNil)
+		models := make([]*TestModel, 0)
+		So(db.Where("value1 = ?", 1).Find(&models).Error, ShouldBeNil)
+
+		ch := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			models := make([]*TestModel, 0)
+			done <- db.WithContext(context.WithValue(context.Background(), blockKey{}, ch)).
+				Where("value1 = ?", 1).Find(&models).Error
+		}()
+		// the query is looking up cache, it hasn't registered a single flight call
+		time.Sleep(50 * time.Millisecond)
+		So(c.SingleFlightSize(), ShouldEqual, 0)
+
+		close(ch)
+		So(<-done, ShouldBeNil)
+		So(c.SearchHitCount(), ShouldEqual, 1)
+		So(c.SingleFlightSize(), ShouldEqual, 0)
+	})
+}
+
+var marshalCount int64
+
+type testModelMarshalCounted struct {
+	ID     int64 `gorm:"column:id;primaryKey"`
+	Value1 int64 `gorm:"column:value1"`
+}
+
+func (testModelMarshalCounted) TableName() string {
+	return TestModelTableName
+}
+
+func (m testModelMarshalCounted) MarshalJSON() ([]byte, error) {
+	atomic.AddInt64(&marshalCount, 1)
+	type plain testModelMarshalCounted
+	return json.Marshal(plain(m))
+}
+
+func TestSingleFlightPayload(t *testing.T) {
+	Convey("test results of single flight are marshaled once", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelOnlySearch,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+			CacheTTL:     5000,
+		})
+		So(err, ShouldBeNil)
+		So(blockQuery(c, db), ShouldBeNil)
+		atomic.StoreInt64(&marshalCount, 0)
+
+		ch := make(chan struct{})
+		done := make(chan []testModelMarshalCounted, 3)
+		find := func(ctx context.Context) {
+			models := make([]testModelMarshalCounted, 0)
+			if err := db.WithContext(ctx).Where("value1 = ?", 1).Find(&models).Error; err != nil {
+				models = nil
+			}
+			done <- models
+		}
+		go find(context.WithValue(context.Background(), blockKey{}, ch))
+		So(waitFor(func() bool { return c.SingleFlightSize() == 1 }), ShouldBeTrue)
+		go find(context.Background())
+		go find(context.Background())
+		time.Sleep(50 * time.Millisecond)
+		close(ch)
+
+		for i := 0; i < 3; i++ {
+			models := <-done
+			So(models, ShouldResemble, []testModelMarshalCounted{{ID: 1, Value1: 1}})
+		}
+		So(c.SingleFlightHitCount(), ShouldEqual, 2)
+		So(atomic.LoadInt64(&marshalCount), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,69 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStatsSnapshot(t *testing.T) {
+	Convey("test stats snapshot", t, func() {
+		ctx := context.Background()
+		s := storage.NewGcache(gcache.New(1000))
+		conf := func() *config.CacheConfig {
+			return &config.CacheConfig{
+				CacheLevel:            config.CacheLevelOnlySearch,
+				CacheStorage:          s,
+				CacheTTL:              50,
+				KeyPrefix:             "test_stats",
+				StatsSnapshotKey:      "test:stats",
+				StatsSnapshotInterval: 3600000,
+			}
+		}
+		c, db, err := newCachedDB(conf())
+		So(err, ShouldBeNil)
+		for i := 0; i < 2; i++ {
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 = ?", 1).Find(&models)
+			So(result.Error, ShouldBeNil)
+		}
+		So(c.(*cache.Gorm2Cache).SaveStats(ctx), ShouldBeNil)
+
+		// the snapshot is namespaced under the key prefix and outlives CacheTTL
+		exists, err := s.KeyExists(ctx, util.GenStatsSnapshotKey("test_stats", "test:stats"))
+		So(err, ShouldBeNil)
+		So(exists, ShouldBeTrue)
+		time.Sleep(100 * time.Millisecond)
+
+		// stats are loaded by the instance which replaces c after restart
+		restarted, err := cache.NewGorm2Cache(conf())
+		So(err, ShouldBeNil)
+		So(restarted.HitCount(), ShouldEqual, 1)
+		So(restarted.MissCount(), ShouldEqual, 1)
+		So(restarted.SearchHitCount(), ShouldEqual, 1)
+		So(restarted.PayloadSizeHistogram().Count, ShouldEqual, 1)
+
+		// Close saves stats a last time
+		restarted.(*cache.Gorm2Cache).IncrHitCount()
+		So(restarted.Close(), ShouldBeNil)
+		So(restarted.Close(), ShouldBeNil)
+		restarted, err = cache.NewGorm2Cache(conf())
+		So(err, ShouldBeNil)
+		So(restarted.HitCount(), ShouldEqual, 2)
+
+		So(restarted.ResetStats(), ShouldBeNil)
+		So(restarted.HitCount(), ShouldEqual, 0)
+		restarted, err = cache.NewGorm2Cache(conf())
+		So(err, ShouldBeNil)
+		So(restarted.HitCount(), ShouldEqual, 0)
+		So(restarted.LookupCount(), ShouldEqual, 0)
+		So(restarted.Close(), ShouldBeNil)
+	})
+}
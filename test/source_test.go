@@ -0,0 +1,63 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSource(t *testing.T) {
+	Convey("test where results of queries come from", t, func() {
+		Convey("nothing is recorded without WithSource", func() {
+			So(cache.SourceFromCtx(context.Background()), ShouldEqual, cache.SourceUnknown)
+			So(cache.SourceFromCtx(cache.WithSource(context.Background())), ShouldEqual, cache.SourceUnknown)
+		})
+
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelAll,
+			CacheStorage: storage.NewGcache(gcache.New(1000)),
+			CacheTTL:     5000,
+		})
+		So(err, ShouldBeNil)
+		gc := c.(*cache.Gorm2Cache)
+		ctx := cache.WithSource(context.Background())
+
+		Convey("search cache", func() {
+			models := make([]*TestModel, 0)
+			tx := db.WithContext(ctx).Where("id <= ?", 3).Find(&models)
+			So(tx.Error, ShouldBeNil)
+			So(cache.SourceFromCtx(ctx), ShouldEqual, cache.SourceDatabase)
+			So(gc.SourceOf(tx), ShouldEqual, cache.SourceDatabase)
+			So(cache.SourceFromCtx(ctx).FromCache(), ShouldBeFalse)
+
+			tx = db.WithContext(ctx).Where("id <= ?", 3).Find(&models)
+			So(tx.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 3)
+			So(cache.SourceFromCtx(ctx), ShouldEqual, cache.SourceSearchCache)
+			So(gc.SourceOf(tx), ShouldEqual, cache.SourceSearchCache)
+			So(cache.SourceFromCtx(ctx).FromCache(), ShouldBeTrue)
+		})
+
+		Convey("primary cache", func() {
+			model := &TestModel{}
+			So(db.WithContext(ctx).Where("id IN ?", []int{1, 2}).Find(&[]*TestModel{}).Error, ShouldBeNil)
+			So(cache.SourceFromCtx(ctx), ShouldEqual, cache.SourceDatabase)
+
+			So(db.WithContext(ctx).Where("id = ?", 1).First(model).Error, ShouldBeNil)
+			So(model.ID, ShouldEqual, 1)
+			So(cache.SourceFromCtx(ctx), ShouldEqual, cache.SourcePrimaryCache)
+		})
+
+		Convey("queries bypassing cache are served by the database", func() {
+			var cnt int64
+			tx := db.WithContext(ctx).Model(&TestModel{}).Where("id <= ?", 3).Count(&cnt)
+			So(tx.Error, ShouldBeNil)
+			So(cache.SourceFromCtx(ctx), ShouldEqual, cache.SourceDatabase)
+		})
+	})
+}
@@ -0,0 +1,130 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type testModelStale struct {
+	ID     int64 `gorm:"primaryKey"`
+	Value1 int64
+}
+
+const testModelStaleTableName = TestModelTableName + "_stale"
+
+func (testModelStale) TableName() string {
+	return testModelStaleTableName
+}
+
+func TestServeStaleOnError(t *testing.T) {
+	Convey("test serve stale on database error", t, func() {
+		newCache := func(tables []string, s ...storage.DataStorage) (cache.Cache, func() ([]*testModelStale, error)) {
+			if len(s) == 0 {
+				s = append(s, storage.NewGcache(gcache.New(1000)))
+			}
+			err := originalDB.AutoMigrate(&testModelStale{})
+			So(err, ShouldBeNil)
+			err = originalDB.Create([]*testModelStale{{ID: 1, Value1: 1}, {ID: 2, Value1: 1}}).Error
+			So(err, ShouldBeNil)
+
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:              config.CacheLevelOnlySearch,
+				CacheStorage:            s[0],
+				CacheTTL:                100,
+				StaleGracePeriod:        5000,
+				ServeStaleOnErrorTables: tables,
+			})
+			So(err, ShouldBeNil)
+			return c, func() ([]*testModelStale, error) {
+				models := make([]*testModelStale, 0)
+				err := db.Where("value1 = ?", 1).Find(&models).Error
+				return models, err
+			}
+		}
+
+		Convey("designated tables serve the last result", func() {
+			c, find := newCache([]string{testModelStaleTableName})
+			models, err := find()
+			So(err, ShouldBeNil)
+			So(len(models), ShouldEqual, 2)
+
+			// the search cache expires and the database fails
+			time.Sleep(200 * time.Millisecond)
+			So(originalDB.Migrator().DropTable(&testModelStale{}), ShouldBeNil)
+
+			models, err = find()
+			So(err, ShouldBeNil)
+			So(len(models), ShouldEqual, 2)
+			So(models[0].ID, ShouldEqual, 1)
+			So(c.(*cache.Gorm2Cache).StaleServeCount(), ShouldEqual, 1)
+		})
+
+		Convey("storages retaining expired cache serve it", func() {
+			c, find := newCache([]string{testModelStaleTableName}, storage.NewMem())
+			_, err := find()
+			So(err, ShouldBeNil)
+
+			time.Sleep(200 * time.Millisecond)
+			So(originalDB.Migrator().DropTable(&testModelStale{}), ShouldBeNil)
+
+			models, err := find()
+			So(err, ShouldBeNil)
+			So(len(models), ShouldEqual, 2)
+			So(c.(*cache.Gorm2Cache).StaleServeCount(), ShouldEqual, 1)
+		})
+
+		Convey("other tables propagate the error", func() {
+			c, find := newCache(nil)
+			_, err := find()
+			So(err, ShouldBeNil)
+
+			time.Sleep(200 * time.Millisecond)
+			So(originalDB.Migrator().DropTable(&testModelStale{}), ShouldBeNil)
+
+			_, err = find()
+			So(err, ShouldNotBeNil)
+			So(c.(*cache.Gorm2Cache).StaleServeCount(), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestStorageGetStale(t *testing.T) {
+	Convey("test storage get stale", t, func() {
+		ctx := context.Background()
+		s := storage.NewMem()
+		So(s.Init(&storage.Config{Logger: &util.DefaultLogger{}, GracePeriodDuration: 200 * time.Millisecond}), ShouldBeNil)
+		So(s.SetKey(ctx, util.Kv{Key: "stale:a", Value: "1", TTL: 50}), ShouldBeNil)
+
+		value, stale, err := s.GetStale(ctx, "stale:a")
+		So(err, ShouldBeNil)
+		So(value, ShouldEqual, "1")
+		So(stale, ShouldBeFalse)
+
+		// expired but within grace period
+		time.Sleep(100 * time.Millisecond)
+		_, err = s.GetValue(ctx, "stale:a")
+		So(err, ShouldEqual, storage.ErrCacheNotFound)
+		value, stale, err = s.GetStale(ctx, "stale:a")
+		So(err, ShouldBeNil)
+		So(value, ShouldEqual, "1")
+		So(stale, ShouldBeTrue)
+
+		time.Sleep(250 * time.Millisecond)
+		_, _, err = s.GetStale(ctx, "stale:a")
+		So(err, ShouldEqual, storage.ErrCacheNotFound)
+
+		// deleted keys are not served stale
+		So(s.SetKey(ctx, util.Kv{Key: "stale:b", Value: "2", TTL: 50}), ShouldBeNil)
+		So(s.DeleteKey(ctx, "stale:b"), ShouldBeNil)
+		_, _, err = s.GetStale(ctx, "stale:b")
+		So(err, ShouldEqual, storage.ErrCacheNotFound)
+	})
+}
@@ -0,0 +1,43 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStatus(t *testing.T) {
+	Convey("test status", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelAll,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+			AsyncWrite:           true,
+		})
+		So(err, ShouldBeNil)
+		gc := c.(*cache.Gorm2Cache)
+
+		for i := 0; i < 2; i++ {
+			model := new(TestModel)
+			result := db.Where("id = ?", 1).First(model)
+			So(result.Error, ShouldBeNil)
+			So(model.ID, ShouldEqual, 1)
+			So(waitFor(func() bool {
+				return gc.Status(context.Background()).AsyncQueueDepth == 0
+			}), ShouldBeTrue)
+		}
+
+		status := gc.Status(context.Background())
+		So(status.StorageType, ShouldEqual, "Gcache")
+		So(status.Healthy, ShouldBeTrue)
+		So(status.InstanceId, ShouldEqual, gc.InstanceId)
+		So(status.HitRate, ShouldEqual, 0.5)
+		So(status.LastError, ShouldBeEmpty)
+		So(status.LastErrorAt.IsZero(), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,68 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var errStorageInit = errors.New("storage unavailable")
+
+// brokenStorage fails to initialize
+type brokenStorage struct {
+	storage.DataStorage
+}
+
+func (s *brokenStorage) Init(config *storage.Config) error {
+	return errStorageInit
+}
+
+func TestStorageFactory(t *testing.T) {
+	Convey("test storage factory", t, func() {
+		Convey("configured storage is used", func() {
+			s := storage.NewGcache(gcache.New(1000))
+			created := 0
+			c, err := cache.NewGorm2Cache(&config.CacheConfig{
+				CacheStorage: s,
+				StorageFactory: func() storage.DataStorage {
+					created++
+					return storage.NewMem()
+				},
+			})
+			So(err, ShouldBeNil)
+			So(created, ShouldEqual, 0)
+			So(c.(*cache.Gorm2Cache).Status(context.Background()).StorageType, ShouldEqual, "Gcache")
+		})
+
+		Convey("storage is created by factory", func() {
+			created := 0
+			c, err := cache.NewGorm2Cache(&config.CacheConfig{
+				StorageFactory: func() storage.DataStorage {
+					created++
+					return storage.NewGcache(gcache.New(1000))
+				},
+			})
+			So(err, ShouldBeNil)
+			So(created, ShouldEqual, 1)
+			So(c.(*cache.Gorm2Cache).Status(context.Background()).StorageType, ShouldEqual, "Gcache")
+		})
+
+		Convey("failures are reported instead of falling back to memory", func() {
+			_, err := cache.NewGorm2Cache(&config.CacheConfig{
+				StorageFactory: func() storage.DataStorage { return nil },
+			})
+			So(err, ShouldNotBeNil)
+
+			_, err = cache.NewGorm2Cache(&config.CacheConfig{
+				StorageFactory: func() storage.DataStorage { return &brokenStorage{} },
+			})
+			So(errors.Is(err, errStorageInit), ShouldBeTrue)
+		})
+	})
+}
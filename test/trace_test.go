@@ -0,0 +1,57 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// traceRecorder records sql traced by gorm
+type traceRecorder struct {
+	logger.Interface
+	sqls []string
+}
+
+func (r *traceRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	r.sqls = append(r.sqls, sql)
+}
+
+func TestTraceCacheHits(t *testing.T) {
+	Convey("test cache hits in trace log", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:     config.CacheLevelAll,
+			CacheStorage:   storage.NewGcache(gcache.New(1000)),
+			TraceCacheHits: true,
+		})
+		So(err, ShouldBeNil)
+		recorder := &traceRecorder{Interface: logger.Discard}
+		db = db.Session(&gorm.Session{Logger: recorder})
+
+		for i := 0; i < 2; i++ {
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 = ?", 1).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 1)
+		}
+		for i := 0; i < 2; i++ {
+			model := new(TestModel)
+			result := db.Where("id = ?", 2).First(model)
+			So(result.Error, ShouldBeNil)
+		}
+		So(c.HitCount(), ShouldEqual, 2)
+		So(len(recorder.sqls), ShouldEqual, 4)
+		So(strings.HasPrefix(recorder.sqls[0], "SELECT"), ShouldBeTrue)
+		So(recorder.sqls[1], ShouldStartWith, "/* gorm-cache: search hit */ SELECT")
+		So(strings.HasPrefix(recorder.sqls[2], "SELECT"), ShouldBeTrue)
+		So(recorder.sqls[3], ShouldStartWith, "/* gorm-cache: primary hit */ SELECT")
+	})
+}
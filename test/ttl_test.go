@@ -0,0 +1,38 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDurationTTL(t *testing.T) {
+	Convey("test duration typed ttl", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:       config.CacheLevelOnlySearch,
+			CacheStorage:     storage.NewGcache(gcache.New(1000)),
+			CacheTTL:         60000,
+			CacheTTLDuration: 100 * time.Millisecond,
+		})
+		So(err, ShouldBeNil)
+
+		find := func() {
+			models := make([]*TestModel, 0)
+			result := db.Where("value1 = ?", 1).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 1)
+		}
+		find()
+		find()
+		So(c.HitCount(), ShouldEqual, 1)
+
+		time.Sleep(150 * time.Millisecond)
+		find()
+		So(c.HitCount(), ShouldEqual, 1)
+		So(c.MissCount(), ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,48 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm/clause"
+)
+
+func TestUpsertInvalidation(t *testing.T) {
+	Convey("test upsert invalidates updated rows", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:           config.CacheLevelAll,
+			CacheStorage:         storage.NewGcache(gcache.New(1000)),
+			InvalidateWhenUpdate: true,
+			CacheTTL:             5000,
+		})
+		So(err, ShouldBeNil)
+
+		id := int64(testSize*10 + 3)
+		err = originalDB.Create(&TestModel{ID: id, Value1: id, Value2: 1}).Error
+		So(err, ShouldBeNil)
+		defer originalDB.Delete(&TestModel{}, id)
+
+		find := func() *TestModel {
+			models := make([]*TestModel, 0)
+			result := db.Where("id = ?", id).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 1)
+			return models[0]
+		}
+		So(find().Value2, ShouldEqual, 1)
+		So(find().Value2, ShouldEqual, 1)
+		So(c.HitCount(), ShouldEqual, 1)
+
+		err = db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"value2"}),
+		}).Create(&TestModel{ID: id, Value1: id, Value2: 2}).Error
+		So(err, ShouldBeNil)
+
+		So(find().Value2, ShouldEqual, 2)
+		So(c.HitCount(), ShouldEqual, 1)
+	})
+}
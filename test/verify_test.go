@@ -0,0 +1,53 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVerifyCacheHits(t *testing.T) {
+	Convey("test verifying sampled cache hits", t, func() {
+		c, db, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:             config.CacheLevelAll,
+			CacheStorage:           storage.NewGcache(gcache.New(1000)),
+			VerifySamplesPerMinute: 3,
+		})
+		So(err, ShouldBeNil)
+		gc := c.(*cache.Gorm2Cache)
+		verified := func(n uint64) bool {
+			return waitFor(func() bool {
+				return c.VerifiedCount() == n && gc.Status(context.Background()).AsyncQueueDepth == 0
+			})
+		}
+
+		models := make([]*TestModel, 0)
+		So(db.Where("value1 IN (?)", []int{1, 2}).Find(&models).Error, ShouldBeNil)
+		models = make([]*TestModel, 0)
+		So(db.Where("value1 IN (?)", []int{1, 2}).Find(&models).Error, ShouldBeNil)
+		So(c.HitCount(), ShouldEqual, 1)
+		So(verified(1), ShouldBeTrue)
+		So(c.DivergenceCount(), ShouldEqual, 0)
+
+		So(db.Where("id = ?", -1).First(new(TestModel)).Error, ShouldNotBeNil)
+		So(db.Where("id = ?", -1).First(new(TestModel)).Error, ShouldNotBeNil)
+		So(verified(2), ShouldBeTrue)
+		So(c.DivergenceCount(), ShouldEqual, 0)
+
+		// updated behind the cache, the hit serves outdated data
+		model := models[0]
+		result := originalDB.Model(&TestModel{}).Where("id = ?", model.ID).UpdateColumn("value2", model.Value2+1)
+		So(result.Error, ShouldBeNil)
+		defer originalDB.Model(&TestModel{}).Where("id = ?", model.ID).UpdateColumn("value2", model.Value2)
+		models = make([]*TestModel, 0)
+		So(db.Where("value1 IN (?)", []int{1, 2}).Find(&models).Error, ShouldBeNil)
+		So(verified(3), ShouldBeTrue)
+		So(c.DivergenceCount(), ShouldEqual, 1)
+
+	})
+}
@@ -0,0 +1,57 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBumpTableVersion(t *testing.T) {
+	Convey("test bump table version", t, func() {
+		shared := storage.NewGcache(gcache.New(1000))
+		c1, db1, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelAll,
+			CacheStorage: shared,
+			KeyPrefix:    "version-test",
+		})
+		So(err, ShouldBeNil)
+		c2, _, err := newCachedDB(&config.CacheConfig{
+			CacheLevel:   config.CacheLevelAll,
+			CacheStorage: shared,
+			KeyPrefix:    "version-test",
+		})
+		So(err, ShouldBeNil)
+
+		find := func() {
+			models := make([]*TestModel, 0)
+			result := db1.Where("value1 = ?", 1).Find(&models)
+			So(result.Error, ShouldBeNil)
+			So(len(models), ShouldEqual, 1)
+		}
+		find()
+		find()
+		So(c1.HitCount(), ShouldEqual, 1)
+
+		err = c1.(*cache.Gorm2Cache).BumpTableVersion(context.Background(), TestModelTableName)
+		So(err, ShouldBeNil)
+		find()
+		So(c1.HitCount(), ShouldEqual, 1)
+		find()
+		So(c1.HitCount(), ShouldEqual, 2)
+
+		// a bump by another instance sharing the storage takes effect once the version is read again
+		err = c2.(*cache.Gorm2Cache).BumpTableVersion(context.Background(), TestModelTableName)
+		So(err, ShouldBeNil)
+		time.Sleep(1100 * time.Millisecond)
+		find()
+		So(c1.HitCount(), ShouldEqual, 2)
+		find()
+		So(c1.HitCount(), ShouldEqual, 3)
+	})
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asjdf/gorm-cache/cache"
+	"github.com/asjdf/gorm-cache/config"
+	"github.com/asjdf/gorm-cache/storage"
+	"github.com/asjdf/gorm-cache/util"
+	"github.com/bluele/gcache"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// missingStorage always misses on reads and counts single key writes to the storage it wraps,
+// writes wait for gate if it isn't nil
+type missingStorage struct {
+	storage.DataStorage
+	sets int64
+	gate chan struct{}
+}
+
+func (s *missingStorage) GetValue(ctx context.Context, key string) (string, error) {
+	return "", storage.ErrCacheNotFound
+}
+
+func (s *missingStorage) SetKey(ctx context.Context, kv util.Kv) error {
+	atomic.AddInt64(&s.sets, 1)
+	if s.gate != nil {
+		<-s.gate
+	}
+	return s.DataStorage.SetKey(ctx, kv)
+}
+
+func TestWriteDedup(t *testing.T) {
+	Convey("test identical search cache isn't rewritten within the dedup window", t, func() {
+		ctx := context.Background()
+		newDB := func(window int64, gate chan struct{}) (*cache.Gorm2Cache, *missingStorage, func()) {
+			s := &missingStorage{DataStorage: storage.NewGcache(gcache.New(1000)), gate: gate}
+			c, db, err := newCachedDB(&config.CacheConfig{
+				CacheLevel:           config.CacheLevelOnlySearch,
+				CacheStorage:         s,
+				InvalidateWhenUpdate: true,
+				CacheTTL:             5000,
+				AsyncCachePopulate:   gate != nil,
+				WriteDedupWindow:     window,
+			})
+			So(err, ShouldBeNil)
+			return c.(*cache.Gorm2Cache), s, func() {
+				models := make([]*TestModel, 0)
+				So(db.Where("id <= ?", 3).Find(&models).Error, ShouldBeNil)
+				So(len(models), ShouldEqual, 3)
+			}
+		}
+
+		Convey("every miss rewrites search cache by default", func() {
+			_, s, find := newDB(0, nil)
+			find()
+			find()
+			So(atomic.LoadInt64(&s.sets), ShouldEqual, 2)
+		})
+
+		Convey("identical value is written once while being written", func() {
+			gate := make(chan struct{})
+			c, s, find := newDB(5000, gate)
+			find()
+			So(waitFor(func() bool { return atomic.LoadInt64(&s.sets) == 1 }), ShouldBeTrue)
+			find()
+			find()
+			// the writes of the latter queries are skipped while the first one waits
+			So(waitFor(func() bool { return c.Status(ctx).AsyncQueueDepth == 1 }), ShouldBeTrue)
+			close(gate)
+			So(waitFor(func() bool { return c.Status(ctx).AsyncQueueDepth == 0 }), ShouldBeTrue)
+			So(atomic.LoadInt64(&s.sets), ShouldEqual, 1)
+		})
+
+		Convey("identical value written within the window isn't rewritten while the key is in storage", func() {
+			_, s, find := newDB(5000, nil)
+			find()
+			find()
+			find()
+			So(atomic.LoadInt64(&s.sets), ShouldEqual, 1)
+		})
+
+		Convey("key deleted from storage within the window is written again", func() {
+			_, s, find := newDB(5000, nil)
+			find()
+			So(s.DataStorage.CleanCache(ctx), ShouldBeNil)
+			find()
+			So(atomic.LoadInt64(&s.sets), ShouldEqual, 2)
+			find()
+			So(atomic.LoadInt64(&s.sets), ShouldEqual, 2)
+		})
+
+		Convey("key is rewritten after the window", func() {
+			_, s, find := newDB(50, nil)
+			find()
+			time.Sleep(100 * time.Millisecond)
+			find()
+			So(atomic.LoadInt64(&s.sets), ShouldEqual, 2)
+		})
+	})
+}
@@ -11,8 +11,10 @@ var ErrCacheUnmarshal = errors.New("cache hit, but unmarshal error")
 var ErrCacheLoadFailed = errors.New("cache hit, but load value error")
 
 type Kv struct {
-	Key   string
-	Value string
+	Key    string
+	Value  string
+	TTL    int64 // ttl in ms for this kv only, 0 represents storage default ttl
+	Pinned bool  // kv never expires and isn't evicted when storage is full, TTL is ignored
 }
 
 const (
@@ -0,0 +1,117 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type logFieldsKey struct{}
+
+// LogFields describes the cache operation that log lines are printed for
+type LogFields struct {
+	Table string
+	Key   string    // cache key of the operation if any, redacted if LogRedactor is set
+	Start time.Time // when the operation started
+}
+
+// WithLogFields returns a copy of ctx carrying fields, for loggers to attach them to log lines
+func WithLogFields(ctx context.Context, fields *LogFields) context.Context {
+	return context.WithValue(ctx, logFieldsKey{}, fields)
+}
+
+// LogFieldsFromContext returns fields carried by ctx, or nil if there is none
+func LogFieldsFromContext(ctx context.Context) *LogFields {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(logFieldsKey{}).(*LogFields)
+	return fields
+}
+
+// JSONLogger prints a JSON object per line with ts, level, op, table, key, latency, msg and err,
+// so logs can be ingested without a custom adapter. Info logs are printed in debug mode only,
+// table, key and latency are known in debug mode only as well.
+type JSONLogger struct {
+	Writer        io.Writer     // os.Stdout if nil
+	CtxFieldsFunc CtxFieldsFunc // if not nil, fields it returns are added to every line
+
+	isDebug bool
+	mu      sync.Mutex
+}
+
+func NewJSONLogger(writer io.Writer) *JSONLogger {
+	return &JSONLogger{Writer: writer}
+}
+
+func (l *JSONLogger) SetIsDebug(d bool) {
+	l.isDebug = d
+}
+
+func (l *JSONLogger) CtxInfo(ctx context.Context, format string, v ...interface{}) {
+	if l.isDebug {
+		l.print(ctx, "info", format, v...)
+	}
+}
+
+func (l *JSONLogger) CtxError(ctx context.Context, format string, v ...interface{}) {
+	l.print(ctx, "error", format, v...)
+}
+
+func (l *JSONLogger) print(ctx context.Context, level string, format string, v ...interface{}) {
+	now := time.Now()
+	entry := map[string]interface{}{
+		"ts":    now.Format(time.RFC3339Nano),
+		"level": level,
+	}
+	msg := fmt.Sprintf(format, v...)
+	// messages are formatted as "[FuncName] message"
+	if strings.HasPrefix(msg, "[") {
+		if end := strings.IndexByte(msg, ']'); end > 0 {
+			entry["op"] = msg[1:end]
+			msg = strings.TrimSpace(msg[end+1:])
+		}
+	}
+	entry["msg"] = msg
+	for i := len(v) - 1; i >= 0; i-- {
+		if err, ok := v[i].(error); ok && err != nil {
+			entry["err"] = err.Error()
+			break
+		}
+	}
+	if fields := LogFieldsFromContext(ctx); fields != nil {
+		if fields.Table != "" {
+			entry["table"] = fields.Table
+		}
+		if fields.Key != "" {
+			entry["key"] = fields.Key
+		}
+		if !fields.Start.IsZero() {
+			entry["latency_ms"] = float64(now.Sub(fields.Start).Microseconds()) / 1000
+		}
+	}
+	if l.CtxFieldsFunc != nil && ctx != nil {
+		for key, value := range l.CtxFieldsFunc(ctx) {
+			if _, ok := entry[key]; !ok {
+				entry[key] = value
+			}
+		}
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line, _ = json.Marshal(map[string]interface{}{"ts": entry["ts"], "level": level, "msg": msg})
+	}
+	writer := l.Writer
+	if writer == nil {
+		writer = os.Stdout
+	}
+	l.mu.Lock()
+	_, _ = writer.Write(append(line, '\n'))
+	l.mu.Unlock()
+}
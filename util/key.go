@@ -5,31 +5,61 @@ import (
 	"math/rand"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 )
 
+var (
+	instanceIdMu   sync.Mutex
+	instanceIdRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
 func GenInstanceId() string {
 	charList := []byte("1234567890abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
-	rand.Seed(time.Now().Unix())
 	length := 5
 	str := make([]byte, 0)
+	instanceIdMu.Lock()
+	defer instanceIdMu.Unlock()
 	for i := 0; i < length; i++ {
-		str = append(str, charList[rand.Intn(len(charList))])
+		str = append(str, charList[instanceIdRand.Intn(len(charList))])
 	}
 	return string(str)
 }
 
-func GenPrimaryCacheKey(instanceId string, tableName string, primaryKey string) string {
-	return fmt.Sprintf("%s:%s:p:%s:%s", GormCachePrefix, instanceId, tableName, primaryKey)
+// GenKeyPrefix generates the prefix of keys of cache instance, which is used when storage doesn't provide one
+func GenKeyPrefix(instanceId string) string {
+	return GormCachePrefix + ":" + instanceId
+}
+
+// keySegmentEscaper escapes the key delimiter ":" in a key segment, so that e.g. table "users:extra" can't
+// be taken for a key of table "users", and redis glob metacharacters, so that prefix deletions match the segment
+// literally. "%" is escaped too to keep the encoding unambiguous.
+var keySegmentEscaper = strings.NewReplacer(
+	"%", "%25",
+	":", "%3A",
+	"*", "%2A",
+	"?", "%3F",
+	"[", "%5B",
+	"]", "%5D",
+	"\\", "%5C",
+)
+
+// EscapeKeySegment encodes s to be used as one segment of cache keys, e.g. a table name
+func EscapeKeySegment(s string) string {
+	return keySegmentEscaper.Replace(s)
+}
+
+func GenPrimaryCacheKey(keyPrefix string, tableName string, primaryKey string) string {
+	return fmt.Sprintf("%s:p:%s:%s", keyPrefix, EscapeKeySegment(tableName), primaryKey)
 }
 
-func GenPrimaryCachePrefix(instanceId string, tableName string) string {
-	return GormCachePrefix + ":" + instanceId + ":p:" + tableName
+func GenPrimaryCachePrefix(keyPrefix string, tableName string) string {
+	return keyPrefix + ":p:" + EscapeKeySegment(tableName)
 }
 
-func GenSearchCacheKey(instanceId string, tableName string, sql string, vars ...interface{}) string {
+func GenSearchCacheKey(keyPrefix string, tableName string, sql string, vars ...interface{}) string {
 	buf := strings.Builder{}
-	buf.WriteString(sql)
+	buf.WriteString(NormalizeSQL(sql))
 	for _, v := range vars {
 		pv := reflect.ValueOf(v)
 		if pv.Kind() == reflect.Ptr {
@@ -38,16 +68,67 @@ func GenSearchCacheKey(instanceId string, tableName string, sql string, vars ...
 			buf.WriteString(fmt.Sprintf(":%v", v))
 		}
 	}
-	return fmt.Sprintf("%s:%s:s:%s:%s", GormCachePrefix, instanceId, tableName, buf.String())
+	return fmt.Sprintf("%s:s:%s:%s", keyPrefix, EscapeKeySegment(tableName), buf.String())
+}
+
+func GenSearchCachePrefix(keyPrefix string, tableName string) string {
+	return keyPrefix + ":s:" + EscapeKeySegment(tableName)
+}
+
+func GenStaleCacheKey(keyPrefix string, tableName string, sql string, vars ...interface{}) string {
+	return GenStaleCachePrefix(keyPrefix, tableName) + strings.TrimPrefix(GenSearchCacheKey(keyPrefix, tableName, sql, vars...),
+		GenSearchCachePrefix(keyPrefix, tableName))
+}
+
+func GenStaleCachePrefix(keyPrefix string, tableName string) string {
+	return keyPrefix + ":st:" + EscapeKeySegment(tableName)
+}
+
+func GenPageCacheKey(keyPrefix string, tableName string, sql string, vars ...interface{}) string {
+	return GenPageCachePrefix(keyPrefix, tableName) + strings.TrimPrefix(GenSearchCacheKey(keyPrefix, tableName, sql, vars...),
+		GenSearchCachePrefix(keyPrefix, tableName))
+}
+
+func GenPageCachePrefix(keyPrefix string, tableName string) string {
+	return keyPrefix + ":pg:" + EscapeKeySegment(tableName)
+}
+
+func GenDirtyMarkerKey(keyPrefix string, tableName string) string {
+	return keyPrefix + ":d:" + EscapeKeySegment(tableName)
+}
+
+// GenDirtyKeyMarkerKey returns key of the dirty marker of a row of table
+func GenDirtyKeyMarkerKey(keyPrefix string, tableName string, primaryKey string) string {
+	return GenDirtyMarkerKey(keyPrefix, tableName) + ":p:" + primaryKey
+}
+
+// GenDirtyAllKeysMarkerKey returns key of the dirty marker of all rows of table, which is put by writes whose
+// primary keys are unknown
+func GenDirtyAllKeysMarkerKey(keyPrefix string, tableName string) string {
+	return GenDirtyMarkerKey(keyPrefix, tableName) + ":*"
+}
+
+func GenTableVersionKey(keyPrefix string, tableName string) string {
+	return keyPrefix + ":tv:" + EscapeKeySegment(tableName)
+}
+
+// GenFullTableMarkerKey returns key of the marker of a table loaded into memory, which is in the namespace of search
+// cache, so that invalidating search cache of the table deletes it
+func GenFullTableMarkerKey(keyPrefix string, tableName string) string {
+	return GenSearchCachePrefix(keyPrefix, tableName) + ":~full"
+}
+
+func GenHealthCheckKey(keyPrefix string) string {
+	return keyPrefix + ":h"
 }
 
-func GenSearchCachePrefix(instanceId string, tableName string) string {
-	return GormCachePrefix + ":" + instanceId + ":s:" + tableName
+func GenStatsSnapshotKey(keyPrefix string, name string) string {
+	return keyPrefix + ":stats:" + EscapeKeySegment(name)
 }
 
 func GenSingleFlightKey(tableName string, sql string, vars ...interface{}) string {
 	buf := strings.Builder{}
-	buf.WriteString(sql)
+	buf.WriteString(NormalizeSQL(sql))
 	for _, v := range vars {
 		pv := reflect.ValueOf(v)
 		if pv.Kind() == reflect.Ptr {
@@ -56,5 +137,5 @@ func GenSingleFlightKey(tableName string, sql string, vars ...interface{}) strin
 			buf.WriteString(fmt.Sprintf(":%v", v))
 		}
 	}
-	return fmt.Sprintf("%s:%s", tableName, buf.String())
+	return fmt.Sprintf("%s:%s", EscapeKeySegment(tableName), buf.String())
 }
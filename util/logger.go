@@ -2,7 +2,11 @@ package util
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -12,8 +16,14 @@ type LoggerInterface interface {
 	CtxError(ctx context.Context, format string, v ...interface{})
 }
 
+// CtxFieldsFunc extracts fields (e.g. request id, trace id) from ctx, which are appended to log lines
+type CtxFieldsFunc func(ctx context.Context) map[string]interface{}
+
 type DefaultLogger struct {
 	isDebug bool
+
+	// CtxFieldsFunc if not nil, fields it returns are appended to every log line as key=value
+	CtxFieldsFunc CtxFieldsFunc
 }
 
 func (l *DefaultLogger) SetIsDebug(d bool) {
@@ -22,14 +32,68 @@ func (l *DefaultLogger) SetIsDebug(d bool) {
 
 func (l *DefaultLogger) CtxInfo(ctx context.Context, format string, v ...interface{}) {
 	if l.isDebug {
-		timePrefix := time.Now().Format("2006-01-02 15:04:05.999")
-		fmt.Printf(timePrefix+" [INFO] "+format+"\n", v...)
+		l.print(ctx, "INFO", format, v...)
 	}
 }
 
 func (l *DefaultLogger) CtxError(ctx context.Context, format string, v ...interface{}) {
 	if l.isDebug {
-		timePrefix := time.Now().Format("2006-01-02 15:04:05.999")
-		fmt.Printf(timePrefix+" [ERROR] "+format+"\n", v...)
+		l.print(ctx, "ERROR", format, v...)
+	}
+}
+
+func (l *DefaultLogger) print(ctx context.Context, level string, format string, v ...interface{}) {
+	timePrefix := time.Now().Format("2006-01-02 15:04:05.999")
+	fmt.Printf(timePrefix+" ["+level+"] "+format+l.ctxFields(ctx)+"\n", v...)
+}
+
+// ctxFields formats fields extracted from ctx, sorted by key
+func (l *DefaultLogger) ctxFields(ctx context.Context) string {
+	if l.CtxFieldsFunc == nil || ctx == nil {
+		return ""
+	}
+	fields := l.CtxFieldsFunc(ctx)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	buf := strings.Builder{}
+	for _, key := range keys {
+		// escape %, the fields are appended to format
+		buf.WriteString(" " + key + "=" + strings.ReplaceAll(fmt.Sprint(fields[key]), "%", "%%"))
 	}
+	return buf.String()
+}
+
+// Redactor rewrites values which may contain sensitive data (cache keys, vars, cached values) before they are logged
+type Redactor func(v interface{}) interface{}
+
+// MaskRedactor replaces values with a fixed mask
+func MaskRedactor(v interface{}) interface{} {
+	if strs, ok := v.([]string); ok {
+		masked := make([]string, len(strs))
+		for i := range strs {
+			masked[i] = "***"
+		}
+		return masked
+	}
+	return "***"
+}
+
+// HashRedactor replaces values with a short hash of them, so that log lines can still be correlated
+func HashRedactor(v interface{}) interface{} {
+	if strs, ok := v.([]string); ok {
+		hashed := make([]string, len(strs))
+		for i, str := range strs {
+			hashed[i] = hashForLog(str)
+		}
+		return hashed
+	}
+	return hashForLog(fmt.Sprint(v))
+}
+
+func hashForLog(str string) string {
+	sum := sha256.Sum256([]byte(str))
+	return "sha256:" + hex.EncodeToString(sum[:8])
 }
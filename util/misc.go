@@ -1,6 +1,9 @@
 package util
 
-import "math/rand"
+import (
+	"math/rand"
+	"time"
+)
 
 func ShouldCache(tableName string, tables []string) bool {
 	if len(tables) == 0 {
@@ -22,3 +25,12 @@ func RandFloatingInt64(v int64) int64 {
 	randNum := rand.Float64()*0.2 + 0.9
 	return int64(float64(v) * randNum)
 }
+
+// DurationToMillis converts d to ms, positive d less than 1ms is converted to 1ms instead of 0
+func DurationToMillis(d time.Duration) int64 {
+	ms := d.Milliseconds()
+	if d > 0 && ms == 0 {
+		return 1
+	}
+	return ms
+}
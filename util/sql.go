@@ -0,0 +1,189 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// NormalizeSQL rewrites sql into the form that is used for key generation: runs of whitespace are collapsed into
+// a single space and numbered placeholders ($1, @p1) are replaced by "?". Quoted strings and identifiers are kept
+// as they are, since quotes tell them apart from other tokens, e.g. "a" is a string literal in MySQL.
+func NormalizeSQL(sql string) string {
+	buf := strings.Builder{}
+	buf.Grow(len(sql))
+
+	runes := []rune(sql)
+	pendingSpace := false
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if unicode.IsSpace(r) {
+			pendingSpace = buf.Len() > 0
+			continue
+		}
+		if pendingSpace {
+			buf.WriteByte(' ')
+			pendingSpace = false
+		}
+
+		switch {
+		case r == '\'' || r == '"' || r == '`':
+			end := quotedEnd(runes, i)
+			buf.WriteString(string(runes[i : end+1]))
+			i = end
+		case r == '$' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			for i+1 < len(runes) && unicode.IsDigit(runes[i+1]) {
+				i++
+			}
+			buf.WriteByte('?')
+		case r == '@' && i+2 < len(runes) && (runes[i+1] == 'p' || runes[i+1] == 'P') && unicode.IsDigit(runes[i+2]):
+			i++
+			for i+1 < len(runes) && unicode.IsDigit(runes[i+1]) {
+				i++
+			}
+			buf.WriteByte('?')
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// quotedEnd returns index of the quote closing the quoted string or identifier starting at runes[start],
+// doubled quotes are escaped quotes, so are quotes after \ in strings. It's the last index if it's not closed.
+func quotedEnd(runes []rune, start int) int {
+	quote := runes[start]
+	end := start + 1
+	for ; end < len(runes); end++ {
+		if runes[end] == '\\' && quote != '`' {
+			end++
+			continue
+		}
+		if runes[end] == quote {
+			if end+1 < len(runes) && runes[end+1] == quote {
+				end++
+				continue
+			}
+			break
+		}
+	}
+	if end >= len(runes) {
+		end = len(runes) - 1
+	}
+	return end
+}
+
+// stripIdentifierQuotes removes quotes of identifiers (` and ") from sql, string literals are kept as they are
+func stripIdentifierQuotes(sql string) string {
+	buf := strings.Builder{}
+	buf.Grow(len(sql))
+
+	runes := []rune(sql)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case '\'':
+			end := quotedEnd(runes, i)
+			buf.WriteString(string(runes[i : end+1]))
+			i = end
+		case '`', '"':
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// StripSQLComments removes /* block */ and -- line comments from sql. Optimizer hints (/*+ ... */)
+// are kept because they are part of the query the user asked for.
+func StripSQLComments(sql string) string {
+	if !strings.Contains(sql, "/*") && !strings.Contains(sql, "--") {
+		return sql
+	}
+	buf := strings.Builder{}
+	buf.Grow(len(sql))
+
+	for i := 0; i < len(sql); i++ {
+		switch {
+		case sql[i] == '\'':
+			end := i + 1
+			for ; end < len(sql); end++ {
+				if sql[end] == '\\' {
+					end++
+					continue
+				}
+				if sql[end] == '\'' {
+					break
+				}
+			}
+			if end >= len(sql) {
+				end = len(sql) - 1
+			}
+			buf.WriteString(sql[i : end+1])
+			i = end
+		case strings.HasPrefix(sql[i:], "/*") && !strings.HasPrefix(sql[i:], "/*+"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return buf.String()
+			}
+			buf.WriteByte(' ')
+			i += end + 3
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return buf.String()
+			}
+			buf.WriteByte(' ')
+			i += end
+		default:
+			buf.WriteByte(sql[i])
+		}
+	}
+	return buf.String()
+}
+
+var (
+	sqlLiteralRegexp = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'`)
+	sqlTableRegexp   = regexp.MustCompile(`(?i)\b(?:from|join)\s+([\w.:]+(?:\s*,\s*[\w.:]+)*)`)
+)
+
+// GetReferencedTables returns names of all tables that sql reads from (FROM and JOIN targets, including subqueries)
+func GetReferencedTables(sql string) []string {
+	sql = NormalizeSQL(stripIdentifierQuotes(sqlLiteralRegexp.ReplaceAllString(sql, "''")))
+	tables := make([]string, 0)
+	for _, match := range sqlTableRegexp.FindAllStringSubmatch(sql, -1) {
+		for _, table := range strings.Split(match[1], ",") {
+			table = strings.TrimSpace(table)
+			if pos := strings.LastIndexByte(table, '.'); pos >= 0 {
+				table = table[pos+1:]
+			}
+			if table != "" && !ContainString(table, tables) {
+				tables = append(tables, table)
+			}
+		}
+	}
+	return tables
+}
+
+var sqlDDLTableRegexp = regexp.MustCompile(
+	`(?i)^(?:alter|drop|truncate|rename)\s+table\s+(?:if\s+exists\s+)?([\w.]+(?:\s*,\s*[\w.]+)*)`)
+
+// GetAlteredTables returns names of tables whose schema or all rows are changed by sql
+// (ALTER, DROP, TRUNCATE and RENAME TABLE statements), or nil if sql is not such a statement
+func GetAlteredTables(sql string) []string {
+	match := sqlDDLTableRegexp.FindStringSubmatch(NormalizeSQL(stripIdentifierQuotes(StripSQLComments(sql))))
+	if match == nil {
+		return nil
+	}
+	tables := make([]string, 0)
+	for _, table := range strings.Split(match[1], ",") {
+		table = strings.TrimSpace(table)
+		if pos := strings.LastIndexByte(table, '.'); pos >= 0 {
+			table = table[pos+1:]
+		}
+		if table != "" && !ContainString(table, tables) {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}